@@ -0,0 +1,270 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// requiresApproval reports whether an entry of this amount needs a second
+// user to approve it. APPROVAL_THRESHOLD sets a global threshold; approval
+// rules narrow it per account type or per role of the maker.
+func requiresApproval(db *gorm.DB, roles []string, debitAccountNumber int, creditAccountNumber int, amount int) (bool, error) {
+	if threshold, err := strconv.Atoi(os.Getenv("APPROVAL_THRESHOLD")); err == nil && threshold > 0 && amount > threshold {
+		return true, nil
+	}
+
+	var accountTypeIDs []uuid.UUID
+	err := db.Table("account").
+		Select("chartofaccount.accounttypeid").
+		Joins("JOIN chartofaccount ON chartofaccount.accountid = account.coaid").
+		Where("account.accountnumber IN ?", []int{debitAccountNumber, creditAccountNumber}).
+		Scan(&accountTypeIDs).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch account types: %v", err)
+	}
+
+	// a rule matches when each of its criteria is either unset or satisfied
+	typeCondition := "accounttypeid IS NULL"
+	var args []interface{}
+	if len(accountTypeIDs) > 0 {
+		typeCondition = "(accounttypeid IS NULL OR accounttypeid IN ?)"
+		args = append(args, accountTypeIDs)
+	}
+	roleCondition := "COALESCE(role, '') = ''"
+	if len(roles) > 0 {
+		roleCondition = "(COALESCE(role, '') = '' OR role IN ?)"
+		args = append(args, roles)
+	}
+
+	var count int64
+	err = db.Model(&ApprovalRule{}).
+		Where("threshold < ?", amount).
+		Where(typeCondition+" AND "+roleCondition, args...).
+		Count(&count).Error
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate approval rules: %v", err)
+	}
+	return count > 0, nil
+}
+
+func ApproveJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid transaction ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		checker := c.GetString("userID")
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			entry, err := lockPendingEntry(tx, transactionID, checker)
+			if err != nil {
+				return err
+			}
+
+			before := *entry
+			now := time.Now()
+			entry.ReviewedBy = checker
+			entry.ReviewedAt = &now
+			if err := postJournalEntry(tx, entry); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionApprove,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				Before:     before,
+				After:      entry,
+			}); err != nil {
+				return err
+			}
+			if err := reviewedDisbursement(tx, entry, auditActor(c)); err != nil {
+				return err
+			}
+			if err := reviewedRepayment(tx, entry, auditActor(c)); err != nil {
+				return err
+			}
+			// fees follow the entry, so a queued entry is charged when it posts
+			_, err = applyPostingCharges(tx, entry, auditActor(c))
+			return err
+		})
+		if err != nil {
+			respondReviewError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Journal entry approved and posted", StatusCode: http.StatusOK})
+	}
+}
+
+func RejectJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid transaction ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || data.Reason == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A rejection reason is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+		checker := c.GetString("userID")
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			entry, err := lockPendingEntry(tx, transactionID, checker)
+			if err != nil {
+				return err
+			}
+
+			before := *entry
+			now := time.Now()
+			entry.Status = JournalStatusRejected
+			entry.ReviewedBy = checker
+			entry.ReviewedAt = &now
+			entry.RejectionReason = data.Reason
+			err = tx.Model(entry).Updates(map[string]interface{}{
+				"status":          entry.Status,
+				"reviewedby":      entry.ReviewedBy,
+				"reviewedat":      entry.ReviewedAt,
+				"rejectionreason": entry.RejectionReason,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionReject,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				Before:     before,
+				After:      entry,
+			}); err != nil {
+				return err
+			}
+			if err := reviewedDisbursement(tx, entry, auditActor(c)); err != nil {
+				return err
+			}
+			return reviewedRepayment(tx, entry, auditActor(c))
+		})
+		if err != nil {
+			respondReviewError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Journal entry rejected", StatusCode: http.StatusOK})
+	}
+}
+
+var (
+	errEntryNotPending = errors.New("Journal entry is not pending approval")
+	errSelfApproval    = errors.New("An entry cannot be reviewed by the user who created it")
+)
+
+// lockPendingEntry loads a pending entry FOR UPDATE so two checkers cannot
+// review it at the same time.
+func lockPendingEntry(tx *gorm.DB, transactionID uuid.UUID, checker string) (*JournalEntry, error) {
+	var entry JournalEntry
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("transactionid = ?", transactionID).
+		First(&entry).Error
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status != JournalStatusPending {
+		return nil, errEntryNotPending
+	}
+	if checker == "" || checker == entry.CreatedBy {
+		return nil, errSelfApproval
+	}
+	return &entry, nil
+}
+
+func respondReviewError(c *gin.Context, err error) {
+	var state errLoanState
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Journal entry not found", StatusCode: http.StatusNotFound})
+	case errors.Is(err, errEntryNotPending), errors.As(err, &state):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+	case errors.Is(err, errSelfApproval):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error(), StatusCode: http.StatusForbidden})
+	default:
+		respondPostingError(c, err)
+	}
+}
+
+func CreateApprovalRuleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			AccountTypeID string `json:"account_type_id"`
+			Role          string `json:"role"`
+			Threshold     int    `json:"threshold"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.Threshold <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "threshold must be greater than zero"})
+			return
+		}
+
+		rule := ApprovalRule{Role: data.Role, Threshold: data.Threshold}
+		if data.AccountTypeID != "" {
+			accountTypeID, err := uuid.Parse(data.AccountTypeID)
+			if err != nil || !AccountTypeExist(db, accountTypeID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Account type does not exist"})
+				return
+			}
+			rule.AccountTypeID = &accountTypeID
+		}
+		if data.Role != "" {
+			if _, ok := rolePermissions[data.Role]; !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown role %s", data.Role)})
+				return
+			}
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&rule).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "approvalrule",
+				EntityID:   rule.RuleID.String(),
+				After:      rule,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Approval rule created successfully", StatusCode: http.StatusOK, Data: rule})
+	}
+}
+
+func ListApprovalRuleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rules []ApprovalRule
+		if err := db.Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Approval Rule List", StatusCode: http.StatusOK, Data: rules})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const testEntryID = "00000000-0000-0000-0000-0000000000e1"
+
+// fakeJournalEntry answers the lookup of testEntryID with an entry in
+// status made by createdBy.
+func fakeJournalEntry(fake *fakeDB, status string, createdBy string) {
+	fake.returns(`FROM "journalentry"`, []string{"transactionid", "status", "createdby", "amount"},
+		[]driver.Value{testEntryID, status, createdBy, int64(5000)})
+}
+
+func TestRequiresApproval(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		threshold string
+		amount    int
+		rules     int64
+		want      bool
+		// the threshold decides without reading the rules
+		queries bool
+	}{
+		{name: "over the threshold", threshold: "1000", amount: 1001, want: true},
+		{name: "at the threshold, no rule", threshold: "1000", amount: 1000, queries: true},
+		{name: "under the threshold, rule matches", threshold: "1000", amount: 500, rules: 1, want: true, queries: true},
+		{name: "no threshold, rule matches", amount: 500, rules: 2, want: true, queries: true},
+		{name: "no threshold, no rule", amount: 500, queries: true},
+		{name: "threshold that is not a number", threshold: "lots", amount: 500, queries: true},
+	} {
+		t.Setenv("APPROVAL_THRESHOLD", tc.threshold)
+		db, fake := newFakeDB(t)
+		fake.returns(`FROM "approvalrule"`, []string{"count"}, []driver.Value{tc.rules})
+
+		got, err := requiresApproval(db, []string{RoleTeller}, 1001, 2001, tc.amount)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %v, %v, want %v", tc.name, got, err, tc.want)
+		}
+		if queried := len(fake.queries()) > 0; queried != tc.queries {
+			t.Errorf("%s: read the database %v, want %v", tc.name, queried, tc.queries)
+		}
+	}
+
+	// the rule query is bounded by the amount and the caller's roles
+	t.Setenv("APPROVAL_THRESHOLD", "")
+	db, fake := newFakeDB(t)
+	if _, err := requiresApproval(db, []string{RoleTeller}, 1001, 2001, 700); err != nil {
+		t.Fatal(err)
+	}
+	rules := fake.sent(`FROM "approvalrule"`)
+	if len(rules) != 1 || !containsArg(rules[0].Args, 700) || !containsArg(rules[0].Args, RoleTeller) {
+		t.Errorf("rule query sent %+v, want it bounded by amount 700 and role %s", rules, RoleTeller)
+	}
+}
+
+func TestLockPendingEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		status  string
+		checker string
+		want    error
+	}{
+		{name: "another user", status: JournalStatusPending, checker: "checker"},
+		{name: "the maker", status: JournalStatusPending, checker: "maker", want: errSelfApproval},
+		{name: "no user", status: JournalStatusPending, checker: "", want: errSelfApproval},
+		{name: "already posted", status: JournalStatusPosted, checker: "checker", want: errEntryNotPending},
+		{name: "already rejected", status: JournalStatusRejected, checker: "checker", want: errEntryNotPending},
+	} {
+		db, fake := newFakeDB(t)
+		fakeJournalEntry(fake, tc.status, "maker")
+
+		entry, err := lockPendingEntry(db, uuid.MustParse(testEntryID), tc.checker)
+		if !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+		if tc.want == nil && (entry == nil || entry.TransactionID.String() != testEntryID) {
+			t.Errorf("%s: got entry %+v", tc.name, entry)
+		}
+		if locks := fake.sent("FOR UPDATE"); len(locks) != 1 {
+			t.Errorf("%s: entry read without a row lock", tc.name)
+		}
+	}
+
+	db, _ := newFakeDB(t)
+	if _, err := lockPendingEntry(db, uuid.MustParse(testEntryID), "checker"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("missing entry: got %v, want ErrRecordNotFound", err)
+	}
+}
+
+func TestReviewRefusals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range []struct {
+		name   string
+		reject bool
+		status string
+		user   string
+		want   int
+	}{
+		{name: "approve own entry", status: JournalStatusPending, user: "maker", want: http.StatusForbidden},
+		{name: "reject own entry", reject: true, status: JournalStatusPending, user: "maker", want: http.StatusForbidden},
+		{name: "approve posted entry", status: JournalStatusPosted, user: "checker", want: http.StatusConflict},
+		{name: "approve rejected entry", status: JournalStatusRejected, user: "checker", want: http.StatusConflict},
+		{name: "reject posted entry", reject: true, status: JournalStatusPosted, user: "checker", want: http.StatusConflict},
+		{name: "reject rejected entry", reject: true, status: JournalStatusRejected, user: "checker", want: http.StatusConflict},
+		{name: "approve missing entry", user: "checker", want: http.StatusNotFound},
+	} {
+		db, fake := newFakeDB(t)
+		if tc.status != "" {
+			fakeJournalEntry(fake, tc.status, "maker")
+		}
+		handler, path := ApproveJournalEntryHandler(db), "/approve"
+		if tc.reject {
+			handler, path = RejectJournalEntryHandler(db), "/reject"
+		}
+		router := gin.New()
+		router.POST("/journal/:id"+path, func(c *gin.Context) { c.Set("userID", tc.user) }, handler)
+
+		request := httptest.NewRequest(http.MethodPost, "/journal/"+testEntryID+path, strings.NewReader(`{"reason":"duplicate"}`))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, response.Code, response.Body, tc.want)
+		}
+		for _, query := range fake.queries() {
+			if strings.HasPrefix(query, "UPDATE") || strings.HasPrefix(query, "INSERT") {
+				t.Errorf("%s: refused review still wrote %s", tc.name, query)
+			}
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionSubmit  = "submit"
+	AuditActionPost    = "post"
+	AuditActionApprove = "approve"
+	AuditActionReject  = "reject"
+	AuditActionReverse = "reverse"
+	AuditActionRepair  = "repair"
+	AuditActionRelease = "release"
+	AuditActionExpire  = "expire"
+	AuditActionDelete  = "delete"
+)
+
+// serialises appends so every entry sees the hash of the one before it
+const auditLockKey = 7310422
+
+const defaultAuditPageSize = 100
+
+// AuditLog is one append-only, hash-chained record of a mutation. Before and
+// After hold the JSON of the entity and are stored as text so that the hash
+// can be recomputed byte for byte.
+type AuditLog struct {
+	AuditID    uuid.UUID `gorm:"column:auditid;default:uuid_generate_v4();primarykey"`
+	Sequence   int64     `gorm:"column:sequence"`
+	Actor      string    `gorm:"column:actor"`
+	OccurredAt time.Time `gorm:"column:occurredat"`
+	Method     string    `gorm:"column:method"`
+	Endpoint   string    `gorm:"column:endpoint"`
+	Action     string    `gorm:"column:action"`
+	EntityType string    `gorm:"column:entitytype"`
+	EntityID   string    `gorm:"column:entityid"`
+	Before     string    `gorm:"column:before"`
+	After      string    `gorm:"column:after"`
+	RequestID  string    `gorm:"column:requestid"`
+	PrevHash   string    `gorm:"column:prevhash"`
+	Hash       string    `gorm:"column:hash"`
+}
+
+func (AuditLog) TableName() string {
+	return "auditlog"
+}
+
+// computeHash covers every field of the record together with the previous
+// hash, so editing or removing any record breaks the chain from that point.
+func (a AuditLog) computeHash() string {
+	fields := []string{
+		strconv.FormatInt(a.Sequence, 10),
+		a.Actor,
+		a.OccurredAt.UTC().Format(time.RFC3339Nano),
+		a.Method,
+		a.Endpoint,
+		a.Action,
+		a.EntityType,
+		a.EntityID,
+		a.Before,
+		a.After,
+		a.RequestID,
+		a.PrevHash,
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// AuditEvent describes a mutation to be recorded. Before is nil for creates.
+type AuditEvent struct {
+	Action     string
+	EntityType string
+	EntityID   string
+	Before     interface{}
+	After      interface{}
+}
+
+// AuditActor identifies who made a change and through which entry point.
+// Background jobs use a fixed actor such as "system" and their own endpoint.
+type AuditActor struct {
+	UserID    string
+	Method    string
+	Endpoint  string
+	RequestID string
+}
+
+func auditActor(c *gin.Context) AuditActor {
+	return AuditActor{
+		UserID:    c.GetString("userID"),
+		Method:    c.Request.Method,
+		Endpoint:  c.FullPath(),
+		RequestID: requestID(c),
+	}
+}
+
+// errAuditOutsideTransaction is returned when the audit log or the outbox
+// is written outside a transaction begun on a pool from withCommitHooks
+var errAuditOutsideTransaction = errors.New("audit log written outside a transaction")
+
+// appendAtCommit runs fn under the audit lock as the last work of the
+// transaction tx belongs to. Taking the lock there, once the transaction
+// holds every row lock it needs, means the lock holder never waits on a
+// row, and transactions only queue behind each other for their appends and
+// commit instead of for their whole run. The lock is held until commit.
+func appendAtCommit(tx *gorm.DB, fn func(tx *gorm.DB) error) error {
+	// the statement tx carries when fn runs is not the caller's concern
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	ok := beforeCommit(tx, func() error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditLockKey).Error; err != nil {
+			return fmt.Errorf("failed to lock audit log: %v", err)
+		}
+		return fn(tx)
+	})
+	if !ok {
+		return errAuditOutsideTransaction
+	}
+	return nil
+}
+
+// recordAudit appends event to the audit log. It must be called with the
+// transaction that performs the mutation so both commit or neither does;
+// the record is written when that transaction commits.
+func recordAudit(tx *gorm.DB, actor AuditActor, event AuditEvent) error {
+	before, err := auditJSON(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditJSON(event.After)
+	if err != nil {
+		return err
+	}
+
+	return appendAtCommit(tx, func(tx *gorm.DB) error {
+		var last AuditLog
+		err := tx.Order("sequence DESC").Limit(1).Find(&last).Error
+		if err != nil {
+			return fmt.Errorf("failed to read audit log head: %v", err)
+		}
+
+		record := AuditLog{
+			Sequence: last.Sequence + 1,
+			Actor:    actor.UserID,
+			// postgres keeps microseconds; hash what will be read back
+			OccurredAt: time.Now().UTC().Truncate(time.Microsecond),
+			Method:     actor.Method,
+			Endpoint:   actor.Endpoint,
+			Action:     event.Action,
+			EntityType: event.EntityType,
+			EntityID:   event.EntityID,
+			Before:     before,
+			After:      after,
+			RequestID:  actor.RequestID,
+			PrevHash:   last.Hash,
+		}
+		record.Hash = record.computeHash()
+
+		if err := tx.Create(&record).Error; err != nil {
+			return fmt.Errorf("failed to write audit log: %v", err)
+		}
+		return nil
+	})
+}
+
+func auditJSON(value interface{}) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit value: %v", err)
+	}
+	return string(data), nil
+}
+
+func requestID(c *gin.Context) string {
+	if id := c.GetString("requestID"); id != "" {
+		return id
+	}
+	return c.GetHeader("X-Request-ID")
+}
+
+type AuditLogResponse struct {
+	AuditID    uuid.UUID       `json:"id"`
+	Sequence   int64           `json:"sequence"`
+	Actor      string          `json:"actor"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Method     string          `json:"method"`
+	Endpoint   string          `json:"endpoint"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entity_type"`
+	EntityID   string          `json:"entity_id"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+	PrevHash   string          `json:"prev_hash"`
+	Hash       string          `json:"hash"`
+}
+
+func ListAuditLogHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&AuditLog{})
+		for param, column := range map[string]string{
+			"actor":       "actor",
+			"action":      "action",
+			"entity_type": "entitytype",
+			"entity_id":   "entityid",
+			"request_id":  "requestid",
+		} {
+			if value := c.Query(param); value != "" {
+				query = query.Where(column+" = ?", value)
+			}
+		}
+		if from := c.Query("from"); from != "" {
+			fromDate, err := time.Parse("2006-01-02", from)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date format", StatusCode: http.StatusBadRequest})
+				return
+			}
+			query = query.Where("occurredat >= ?", fromDate)
+		}
+		if to := c.Query("to"); to != "" {
+			toDate, err := time.Parse("2006-01-02", to)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date format", StatusCode: http.StatusBadRequest})
+				return
+			}
+			query = query.Where("occurredat < ?", toDate.AddDate(0, 0, 1))
+		}
+
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultAuditPageSize)))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 1000", StatusCode: http.StatusBadRequest})
+			return
+		}
+		offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+		if err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid offset", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var records []AuditLog
+		err = query.Order("sequence").Limit(limit).Offset(offset).Find(&records).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		response := make([]AuditLogResponse, 0, len(records))
+		for _, record := range records {
+			response = append(response, AuditLogResponse{
+				AuditID:    record.AuditID,
+				Sequence:   record.Sequence,
+				Actor:      record.Actor,
+				OccurredAt: record.OccurredAt,
+				Method:     record.Method,
+				Endpoint:   record.Endpoint,
+				Action:     record.Action,
+				EntityType: record.EntityType,
+				EntityID:   record.EntityID,
+				Before:     rawJSON(record.Before),
+				After:      rawJSON(record.After),
+				RequestID:  record.RequestID,
+				PrevHash:   record.PrevHash,
+				Hash:       record.Hash,
+			})
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Audit Log", StatusCode: http.StatusOK, Data: response})
+	}
+}
+
+func rawJSON(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
+}
+
+type AuditVerification struct {
+	Valid         bool   `json:"valid"`
+	Records       int64  `json:"records"`
+	HeadSequence  int64  `json:"head_sequence"`
+	HeadHash      string `json:"head_hash"`
+	BrokenAt      int64  `json:"broken_at,omitempty"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// verifyAuditChain walks the log in sequence order and checks that sequences
+// are contiguous, each record points at its predecessor's hash and each hash
+// matches the record's contents. Auditors should keep the returned head hash:
+// it is what proves that nothing was removed from the end of the log.
+func verifyAuditChain(db *gorm.DB) (AuditVerification, error) {
+	result := AuditVerification{Valid: true}
+	var previous AuditLog
+
+	for {
+		var batch []AuditLog
+		err := db.Where("sequence > ?", previous.Sequence).Order("sequence").Limit(1000).Find(&batch).Error
+		if err != nil {
+			return result, err
+		}
+		if len(batch) == 0 {
+			return result, nil
+		}
+
+		for _, record := range batch {
+			if reason := auditLinkProblem(previous, record); reason != "" {
+				result.Valid = false
+				result.BrokenAt = record.Sequence
+				result.FailureReason = reason
+				return result, nil
+			}
+
+			result.Records++
+			result.HeadSequence = record.Sequence
+			result.HeadHash = record.Hash
+			previous = record
+		}
+	}
+}
+
+// auditLinkProblem says why record cannot follow previous in the chain, or
+// returns "" when it can. The zero AuditLog stands before the first record.
+func auditLinkProblem(previous, record AuditLog) string {
+	switch {
+	case record.Sequence != previous.Sequence+1:
+		return fmt.Sprintf("expected sequence %d, found %d", previous.Sequence+1, record.Sequence)
+	case record.PrevHash != previous.Hash:
+		return "previous hash does not match"
+	case record.Hash != record.computeHash():
+		return "record hash does not match its contents"
+	}
+	return ""
+}
+
+func VerifyAuditLogHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := verifyAuditChain(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		message := "Audit chain is intact"
+		if !result.Valid {
+			message = "Audit chain is broken"
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: result})
+	}
+}
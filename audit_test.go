@@ -0,0 +1,177 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// testAuditChain builds n correctly chained records.
+func testAuditChain(n int) []AuditLog {
+	var chain []AuditLog
+	previous := AuditLog{}
+	for i := 1; i <= n; i++ {
+		record := AuditLog{
+			Sequence:   int64(i),
+			Actor:      "user-1",
+			OccurredAt: time.Date(2024, 1, 1, 9, i, 0, 0, time.UTC),
+			Method:     "POST",
+			Endpoint:   "/journalentry",
+			Action:     AuditActionPost,
+			EntityType: "journalentry",
+			EntityID:   "entry",
+			After:      `{"amount":100}`,
+			RequestID:  "req-1",
+			PrevHash:   previous.Hash,
+		}
+		record.Hash = record.computeHash()
+		chain = append(chain, record)
+		previous = record
+	}
+	return chain
+}
+
+// firstBreak walks chain the way verifyAuditChain does.
+func firstBreak(chain []AuditLog) (int64, string) {
+	previous := AuditLog{}
+	for _, record := range chain {
+		if reason := auditLinkProblem(previous, record); reason != "" {
+			return record.Sequence, reason
+		}
+		previous = record
+	}
+	return 0, ""
+}
+
+func TestComputeHash(t *testing.T) {
+	record := testAuditChain(1)[0]
+	if len(record.Hash) != 64 {
+		t.Fatalf("got hash %q, want 64 hex characters", record.Hash)
+	}
+	if record.computeHash() != record.Hash {
+		t.Error("hash is not deterministic")
+	}
+
+	// the same instant in another zone hashes the same, as it does after a
+	// round trip through the database
+	moved := record
+	moved.OccurredAt = record.OccurredAt.In(time.FixedZone("EAT", 3*60*60))
+	if moved.computeHash() != record.Hash {
+		t.Error("hash depends on the time zone of OccurredAt")
+	}
+
+	for name, edit := range map[string]func(*AuditLog){
+		"actor":     func(r *AuditLog) { r.Actor = "user-2" },
+		"time":      func(r *AuditLog) { r.OccurredAt = r.OccurredAt.Add(time.Nanosecond) },
+		"after":     func(r *AuditLog) { r.After = `{"amount":1000}` },
+		"request":   func(r *AuditLog) { r.RequestID = "req-2" },
+		"prev hash": func(r *AuditLog) { r.PrevHash = "x" },
+		// fields are separated, so moving text between them changes the hash
+		"boundary": func(r *AuditLog) { r.Method, r.Endpoint = "POST/", "journalentry" },
+	} {
+		edited := record
+		edit(&edited)
+		if edited.computeHash() == record.Hash {
+			t.Errorf("editing %s does not change the hash", name)
+		}
+	}
+}
+
+func TestAuditChainVerification(t *testing.T) {
+	if sequence, reason := firstBreak(testAuditChain(5)); reason != "" {
+		t.Fatalf("intact chain broken at %d: %s", sequence, reason)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		tamper func([]AuditLog) []AuditLog
+		at     int64
+		reason string
+	}{
+		{
+			name:   "edited record",
+			tamper: func(chain []AuditLog) []AuditLog { chain[2].After = `{"amount":1}`; return chain },
+			at:     3,
+			reason: "record hash does not match its contents",
+		},
+		{
+			name: "edited record with its hash recomputed",
+			tamper: func(chain []AuditLog) []AuditLog {
+				chain[2].After = `{"amount":1}`
+				chain[2].Hash = chain[2].computeHash()
+				return chain
+			},
+			at:     4,
+			reason: "previous hash does not match",
+		},
+		{
+			name:   "removed record",
+			tamper: func(chain []AuditLog) []AuditLog { return append(chain[:1], chain[2:]...) },
+			at:     3,
+			reason: "expected sequence 2, found 3",
+		},
+	} {
+		at, reason := firstBreak(tc.tamper(testAuditChain(5)))
+		if at != tc.at || reason != tc.reason {
+			t.Errorf("%s: broken at %d (%s), want %d (%s)", tc.name, at, reason, tc.at, tc.reason)
+		}
+	}
+}
+
+func TestAuditAppendedAtCommit(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.returns(`FROM "auditlog"`, []string{"sequence", "hash"}, []driver.Value{int64(4), "head-hash"})
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := recordAudit(tx, AuditActor{UserID: "user-1"}, AuditEvent{Action: AuditActionCreate, EntityType: "account"}); err != nil {
+			return err
+		}
+		return tx.Exec("UPDATE account SET balance = 1").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the lock comes after the transaction's own work, with only the
+	// append between it and the commit
+	var order []string
+	for _, query := range fake.queries() {
+		switch {
+		case strings.Contains(query, "UPDATE account"):
+			order = append(order, "update")
+		case strings.Contains(query, "pg_advisory_xact_lock"):
+			order = append(order, "lock")
+		case strings.Contains(query, `INSERT INTO "auditlog"`):
+			order = append(order, "append")
+		case query == "COMMIT":
+			order = append(order, "commit")
+		}
+	}
+	if want := []string{"update", "lock", "append", "commit"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("statements ran in order %v, want %v", order, want)
+	}
+
+	inserts := fake.sent(`INSERT INTO "auditlog"`)
+	if len(inserts) != 1 || !containsArg(inserts[0].Args, int64(5)) || !containsArg(inserts[0].Args, "head-hash") {
+		t.Errorf("audit record not chained to sequence 4: %+v", inserts)
+	}
+
+	err = recordAudit(db, AuditActor{}, AuditEvent{Action: AuditActionCreate})
+	if !errors.Is(err, errAuditOutsideTransaction) {
+		t.Errorf("recordAudit outside a transaction returned %v, want errAuditOutsideTransaction", err)
+	}
+}
+
+func containsArg(args []interface{}, want interface{}) bool {
+	for _, arg := range args {
+		if reflect.DeepEqual(arg, want) {
+			return true
+		}
+	}
+	return false
+}
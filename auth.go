@@ -0,0 +1,537 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AuthModeLocal  = "local"
+	AuthModeRemote = "remote"
+)
+
+// minimum time between JWKS refreshes triggered by an unknown key id
+const jwksRefreshInterval = time.Minute
+
+type AuthConfig struct {
+	Mode      string
+	Secret    []byte
+	JWKSURL   string
+	JWKSFile  string
+	AuthURL   string
+	Timeout   time.Duration
+	CacheTTL  time.Duration
+	UserClaim string
+}
+
+func NewAuthConfig() *AuthConfig {
+	mode := os.Getenv("AUTH_MODE")
+	if mode == "" {
+		mode = AuthModeRemote
+	}
+	userClaim := os.Getenv("JWT_USER_CLAIM")
+	if userClaim == "" {
+		userClaim = "user_id"
+	}
+	return &AuthConfig{
+		Mode:      mode,
+		Secret:    []byte(os.Getenv("SECRET")),
+		JWKSURL:   os.Getenv("JWKS_URL"),
+		JWKSFile:  os.Getenv("JWKS_FILE"),
+		AuthURL:   os.Getenv("AUTH_URL"),
+		Timeout:   envDuration("AUTH_TIMEOUT", 3*time.Second),
+		CacheTTL:  envDuration("AUTH_CACHE_TTL", time.Minute),
+		UserClaim: userClaim,
+	}
+}
+
+// Authenticator verifies bearer tokens either locally (HMAC secret or JWKS
+// public keys) or by introspecting them against AUTH_URL.
+type Authenticator struct {
+	config *AuthConfig
+	client *http.Client
+	cache  *introspectionCache
+
+	mu          sync.RWMutex
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// AuthResult is what the middleware knows about the caller once a token has
+// been accepted.
+type AuthResult struct {
+	UserID string
+	Roles  []string
+	Scopes []string
+	Claims map[string]interface{}
+}
+
+func NewAuthenticator(config *AuthConfig) (*Authenticator, error) {
+	if config.Mode != AuthModeLocal && config.Mode != AuthModeRemote {
+		return nil, fmt.Errorf("unknown AUTH_MODE %q", config.Mode)
+	}
+	if config.Mode == AuthModeRemote && config.AuthURL == "" {
+		return nil, fmt.Errorf("AUTH_URL is required when AUTH_MODE=%s", AuthModeRemote)
+	}
+
+	auth := &Authenticator{
+		config: config,
+		client: &http.Client{Timeout: config.Timeout},
+		cache:  newIntrospectionCache(),
+	}
+
+	if config.JWKSURL != "" || config.JWKSFile != "" {
+		if err := auth.loadKeys(context.Background()); err != nil {
+			return nil, err
+		}
+	} else if config.Mode == AuthModeLocal && len(config.Secret) == 0 {
+		return nil, fmt.Errorf("AUTH_MODE=%s requires SECRET, JWKS_URL or JWKS_FILE", AuthModeLocal)
+	}
+
+	return auth, nil
+}
+
+// Authenticate validates tokenString and returns the caller identity.
+func (a *Authenticator) Authenticate(ctx context.Context, tokenString string) (*AuthResult, error) {
+	claims, err := a.verifyLocally(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.config.Mode == AuthModeLocal {
+		userID := claimString(claims, a.config.UserClaim)
+		if userID == "" {
+			return nil, errNoSubject
+		}
+		return &AuthResult{
+			UserID: userID,
+			Roles:  rolesFromClaims(claims),
+			Scopes: scopesFromClaims(claims),
+			Claims: claims,
+		}, nil
+	}
+
+	result, err := a.introspect(ctx, tokenString, claims)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (a *Authenticator) verifyLocally(ctx context.Context, tokenString string) (jwt.MapClaims, error) {
+	// without any local key material the auth service is the only authority
+	if len(a.config.Secret) == 0 && !a.hasKeys() {
+		claims := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+			return nil, &authError{message: err.Error()}
+		}
+		return claims, nil
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return a.keyFor(ctx, token)
+	})
+	if err != nil {
+		return nil, &authError{message: err.Error()}
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, &authError{message: "Invalid token"}
+	}
+	return claims, nil
+}
+
+func (a *Authenticator) keyFor(ctx context.Context, token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if len(a.config.Secret) == 0 {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return a.config.Secret, nil
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		kid, _ := token.Header["kid"].(string)
+		key, err := a.publicKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("key %q is not an RSA key", kid)
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("key %q is not an EC key", kid)
+			}
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+func (a *Authenticator) hasKeys() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.keys) > 0
+}
+
+func (a *Authenticator) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	a.mu.RLock()
+	key, ok := a.lookupKey(kid)
+	stale := time.Since(a.keysFetched) > jwksRefreshInterval
+	a.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	// the issuer may have rotated keys since we last looked
+	if a.config.JWKSURL != "" && stale {
+		if err := a.loadKeys(ctx); err != nil {
+			return nil, err
+		}
+		a.mu.RLock()
+		key, ok = a.lookupKey(kid)
+		a.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey must be called with a.mu held. A token without a kid is accepted
+// only when the key set has exactly one key.
+func (a *Authenticator) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, true
+		}
+	}
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+func (a *Authenticator) loadKeys(ctx context.Context) error {
+	var data []byte
+	var err error
+	if a.config.JWKSFile != "" {
+		data, err = os.ReadFile(a.config.JWKSFile)
+	} else {
+		data, err = a.fetch(ctx, a.config.JWKSURL)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS: %v", err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+
+	a.mu.Lock()
+	a.keys = keys
+	a.keysFetched = time.Now()
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *Authenticator) fetch(ctx context.Context, url string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	setRequestID(ctx, request)
+	response, err := a.do("jwks", request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %d", url, response.StatusCode)
+	}
+	return io.ReadAll(response.Body)
+}
+
+// do sends request to the auth service, timing it for the metrics.
+func (a *Authenticator) do(operation string, request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, err := a.client.Do(request)
+	observeAuthCall(operation, start, response, err)
+	return response, err
+}
+
+// setRequestID forwards the caller's request ID so the auth service can
+// log the same ID.
+func setRequestID(ctx context.Context, request *http.Request) {
+	if id := requestIDFrom(ctx); id != "" {
+		request.Header.Set("X-Request-ID", id)
+	}
+}
+
+func (a *Authenticator) introspect(ctx context.Context, tokenString string, claims jwt.MapClaims) (*AuthResult, error) {
+	cacheKey := hashToken(tokenString)
+	if result, ok := a.cache.get(cacheKey); ok {
+		return result, nil
+	}
+
+	jsonPayload, err := json.Marshal(map[string]string{"token": tokenString})
+	if err != nil {
+		return nil, fmt.Errorf("Error encoding payload")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, a.config.AuthURL, bytes.NewBuffer(jsonPayload))
+	if err != nil {
+		return nil, fmt.Errorf("Error contacting auth service")
+	}
+	request.Header.Set("Authorization", "Bearer "+tokenString)
+	request.Header.Set("Content-Type", "application/json")
+	setRequestID(ctx, request)
+
+	response, err := a.do("introspect", request)
+	if err != nil {
+		return nil, errAuthUnavailable
+	}
+	defer response.Body.Close()
+
+	switch {
+	case response.StatusCode >= http.StatusInternalServerError:
+		return nil, errAuthUnavailable
+	case response.StatusCode != http.StatusOK:
+		return nil, &authError{message: "Invalid token"}
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("Error decoding response")
+	}
+
+	result := &AuthResult{
+		UserID: claimString(body, "user_id"),
+		Roles:  rolesFromClaims(body),
+		Scopes: scopesFromClaims(body),
+		Claims: body,
+	}
+	// roles and scopes come from the auth service alone: the token's own
+	// claims are not trusted in remote mode, where nothing verified them
+	if result.UserID == "" {
+		return nil, errNoSubject
+	}
+
+	ttl := a.config.CacheTTL
+	// never cache a result past the token's own expiry
+	if exp, ok := claims["exp"].(float64); ok {
+		if untilExpiry := time.Until(time.Unix(int64(exp), 0)); untilExpiry < ttl {
+			ttl = untilExpiry
+		}
+	}
+	if ttl > 0 {
+		a.cache.set(cacheKey, result, ttl)
+	}
+
+	return result, nil
+}
+
+// Reachable reports whether the auth service answers. In local mode there is
+// nothing remote to depend on unless keys come from a JWKS URL.
+func (a *Authenticator) Reachable(ctx context.Context) error {
+	if a.config.Mode == AuthModeLocal {
+		if a.config.JWKSURL != "" && !a.hasKeys() {
+			return fmt.Errorf("no JWKS keys loaded")
+		}
+		return nil
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, a.config.AuthURL, nil)
+	if err != nil {
+		return err
+	}
+	setRequestID(ctx, request)
+	response, err := a.do("probe", request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	// the endpoint expects a POST with a token, so anything below 500 is fine
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("auth service returned %d", response.StatusCode)
+	}
+	return nil
+}
+
+// authError marks failures caused by the token itself rather than by the
+// auth service, so the middleware can answer 401 instead of 500.
+type authError struct {
+	message string
+}
+
+func (e *authError) Error() string {
+	return e.message
+}
+
+var errNoSubject = &authError{message: "Token has no subject"}
+
+// errAuthUnavailable means the auth service could not be reached or failed,
+// so the token could not be checked either way. Callers answer 503.
+var errAuthUnavailable = errors.New("Auth service unavailable")
+
+type introspectionEntry struct {
+	result  *AuthResult
+	expires time.Time
+}
+
+type introspectionCache struct {
+	mu      sync.Mutex
+	entries map[string]introspectionEntry
+}
+
+func newIntrospectionCache() *introspectionCache {
+	return &introspectionCache{entries: make(map[string]introspectionEntry)}
+}
+
+func (c *introspectionCache) get(key string) (*AuthResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.result, true
+}
+
+func (c *introspectionCache) set(key string, result *AuthResult, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = introspectionEntry{result: result, expires: now.Add(ttl)}
+}
+
+// tokens are cached by hash so raw bearer tokens are never kept in memory
+// longer than the request that carried them
+func hashToken(tokenString string) string {
+	sum := sha256.Sum256([]byte(tokenString))
+	return hex.EncodeToString(sum[:])
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			key, err := rsaKeyFromJWK(k)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", k.Kid, err)
+			}
+			keys[k.Kid] = key
+		case "EC":
+			key, err := ecKeyFromJWK(k)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %v", k.Kid, err)
+			}
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no usable signing keys")
+	}
+	return keys, nil
+}
+
+func rsaKeyFromJWK(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func ecKeyFromJWK(k jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	switch value := claims[name].(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case nil:
+		if name != "sub" {
+			return claimString(claims, "sub")
+		}
+	}
+	return ""
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func encodeJWKS(t *testing.T, keys ...jwk) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string][]jwk{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func b64(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaJWK := jwk{Kty: "RSA", Kid: "rsa-1", Use: "sig", N: b64(rsaKey.N.Bytes()), E: b64(big.NewInt(int64(rsaKey.E)).Bytes())}
+	ecJWK := jwk{Kty: "EC", Kid: "ec-1", Crv: "P-256", X: b64(ecKey.X.Bytes()), Y: b64(ecKey.Y.Bytes())}
+	encJWK := rsaJWK
+	encJWK.Kid, encJWK.Use = "rsa-enc", "enc"
+
+	keys, err := parseJWKS(encodeJWKS(t, rsaJWK, ecJWK, encJWK, jwk{Kty: "oct", Kid: "hmac"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want the RSA and EC signing keys only", len(keys))
+	}
+	if got, ok := keys["rsa-1"].(*rsa.PublicKey); !ok || !got.Equal(&rsaKey.PublicKey) {
+		t.Errorf("rsa-1 = %#v, want the RSA public key", keys["rsa-1"])
+	}
+	if got, ok := keys["ec-1"].(*ecdsa.PublicKey); !ok || !got.Equal(&ecKey.PublicKey) {
+		t.Errorf("ec-1 = %#v, want the EC public key", keys["ec-1"])
+	}
+
+	for name, data := range map[string][]byte{
+		"malformed":         []byte(`{"keys":`),
+		"no keys":           encodeJWKS(t),
+		"only enc keys":     encodeJWKS(t, encJWK),
+		"unsupported curve": encodeJWKS(t, jwk{Kty: "EC", Kid: "ec-2", Crv: "secp256k1", X: ecJWK.X, Y: ecJWK.Y}),
+		"bad modulus":       encodeJWKS(t, jwk{Kty: "RSA", Kid: "rsa-2", N: "!!", E: rsaJWK.E}),
+	} {
+		if _, err := parseJWKS(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestAuthenticateRequiresSubject(t *testing.T) {
+	auth, err := NewAuthenticator(&AuthConfig{Mode: AuthModeLocal, Secret: []byte("test-secret"), UserClaim: "user_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sign := func(claims jwt.MapClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	result, err := auth.Authenticate(context.Background(), sign(jwt.MapClaims{"sub": "user-1", "roles": []string{"teller"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.UserID != "user-1" || strings.Join(result.Roles, ",") != "teller" {
+		t.Errorf("got user %q roles %v, want user-1 [teller]", result.UserID, result.Roles)
+	}
+
+	_, err = auth.Authenticate(context.Background(), sign(jwt.MapClaims{"roles": []string{"admin"}}))
+	var tokenErr *authError
+	if !errors.As(err, &tokenErr) {
+		t.Errorf("token without a subject: got %v, want an authError", err)
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	var status int
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	// the token claims admin, which must not count in remote mode
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1", "roles": []string{"admin"}}).SignedString([]byte("unused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		status      int
+		body        string
+		unavailable bool
+		rejected    bool
+		roles       string
+	}{
+		{name: "accepted", status: http.StatusOK, body: `{"user_id":"user-1","roles":["viewer"]}`, roles: "viewer"},
+		{name: "no roles from the service", status: http.StatusOK, body: `{"user_id":"user-1"}`, roles: ""},
+		{name: "no subject", status: http.StatusOK, body: `{"roles":["viewer"]}`, rejected: true},
+		{name: "rejected", status: http.StatusUnauthorized, body: `{}`, rejected: true},
+		{name: "server error", status: http.StatusBadGateway, body: `{}`, unavailable: true},
+	} {
+		status, body = tc.status, tc.body
+		auth, err := NewAuthenticator(&AuthConfig{Mode: AuthModeRemote, AuthURL: server.URL, Timeout: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err := auth.Authenticate(context.Background(), token)
+		var tokenErr *authError
+		switch {
+		case tc.unavailable:
+			if !errors.Is(err, errAuthUnavailable) {
+				t.Errorf("%s: got %v, want errAuthUnavailable", tc.name, err)
+			}
+		case tc.rejected:
+			if !errors.As(err, &tokenErr) {
+				t.Errorf("%s: got %v, want an authError", tc.name, err)
+			}
+		case err != nil:
+			t.Errorf("%s: %v", tc.name, err)
+		case strings.Join(result.Roles, ",") != tc.roles:
+			t.Errorf("%s: got roles %v, want %q", tc.name, result.Roles, tc.roles)
+		}
+	}
+
+	server.Close()
+	auth, err := NewAuthenticator(&AuthConfig{Mode: AuthModeRemote, AuthURL: server.URL, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Authenticate(context.Background(), token); !errors.Is(err, errAuthUnavailable) {
+		t.Errorf("unreachable: got %v, want errAuthUnavailable", err)
+	}
+}
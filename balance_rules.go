@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Balance rules decide how far a debit may take an account. An account's own
+// rule wins; otherwise its chart of account's rule applies, and accounts with
+// neither are unrestricted.
+const (
+	BalanceRuleNoOverdraft    = "no_overdraft"
+	BalanceRuleOverdraftLimit = "overdraft_limit"
+	BalanceRuleUnrestricted   = "unrestricted"
+)
+
+type InsufficientFundsError struct {
+	AccountNumber int
+	Available     int
+	Requested     int
+}
+
+func (e *InsufficientFundsError) Error() string {
+	return fmt.Sprintf("Insufficient funds in account %d: available balance is %d, requested %d", e.AccountNumber, e.Available, e.Requested)
+}
+
+func validBalanceRule(rule string) bool {
+	switch rule {
+	case BalanceRuleNoOverdraft, BalanceRuleOverdraftLimit, BalanceRuleUnrestricted:
+		return true
+	}
+	return false
+}
+
+// balanceFloor returns the lowest balance the account may reach, or nil when
+// it is unrestricted.
+func balanceFloor(db *gorm.DB, accountID uuid.UUID) (*int, error) {
+	var rule struct {
+		Rule           string `gorm:"column:rule"`
+		OverdraftLimit int    `gorm:"column:overdraftlimit"`
+	}
+	err := db.Raw(`
+SELECT
+    CASE WHEN a.balancerule <> '' THEN a.balancerule ELSE COALESCE(c.balancerule, '') END AS rule,
+    CASE WHEN a.balancerule <> '' THEN a.overdraftlimit ELSE COALESCE(c.overdraftlimit, 0) END AS overdraftlimit
+FROM account a
+LEFT JOIN chartofaccount c ON c.accountid = a.coaid
+WHERE a.accountid = ?`, accountID).Scan(&rule).Error
+	if err != nil {
+		return nil, err
+	}
+
+	floor := 0
+	switch rule.Rule {
+	case BalanceRuleNoOverdraft:
+		return &floor, nil
+	case BalanceRuleOverdraftLimit:
+		floor = -rule.OverdraftLimit
+		return &floor, nil
+	default:
+		return nil, nil
+	}
+}
+
+type balanceRuleRequest struct {
+	BalanceRule    string `json:"balance_rule"`
+	OverdraftLimit int    `json:"overdraft_limit"`
+}
+
+func (r balanceRuleRequest) validate(allowEmpty bool) error {
+	if r.BalanceRule == "" && allowEmpty {
+		return nil
+	}
+	if !validBalanceRule(r.BalanceRule) {
+		return fmt.Errorf("balance_rule must be one of %s, %s or %s", BalanceRuleNoOverdraft, BalanceRuleOverdraftLimit, BalanceRuleUnrestricted)
+	}
+	if r.OverdraftLimit < 0 {
+		return fmt.Errorf("overdraft_limit cannot be negative")
+	}
+	if r.BalanceRule != BalanceRuleOverdraftLimit && r.OverdraftLimit != 0 {
+		return fmt.Errorf("overdraft_limit only applies to %s", BalanceRuleOverdraftLimit)
+	}
+	return nil
+}
+
+// SetAccountBalanceRuleHandler overrides the chart of account default for a
+// single account. An empty balance_rule removes the override.
+func SetAccountBalanceRuleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data balanceRuleRequest
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := data.validate(true); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var account Account
+			if err := tx.Where("accountid = ?", accountID).First(&account).Error; err != nil {
+				return err
+			}
+			before := account
+			account.BalanceRule = data.BalanceRule
+			account.OverdraftLimit = data.OverdraftLimit
+
+			err := tx.Model(&Account{}).Where("accountid = ?", accountID).Updates(map[string]interface{}{
+				"balancerule":    account.BalanceRule,
+				"overdraftlimit": account.OverdraftLimit,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "account",
+				EntityID:   accountID.String(),
+				Before:     before,
+				After:      account,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Account not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account balance rule updated successfully", StatusCode: http.StatusOK})
+	}
+}
+
+// SetChartBalanceRuleHandler sets the default rule for every account under a
+// chart of account, e.g. no_overdraft for member savings.
+func SetChartBalanceRuleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coaID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid chart of account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data balanceRuleRequest
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := data.validate(false); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var coa ChartOfAccount
+			if err := tx.Where("accountid = ?", coaID).First(&coa).Error; err != nil {
+				return err
+			}
+			before := coa
+			coa.BalanceRule = data.BalanceRule
+			coa.OverdraftLimit = data.OverdraftLimit
+
+			err := tx.Model(&ChartOfAccount{}).Where("accountid = ?", coaID).Updates(map[string]interface{}{
+				"balancerule":    coa.BalanceRule,
+				"overdraftlimit": coa.OverdraftLimit,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "chartofaccount",
+				EntityID:   coaID.String(),
+				Before:     before,
+				After:      coa,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Chart of account not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Chart of account balance rule updated successfully", StatusCode: http.StatusOK})
+	}
+}
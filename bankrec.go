@@ -0,0 +1,794 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A ledger account that mirrors a bank account is reconciled by importing
+// the bank's statements against it and matching each statement line to the
+// journal entry that booked the same movement. Statement amounts are in
+// minor units and signed the way the account moves: a credit to the
+// account is money in.
+
+const (
+	MatchMethodAuto   = "auto"
+	MatchMethodManual = "manual"
+)
+
+type errStatementMatch string
+
+func (e errStatementMatch) Error() string {
+	return string(e)
+}
+
+// MatchTolerance is how far a journal entry may be from a statement line
+// and still be matched to it automatically.
+type MatchTolerance struct {
+	Amount int `json:"amount"`
+	Days   int `json:"days"`
+}
+
+// defaultMatchTolerance reads RECON_AMOUNT_TOLERANCE and
+// RECON_DATE_TOLERANCE_DAYS, falling back to an exact amount within three
+// days.
+func defaultMatchTolerance() MatchTolerance {
+	tolerance := MatchTolerance{Amount: 0, Days: 3}
+	if amount, err := strconv.Atoi(os.Getenv("RECON_AMOUNT_TOLERANCE")); err == nil && amount >= 0 {
+		tolerance.Amount = amount
+	}
+	if days, err := strconv.Atoi(os.Getenv("RECON_DATE_TOLERANCE_DAYS")); err == nil && days >= 0 {
+		tolerance.Days = days
+	}
+	return tolerance
+}
+
+// matchTolerance lets a request override the defaults with the
+// amount_tolerance and date_tolerance_days query parameters.
+func matchTolerance(c *gin.Context) (MatchTolerance, error) {
+	tolerance := defaultMatchTolerance()
+	if value := c.Query("amount_tolerance"); value != "" {
+		amount, err := strconv.Atoi(value)
+		if err != nil || amount < 0 {
+			return tolerance, fmt.Errorf("amount_tolerance must be a non-negative integer")
+		}
+		tolerance.Amount = amount
+	}
+	if value := c.Query("date_tolerance_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return tolerance, fmt.Errorf("date_tolerance_days must be a non-negative integer")
+		}
+		tolerance.Days = days
+	}
+	return tolerance, nil
+}
+
+// signedAmount is the amount of an entry as it moves the given account.
+func signedAmount(entry JournalEntry, accountNumber int) int {
+	if entry.AccountCreditNumber == accountNumber {
+		return entry.Amount
+	}
+	return -entry.Amount
+}
+
+// referenceHit reports whether the entry carries one of the line's
+// references, either as its transaction ID or within its description.
+func referenceHit(line BankStatementLine, entry JournalEntry) bool {
+	description := strings.ToLower(entry.Description)
+	for _, reference := range []string{line.Reference, line.BankReference} {
+		reference = strings.ToLower(strings.TrimSpace(reference))
+		if len(reference) < 3 {
+			continue
+		}
+		if reference == entry.TransactionID.String() || strings.Contains(description, reference) {
+			return true
+		}
+	}
+	return false
+}
+
+func absInt(value int) int {
+	if value < 0 {
+		return -value
+	}
+	return value
+}
+
+type matchCandidate struct {
+	entry     JournalEntry
+	reference bool
+	days      int
+	amount    int
+}
+
+// better ranks a reference hit first, then the nearest date, then the
+// nearest amount.
+func (m matchCandidate) better(other matchCandidate) bool {
+	if m.reference != other.reference {
+		return m.reference
+	}
+	if m.days != other.days {
+		return m.days < other.days
+	}
+	return m.amount < other.amount
+}
+
+// bestMatch picks the entry, among those not taken, that ranks strictly
+// best for line within the tolerance. It reports false when nothing is in
+// range or the best two candidates rank the same.
+func bestMatch(line BankStatementLine, entries []JournalEntry, accountNumber int, tolerance MatchTolerance, taken map[uuid.UUID]bool) (JournalEntry, bool) {
+	var best, second *matchCandidate
+	for _, entry := range entries {
+		if taken[entry.TransactionID] {
+			continue
+		}
+		candidate := matchCandidate{
+			entry:     entry,
+			reference: referenceHit(line, entry),
+			days:      absInt(int(utcDate(entry.Date).Sub(utcDate(line.ValueDate)).Hours() / 24)),
+			amount:    absInt(signedAmount(entry, accountNumber) - line.Amount),
+		}
+		if candidate.amount > tolerance.Amount || candidate.days > tolerance.Days {
+			continue
+		}
+		switch {
+		case best == nil || candidate.better(*best):
+			second, best = best, &candidate
+		case second == nil || candidate.better(*second):
+			second = &candidate
+		}
+	}
+	if best == nil || (second != nil && !best.better(*second)) {
+		return JournalEntry{}, false
+	}
+	return best.entry, true
+}
+
+// autoMatchStatementLines matches the account's unmatched statement lines to
+// unmatched posted entries within the tolerance. A line is only matched
+// when one candidate ranks strictly best, so ambiguous lines are left for
+// a person to match by hand.
+func autoMatchStatementLines(tx *gorm.DB, account Account, tolerance MatchTolerance, actor AuditActor) (int, error) {
+	var lines []BankStatementLine
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("accountid = ? AND transactionid IS NULL", account.AccountID).
+		Order("valuedate, lineid").Find(&lines).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(lines) == 0 {
+		return 0, nil
+	}
+
+	from, to := lines[0].ValueDate, lines[0].ValueDate
+	for _, line := range lines {
+		if line.ValueDate.Before(from) {
+			from = line.ValueDate
+		}
+		if line.ValueDate.After(to) {
+			to = line.ValueDate
+		}
+	}
+	var entries []JournalEntry
+	err = tx.Where("status = ? AND (accountdebitnumber = ? OR accountcreditnumber = ?)", JournalStatusPosted, account.AccountNumber, account.AccountNumber).
+		Where("date >= ? AND date < ?", from.AddDate(0, 0, -tolerance.Days), to.AddDate(0, 0, tolerance.Days+1)).
+		Where("transactionid NOT IN (SELECT transactionid FROM bankstatementline WHERE transactionid IS NOT NULL)").
+		Order("date, transactionid").Find(&entries).Error
+	if err != nil {
+		return 0, err
+	}
+
+	taken := make(map[uuid.UUID]bool)
+	now := time.Now()
+	matched := 0
+	for _, line := range lines {
+		best, ok := bestMatch(line, entries, account.AccountNumber, tolerance, taken)
+		if !ok {
+			continue
+		}
+
+		before := line
+		method := MatchMethodAuto
+		line.TransactionID = &best.TransactionID
+		line.MatchMethod = &method
+		line.MatchedBy = &actor.UserID
+		line.MatchedAt = &now
+		if err := tx.Save(&line).Error; err != nil {
+			return matched, err
+		}
+		err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionUpdate,
+			EntityType: "bankstatementline",
+			EntityID:   line.LineID.String(),
+			Before:     before,
+			After:      line,
+		})
+		if err != nil {
+			return matched, err
+		}
+		taken[best.TransactionID] = true
+		matched++
+	}
+	return matched, nil
+}
+
+type StatementImportReport struct {
+	Statements        []BankStatement `json:"statements"`
+	SkippedStatements []string        `json:"skipped_statements"`
+	LinesImported     int             `json:"lines_imported"`
+	DuplicateLines    int             `json:"duplicate_lines"`
+	Matched           int             `json:"matched"`
+	Unmatched         int             `json:"unmatched"`
+	Tolerance         MatchTolerance  `json:"tolerance"`
+}
+
+// importStatements stores parsed statements against the account and runs
+// auto-matching, all in one transaction. A statement already imported, or
+// a line whose bank reference has been seen before, is skipped so a file
+// can safely be imported again.
+func importStatements(db *gorm.DB, account Account, format string, filename string, statements []ParsedStatement,
+	tolerance MatchTolerance, importedBy string, actor AuditActor) (*StatementImportReport, error) {
+	report := &StatementImportReport{Statements: []BankStatement{}, SkippedStatements: []string{}, Tolerance: tolerance}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, parsed := range statements {
+			var existing int64
+			err := tx.Model(&BankStatement{}).
+				Where("accountid = ? AND reference = ? AND fromdate = ? AND todate = ?", account.AccountID, parsed.Reference, parsed.FromDate, parsed.ToDate).
+				Count(&existing).Error
+			if err != nil {
+				return err
+			}
+			if existing > 0 {
+				report.SkippedStatements = append(report.SkippedStatements, parsed.Reference)
+				continue
+			}
+
+			statement := BankStatement{
+				AccountID:      account.AccountID,
+				Format:         format,
+				Reference:      parsed.Reference,
+				BankAccount:    parsed.BankAccount,
+				Currency:       parsed.Currency,
+				OpeningBalance: parsed.OpeningBalance,
+				ClosingBalance: parsed.ClosingBalance,
+				FromDate:       parsed.FromDate,
+				ToDate:         parsed.ToDate,
+				FileName:       filename,
+				ImportedBy:     importedBy,
+				ImportedAt:     time.Now(),
+			}
+			if err := tx.Create(&statement).Error; err != nil {
+				return err
+			}
+
+			imported := 0
+			for _, parsedLine := range parsed.Lines {
+				if parsedLine.BankReference != "" {
+					var seen int64
+					err := tx.Model(&BankStatementLine{}).
+						Where("accountid = ? AND bankreference = ?", account.AccountID, parsedLine.BankReference).
+						Count(&seen).Error
+					if err != nil {
+						return err
+					}
+					if seen > 0 {
+						report.DuplicateLines++
+						continue
+					}
+				}
+				line := BankStatementLine{
+					StatementID:   statement.StatementID,
+					AccountID:     account.AccountID,
+					ValueDate:     parsedLine.ValueDate,
+					BookingDate:   parsedLine.BookingDate,
+					Amount:        parsedLine.Amount,
+					Reference:     parsedLine.Reference,
+					BankReference: parsedLine.BankReference,
+					Description:   parsedLine.Description,
+				}
+				if err := tx.Create(&line).Error; err != nil {
+					return err
+				}
+				imported++
+			}
+			report.LinesImported += imported
+
+			err = recordAudit(tx, actor, AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "bankstatement",
+				EntityID:   statement.StatementID.String(),
+				After:      gin.H{"statement": statement, "lines": imported},
+			})
+			if err != nil {
+				return err
+			}
+			report.Statements = append(report.Statements, statement)
+		}
+
+		matched, err := autoMatchStatementLines(tx, account, tolerance, actor)
+		if err != nil {
+			return err
+		}
+		report.Matched = matched
+
+		var unmatched int64
+		err = tx.Model(&BankStatementLine{}).Where("accountid = ? AND transactionid IS NULL", account.AccountID).Count(&unmatched).Error
+		report.Unmatched = int(unmatched)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// statementAccount loads the account named by the :id parameter, answering
+// the request itself when it cannot.
+func statementAccount(c *gin.Context, db *gorm.DB) (Account, bool) {
+	var account Account
+	accountID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+		return account, false
+	}
+	if err := db.Where("accountid = ?", accountID).First(&account).Error; err != nil {
+		respondNotFoundOr500(c, err, "Account not found")
+		return account, false
+	}
+	return account, true
+}
+
+// ImportStatementHandler takes a multipart statement file for the account.
+// The format is detected from the content unless the format field names it.
+func ImportStatementHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := statementAccount(c, db)
+		if !ok {
+			return
+		}
+		tolerance, err := matchTolerance(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A file is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if header.Size > maxImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("File exceeds %d bytes", maxImportSize), StatusCode: http.StatusRequestEntityTooLarge})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file", StatusCode: http.StatusBadRequest})
+			return
+		}
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		format := strings.ToLower(c.PostForm("format"))
+		switch format {
+		case StatementFormatMT940, StatementFormatCAMT053, StatementFormatOFX:
+		case "":
+			if format, err = detectStatementFormat(content); err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("format must be %s, %s or %s", StatementFormatMT940, StatementFormatCAMT053, StatementFormatOFX), StatusCode: http.StatusBadRequest})
+			return
+		}
+		statements, err := parseStatements(format, content)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnprocessableEntity})
+			return
+		}
+
+		report, err := importStatements(db, account, format, header.Filename, statements, tolerance, c.GetString("userID"), auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Statement imported successfully", StatusCode: http.StatusCreated, Data: report})
+	}
+}
+
+// AutoMatchStatementHandler runs auto-matching again, typically after the
+// missing entries have been posted or with a wider tolerance.
+func AutoMatchStatementHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := statementAccount(c, db)
+		if !ok {
+			return
+		}
+		tolerance, err := matchTolerance(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var matched int
+		var unmatched int64
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if matched, err = autoMatchStatementLines(tx, account, tolerance, auditActor(c)); err != nil {
+				return err
+			}
+			return tx.Model(&BankStatementLine{}).Where("accountid = ? AND transactionid IS NULL", account.AccountID).Count(&unmatched).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Statement lines matched", StatusCode: http.StatusOK,
+			Data: gin.H{"matched": matched, "unmatched": unmatched, "tolerance": tolerance}})
+	}
+}
+
+func ListStatementHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		account, ok := statementAccount(c, db)
+		if !ok {
+			return
+		}
+
+		statements := []BankStatement{}
+		if err := db.Where("accountid = ?", account.AccountID).Order("todate DESC").Find(&statements).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Bank Statements", StatusCode: http.StatusOK, Data: statements})
+	}
+}
+
+func GetStatementHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		statementID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid statement ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var statement BankStatement
+		err = db.Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("valuedate, lineid") }).
+			Where("statementid = ?", statementID).First(&statement).Error
+		if err != nil {
+			respondNotFoundOr500(c, err, "Statement not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Bank Statement", StatusCode: http.StatusOK, Data: statement})
+	}
+}
+
+// MatchStatementLineHandler matches a line to a posted entry by hand. The
+// amounts need not agree; the difference shows on the reconciliation
+// report.
+func MatchStatementLineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lineID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid statement line ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		var data struct {
+			TransactionID uuid.UUID `json:"transactionid"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.TransactionID == uuid.Nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "transactionid is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var line BankStatementLine
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("lineid = ?", lineID).First(&line).Error; err != nil {
+				return err
+			}
+			if line.TransactionID != nil {
+				return errStatementMatch(fmt.Sprintf("Statement line is already matched to %s", line.TransactionID))
+			}
+			var account Account
+			if err := tx.Where("accountid = ?", line.AccountID).First(&account).Error; err != nil {
+				return err
+			}
+			var entry JournalEntry
+			if err := tx.Where("transactionid = ?", data.TransactionID).First(&entry).Error; err != nil {
+				return err
+			}
+			if entry.Status != JournalStatusPosted {
+				return errStatementMatch("Only posted journal entries can be matched")
+			}
+			if entry.AccountDebitNumber != account.AccountNumber && entry.AccountCreditNumber != account.AccountNumber {
+				return errStatementMatch(fmt.Sprintf("Journal entry does not post to account %d", account.AccountNumber))
+			}
+			var taken int64
+			if err := tx.Model(&BankStatementLine{}).Where("transactionid = ?", entry.TransactionID).Count(&taken).Error; err != nil {
+				return err
+			}
+			if taken > 0 {
+				return errStatementMatch("Journal entry is already matched to another statement line")
+			}
+
+			before := line
+			now := time.Now()
+			method := MatchMethodManual
+			userID := c.GetString("userID")
+			line.TransactionID = &entry.TransactionID
+			line.MatchMethod = &method
+			line.MatchedBy = &userID
+			line.MatchedAt = &now
+			if err := tx.Save(&line).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "bankstatementline",
+				EntityID:   line.LineID.String(),
+				Before:     before,
+				After:      line,
+			})
+		})
+		var conflict errStatementMatch
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			return
+		}
+		if err != nil {
+			respondNotFoundOr500(c, err, "Statement line or journal entry not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Statement line matched", StatusCode: http.StatusOK, Data: line})
+	}
+}
+
+func UnmatchStatementLineHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		lineID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid statement line ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var line BankStatementLine
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("lineid = ?", lineID).First(&line).Error; err != nil {
+				return err
+			}
+			if line.TransactionID == nil {
+				return errStatementMatch("Statement line is not matched")
+			}
+
+			before := line
+			line.TransactionID = nil
+			line.MatchMethod = nil
+			line.MatchedBy = nil
+			line.MatchedAt = nil
+			if err := tx.Save(&line).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "bankstatementline",
+				EntityID:   line.LineID.String(),
+				Before:     before,
+				After:      line,
+			})
+		})
+		var conflict errStatementMatch
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			return
+		}
+		if err != nil {
+			respondNotFoundOr500(c, err, "Statement line not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Statement line unmatched", StatusCode: http.StatusOK, Data: line})
+	}
+}
+
+// BankReconciliationEntry is a posted entry with no statement line, its amount
+// signed the way it moves the account.
+type BankReconciliationEntry struct {
+	TransactionID uuid.UUID `json:"transactionid" gorm:"column:transactionid"`
+	Date          time.Time `json:"date" gorm:"column:date"`
+	Amount        int       `json:"amount" gorm:"column:amount"`
+	Description   string    `json:"description" gorm:"column:description"`
+}
+
+// BankReconciliation explains the difference between the bank and the
+// ledger at a date. The reconciled balance is the statement balance less
+// the lines the ledger has not booked, plus the entries the bank has not
+// shown, less any amount differences on matched pairs; it equals the
+// ledger balance when the two agree.
+type BankReconciliation struct {
+	AccountNumber           int                       `json:"account_number"`
+	Date                    time.Time                 `json:"date"`
+	StatementID             uuid.UUID                 `json:"statementid"`
+	StatementBalance        int                       `json:"statement_balance"`
+	LedgerBalance           int                       `json:"ledger_balance"`
+	UnmatchedStatementLines []BankStatementLine       `json:"unmatched_statement_lines"`
+	UnmatchedStatementTotal int                       `json:"unmatched_statement_total"`
+	UnmatchedEntries        []BankReconciliationEntry `json:"unmatched_entries"`
+	UnmatchedEntryTotal     int                       `json:"unmatched_entry_total"`
+	MatchedDifference       int                       `json:"matched_difference"`
+	ReconciledBalance       int                       `json:"reconciled_balance"`
+	Difference              int                       `json:"difference"`
+	Reconciled              bool                      `json:"reconciled"`
+}
+
+// reconcileBankAccount builds the report from the latest statement ending on or
+// before date, or the latest statement when date is nil. A match only
+// counts when both sides fall on or before the report date.
+func reconcileBankAccount(db *gorm.DB, account Account, date *time.Time) (*BankReconciliation, error) {
+	var statement BankStatement
+	query := db.Where("accountid = ?", account.AccountID).Order("todate DESC")
+	if date != nil {
+		query = query.Where("todate <= ?", *date)
+	}
+	if err := query.First(&statement).Error; err != nil {
+		return nil, err
+	}
+	report := &BankReconciliation{
+		AccountNumber:    account.AccountNumber,
+		Date:             utcDate(statement.ToDate),
+		StatementID:      statement.StatementID,
+		StatementBalance: statement.ClosingBalance,
+	}
+	if date != nil {
+		report.Date = *date
+	}
+	end := report.Date.AddDate(0, 0, 1)
+
+	var since time.Time
+	err := db.Model(&BankStatement{}).Where("accountid = ?", account.AccountID).Select("MIN(fromdate)").Scan(&since).Error
+	if err != nil {
+		return nil, err
+	}
+
+	signed := "CASE WHEN j.accountcreditnumber = ? THEN j.amount ELSE -j.amount END"
+	err = db.Table("journalentry j").
+		Where("j.status = ? AND (j.accountdebitnumber = ? OR j.accountcreditnumber = ?) AND j.date < ?", JournalStatusPosted, account.AccountNumber, account.AccountNumber, end).
+		Select("COALESCE(SUM("+signed+"), 0)", account.AccountNumber).Scan(&report.LedgerBalance).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report.UnmatchedStatementLines = []BankStatementLine{}
+	err = db.Table("bankstatementline l").
+		Joins("JOIN bankstatement s ON s.statementid = l.statementid").
+		Joins("LEFT JOIN journalentry j ON j.transactionid = l.transactionid").
+		Where("l.accountid = ? AND s.todate <= ?", account.AccountID, report.Date).
+		Where("l.transactionid IS NULL OR j.date >= ?", end).
+		Select("l.*").Order("l.valuedate, l.lineid").Find(&report.UnmatchedStatementLines).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range report.UnmatchedStatementLines {
+		report.UnmatchedStatementTotal += line.Amount
+	}
+
+	report.UnmatchedEntries = []BankReconciliationEntry{}
+	err = db.Table("journalentry j").
+		Where("j.status = ? AND (j.accountdebitnumber = ? OR j.accountcreditnumber = ?)", JournalStatusPosted, account.AccountNumber, account.AccountNumber).
+		Where("j.date >= ? AND j.date < ?", since, end).
+		Where(`NOT EXISTS (SELECT 1 FROM bankstatementline l JOIN bankstatement s ON s.statementid = l.statementid
+			WHERE l.transactionid = j.transactionid AND s.todate <= ?)`, report.Date).
+		Select("j.transactionid, j.date, "+signed+" AS amount, j.description", account.AccountNumber).
+		Order("j.date, j.transactionid").Scan(&report.UnmatchedEntries).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range report.UnmatchedEntries {
+		report.UnmatchedEntryTotal += entry.Amount
+	}
+
+	err = db.Table("bankstatementline l").
+		Joins("JOIN bankstatement s ON s.statementid = l.statementid").
+		Joins("JOIN journalentry j ON j.transactionid = l.transactionid").
+		Where("l.accountid = ? AND s.todate <= ? AND j.date < ?", account.AccountID, report.Date, end).
+		Select("COALESCE(SUM(l.amount - "+signed+"), 0)", account.AccountNumber).Scan(&report.MatchedDifference).Error
+	if err != nil {
+		return nil, err
+	}
+
+	report.ReconciledBalance = report.StatementBalance - report.UnmatchedStatementTotal + report.UnmatchedEntryTotal - report.MatchedDifference
+	report.Difference = report.LedgerBalance - report.ReconciledBalance
+	report.Reconciled = report.Difference == 0
+	return report, nil
+}
+
+func BankReconciliationHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+		account, ok := statementAccount(c, db)
+		if !ok {
+			return
+		}
+
+		var date *time.Time
+		if value := c.Query("date"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "date must be YYYY-MM-DD", StatusCode: http.StatusBadRequest})
+				return
+			}
+			date = &parsed
+		}
+
+		report, err := reconcileBankAccount(db, account, date)
+		if err != nil {
+			respondNotFoundOr500(c, err, "No statement has been imported for this account up to that date")
+			return
+		}
+		if format != ExportFormatJSON {
+			exportReconciliation(c, format, *report)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Bank Reconciliation", StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+func exportReconciliation(c *gin.Context, format string, report BankReconciliation) {
+	header := ExportHeader{
+		Name:     "reconciliation",
+		Title:    "Bank Reconciliation",
+		Subtitle: fmt.Sprintf("Account %d as at %s", report.AccountNumber, report.Date.Format("2006-01-02")),
+		Columns: []ExportColumn{
+			{Name: "Date", Width: 1},
+			{Name: "Reference", Width: 1.4},
+			{Name: "Description", Width: 2.6},
+			{Name: "Amount", Numeric: true, Width: 1},
+		},
+	}
+	lines := exportSection{Heading: "Statement lines not in the ledger"}
+	for _, line := range report.UnmatchedStatementLines {
+		lines.Rows = append(lines.Rows, []interface{}{line.ValueDate, line.Reference, line.Description, line.Amount})
+	}
+	lines.Total = []interface{}{"Total", "", "", report.UnmatchedStatementTotal}
+
+	entries := exportSection{Heading: "Ledger entries not on the statement"}
+	for _, entry := range report.UnmatchedEntries {
+		entries.Rows = append(entries.Rows, []interface{}{entry.Date, entry.TransactionID.String(), entry.Description, entry.Amount})
+	}
+	entries.Total = []interface{}{"Total", "", "", report.UnmatchedEntryTotal}
+
+	writeExport(c, format, header, []exportSection{lines, entries},
+		[]interface{}{"Statement balance", "", "", report.StatementBalance},
+		[]interface{}{"Matched amount differences", "", "", report.MatchedDifference},
+		[]interface{}{"Reconciled balance", "", "", report.ReconciledBalance},
+		[]interface{}{"Ledger balance", "", "", report.LedgerBalance},
+		[]interface{}{"Difference", "", "", report.Difference})
+}
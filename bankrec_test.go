@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBestMatch(t *testing.T) {
+	const bankAccount = 1001
+	entry := func(id string, credit bool, amount int, day int, description string) JournalEntry {
+		e := JournalEntry{TransactionID: uuid.MustParse(id), Amount: amount, Date: date(2024, 1, day), Description: description,
+			AccountDebitNumber: 4001, AccountCreditNumber: bankAccount}
+		if !credit {
+			e.AccountDebitNumber, e.AccountCreditNumber = bankAccount, 4001
+		}
+		return e
+	}
+	const (
+		a = "00000000-0000-0000-0000-00000000000a"
+		b = "00000000-0000-0000-0000-00000000000b"
+	)
+	line := BankStatementLine{ValueDate: date(2024, 1, 10), Amount: 10000, Reference: "INV-42"}
+	exact := MatchTolerance{Amount: 0, Days: 3}
+
+	for _, tc := range []struct {
+		name      string
+		line      BankStatementLine
+		entries   []JournalEntry
+		tolerance MatchTolerance
+		taken     []string
+		want      string
+	}{
+		{
+			name:    "same amount and date",
+			entries: []JournalEntry{entry(a, true, 10000, 10, "")},
+			want:    a,
+		},
+		{
+			name:    "money out matches a debit to the bank account",
+			line:    BankStatementLine{ValueDate: date(2024, 1, 10), Amount: -10000},
+			entries: []JournalEntry{entry(a, true, 10000, 10, ""), entry(b, false, 10000, 10, "")},
+			want:    b,
+		},
+		{
+			name:    "wrong side of the bank account",
+			entries: []JournalEntry{entry(a, false, 10000, 10, "")},
+		},
+		{
+			name:    "amount outside the tolerance",
+			entries: []JournalEntry{entry(a, true, 9999, 10, "")},
+		},
+		{
+			name:      "amount within the tolerance",
+			entries:   []JournalEntry{entry(a, true, 9950, 10, "")},
+			tolerance: MatchTolerance{Amount: 50, Days: 3},
+			want:      a,
+		},
+		{
+			name:    "date outside the tolerance",
+			entries: []JournalEntry{entry(a, true, 10000, 14, "")},
+		},
+		{
+			name:    "date at the edge of the tolerance",
+			entries: []JournalEntry{entry(a, true, 10000, 7, "")},
+			want:    a,
+		},
+		{
+			name:    "nearer date wins",
+			entries: []JournalEntry{entry(a, true, 10000, 12, ""), entry(b, true, 10000, 11, "")},
+			want:    b,
+		},
+		{
+			name:      "nearer amount wins on the same date",
+			entries:   []JournalEntry{entry(a, true, 9980, 10, ""), entry(b, true, 9990, 10, "")},
+			tolerance: MatchTolerance{Amount: 50, Days: 3},
+			want:      b,
+		},
+		{
+			name:    "reference beats a nearer date",
+			entries: []JournalEntry{entry(a, true, 10000, 10, "rent"), entry(b, true, 10000, 12, "payment for inv-42")},
+			want:    b,
+		},
+		{
+			name:    "reference as the transaction id",
+			line:    BankStatementLine{ValueDate: date(2024, 1, 10), Amount: 10000, BankReference: b},
+			entries: []JournalEntry{entry(a, true, 10000, 10, ""), entry(b, true, 10000, 12, "")},
+			want:    b,
+		},
+		{
+			name:    "references shorter than three characters are ignored",
+			line:    BankStatementLine{ValueDate: date(2024, 1, 10), Amount: 10000, Reference: "42"},
+			entries: []JournalEntry{entry(a, true, 10000, 10, ""), entry(b, true, 10000, 12, "invoice 42")},
+			want:    a,
+		},
+		{
+			name:    "two equally good candidates",
+			entries: []JournalEntry{entry(a, true, 10000, 9, ""), entry(b, true, 10000, 11, "")},
+		},
+		{
+			name:    "taken entry is skipped",
+			entries: []JournalEntry{entry(a, true, 10000, 10, ""), entry(b, true, 10000, 12, "")},
+			taken:   []string{a},
+			want:    b,
+		},
+		{
+			name: "no entries",
+		},
+	} {
+		if tc.line.ValueDate.IsZero() {
+			tc.line = line
+		}
+		if tc.tolerance == (MatchTolerance{}) {
+			tc.tolerance = exact
+		}
+		taken := make(map[uuid.UUID]bool)
+		for _, id := range tc.taken {
+			taken[uuid.MustParse(id)] = true
+		}
+		got, ok := bestMatch(tc.line, tc.entries, bankAccount, tc.tolerance, taken)
+		switch {
+		case tc.want == "" && ok:
+			t.Errorf("%s: matched %s, want no match", tc.name, got.TransactionID)
+		case tc.want != "" && (!ok || got.TransactionID.String() != tc.want):
+			t.Errorf("%s: got %s, %v, want %s", tc.name, got.TransactionID, ok, tc.want)
+		}
+	}
+}
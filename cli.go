@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+// runCommand runs a maintenance subcommand and returns the process exit code.
+// Reports are written to stdout as JSON so they can be piped into other tools.
+func runCommand(db *gorm.DB, args []string) int {
+	switch args[0] {
+	case "reconcile":
+		return reconcileCommand(db, args[1:])
+	case "verify":
+		return verifyCommand(db, args[1:])
+	case "import":
+		return importCommand(db, args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, expected one of: serve, reconcile, verify, import\n", args[0])
+		return 2
+	}
+}
+
+func reconcileCommand(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "overwrite drifted balances with the journal total")
+	actor := flags.String("actor", "system", "user recorded in the audit log for repairs")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	report, err := reconcileBalances(db, *repair, AuditActor{UserID: *actor, Method: "CLI", Endpoint: "reconcile"})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := writeJSON(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	// non-zero when drift remains so cron jobs can alert on it
+	if len(report.Discrepancies) > report.Repaired {
+		return 1
+	}
+	return 0
+}
+
+func verifyCommand(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	report, err := verifyLedgerIntegrity(db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := writeJSON(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if !report.Valid {
+		return 1
+	}
+	return 0
+}
+
+func importCommand(db *gorm.DB, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	path := flags.String("file", "", "CSV or XLSX file of journal lines")
+	format := flags.String("format", "", "csv or xlsx, taken from the file extension when omitted")
+	dryRun := flags.Bool("dry-run", false, "validate the file without posting it")
+	actor := flags.String("actor", "system", "user recorded as the creator of the entries")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(os.Stderr, "-file is required")
+		return 2
+	}
+	fileFormat, err := importFormat(*format, *path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	report, err := importJournal(db, fileFormat, *path, file, nil, *actor,
+		AuditActor{UserID: *actor, Method: "CLI", Endpoint: "import"}, *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := writeJSON(report); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func writeJSON(value interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
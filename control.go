@@ -0,0 +1,381 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// A control account is a chart of account whose balance is carried on the
+// general ledger as one figure while the detail lives in the sub-ledger
+// accounts under it. Its ControlBalance moves in the same transaction as
+// every sub-ledger posting, so the two can only disagree if something
+// bypasses the ledger.
+
+type ControlAccountError struct {
+	AccountNumber int
+}
+
+func (e *ControlAccountError) Error() string {
+	return fmt.Sprintf("Account %d is a control account, post to one of its sub-ledger accounts instead", e.AccountNumber)
+}
+
+// checkNotControlAccount refuses a posting addressed to a control account's
+// own number.
+func checkNotControlAccount(db *gorm.DB, accountNumber int) error {
+	var controls int64
+	err := db.Model(&ChartOfAccount{}).
+		Where("accountnumber = ? AND iscontrol", accountNumber).
+		Count(&controls).Error
+	if err != nil {
+		return fmt.Errorf("failed to check control accounts: %v", err)
+	}
+	if controls > 0 {
+		return &ControlAccountError{AccountNumber: accountNumber}
+	}
+	return nil
+}
+
+// updateControlBalances moves the control balance of every control account
+// touched by a posting. Changes are netted per chart of account, so a
+// transfer between two sub-ledgers of one control account leaves it alone,
+// and applied in chart of account order to keep lock order stable.
+func updateControlBalances(db *gorm.DB, changes map[uuid.UUID]int) error {
+	accountIDs := make([]uuid.UUID, 0, len(changes))
+	for accountID := range changes {
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	var accounts []Account
+	err := db.Select("accountid", "coaid").Where("accountid IN ?", accountIDs).Find(&accounts).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch sub-ledger accounts: %v", err)
+	}
+
+	net := make(map[uuid.UUID]int)
+	for _, account := range accounts {
+		net[account.COAID] += changes[account.AccountID]
+	}
+	coaIDs := make([]uuid.UUID, 0, len(net))
+	for coaID, amount := range net {
+		if amount != 0 {
+			coaIDs = append(coaIDs, coaID)
+		}
+	}
+	sort.Slice(coaIDs, func(i, j int) bool { return coaIDs[i].String() < coaIDs[j].String() })
+
+	for _, coaID := range coaIDs {
+		err := db.Model(&ChartOfAccount{}).
+			Where("accountid = ? AND iscontrol", coaID).
+			Update("controlbalance", gorm.Expr("controlbalance + ?", net[coaID])).Error
+		if err != nil {
+			return fmt.Errorf("failed to update control balance: %v", err)
+		}
+	}
+	return nil
+}
+
+// subledgerTotal locks the sub-ledger balances of a chart of account and
+// returns their sum. Holding the locks means no posting can be half way
+// through a sub-ledger while the control balance is set from the total.
+func subledgerTotal(tx *gorm.DB, coaID uuid.UUID) (int, error) {
+	var balances []AccountBalance
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("accountid IN (SELECT accountid FROM account WHERE coaid = ?)", coaID).
+		Order("accountid").
+		Find(&balances).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock sub-ledger balances: %v", err)
+	}
+	total := 0
+	for _, balance := range balances {
+		total += balance.Balance
+	}
+	return total, nil
+}
+
+// SetControlAccountHandler turns a chart of account into a control account,
+// opening its control balance at the current sub-ledger total, or back into
+// an ordinary one.
+func SetControlAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coaID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid chart of account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			IsControl *bool `json:"is_control"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || data.IsControl == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var coa ChartOfAccount
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", coaID).
+				First(&coa).Error
+			if err != nil {
+				return err
+			}
+
+			before := coa
+			coa.IsControl = *data.IsControl
+			coa.ControlBalance = 0
+			if coa.IsControl {
+				coa.ControlBalance, err = subledgerTotal(tx, coaID)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = tx.Model(&ChartOfAccount{}).Where("accountid = ?", coaID).Updates(map[string]interface{}{
+				"iscontrol":      coa.IsControl,
+				"controlbalance": coa.ControlBalance,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "chartofaccount",
+				EntityID:   coaID.String(),
+				Before:     before,
+				After:      coa,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Chart of account not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Chart of account control flag updated successfully", StatusCode: http.StatusOK, Data: coa})
+	}
+}
+
+// ControlAccountCheck compares a control balance with its sub-ledger, both
+// as stored and as implied by the posted journal.
+type ControlAccountCheck struct {
+	COAID          uuid.UUID `json:"coa_id" gorm:"column:accountid"`
+	AccountNumber  int       `json:"account_number" gorm:"column:accountnumber"`
+	Name           string    `json:"name" gorm:"column:name"`
+	ControlBalance int       `json:"control_balance" gorm:"column:controlbalance"`
+	SubledgerTotal int       `json:"subledger_total" gorm:"column:subledgertotal"`
+	JournalTotal   int       `json:"journal_total" gorm:"column:journaltotal"`
+	Accounts       int       `json:"accounts" gorm:"column:accounts"`
+	Difference     int       `json:"difference" gorm:"-"`
+	Balanced       bool      `json:"balanced" gorm:"-"`
+	Repaired       bool      `json:"repaired,omitempty" gorm:"-"`
+}
+
+type ControlAccountReport struct {
+	CheckedAt time.Time             `json:"checked_at"`
+	Balanced  bool                  `json:"balanced"`
+	Controls  []ControlAccountCheck `json:"controls"`
+	Repaired  int                   `json:"repaired"`
+}
+
+const controlAccountsSQL = `
+SELECT c.accountid, c.accountnumber, c.name, c.controlbalance,
+    COALESCE((SELECT SUM(b.balance) FROM accountbalance b
+        JOIN account a ON a.accountid = b.accountid
+        WHERE a.coaid = c.accountid), 0) AS subledgertotal,
+    COALESCE((SELECT SUM(CASE WHEN a.accountnumber = j.accountcreditnumber THEN j.amount ELSE -j.amount END)
+        FROM journalentry j
+        JOIN account a ON a.accountnumber IN (j.accountcreditnumber, j.accountdebitnumber)
+        WHERE a.coaid = c.accountid AND j.status = 'posted'
+          AND j.accountcreditnumber <> j.accountdebitnumber), 0) AS journaltotal,
+    (SELECT COUNT(*) FROM account a WHERE a.coaid = c.accountid) AS accounts
+FROM chartofaccount c
+WHERE c.iscontrol`
+
+func controlAccountChecks(db *gorm.DB, where string, args ...interface{}) ([]ControlAccountCheck, error) {
+	var checks []ControlAccountCheck
+	err := db.Raw(controlAccountsSQL+where+" ORDER BY c.accountnumber", args...).Scan(&checks).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to check control accounts: %v", err)
+	}
+	for i := range checks {
+		check := &checks[i]
+		check.Difference = check.ControlBalance - check.SubledgerTotal
+		check.Balanced = check.Difference == 0 && check.SubledgerTotal == check.JournalTotal
+	}
+	return checks, nil
+}
+
+// reconcileControlAccounts proves every control balance against its
+// sub-ledger. With repair set, a control balance that disagrees with the
+// stored sub-ledger total is reset to it; sub-ledger drift from the journal
+// is left to the balance reconciliation job.
+func reconcileControlAccounts(db *gorm.DB, repair bool, actor AuditActor) (*ControlAccountReport, error) {
+	report := &ControlAccountReport{CheckedAt: time.Now(), Balanced: true}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		report.Controls, err = controlAccountChecks(tx, "")
+		return err
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	if report.Controls == nil {
+		report.Controls = []ControlAccountCheck{}
+	}
+
+	for i := range report.Controls {
+		check := &report.Controls[i]
+		if check.Difference != 0 && repair {
+			repaired, err := repairControlBalance(db, check.COAID, actor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to repair control account %d: %v", check.AccountNumber, err)
+			}
+			if repaired != nil {
+				*check = *repaired
+				check.Repaired = true
+				report.Repaired++
+			}
+		}
+		if !check.Balanced && !check.Repaired {
+			report.Balanced = false
+		}
+	}
+	return report, nil
+}
+
+func repairControlBalance(db *gorm.DB, coaID uuid.UUID, actor AuditActor) (*ControlAccountCheck, error) {
+	var result *ControlAccountCheck
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var coa ChartOfAccount
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("accountid = ? AND iscontrol", coaID).
+			First(&coa).Error
+		if err != nil {
+			return err
+		}
+		total, err := subledgerTotal(tx, coaID)
+		if err != nil {
+			return err
+		}
+		if total == coa.ControlBalance {
+			return nil
+		}
+
+		before := coa
+		coa.ControlBalance = total
+		err = tx.Model(&ChartOfAccount{}).Where("accountid = ?", coaID).Update("controlbalance", total).Error
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionRepair,
+			EntityType: "chartofaccount",
+			EntityID:   coaID.String(),
+			Before:     before,
+			After:      coa,
+		}); err != nil {
+			return err
+		}
+
+		checks, err := controlAccountChecks(tx, " AND c.accountid = ?", coaID)
+		if err != nil || len(checks) == 0 {
+			return err
+		}
+		result = &checks[0]
+		return nil
+	})
+	return result, err
+}
+
+// ControlAccountReportHandler proves the control accounts against their
+// sub-ledgers; POST with ?repair=true resets drifted control balances.
+func ControlAccountReportHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		repair := c.Query("repair") == "true"
+		if repair && c.Request.Method != http.MethodPost {
+			c.JSON(http.StatusMethodNotAllowed, ErrorResponse{Error: "Repairs must be requested with POST", StatusCode: http.StatusMethodNotAllowed})
+			return
+		}
+
+		report, err := reconcileControlAccounts(db, repair, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		if format != ExportFormatJSON {
+			exportControlAccounts(c, format, report)
+			return
+		}
+
+		message := "Control accounts agree with their sub-ledgers"
+		if !report.Balanced {
+			message = "Control accounts disagree with their sub-ledgers"
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+func checkControlAccounts(db *gorm.DB, report *IntegrityReport) error {
+	checks, err := controlAccountChecks(db, "")
+	if err != nil {
+		return err
+	}
+	for _, check := range checks {
+		if check.Difference != 0 {
+			report.add(IntegrityFinding{
+				Check:      "control_accounts_balance",
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("control account %d is %d but its sub-ledger totals %d", check.AccountNumber, check.ControlBalance, check.SubledgerTotal),
+				EntityType: "chartofaccount",
+				EntityID:   check.COAID.String(),
+			})
+		}
+		if check.SubledgerTotal != check.JournalTotal {
+			report.add(IntegrityFinding{
+				Check:      "control_accounts_balance",
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("sub-ledger of control account %d totals %d but its journal totals %d", check.AccountNumber, check.SubledgerTotal, check.JournalTotal),
+				EntityType: "chartofaccount",
+				EntityID:   check.COAID.String(),
+			})
+		}
+	}
+	return nil
+}
+
+// controlDrilldown reads the balance sheet's drilldown parameter: "all", a
+// control account number, or empty for totals only.
+func controlDrilldown(c *gin.Context) (func(accountNumber int) bool, error) {
+	return parseDrilldown(c.Query("drilldown"))
+}
+
+func parseDrilldown(value string) (func(accountNumber int) bool, error) {
+	switch value {
+	case "":
+		return func(int) bool { return false }, nil
+	case "all":
+		return func(int) bool { return true }, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return nil, errors.New("drilldown must be all or a control account number")
+	}
+	return func(accountNumber int) bool { return accountNumber == number }, nil
+}
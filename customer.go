@@ -0,0 +1,575 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Mandates say how many signatories must sign for a joint account: any one
+// of them, all of them, or RequiredSignatories of them. The ledger records
+// the mandate for the branch and channel systems that collect signatures;
+// it does not enforce it. Postings and approvals are made by staff, not by
+// the account's owners, so there is no signature here to count.
+const (
+	MandateAny  = "any"
+	MandateAll  = "all"
+	MandateNOfM = "n_of_m"
+)
+
+var (
+	errCustomerNotFound = errors.New("Customer not found")
+	errCustomerKYC      = errors.New("Customer failed KYC and cannot own accounts")
+)
+
+type errOwnership string
+
+func (e errOwnership) Error() string {
+	return string(e)
+}
+
+func validCustomerType(customerType string) bool {
+	return customerType == CustomerTypeIndividual || customerType == CustomerTypeOrganization
+}
+
+func validKYCStatus(status string) bool {
+	switch status {
+	case KYCStatusPending, KYCStatusVerified, KYCStatusRejected:
+		return true
+	}
+	return false
+}
+
+func validOwnerRole(role string) bool {
+	switch role {
+	case OwnerRolePrimary, OwnerRoleJoint, OwnerRoleSignatory:
+		return true
+	}
+	return false
+}
+
+func validMandate(mandate string) bool {
+	switch mandate {
+	case MandateAny, MandateAll, MandateNOfM:
+		return true
+	}
+	return false
+}
+
+// addAccountOwner links a customer to an account. Customers rejected at KYC
+// cannot take on new accounts.
+func addAccountOwner(tx *gorm.DB, owner AccountOwner, actor AuditActor) error {
+	var customer Customer
+	err := tx.Where("customerid = ?", owner.CustomerID).First(&customer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errCustomerNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if customer.KYCStatus == KYCStatusRejected {
+		return errCustomerKYC
+	}
+
+	query := tx.Model(&AccountOwner{}).Where("accountid = ?", owner.AccountID)
+	if owner.Role == OwnerRolePrimary {
+		query = query.Where("customerid = ? OR role = ?", owner.CustomerID, OwnerRolePrimary)
+	} else {
+		query = query.Where("customerid = ?", owner.CustomerID)
+	}
+	var existing int64
+	if err := query.Count(&existing).Error; err != nil {
+		return err
+	}
+	if existing > 0 {
+		return errOwnership("Customer already owns this account, or the account already has a primary owner")
+	}
+
+	owner.CreatedAt = time.Now()
+	if err := tx.Create(&owner).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionCreate,
+		EntityType: "accountowner",
+		EntityID:   owner.AccountID.String() + "/" + owner.CustomerID.String(),
+		After:      owner,
+	})
+}
+
+// checkMandate verifies that an n_of_m mandate can still be met by the
+// account's signing owners.
+func checkMandate(tx *gorm.DB, accountID uuid.UUID, mandate string, required int) error {
+	if mandate != MandateNOfM {
+		return nil
+	}
+	var signatories int64
+	err := tx.Model(&AccountOwner{}).Where("accountid = ? AND cansign", accountID).Count(&signatories).Error
+	if err != nil {
+		return err
+	}
+	if int64(required) > signatories {
+		return errOwnership(fmt.Sprintf("Mandate requires %d signatories but the account has %d", required, signatories))
+	}
+	return nil
+}
+
+func respondCustomerError(c *gin.Context, err error, notFound string) {
+	var ownership errOwnership
+	switch {
+	case errors.Is(err, errCustomerNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error(), StatusCode: http.StatusNotFound})
+	case errors.Is(err, errCustomerKYC), errors.As(err, &ownership):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+	default:
+		respondNotFoundOr500(c, err, notFound)
+	}
+}
+
+func CreateCustomerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			CustomerType string `json:"customer_type"`
+			Name         string `json:"name"`
+			IDType       string `json:"id_type"`
+			IDNumber     string `json:"id_number"`
+			Email        string `json:"email"`
+			Phone        string `json:"phone"`
+			Address      string `json:"address"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if !validCustomerType(data.CustomerType) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("customer_type must be %s or %s", CustomerTypeIndividual, CustomerTypeOrganization), StatusCode: http.StatusBadRequest})
+			return
+		}
+		if data.Name == "" || data.IDType == "" || data.IDNumber == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "name, id_type and id_number are required", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var existing int64
+		err := db.Model(&Customer{}).Where("idtype = ? AND idnumber = ?", data.IDType, data.IDNumber).Count(&existing).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		if existing > 0 {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: fmt.Sprintf("Customer with %s %s already exists", data.IDType, data.IDNumber), StatusCode: http.StatusConflict})
+			return
+		}
+
+		customer := Customer{
+			CustomerType: data.CustomerType,
+			Name:         data.Name,
+			IDType:       data.IDType,
+			IDNumber:     data.IDNumber,
+			Email:        data.Email,
+			Phone:        data.Phone,
+			Address:      data.Address,
+			KYCStatus:    KYCStatusPending,
+			CreatedBy:    c.GetString("userID"),
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&customer).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "customer",
+				EntityID:   customer.CustomerID.String(),
+				After:      customer,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Customer created successfully", StatusCode: http.StatusCreated, Data: customer})
+	}
+}
+
+func ListCustomerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Order("name")
+		if status := c.Query("kyc_status"); status != "" {
+			query = query.Where("kycstatus = ?", status)
+		}
+		if customerType := c.Query("customer_type"); customerType != "" {
+			query = query.Where("customertype = ?", customerType)
+		}
+
+		customers := []Customer{}
+		if err := query.Find(&customers).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Customer List", StatusCode: http.StatusOK, Data: customers})
+	}
+}
+
+func GetCustomerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		customerID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var customer Customer
+		if err := db.Where("customerid = ?", customerID).First(&customer).Error; err != nil {
+			respondNotFoundOr500(c, err, "Customer not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Customer", StatusCode: http.StatusOK, Data: customer})
+	}
+}
+
+// ReviewCustomerKYCHandler records the outcome of a KYC review.
+func ReviewCustomerKYCHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		customerID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			KYCStatus string `json:"kyc_status"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || !validKYCStatus(data.KYCStatus) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("kyc_status must be one of %s, %s or %s", KYCStatusPending, KYCStatusVerified, KYCStatusRejected), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var customer Customer
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("customerid = ?", customerID).
+				First(&customer).Error
+			if err != nil {
+				return err
+			}
+
+			before := customer
+			now := time.Now()
+			customer.KYCStatus = data.KYCStatus
+			customer.KYCReviewedBy = c.GetString("userID")
+			customer.KYCReviewedAt = &now
+			err = tx.Model(&Customer{}).Where("customerid = ?", customerID).Updates(map[string]interface{}{
+				"kycstatus":     customer.KYCStatus,
+				"kycreviewedby": customer.KYCReviewedBy,
+				"kycreviewedat": customer.KYCReviewedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "customer",
+				EntityID:   customerID.String(),
+				Before:     before,
+				After:      customer,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Customer not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Customer KYC status updated successfully", StatusCode: http.StatusOK, Data: customer})
+	}
+}
+
+type CustomerAccountResponse struct {
+	ListAccountResponse
+	Role    string `json:"role"`
+	CanSign bool   `json:"can_sign"`
+}
+
+// ListCustomerAccountsHandler returns every account the customer owns,
+// jointly or alone, with its balances.
+func ListCustomerAccountsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		customerID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var customer Customer
+		if err := db.Where("customerid = ?", customerID).First(&customer).Error; err != nil {
+			respondNotFoundOr500(c, err, "Customer not found")
+			return
+		}
+
+		var owners []AccountOwner
+		if err := db.Where("customerid = ?", customerID).Find(&owners).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		response := []CustomerAccountResponse{}
+		if len(owners) == 0 {
+			c.JSON(http.StatusOK, SuccessResponse{Message: "Customer Account List", StatusCode: http.StatusOK, Data: response})
+			return
+		}
+
+		accountIDs := make([]uuid.UUID, 0, len(owners))
+		for _, owner := range owners {
+			accountIDs = append(accountIDs, owner.AccountID)
+		}
+		var accounts []Account
+		if err := db.Where("accountid IN ?", accountIDs).Order("accountnumber").Find(&accounts).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		balances, err := accountBalances(db, accountIDs...)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		ownership := make(map[uuid.UUID]AccountOwner, len(owners))
+		for _, owner := range owners {
+			ownership[owner.AccountID] = owner
+		}
+		for _, account := range accounts {
+			owner := ownership[account.AccountID]
+			response = append(response, CustomerAccountResponse{
+				ListAccountResponse: ListAccountResponse{
+					AccountID:       account.AccountID,
+					Name:            account.Name,
+					AccountNumber:   account.AccountNumber,
+					BalanceRule:     account.BalanceRule,
+					OverdraftLimit:  account.OverdraftLimit,
+					Status:          account.Status,
+					AccountBalances: balances[account.AccountID],
+				},
+				Role:    owner.Role,
+				CanSign: owner.CanSign,
+			})
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Customer Account List", StatusCode: http.StatusOK, Data: response})
+	}
+}
+
+func ListAccountOwnersHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		owners := []AccountOwner{}
+		if err := db.Where("accountid = ?", accountID).Order("createdat").Find(&owners).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account Owner List", StatusCode: http.StatusOK, Data: owners})
+	}
+}
+
+// AddAccountOwnerHandler adds a joint owner or signatory to an account, or a
+// primary owner to an account that has none.
+func AddAccountOwnerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			CustomerID string `json:"customer_id"`
+			Role       string `json:"role"`
+			CanSign    *bool  `json:"can_sign"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		customerID, err := uuid.Parse(data.CustomerID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer_id", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if !validOwnerRole(data.Role) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("role must be one of %s, %s or %s", OwnerRolePrimary, OwnerRoleJoint, OwnerRoleSignatory), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		owner := AccountOwner{
+			AccountID:  accountID,
+			CustomerID: customerID,
+			Role:       data.Role,
+			CanSign:    true,
+			CreatedBy:  c.GetString("userID"),
+		}
+		if data.CanSign != nil {
+			owner.CanSign = *data.CanSign
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var account Account
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", accountID).
+				First(&account).Error
+			if err != nil {
+				return err
+			}
+			if account.Status == AccountStatusClosed {
+				return errOwnership("Owners cannot be added to a closed account")
+			}
+			return addAccountOwner(tx, owner, auditActor(c))
+		})
+		if err != nil {
+			respondCustomerError(c, err, "Account not found")
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Account owner added successfully", StatusCode: http.StatusCreated, Data: owner})
+	}
+}
+
+// RemoveAccountOwnerHandler removes a joint owner or signatory. The primary
+// owner stays for the life of the account.
+func RemoveAccountOwnerHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		customerID, err := uuid.Parse(c.Param("customerid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var account Account
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", accountID).
+				First(&account).Error
+			if err != nil {
+				return err
+			}
+
+			var owner AccountOwner
+			err = tx.Where("accountid = ? AND customerid = ?", accountID, customerID).First(&owner).Error
+			if err != nil {
+				return err
+			}
+			if owner.Role == OwnerRolePrimary {
+				return errOwnership("The primary owner cannot be removed")
+			}
+
+			err = tx.Where("accountid = ? AND customerid = ?", accountID, customerID).Delete(&AccountOwner{}).Error
+			if err != nil {
+				return err
+			}
+			if err := checkMandate(tx, accountID, account.Mandate, account.RequiredSignatories); err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionDelete,
+				EntityType: "accountowner",
+				EntityID:   accountID.String() + "/" + customerID.String(),
+				Before:     owner,
+			})
+		})
+		if err != nil {
+			respondCustomerError(c, err, "Account owner not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account owner removed successfully", StatusCode: http.StatusOK})
+	}
+}
+
+// SetAccountMandateHandler records the account's mandate. It is validated
+// against the account's signatories but, like every mandate, not enforced
+// on postings.
+func SetAccountMandateHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			Mandate             string `json:"mandate"`
+			RequiredSignatories int    `json:"required_signatories"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if !validMandate(data.Mandate) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("mandate must be one of %s, %s or %s", MandateAny, MandateAll, MandateNOfM), StatusCode: http.StatusBadRequest})
+			return
+		}
+		if data.Mandate != MandateNOfM {
+			data.RequiredSignatories = 1
+		} else if data.RequiredSignatories < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "required_signatories must be at least 1", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var account Account
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", accountID).
+				First(&account).Error
+			if err != nil {
+				return err
+			}
+			if err := checkMandate(tx, accountID, data.Mandate, data.RequiredSignatories); err != nil {
+				return err
+			}
+
+			before := account
+			account.Mandate = data.Mandate
+			account.RequiredSignatories = data.RequiredSignatories
+			err = tx.Model(&Account{}).Where("accountid = ?", accountID).Updates(map[string]interface{}{
+				"mandate":             account.Mandate,
+				"requiredsignatories": account.RequiredSignatories,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "account",
+				EntityID:   accountID.String(),
+				Before:     before,
+				After:      account,
+			})
+		})
+		if err != nil {
+			respondCustomerError(c, err, "Account not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account mandate updated successfully", StatusCode: http.StatusOK,
+			Data: gin.H{"mandate": account.Mandate, "required_signatories": account.RequiredSignatories}})
+	}
+}
@@ -31,10 +31,11 @@ func ConnectDB() (*gorm.DB, error) {
 	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=Asia/Kolkata",
 		dbConfig.Host, dbConfig.User, dbConfig.Password, dbConfig.DBName, dbConfig.Port)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: newGormLogger()})
 	if err != nil {
 		return nil, err
 	}
+	withCommitHooks(db)
 	//Drop existing tables (if any)
   // db.Migrator().DropTable(&Account{}, &AccountType{}, &ChartOfAccount{}, &AccountBalance{}, &JournalEntry{})
 	// AutoMigrate will create the necessary tables based on the models
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// fakeDB stands in for postgres in tests. It records every statement gorm
+// sends, including BEGIN, COMMIT and ROLLBACK, and answers them from rules
+// that match on a substring of the SQL; the most recently added rule wins.
+// A query no rule matches returns no rows and a statement no rule matches
+// affects one row.
+type fakeDB struct {
+	mu         sync.Mutex
+	rules      []fakeRule
+	statements []fakeStatement
+}
+
+type fakeRule struct {
+	match   string
+	columns []string
+	rows    [][]driver.Value
+	// affected is what a matched statement reports, -1 for the default
+	affected int64
+	err      error
+}
+
+type fakeStatement struct {
+	Query string
+	Args  []interface{}
+}
+
+// newFakeDB opens a gorm connection on a fresh fakeDB, with commit hooks as
+// ConnectDB sets them up.
+func newFakeDB(t *testing.T) (*gorm.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sql.OpenDB(fake)}),
+		&gorm.Config{DisableAutomaticPing: true, Logger: gormlogger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCommitHooks(db)
+	return db, fake
+}
+
+// returns answers queries containing match with rows of columns.
+func (f *fakeDB) returns(match string, columns []string, rows ...[]driver.Value) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{match: match, columns: columns, rows: rows, affected: -1})
+}
+
+// affects makes statements containing match report n rows affected.
+func (f *fakeDB) affects(match string, n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{match: match, affected: n})
+}
+
+// fails makes statements containing match return err.
+func (f *fakeDB) fails(match string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rules = append(f.rules, fakeRule{match: match, affected: -1, err: err})
+}
+
+// sent returns the statements containing match, in the order they were sent.
+func (f *fakeDB) sent(match string) []fakeStatement {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var found []fakeStatement
+	for _, statement := range f.statements {
+		if strings.Contains(statement.Query, match) {
+			found = append(found, statement)
+		}
+	}
+	return found
+}
+
+// queries returns the SQL of every statement sent, in order.
+func (f *fakeDB) queries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	queries := make([]string, len(f.statements))
+	for i, statement := range f.statements {
+		queries[i] = statement.Query
+	}
+	return queries
+}
+
+func (f *fakeDB) record(query string, args []driver.NamedValue) (fakeRule, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.statements = append(f.statements, fakeStatement{Query: query, Args: values})
+	for i := len(f.rules) - 1; i >= 0; i-- {
+		if strings.Contains(query, f.rules[i].match) {
+			return f.rules[i], true
+		}
+	}
+	return fakeRule{}, false
+}
+
+func (f *fakeDB) Connect(context.Context) (driver.Conn, error) { return fakeConn{f}, nil }
+func (f *fakeDB) Driver() driver.Driver                        { return fakeDriver{f} }
+
+type fakeDriver struct{ db *fakeDB }
+
+func (d fakeDriver) Open(string) (driver.Conn, error) { return fakeConn{d.db}, nil }
+
+type fakeConn struct{ db *fakeDB }
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepare is not supported")
+}
+func (fakeConn) Close() error { return nil }
+
+func (c fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c fakeConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	c.db.record("BEGIN", nil)
+	return fakeTx{c.db}, nil
+}
+
+// CheckNamedValue passes every argument through as it is, so tests see
+// what gorm sent rather than its driver.Value.
+func (fakeConn) CheckNamedValue(*driver.NamedValue) error { return nil }
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	rule, ok := c.db.record(query, args)
+	if ok && rule.err != nil {
+		return nil, rule.err
+	}
+	if ok && rule.affected >= 0 {
+		return driver.RowsAffected(rule.affected), nil
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	rule, ok := c.db.record(query, args)
+	if ok && rule.err != nil {
+		return nil, rule.err
+	}
+	return &fakeRows{columns: rule.columns, rows: rule.rows}, nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error {
+	tx.db.record("COMMIT", nil)
+	return nil
+}
+
+func (tx fakeTx) Rollback() error {
+	tx.db.record("ROLLBACK", nil)
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
@@ -0,0 +1,724 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pdf/fpdf"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// Reports answer JSON unless ?format= or the Accept header asks for CSV,
+// XLSX or PDF. Every export goes through an exportWriter, so a report is
+// written a row at a time and the journal can be streamed straight from the
+// database.
+
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+	ExportFormatXLSX = "xlsx"
+	ExportFormatPDF  = "pdf"
+
+	defaultCompanyName = "Ledger"
+)
+
+var exportContentTypes = map[string]string{
+	ExportFormatJSON: "application/json",
+	ExportFormatCSV:  "text/csv",
+	ExportFormatXLSX: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	ExportFormatPDF:  "application/pdf",
+}
+
+// exportFormat returns the format asked for by ?format=, or failing that by
+// the Accept header. JSON is the default.
+func exportFormat(c *gin.Context) (string, error) {
+	if format := strings.ToLower(c.Query("format")); format != "" {
+		if _, ok := exportContentTypes[format]; !ok {
+			return "", fmt.Errorf("format must be one of json, csv, xlsx or pdf")
+		}
+		return format, nil
+	}
+	accepted := c.NegotiateFormat(exportContentTypes[ExportFormatJSON], exportContentTypes[ExportFormatCSV],
+		exportContentTypes[ExportFormatXLSX], exportContentTypes[ExportFormatPDF])
+	for format, contentType := range exportContentTypes {
+		if contentType == accepted {
+			return format, nil
+		}
+	}
+	return ExportFormatJSON, nil
+}
+
+// requestedExport reads the export format, answering 400 for an unknown
+// one; ok is false when that response has been written.
+func requestedExport(c *gin.Context) (format string, ok bool) {
+	format, err := exportFormat(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+		return "", false
+	}
+	return format, true
+}
+
+type ExportColumn struct {
+	Name    string
+	Numeric bool
+	// Width is the column's share of the page width in a PDF.
+	Width float64
+}
+
+// ExportHeader describes a report: its title, the date or range it covers
+// and its columns.
+type ExportHeader struct {
+	Name     string
+	Title    string
+	Subtitle string
+	Columns  []ExportColumn
+	// Landscape turns PDF pages for reports with many columns.
+	Landscape bool
+}
+
+// exportWriter writes a report one row at a time. Heading starts a section,
+// Total writes an emphasised totals row and Close finishes the document.
+type exportWriter interface {
+	Heading(text string) error
+	Row(values ...interface{}) error
+	Total(values ...interface{}) error
+	Close() error
+}
+
+func companyName() string {
+	if name := os.Getenv("COMPANY_NAME"); name != "" {
+		return name
+	}
+	return defaultCompanyName
+}
+
+// newExportWriter sets the download headers and returns a writer for format.
+func newExportWriter(c *gin.Context, format string, header ExportHeader) (exportWriter, error) {
+	filename := fmt.Sprintf("%s-%s.%s", header.Name, time.Now().Format("20060102"), format)
+	c.Header("Content-Type", exportContentTypes[format])
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Status(http.StatusOK)
+
+	switch format {
+	case ExportFormatCSV:
+		return newCSVExportWriter(c, header)
+	case ExportFormatXLSX:
+		return newXLSXExportWriter(c, header)
+	case ExportFormatPDF:
+		return newPDFExportWriter(c, header), nil
+	}
+	return nil, fmt.Errorf("unsupported export format %s", format)
+}
+
+// exportSection is a titled block of rows with an optional totals row.
+type exportSection struct {
+	Heading string
+	Rows    [][]interface{}
+	Total   []interface{}
+}
+
+// writeExport writes a report that has already been built in memory.
+func writeExport(c *gin.Context, format string, header ExportHeader, sections []exportSection, totals ...[]interface{}) {
+	writer, err := newExportWriter(c, format, header)
+	if err == nil {
+		err = func() error {
+			for _, section := range sections {
+				if section.Heading != "" {
+					if err := writer.Heading(section.Heading); err != nil {
+						return err
+					}
+				}
+				for _, row := range section.Rows {
+					if err := writer.Row(row...); err != nil {
+						return err
+					}
+				}
+				if section.Total != nil {
+					if err := writer.Total(section.Total...); err != nil {
+						return err
+					}
+				}
+			}
+			for _, total := range totals {
+				if err := writer.Total(total...); err != nil {
+					return err
+				}
+			}
+			return writer.Close()
+		}()
+	}
+	if err != nil {
+		c.Header("Content-Disposition", "")
+		c.Header("Content-Type", "")
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+	}
+}
+
+// exportText formats a cell for CSV and PDF. Times at midnight are dates.
+func exportText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		if v.Equal(utcDate(v)) {
+			return v.Format("2006-01-02")
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return exportText(*v)
+	case uuid.UUID:
+		return v.String()
+	case *uuid.UUID:
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func exportTexts(values []interface{}) []string {
+	texts := make([]string, len(values))
+	for i, value := range values {
+		texts[i] = exportText(value)
+	}
+	return texts
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func newCSVExportWriter(c *gin.Context, header ExportHeader) (*csvExportWriter, error) {
+	w := &csvExportWriter{writer: csv.NewWriter(c.Writer)}
+	names := make([]string, len(header.Columns))
+	for i, column := range header.Columns {
+		names[i] = column.Name
+	}
+	return w, w.writer.Write(names)
+}
+
+func (w *csvExportWriter) Heading(text string) error {
+	return w.writer.Write([]string{text})
+}
+
+func (w *csvExportWriter) Row(values ...interface{}) error {
+	return w.writer.Write(exportTexts(values))
+}
+
+func (w *csvExportWriter) Total(values ...interface{}) error {
+	return w.writer.Write(exportTexts(values))
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// xlsxExportWriter uses excelize's stream writer, which keeps only a window
+// of rows in memory and spills the rest to a temporary file.
+type xlsxExportWriter struct {
+	c       *gin.Context
+	file    *excelize.File
+	stream  *excelize.StreamWriter
+	columns []ExportColumn
+	row     int
+	styles  struct{ title, bold, number, boldNumber int }
+}
+
+func newXLSXExportWriter(c *gin.Context, header ExportHeader) (*xlsxExportWriter, error) {
+	file := excelize.NewFile()
+	sheet := header.Title
+	if len(sheet) > 31 {
+		sheet = sheet[:31]
+	}
+	if err := file.SetSheetName("Sheet1", sheet); err != nil {
+		return nil, err
+	}
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return nil, err
+	}
+	w := &xlsxExportWriter{c: c, file: file, stream: stream, columns: header.Columns}
+
+	styles := []struct {
+		id    *int
+		style excelize.Style
+	}{
+		{&w.styles.title, excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}}},
+		{&w.styles.bold, excelize.Style{Font: &excelize.Font{Bold: true}}},
+		{&w.styles.number, excelize.Style{NumFmt: 3}},
+		{&w.styles.boldNumber, excelize.Style{Font: &excelize.Font{Bold: true}, NumFmt: 3}},
+	}
+	for _, s := range styles {
+		if *s.id, err = file.NewStyle(&s.style); err != nil {
+			return nil, err
+		}
+	}
+	for i, column := range header.Columns {
+		width := 14.0
+		if column.Width > 0 {
+			width = max(10, column.Width*12)
+		}
+		if err := stream.SetColWidth(i+1, i+1, width); err != nil {
+			return nil, err
+		}
+	}
+
+	subtitle := companyName()
+	if header.Subtitle != "" {
+		subtitle += " - " + header.Subtitle
+	}
+	if err := w.write([]interface{}{excelize.Cell{StyleID: w.styles.title, Value: header.Title}}); err != nil {
+		return nil, err
+	}
+	if err := w.write([]interface{}{subtitle}); err != nil {
+		return nil, err
+	}
+	w.row++
+	names := make([]interface{}, len(header.Columns))
+	for i, column := range header.Columns {
+		names[i] = column.Name
+	}
+	return w, w.write(w.cells(names, true))
+}
+
+func (w *xlsxExportWriter) write(values []interface{}) error {
+	w.row++
+	cell, err := excelize.CoordinatesToCellName(1, w.row)
+	if err != nil {
+		return err
+	}
+	return w.stream.SetRow(cell, values)
+}
+
+// cells keeps numbers numeric so totals can be summed in the sheet.
+func (w *xlsxExportWriter) cells(values []interface{}, bold bool) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		style := 0
+		if bold {
+			style = w.styles.bold
+		}
+		if number, ok := value.(int); ok && i < len(w.columns) && w.columns[i].Numeric {
+			if bold {
+				style = w.styles.boldNumber
+			} else {
+				style = w.styles.number
+			}
+			cells[i] = excelize.Cell{StyleID: style, Value: number}
+			continue
+		}
+		cells[i] = excelize.Cell{StyleID: style, Value: exportText(value)}
+	}
+	return cells
+}
+
+func (w *xlsxExportWriter) Heading(text string) error {
+	return w.write([]interface{}{excelize.Cell{StyleID: w.styles.bold, Value: text}})
+}
+
+func (w *xlsxExportWriter) Row(values ...interface{}) error {
+	return w.write(w.cells(values, false))
+}
+
+func (w *xlsxExportWriter) Total(values ...interface{}) error {
+	return w.write(w.cells(values, true))
+}
+
+func (w *xlsxExportWriter) Close() error {
+	defer w.file.Close()
+	if err := w.stream.Flush(); err != nil {
+		return err
+	}
+	return w.file.Write(w.c.Writer)
+}
+
+// pdfExportWriter lays the report out as a table with the company name,
+// title and report date on every page. fpdf builds the document in memory,
+// compressed, and it is sent on Close.
+type pdfExportWriter struct {
+	c         *gin.Context
+	pdf       *fpdf.Fpdf
+	columns   []ExportColumn
+	widths    []float64
+	translate func(string) string
+}
+
+const pdfRowHeight = 6
+
+func newPDFExportWriter(c *gin.Context, header ExportHeader) *pdfExportWriter {
+	orientation := "P"
+	if header.Landscape {
+		orientation = "L"
+	}
+	pdf := fpdf.New(orientation, "mm", "A4", "")
+	w := &pdfExportWriter{c: c, pdf: pdf, columns: header.Columns, translate: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	share := 0.0
+	for _, column := range header.Columns {
+		share += max(column.Width, 0.1)
+	}
+	for _, column := range header.Columns {
+		w.widths = append(w.widths, (pageWidth-left-right)*max(column.Width, 0.1)/share)
+	}
+
+	generated := time.Now().Format("2006-01-02 15:04")
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(0, 8, w.translate(companyName()), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 12)
+		pdf.CellFormat(0, 7, w.translate(header.Title), "", 1, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(0, 5, w.translate(header.Subtitle), "", 0, "L", false, 0, "")
+		pdf.CellFormat(0, 5, "Generated "+generated, "", 1, "R", false, 0, "")
+		pdf.Ln(3)
+		pdf.SetFont("Helvetica", "B", 9)
+		pdf.SetFillColor(230, 230, 230)
+		for i, column := range w.columns {
+			pdf.CellFormat(w.widths[i], pdfRowHeight, w.translate(column.Name), "B", 0, w.align(i), true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 9)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-12)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+	pdf.AliasNbPages("")
+	pdf.AddPage()
+	return w
+}
+
+func (w *pdfExportWriter) align(column int) string {
+	if column < len(w.columns) && w.columns[column].Numeric {
+		return "R"
+	}
+	return "L"
+}
+
+// fit shortens text that would overflow its column.
+func (w *pdfExportWriter) fit(text string, width float64) string {
+	text = w.translate(text)
+	if w.pdf.GetStringWidth(text) <= width-2 {
+		return text
+	}
+	for len(text) > 0 && w.pdf.GetStringWidth(text+"...") > width-2 {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
+
+func (w *pdfExportWriter) line(values []interface{}, style string, border string) error {
+	w.pdf.SetFont("Helvetica", style, 9)
+	for i := range w.columns {
+		text := ""
+		if i < len(values) {
+			text = exportText(values[i])
+		}
+		w.pdf.CellFormat(w.widths[i], pdfRowHeight, w.fit(text, w.widths[i]), border, 0, w.align(i), false, 0, "")
+	}
+	w.pdf.Ln(-1)
+	w.pdf.SetFont("Helvetica", "", 9)
+	return w.pdf.Error()
+}
+
+func (w *pdfExportWriter) Heading(text string) error {
+	w.pdf.Ln(2)
+	w.pdf.SetFont("Helvetica", "B", 10)
+	w.pdf.CellFormat(0, pdfRowHeight+1, w.translate(text), "", 1, "L", false, 0, "")
+	w.pdf.SetFont("Helvetica", "", 9)
+	return w.pdf.Error()
+}
+
+func (w *pdfExportWriter) Row(values ...interface{}) error {
+	return w.line(values, "", "")
+}
+
+func (w *pdfExportWriter) Total(values ...interface{}) error {
+	return w.line(values, "B", "T")
+}
+
+func (w *pdfExportWriter) Close() error {
+	return w.pdf.Output(w.c.Writer)
+}
+
+func exportProfitAndLoss(c *gin.Context, format string, date *time.Time, data map[string]interface{}) {
+	subtitle := "All dates"
+	if date != nil {
+		subtitle = "For " + date.Format("2006-01-02")
+	}
+	header := ExportHeader{
+		Name:     "profit-and-loss",
+		Title:    "Profit and Loss",
+		Subtitle: subtitle,
+		Columns:  []ExportColumn{{Name: "Account", Width: 3}, {Name: "Amount", Numeric: true, Width: 1}},
+	}
+
+	totals := map[string]int{}
+	var sections []exportSection
+	for _, part := range []struct{ key, heading string }{{"incomes", "Incomes"}, {"expenses", "Expenses"}} {
+		section := exportSection{Heading: part.heading}
+		lines, _ := data[part.key].([]map[string]interface{})
+		for _, line := range lines {
+			balance, _ := line["balance"].(int)
+			section.Rows = append(section.Rows, []interface{}{line["account_name"], balance})
+			totals[part.key] += balance
+		}
+		section.Total = []interface{}{"Total " + strings.ToLower(part.heading), totals[part.key]}
+		sections = append(sections, section)
+	}
+
+	writeExport(c, format, header, sections, []interface{}{"Net profit", totals["incomes"] - totals["expenses"]})
+}
+
+func exportBalanceSheet(c *gin.Context, format string, data map[string]interface{}) {
+	header := ExportHeader{
+		Name:     "balance-sheet",
+		Title:    "Balance Sheet",
+		Subtitle: "As of " + time.Now().Format("2006-01-02"),
+		Columns: []ExportColumn{
+			{Name: "Account number", Width: 1},
+			{Name: "Account", Width: 3},
+			{Name: "Balance", Numeric: true, Width: 1},
+		},
+	}
+
+	var sections []exportSection
+	for _, part := range []struct{ key, heading string }{{"assets", "Assets"}, {"liabilities", "Liabilities"}, {"equity", "Equity"}} {
+		section := exportSection{Heading: part.heading}
+		total := 0
+		lines, _ := data[part.key].([]map[string]interface{})
+		for _, line := range lines {
+			balance, _ := line["balance"].(int)
+			section.Rows = append(section.Rows, []interface{}{line["account_number"], line["account_name"], balance})
+			total += balance
+			// drilled-down sub-ledger accounts are indented under their
+			// control account and already counted in its balance
+			subLedger, _ := line["accounts"].([]map[string]interface{})
+			for _, account := range subLedger {
+				section.Rows = append(section.Rows, []interface{}{account["account_number"], "    " + exportText(account["account_name"]), account["balance"]})
+			}
+		}
+		section.Total = []interface{}{"", "Total " + strings.ToLower(part.heading), total}
+		sections = append(sections, section)
+	}
+
+	writeExport(c, format, header, sections)
+}
+
+// streamJournalExport writes the entries matched by query as they are read
+// from the database, so an export of the whole journal holds one entry in
+// memory at a time.
+func streamJournalExport(c *gin.Context, format string, query *gorm.DB) {
+	subtitle := "All dates"
+	switch from, to := c.Query("from"), c.Query("to"); {
+	case from != "" && to != "":
+		subtitle = fmt.Sprintf("From %s to %s", from, to)
+	case from != "":
+		subtitle = "From " + from
+	case to != "":
+		subtitle = "Up to " + to
+	}
+	header := ExportHeader{
+		Name:     "journal",
+		Title:    "Journal",
+		Subtitle: subtitle,
+		Columns: []ExportColumn{
+			{Name: "Date", Width: 1.4},
+			{Name: "Transaction", Width: 2.6},
+			{Name: "Debit", Width: 0.8},
+			{Name: "Credit", Width: 0.8},
+			{Name: "Amount", Numeric: true, Width: 1},
+			{Name: "Description", Width: 3},
+			{Name: "Status", Width: 0.8},
+			{Name: "Type", Width: 0.9},
+			{Name: "Created by", Width: 1.2},
+		},
+		Landscape: true,
+	}
+
+	rows, err := query.Model(&JournalEntry{}).Order("date").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+		return
+	}
+	defer rows.Close()
+
+	err = func() error {
+		writer, err := newExportWriter(c, format, header)
+		if err != nil {
+			return err
+		}
+		count, total := 0, 0
+		for rows.Next() {
+			var entry JournalEntry
+			if err := query.ScanRows(rows, &entry); err != nil {
+				return err
+			}
+			err := writer.Row(entry.Date, entry.TransactionID, entry.AccountDebitNumber, entry.AccountCreditNumber,
+				entry.Amount, entry.Description, entry.Status, entry.TransactionType, entry.CreatedBy)
+			if err != nil {
+				return err
+			}
+			count++
+			total += entry.Amount
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if err := writer.Total(fmt.Sprintf("%d entries", count), "", "", "", total); err != nil {
+			return err
+		}
+		return writer.Close()
+	}()
+	if err == nil {
+		return
+	}
+	// a CSV export may already be partly sent; all that is left is to log
+	if c.Writer.Written() {
+		loggerFrom(c).Error("journal export failed", "error", err)
+		return
+	}
+	c.Header("Content-Disposition", "")
+	c.Header("Content-Type", "")
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+}
+
+func exportAccounts(c *gin.Context, format string, accounts []ListAccountResponse) {
+	header := ExportHeader{
+		Name:     "accounts",
+		Title:    "Accounts",
+		Subtitle: "As of " + time.Now().Format("2006-01-02"),
+		Columns: []ExportColumn{
+			{Name: "Account number", Width: 1},
+			{Name: "Name", Width: 2.5},
+			{Name: "Status", Width: 1},
+			{Name: "Ledger balance", Numeric: true, Width: 1},
+			{Name: "Held", Numeric: true, Width: 1},
+			{Name: "Available", Numeric: true, Width: 1},
+		},
+	}
+	section := exportSection{}
+	for _, account := range accounts {
+		section.Rows = append(section.Rows, []interface{}{account.AccountNumber, account.Name, account.Status,
+			account.LedgerBalance, account.Held, account.AvailableBalance})
+	}
+	writeExport(c, format, header, []exportSection{section})
+}
+
+func exportChartOfAccounts(c *gin.Context, format string, accounts []CharOfAccountResponse) {
+	header := ExportHeader{
+		Name:  "chart-of-accounts",
+		Title: "Chart of Accounts",
+		Columns: []ExportColumn{
+			{Name: "Account number", Width: 1},
+			{Name: "Name", Width: 3},
+			{Name: "Control account", Width: 1},
+			{Name: "Control balance", Numeric: true, Width: 1},
+		},
+	}
+	section := exportSection{}
+	for _, account := range accounts {
+		section.Rows = append(section.Rows, []interface{}{account.AccountNumber, account.Name, account.IsControl, account.ControlBalance})
+	}
+	writeExport(c, format, header, []exportSection{section})
+}
+
+func exportAccountTypes(c *gin.Context, format string, accountTypes []ListAccountTypeResponse) {
+	header := ExportHeader{
+		Name:  "account-types",
+		Title: "Account Types",
+		Columns: []ExportColumn{
+			{Name: "Name", Width: 1.5},
+			{Name: "Description", Width: 3},
+			{Name: "Start range", Width: 1},
+			{Name: "End range", Width: 1},
+		},
+	}
+	section := exportSection{}
+	for _, accountType := range accountTypes {
+		section.Rows = append(section.Rows, []interface{}{accountType.Name, accountType.Description, accountType.StartRange, accountType.EndRange})
+	}
+	writeExport(c, format, header, []exportSection{section})
+}
+
+func exportControlAccounts(c *gin.Context, format string, report *ControlAccountReport) {
+	header := ExportHeader{
+		Name:     "control-accounts",
+		Title:    "Control Accounts",
+		Subtitle: "Checked at " + report.CheckedAt.Format("2006-01-02 15:04:05"),
+		Columns: []ExportColumn{
+			{Name: "Account number", Width: 1},
+			{Name: "Name", Width: 2.2},
+			{Name: "Control balance", Numeric: true, Width: 1},
+			{Name: "Sub-ledger total", Numeric: true, Width: 1},
+			{Name: "Journal total", Numeric: true, Width: 1},
+			{Name: "Accounts", Numeric: true, Width: 0.8},
+			{Name: "Difference", Numeric: true, Width: 1},
+			{Name: "Balanced", Width: 0.8},
+		},
+		Landscape: true,
+	}
+	section := exportSection{}
+	for _, control := range report.Controls {
+		section.Rows = append(section.Rows, []interface{}{control.AccountNumber, control.Name, control.ControlBalance,
+			control.SubledgerTotal, control.JournalTotal, control.Accounts, control.Difference, control.Balanced})
+	}
+	writeExport(c, format, header, []exportSection{section})
+}
+
+func exportLoanSchedule(c *gin.Context, format string, accountNumber int, schedule LoanSchedule) {
+	header := ExportHeader{
+		Name:     "loan-schedule",
+		Title:    "Loan Schedule",
+		Subtitle: fmt.Sprintf("Loan account %d, principal %d", accountNumber, schedule.Loan.Principal),
+		Columns: []ExportColumn{
+			{Name: "Installment", Width: 0.9},
+			{Name: "Due date", Width: 1.2},
+			{Name: "Principal", Numeric: true, Width: 1},
+			{Name: "Interest", Numeric: true, Width: 1},
+			{Name: "Penalty", Numeric: true, Width: 1},
+			{Name: "Total due", Numeric: true, Width: 1},
+			{Name: "Paid", Numeric: true, Width: 1},
+			{Name: "Outstanding", Numeric: true, Width: 1},
+			{Name: "Status", Width: 1},
+		},
+		Landscape: true,
+	}
+	section := exportSection{}
+	for _, line := range schedule.Installments {
+		section.Rows = append(section.Rows, []interface{}{line.Number, line.DueDate, line.PrincipalDue, line.InterestDue,
+			line.PenaltyDue, line.TotalDue, line.TotalPaid, line.Outstanding, line.Status})
+	}
+	section.Total = []interface{}{"Total", "", "", "", "", schedule.TotalDue, schedule.TotalPaid, schedule.Outstanding,
+		fmt.Sprintf("%d overdue", schedule.Overdue)}
+	writeExport(c, format, header, []exportSection{section})
+}
@@ -0,0 +1,693 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultMaintenanceFeeInterval = time.Hour
+
+const activeWaiverCondition = "revokedat IS NULL AND (expiresat IS NULL OR expiresat > now())"
+
+var errWaiverNotActive = errors.New("Waiver is no longer active")
+
+// fee is the charge on a transaction amount, or on a balance for maintenance
+// charges. Percentage fees are kept within MinAmount and MaxAmount; a zero
+// MaxAmount leaves them uncapped.
+func (ch Charge) fee(base int) int {
+	switch ch.Method {
+	case ChargeMethodFlat:
+		return ch.Amount
+	case ChargeMethodPercentage:
+		fee := int(math.Round(float64(base) * float64(ch.RateBps) / 10000))
+		if fee < ch.MinAmount {
+			fee = ch.MinAmount
+		}
+		if ch.MaxAmount > 0 && fee > ch.MaxAmount {
+			fee = ch.MaxAmount
+		}
+		return fee
+	case ChargeMethodTiered:
+		fee := 0
+		for _, tier := range ch.Tiers {
+			if base >= tier.MinAmount {
+				fee = tier.Amount
+			}
+		}
+		return fee
+	}
+	return 0
+}
+
+func preloadChargeTiers(db *gorm.DB) *gorm.DB {
+	return db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("minamount")
+	})
+}
+
+// activeWaiver returns the waiver exempting the account from the charge, if
+// any.
+func activeWaiver(tx *gorm.DB, accountID, chargeID uuid.UUID) (*ChargeWaiver, error) {
+	var waiver ChargeWaiver
+	err := tx.Where("accountid = ? AND (chargeid IS NULL OR chargeid = ?) AND "+activeWaiverCondition, accountID, chargeID).
+		Order("createdat").
+		First(&waiver).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check fee waivers: %v", err)
+	}
+	return &waiver, nil
+}
+
+// takeCharge posts fee from the account to the charge's income account, or
+// records it as waived, and stores the application.
+func takeCharge(tx *gorm.DB, ch Charge, account Account, application *ChargeApplication, description string, actor AuditActor) error {
+	waiver, err := activeWaiver(tx, account.AccountID, ch.ChargeID)
+	if err != nil {
+		return err
+	}
+	if waiver != nil {
+		application.WaiverID = &waiver.WaiverID
+	} else {
+		entry := JournalEntry{
+			AccountDebitNumber:  account.AccountNumber,
+			AccountCreditNumber: ch.IncomeAccount,
+			Amount:              application.Amount,
+			Description:         description,
+			Date:                time.Now(),
+			TransactionType:     TransactionTypeFee,
+			CreatedBy:           actor.UserID,
+		}
+		if err := postJournalEntry(systemPosting(tx), &entry); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionPost,
+			EntityType: "journalentry",
+			EntityID:   entry.TransactionID.String(),
+			After:      entry,
+		}); err != nil {
+			return err
+		}
+		application.TransactionID = &entry.TransactionID
+	}
+	application.CreatedAt = time.Now()
+	return tx.Create(application).Error
+}
+
+// applyPostingCharges adds the fee lines for a journal entry that has just
+// been posted, in the same transaction, so the entry and its fees stand or
+// fall together. Fee entries never trigger charges themselves: takeCharge
+// posts them without calling it.
+func applyPostingCharges(tx *gorm.DB, entry *JournalEntry, actor AuditActor) ([]ChargeApplication, error) {
+	applications := []ChargeApplication{}
+
+	var charges []Charge
+	err := preloadChargeTiers(tx).
+		Where("trigger = ? AND active AND (transactiontype = '' OR transactiontype = ?)", ChargeTriggerPosting, entry.TransactionType).
+		Order("name").
+		Find(&charges).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load charges: %v", err)
+	}
+	if len(charges) == 0 {
+		return applications, nil
+	}
+
+	accounts := map[string]Account{}
+	for side, number := range map[string]int{"debit": entry.AccountDebitNumber, "credit": entry.AccountCreditNumber} {
+		var account Account
+		if err := tx.Where("accountnumber = ?", number).First(&account).Error; err != nil {
+			return nil, fmt.Errorf("failed to fetch %s account: %v", side, err)
+		}
+		accounts[side] = account
+	}
+
+	for _, ch := range charges {
+		account := accounts[ch.Side]
+		if ch.COAID != nil && *ch.COAID != account.COAID {
+			continue
+		}
+		amount := ch.fee(entry.Amount)
+		if amount <= 0 {
+			continue
+		}
+
+		application := ChargeApplication{
+			ChargeID:  ch.ChargeID,
+			AccountID: account.AccountID,
+			SourceID:  &entry.TransactionID,
+			Amount:    amount,
+		}
+		description := fmt.Sprintf("%s on %s", ch.Name, entry.TransactionID)
+		if err := takeCharge(tx, ch, account, &application, description, actor); err != nil {
+			return nil, err
+		}
+		applications = append(applications, application)
+	}
+	return applications, nil
+}
+
+// lastCompletedPeriod is the most recent monthly, quarterly or annual period
+// that ended before today.
+func lastCompletedPeriod(frequency string, now time.Time) (time.Time, time.Time) {
+	start, _ := settlementPeriod(frequency, utcDate(now))
+	return settlementPeriod(frequency, start.AddDate(0, 0, -1))
+}
+
+type MaintenanceFeeRun struct {
+	ChargeID  uuid.UUID        `json:"chargeid"`
+	Name      string           `json:"name"`
+	PeriodEnd time.Time        `json:"period_end"`
+	Charged   int              `json:"charged"`
+	Amount    int              `json:"amount"`
+	Waived    int              `json:"waived"`
+	Failures  []AccountFailure `json:"failures,omitempty"`
+}
+
+type MaintenanceFeeReport struct {
+	RunAt   time.Time           `json:"run_at"`
+	Charges []MaintenanceFeeRun `json:"charges"`
+	Charged int                 `json:"charged"`
+	Amount  int                 `json:"amount"`
+}
+
+// accounts that existed during the period, accept debits and have not been
+// charged for it yet
+const maintenanceCandidatesSQL = `
+SELECT a.* FROM account a
+WHERE a.coaid = ? AND a.createdat < ? AND a.status IN ('active', 'frozen_credit')
+  AND NOT EXISTS (SELECT 1 FROM chargeapplication ca
+      WHERE ca.chargeid = ? AND ca.accountid = a.accountid AND ca.periodend = ?)
+ORDER BY a.accountnumber`
+
+// chargeMaintenanceFees takes every active maintenance charge for its last
+// completed period, or for the period containing day when it is given.
+// Accounts already charged for the period are skipped, so the run can be
+// repeated; an account that cannot pay, e.g. for lack of funds, is reported
+// and tried again on the next run. Percentage and tiered charges use the
+// account's balance when the fee is taken.
+func chargeMaintenanceFees(db *gorm.DB, day *time.Time, actor AuditActor) (*MaintenanceFeeReport, error) {
+	var charges []Charge
+	err := preloadChargeTiers(db).Where("trigger = ? AND active", ChargeTriggerMaintenance).Order("name").Find(&charges).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load maintenance charges: %v", err)
+	}
+
+	now := time.Now()
+	report := &MaintenanceFeeReport{RunAt: now, Charges: []MaintenanceFeeRun{}}
+	for _, ch := range charges {
+		start, end := lastCompletedPeriod(ch.Frequency, now)
+		if day != nil {
+			start, end = settlementPeriod(ch.Frequency, *day)
+			if !end.Before(utcDate(now)) {
+				continue
+			}
+		}
+		run := MaintenanceFeeRun{ChargeID: ch.ChargeID, Name: ch.Name, PeriodEnd: end}
+
+		var accounts []Account
+		if err := db.Raw(maintenanceCandidatesSQL, ch.COAID, end.AddDate(0, 0, 1), ch.ChargeID, end).Scan(&accounts).Error; err != nil {
+			return nil, fmt.Errorf("failed to find accounts for %s: %v", ch.Name, err)
+		}
+
+		description := fmt.Sprintf("%s %s to %s", ch.Name, start.Format("2006-01-02"), end.Format("2006-01-02"))
+		for _, account := range accounts {
+			var application ChargeApplication
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var balance AccountBalance
+				err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("accountid = ?", account.AccountID).First(&balance).Error
+				if err != nil {
+					return err
+				}
+				var charged int64
+				err = tx.Model(&ChargeApplication{}).
+					Where("chargeid = ? AND accountid = ? AND periodend = ?", ch.ChargeID, account.AccountID, end).
+					Count(&charged).Error
+				if err != nil || charged > 0 {
+					return err
+				}
+
+				application = ChargeApplication{
+					ChargeID:  ch.ChargeID,
+					AccountID: account.AccountID,
+					PeriodEnd: &end,
+					Amount:    ch.fee(max(balance.Balance, 0)),
+				}
+				if application.Amount <= 0 {
+					return nil
+				}
+				return takeCharge(tx, ch, account, &application, description, actor)
+			})
+			switch {
+			case err != nil:
+				run.Failures = append(run.Failures, AccountFailure{AccountNumber: account.AccountNumber, Error: err.Error()})
+			case application.WaiverID != nil:
+				run.Waived++
+			case application.TransactionID != nil:
+				run.Charged++
+				run.Amount += application.Amount
+			}
+		}
+
+		report.Charged += run.Charged
+		report.Amount += run.Amount
+		report.Charges = append(report.Charges, run)
+	}
+	return report, nil
+}
+
+// runMaintenanceFees takes maintenance fees for each charge's last completed
+// period every interval until ctx is done.
+func runMaintenanceFees(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	actor := AuditActor{UserID: "system", Method: "JOB", Endpoint: "maintenance-fees"}
+	logger = logger.With("job", actor.Endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := chargeMaintenanceFees(db, nil, actor)
+			if err != nil {
+				logger.Error("maintenance fees failed", "error", err)
+				continue
+			}
+			if report.Charged > 0 {
+				logger.Info("maintenance fees charged", "accounts", report.Charged, "amount", report.Amount)
+			}
+		}
+	}
+}
+
+func MaintenanceFeeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var day *time.Time
+		if value := c.Query("date"); value != "" {
+			parsed, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid date format", StatusCode: http.StatusBadRequest})
+				return
+			}
+			day = &parsed
+		}
+
+		report, err := chargeMaintenanceFees(db, day, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: fmt.Sprintf("%d maintenance fees charged", report.Charged), StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+func CreateChargeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Name            string       `json:"name"`
+			Trigger         string       `json:"trigger"`
+			TransactionType string       `json:"transaction_type"`
+			COAID           string       `json:"coa_id"`
+			Side            string       `json:"side"`
+			Method          string       `json:"method"`
+			Amount          int          `json:"amount"`
+			RateBps         int          `json:"rate_bps"`
+			MinAmount       int          `json:"min_amount"`
+			MaxAmount       int          `json:"max_amount"`
+			Tiers           []ChargeTier `json:"tiers"`
+			Frequency       string       `json:"frequency"`
+			IncomeAccount   int          `json:"income_account"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var problems []string
+		if data.Name == "" {
+			problems = append(problems, "name is required")
+		}
+
+		var coaID *uuid.UUID
+		if data.COAID != "" {
+			parsed, err := uuid.Parse(data.COAID)
+			if err != nil {
+				problems = append(problems, "Invalid coa_id")
+			} else if _, err := ReturnAccount(db, parsed); err != nil {
+				problems = append(problems, "coa_id does not exist")
+			} else {
+				coaID = &parsed
+			}
+		}
+
+		switch data.Trigger {
+		case ChargeTriggerPosting:
+			if data.Side == "" {
+				data.Side = "debit"
+			}
+			if data.Side != "debit" && data.Side != "credit" {
+				problems = append(problems, "side must be debit or credit")
+			}
+			if data.TransactionType == "" && data.COAID == "" {
+				problems = append(problems, "a posting charge needs a transaction_type, a coa_id or both")
+			}
+			if data.TransactionType == TransactionTypeFee {
+				problems = append(problems, "fees cannot be charged on fees")
+			}
+			data.Frequency = ""
+		case ChargeTriggerMaintenance:
+			if data.Frequency == "" {
+				data.Frequency = SettlementMonthly
+			}
+			if !validSettlementFrequency(data.Frequency) {
+				problems = append(problems, fmt.Sprintf("frequency must be one of %s, %s or %s", SettlementMonthly, SettlementQuarterly, SettlementAnnually))
+			}
+			if data.COAID == "" {
+				problems = append(problems, "a maintenance charge needs a coa_id")
+			}
+			if data.TransactionType != "" || data.Side != "" {
+				problems = append(problems, "transaction_type and side only apply to posting charges")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("trigger must be %s or %s", ChargeTriggerPosting, ChargeTriggerMaintenance))
+		}
+
+		switch data.Method {
+		case ChargeMethodFlat:
+			if data.Amount <= 0 {
+				problems = append(problems, "a flat charge needs a positive amount")
+			}
+		case ChargeMethodPercentage:
+			if data.RateBps <= 0 {
+				problems = append(problems, "a percentage charge needs a positive rate_bps")
+			}
+			if data.MinAmount < 0 || data.MaxAmount < 0 {
+				problems = append(problems, "min_amount and max_amount cannot be negative")
+			} else if data.MaxAmount > 0 && data.MaxAmount < data.MinAmount {
+				problems = append(problems, "max_amount cannot be below min_amount")
+			}
+		case ChargeMethodTiered:
+			if len(data.Tiers) == 0 {
+				problems = append(problems, "a tiered charge needs at least one tier")
+			}
+			sort.Slice(data.Tiers, func(i, j int) bool { return data.Tiers[i].MinAmount < data.Tiers[j].MinAmount })
+			for i, tier := range data.Tiers {
+				if tier.MinAmount < 0 || tier.Amount < 0 {
+					problems = append(problems, "tier min_amount and amount cannot be negative")
+					break
+				}
+				if i > 0 && tier.MinAmount == data.Tiers[i-1].MinAmount {
+					problems = append(problems, fmt.Sprintf("more than one tier starts at %d", tier.MinAmount))
+					break
+				}
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("method must be one of %s, %s or %s", ChargeMethodFlat, ChargeMethodPercentage, ChargeMethodTiered))
+		}
+		if data.Method != ChargeMethodTiered {
+			data.Tiers = nil
+		}
+
+		if _, err := getAccountNumber(db, data.IncomeAccount); err != nil {
+			problems = append(problems, "Invalid income_account")
+		} else if err := checkNotControlAccount(db, data.IncomeAccount); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		charge := Charge{
+			Name:            data.Name,
+			Trigger:         data.Trigger,
+			TransactionType: data.TransactionType,
+			COAID:           coaID,
+			Side:            data.Side,
+			Method:          data.Method,
+			Amount:          data.Amount,
+			RateBps:         data.RateBps,
+			MinAmount:       data.MinAmount,
+			MaxAmount:       data.MaxAmount,
+			Tiers:           data.Tiers,
+			Frequency:       data.Frequency,
+			IncomeAccount:   data.IncomeAccount,
+			Active:          true,
+			CreatedBy:       c.GetString("userID"),
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&charge).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "charge",
+				EntityID:   charge.ChargeID.String(),
+				After:      charge,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Charge created successfully", StatusCode: http.StatusCreated, Data: charge})
+	}
+}
+
+func ListChargeHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := preloadChargeTiers(db).Order("name")
+		if trigger := c.Query("trigger"); trigger != "" {
+			query = query.Where("trigger = ?", trigger)
+		}
+
+		charges := []Charge{}
+		if err := query.Find(&charges).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Charge List", StatusCode: http.StatusOK, Data: charges})
+	}
+}
+
+// SetChargeActiveHandler switches a charge on or off. Charges are never
+// deleted so past applications keep their definition.
+func SetChargeActiveHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		chargeID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid charge ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		var data struct {
+			Active *bool `json:"active"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || data.Active == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var charge Charge
+			if err := tx.Where("chargeid = ?", chargeID).First(&charge).Error; err != nil {
+				return err
+			}
+			before := charge
+			charge.Active = *data.Active
+			if err := tx.Model(&Charge{}).Where("chargeid = ?", chargeID).Update("active", charge.Active).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "charge",
+				EntityID:   chargeID.String(),
+				Before:     before,
+				After:      charge,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Charge not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Charge updated successfully", StatusCode: http.StatusOK})
+	}
+}
+
+func CreateWaiverHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		var data struct {
+			ChargeID  string     `json:"charge_id"`
+			Reason    string     `json:"reason"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.Reason == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A waiver reason is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if data.ExpiresAt != nil && !data.ExpiresAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "expires_at must be in the future", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		waiver := ChargeWaiver{
+			AccountID: accountID,
+			Reason:    data.Reason,
+			ExpiresAt: data.ExpiresAt,
+			CreatedBy: c.GetString("userID"),
+		}
+		if data.ChargeID != "" {
+			chargeID, err := uuid.Parse(data.ChargeID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid charge_id", StatusCode: http.StatusBadRequest})
+				return
+			}
+			if err := db.Where("chargeid = ?", chargeID).First(&Charge{}).Error; err != nil {
+				respondNotFoundOr500(c, err, "Charge not found")
+				return
+			}
+			waiver.ChargeID = &chargeID
+		}
+		if err := db.Where("accountid = ?", accountID).First(&Account{}).Error; err != nil {
+			respondNotFoundOr500(c, err, "Account not found")
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&waiver).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "chargewaiver",
+				EntityID:   waiver.WaiverID.String(),
+				After:      waiver,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Waiver created successfully", StatusCode: http.StatusCreated, Data: waiver})
+	}
+}
+
+// ListWaiverHandler lists an account's active waivers, or every waiver with
+// ?all=true.
+func ListWaiverHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		query := db.Where("accountid = ?", accountID).Order("createdat DESC")
+		if c.Query("all") != "true" {
+			query = query.Where(activeWaiverCondition)
+		}
+		waivers := []ChargeWaiver{}
+		if err := query.Find(&waivers).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Waiver List", StatusCode: http.StatusOK, Data: waivers})
+	}
+}
+
+func RevokeWaiverHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		waiverID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid waiver ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var waiver ChargeWaiver
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("waiverid = ?", waiverID).First(&waiver).Error
+			if err != nil {
+				return err
+			}
+			if waiver.RevokedAt != nil || (waiver.ExpiresAt != nil && !waiver.ExpiresAt.After(time.Now())) {
+				return errWaiverNotActive
+			}
+
+			before := waiver
+			now := time.Now()
+			waiver.RevokedBy = c.GetString("userID")
+			waiver.RevokedAt = &now
+			err = tx.Model(&ChargeWaiver{}).Where("waiverid = ?", waiverID).Updates(map[string]interface{}{
+				"revokedby": waiver.RevokedBy,
+				"revokedat": waiver.RevokedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionRelease,
+				EntityType: "chargewaiver",
+				EntityID:   waiverID.String(),
+				Before:     before,
+				After:      waiver,
+			})
+		})
+		if errors.Is(err, errWaiverNotActive) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			return
+		}
+		if err != nil {
+			respondNotFoundOr500(c, err, "Waiver not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Waiver revoked successfully", StatusCode: http.StatusOK})
+	}
+}
+
+// ListAccountFeesHandler lists the fees taken from, or waived for, an
+// account, newest first.
+func ListAccountFeesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		applications := []ChargeApplication{}
+		if err := db.Where("accountid = ?", accountID).Order("createdat DESC").Find(&applications).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account Fee List", StatusCode: http.StatusOK, Data: applications})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChargeFee(t *testing.T) {
+	percentage := Charge{Method: ChargeMethodPercentage, RateBps: 150, MinAmount: 50, MaxAmount: 500}
+	tiered := Charge{Method: ChargeMethodTiered, Tiers: []ChargeTier{{MinAmount: 0, Amount: 10}, {MinAmount: 1000, Amount: 25}, {MinAmount: 10000, Amount: 60}}}
+
+	for _, tc := range []struct {
+		name   string
+		charge Charge
+		base   int
+		want   int
+	}{
+		{"flat ignores the base", Charge{Method: ChargeMethodFlat, Amount: 75}, 123456, 75},
+		{"percentage", percentage, 10000, 150},
+		{"percentage rounds to the nearest unit", percentage, 10033, 150},
+		{"percentage below the minimum", percentage, 1000, 50},
+		{"percentage above the maximum", percentage, 100000, 500},
+		{"percentage without a maximum", Charge{Method: ChargeMethodPercentage, RateBps: 150}, 100000, 1500},
+		{"lowest tier", tiered, 999, 10},
+		{"tier boundary", tiered, 1000, 25},
+		{"highest tier", tiered, 50000, 60},
+		{"below every tier", Charge{Method: ChargeMethodTiered, Tiers: []ChargeTier{{MinAmount: 500, Amount: 10}}}, 100, 0},
+		{"unknown method", Charge{Method: "other", Amount: 75}, 1000, 0},
+	} {
+		if got := tc.charge.fee(tc.base); got != tc.want {
+			t.Errorf("%s: fee(%d) = %d, want %d", tc.name, tc.base, got, tc.want)
+		}
+	}
+}
+
+func TestLastCompletedPeriod(t *testing.T) {
+	for _, tc := range []struct {
+		frequency  string
+		now        time.Time
+		start, end time.Time
+	}{
+		{SettlementMonthly, time.Date(2024, 3, 1, 0, 5, 0, 0, time.UTC), date(2024, 2, 1), date(2024, 2, 29)},
+		{SettlementMonthly, time.Date(2024, 3, 31, 23, 0, 0, 0, time.UTC), date(2024, 2, 1), date(2024, 2, 29)},
+		{SettlementMonthly, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC), date(2023, 12, 1), date(2023, 12, 31)},
+		{SettlementQuarterly, time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC), date(2024, 1, 1), date(2024, 3, 31)},
+		{SettlementAnnually, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), date(2023, 1, 1), date(2023, 12, 31)},
+	} {
+		start, end := lastCompletedPeriod(tc.frequency, tc.now)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s before %s: got %s to %s, want %s to %s", tc.frequency, tc.now.Format(time.RFC3339),
+				start.Format("2006-01-02"), end.Format("2006-01-02"), tc.start.Format("2006-01-02"), tc.end.Format("2006-01-02"))
+		}
+	}
+}
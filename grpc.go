@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"ledger_api/ledgerpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+//go:generate buf generate proto
+
+// The gRPC API serves the same operations as the REST routes of the same
+// name, authenticated by the same bearer tokens and guarded by the same
+// permissions. Both call into the shared functions in handler.go, so a
+// change to the business rules applies to both.
+
+const defaultGRPCAddr = ":9090"
+
+// grpcPermissions is the permission each method needs, matching the REST
+// route it mirrors. Methods missing from the map are refused.
+var grpcPermissions = map[string]Permission{
+	ledgerpb.LedgerService_CreateAccountType_FullMethodName:    PermChartWrite,
+	ledgerpb.LedgerService_ListAccountTypes_FullMethodName:     PermLedgerRead,
+	ledgerpb.LedgerService_CreateChartOfAccount_FullMethodName: PermChartWrite,
+	ledgerpb.LedgerService_ListChartOfAccounts_FullMethodName:  PermLedgerRead,
+	ledgerpb.LedgerService_CreateAccount_FullMethodName:        PermAccountWrite,
+	ledgerpb.LedgerService_ListAccounts_FullMethodName:         PermLedgerRead,
+	ledgerpb.LedgerService_PostJournalEntry_FullMethodName:     PermJournalPost,
+	ledgerpb.LedgerService_ListJournalEntries_FullMethodName:   PermLedgerRead,
+	ledgerpb.LedgerService_ExportJournal_FullMethodName:        PermLedgerRead,
+	ledgerpb.LedgerService_GetProfitAndLoss_FullMethodName:     PermLedgerRead,
+	ledgerpb.LedgerService_GetBalanceSheet_FullMethodName:      PermLedgerRead,
+}
+
+type grpcCallerKey struct{}
+
+// grpcCaller is the authenticated caller of an RPC, the gRPC counterpart
+// of what JWTAuthMiddleware stores on the gin context.
+type grpcCaller struct {
+	*AuthResult
+	Method    string
+	RequestID string
+}
+
+func (caller *grpcCaller) actor() AuditActor {
+	return AuditActor{
+		UserID:    caller.UserID,
+		Method:    "GRPC",
+		Endpoint:  caller.Method,
+		RequestID: caller.RequestID,
+	}
+}
+
+func callerFrom(ctx context.Context) *grpcCaller {
+	caller, _ := ctx.Value(grpcCallerKey{}).(*grpcCaller)
+	return caller
+}
+
+func newGRPCServer(db *gorm.DB, auth *Authenticator, logger *slog.Logger) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			start := time.Now()
+			ctx = rpcRequestContext(ctx)
+			defer func() { logRPC(ctx, logger, info.FullMethod, start, err) }()
+
+			authenticated, err := authenticateRPC(ctx, auth, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			ctx = authenticated
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			start := time.Now()
+			ctx := rpcRequestContext(stream.Context())
+			defer func() { logRPC(ctx, logger, info.FullMethod, start, err) }()
+
+			authenticated, err := authenticateRPC(ctx, auth, info.FullMethod)
+			if err != nil {
+				return err
+			}
+			ctx = authenticated
+			return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+		}),
+	)
+	ledgerpb.RegisterLedgerServiceServer(server, &ledgerServer{db: db})
+	reflection.Register(server)
+	return server
+}
+
+// authenticateRPC checks the bearer token in the authorization metadata
+// and the permission the method needs, and returns a context carrying the
+// caller. Server reflection only describes the API, so it is left open
+// like the REST probes.
+func authenticateRPC(ctx context.Context, auth *Authenticator, method string) (context.Context, error) {
+	if strings.HasPrefix(method, "/grpc.reflection.") {
+		return ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || values[0] == "" {
+		return nil, status.Error(codes.Unauthenticated, "No token provided")
+	}
+	if !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "Token format is invalid")
+	}
+
+	result, err := auth.Authenticate(ctx, values[0][len("Bearer "):])
+	if err != nil {
+		var tokenErr *authError
+		if errors.As(err, &tokenErr) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, errAuthUnavailable) {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	permission, ok := grpcPermissions[method]
+	if !ok || !grants(result.Roles, result.Scopes, permission) {
+		return nil, status.Error(codes.PermissionDenied, "Insufficient permissions")
+	}
+
+	caller := &grpcCaller{AuthResult: result, Method: method, RequestID: requestIDFrom(ctx)}
+	return context.WithValue(ctx, grpcCallerKey{}, caller), nil
+}
+
+// rpcRequestContext gives an RPC a request ID, taken from x-request-id
+// metadata like the REST header, and returns it in the response headers.
+func rpcRequestContext(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var header string
+	if ids := md.Get("x-request-id"); len(ids) > 0 {
+		header = ids[0]
+	}
+	id := newRequestID(header)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	return withRequestID(ctx, id)
+}
+
+// logRPC writes the access line for an RPC, levelled as RequestIDMiddleware
+// levels HTTP statuses.
+func logRPC(ctx context.Context, logger *slog.Logger, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	var userID string
+	if caller := callerFrom(ctx); caller != nil {
+		userID = caller.UserID
+	}
+	logger.Log(ctx, level, "rpc",
+		"request_id", requestIDFrom(ctx),
+		"method", method,
+		"code", code.String(),
+		"duration_ms", time.Since(start).Milliseconds(),
+		"user_id", userID,
+	)
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// grpcError maps an error from the shared ledger logic to a status, along
+// the same lines the REST handlers map it to an HTTP status.
+func grpcError(err error) error {
+	var invalid errInvalidRequest
+	var overLimit *PostingLimitError
+	var ownership errOwnership
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.As(err, &overLimit):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case isPostingRefusal(err), errors.Is(err, errCustomerKYC), errors.As(err, &ownership):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errCustomerNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
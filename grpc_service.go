@@ -0,0 +1,346 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"ledger_api/ledgerpb"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// ledgerServer implements ledgerpb.LedgerServiceServer. Every method runs
+// behind authenticateRPC, so the caller is always in the context.
+type ledgerServer struct {
+	ledgerpb.UnimplementedLedgerServiceServer
+	db *gorm.DB
+}
+
+func (s *ledgerServer) CreateAccountType(ctx context.Context, req *ledgerpb.CreateAccountTypeRequest) (*ledgerpb.AccountType, error) {
+	accountType, err := createAccountType(s.db.WithContext(ctx), AccountTypeInput{
+		Name:        req.GetName(),
+		Description: req.GetDescription(),
+		StartRange:  int(req.GetStartRange()),
+		EndRange:    int(req.GetEndRange()),
+	}, callerFrom(ctx).actor())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &ledgerpb.AccountType{
+		Id:          accountType.AccountID.String(),
+		Name:        accountType.Name,
+		Description: accountType.Description,
+		StartRange:  int64(accountType.StartRange),
+		EndRange:    int64(accountType.EndRange),
+	}, nil
+}
+
+func (s *ledgerServer) ListAccountTypes(ctx context.Context, req *ledgerpb.ListAccountTypesRequest) (*ledgerpb.ListAccountTypesResponse, error) {
+	accountTypes, err := listAccountTypes(s.db.WithContext(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &ledgerpb.ListAccountTypesResponse{}
+	for _, accountType := range accountTypes {
+		response.AccountTypes = append(response.AccountTypes, &ledgerpb.AccountType{
+			Id:          accountType.AccountID.String(),
+			Name:        accountType.Name,
+			Description: accountType.Description,
+			StartRange:  int64(accountType.StartRange),
+			EndRange:    int64(accountType.EndRange),
+		})
+	}
+	return response, nil
+}
+
+func (s *ledgerServer) CreateChartOfAccount(ctx context.Context, req *ledgerpb.CreateChartOfAccountRequest) (*ledgerpb.ChartOfAccount, error) {
+	coa, err := createChartOfAccount(s.db.WithContext(ctx), ChartOfAccountInput{
+		AccountTypeID:  req.GetAccountTypeId(),
+		AccountNumber:  int(req.GetAccountNumber()),
+		Name:           req.GetName(),
+		BalanceRule:    req.GetBalanceRule(),
+		OverdraftLimit: int(req.GetOverdraftLimit()),
+	}, callerFrom(ctx).actor())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return chartOfAccountMessage(CharOfAccountResponse{
+		AccountID:      coa.AccountID,
+		Name:           coa.Name,
+		AccountNumber:  coa.AccountNumber,
+		IsControl:      coa.IsControl,
+		ControlBalance: coa.ControlBalance,
+		InterestPlanID: coa.InterestPlanID,
+	}), nil
+}
+
+func (s *ledgerServer) ListChartOfAccounts(ctx context.Context, req *ledgerpb.ListChartOfAccountsRequest) (*ledgerpb.ListChartOfAccountsResponse, error) {
+	accounts, err := listChartOfAccounts(s.db.WithContext(ctx))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &ledgerpb.ListChartOfAccountsResponse{}
+	for _, account := range accounts {
+		response.ChartOfAccounts = append(response.ChartOfAccounts, chartOfAccountMessage(account))
+	}
+	return response, nil
+}
+
+func chartOfAccountMessage(account CharOfAccountResponse) *ledgerpb.ChartOfAccount {
+	message := &ledgerpb.ChartOfAccount{
+		Id:             account.AccountID.String(),
+		Name:           account.Name,
+		AccountNumber:  int64(account.AccountNumber),
+		IsControl:      account.IsControl,
+		ControlBalance: int64(account.ControlBalance),
+	}
+	if account.InterestPlanID != nil {
+		message.InterestPlanId = account.InterestPlanID.String()
+	}
+	return message
+}
+
+func (s *ledgerServer) CreateAccount(ctx context.Context, req *ledgerpb.CreateAccountRequest) (*ledgerpb.Account, error) {
+	account, err := createAccount(s.db.WithContext(ctx), AccountInput{
+		COAID:          req.GetCoaId(),
+		Name:           req.GetName(),
+		BalanceRule:    req.GetBalanceRule(),
+		OverdraftLimit: int(req.GetOverdraftLimit()),
+		Status:         req.GetStatus(),
+		OwnerID:        req.GetOwnerId(),
+	}, callerFrom(ctx).actor())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	// a new account has nothing posted or held yet
+	return accountMessage(ListAccountResponse{
+		AccountID:      account.AccountID,
+		Name:           account.Name,
+		AccountNumber:  account.AccountNumber,
+		BalanceRule:    account.BalanceRule,
+		OverdraftLimit: account.OverdraftLimit,
+		Status:         account.Status,
+	}), nil
+}
+
+func (s *ledgerServer) ListAccounts(ctx context.Context, req *ledgerpb.ListAccountsRequest) (*ledgerpb.ListAccountsResponse, error) {
+	var customerID *uuid.UUID
+	if req.GetCustomerId() != "" {
+		parsed, err := uuid.Parse(req.GetCustomerId())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid customer_id")
+		}
+		customerID = &parsed
+	}
+	accounts, err := listAccounts(s.db.WithContext(ctx), customerID)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	response := &ledgerpb.ListAccountsResponse{}
+	for _, account := range accounts {
+		response.Accounts = append(response.Accounts, accountMessage(account))
+	}
+	return response, nil
+}
+
+func accountMessage(account ListAccountResponse) *ledgerpb.Account {
+	return &ledgerpb.Account{
+		Id:               account.AccountID.String(),
+		Name:             account.Name,
+		AccountNumber:    int64(account.AccountNumber),
+		BalanceRule:      account.BalanceRule,
+		OverdraftLimit:   int64(account.OverdraftLimit),
+		Status:           account.Status,
+		LedgerBalance:    int64(account.LedgerBalance),
+		Held:             int64(account.Held),
+		AvailableBalance: int64(account.AvailableBalance),
+	}
+}
+
+func (s *ledgerServer) PostJournalEntry(ctx context.Context, req *ledgerpb.PostJournalEntryRequest) (*ledgerpb.PostJournalEntryResponse, error) {
+	caller := callerFrom(ctx)
+	submission, err := submitJournalEntry(s.db.WithContext(ctx), JournalEntryInput{
+		DebitAccount:    int(req.GetDebitAccount()),
+		CreditAccount:   int(req.GetCreditAccount()),
+		Amount:          int(req.GetAmount()),
+		Description:     req.GetDescription(),
+		TransactionType: req.GetTransactionType(),
+	}, caller.Roles, caller.actor())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	response := &ledgerpb.PostJournalEntryResponse{
+		TransactionId: submission.Entry.TransactionID.String(),
+		Pending:       submission.Pending,
+	}
+	for _, fee := range submission.Fees {
+		response.Fees = append(response.Fees, &ledgerpb.Fee{
+			ApplicationId: fee.ApplicationID.String(),
+			ChargeId:      fee.ChargeID.String(),
+			AccountId:     fee.AccountID.String(),
+			Amount:        int64(fee.Amount),
+			TransactionId: optionalUUID(fee.TransactionID),
+			WaiverId:      optionalUUID(fee.WaiverID),
+		})
+	}
+	return response, nil
+}
+
+func (s *ledgerServer) ListJournalEntries(ctx context.Context, req *ledgerpb.JournalFilter) (*ledgerpb.ListJournalEntriesResponse, error) {
+	query, err := journalFilterQuery(req).apply(s.db.WithContext(ctx))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var entries []JournalEntry
+	if err := query.Find(&entries).Error; err != nil {
+		return nil, grpcError(err)
+	}
+	response := &ledgerpb.ListJournalEntriesResponse{}
+	for _, entry := range entries {
+		response.Entries = append(response.Entries, journalEntryMessage(entry))
+	}
+	return response, nil
+}
+
+// ExportJournal sends the matching entries one at a time as they are read,
+// like the streamed CSV export of GET /journalentry.
+func (s *ledgerServer) ExportJournal(req *ledgerpb.JournalFilter, stream ledgerpb.LedgerService_ExportJournalServer) error {
+	query, err := journalFilterQuery(req).apply(s.db.WithContext(stream.Context()))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	rows, err := query.Model(&JournalEntry{}).Order("date").Rows()
+	if err != nil {
+		return grpcError(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry JournalEntry
+		if err := query.ScanRows(rows, &entry); err != nil {
+			return grpcError(err)
+		}
+		if err := stream.Send(journalEntryMessage(entry)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return grpcError(err)
+	}
+	return nil
+}
+
+func journalFilterQuery(req *ledgerpb.JournalFilter) JournalQuery {
+	query := JournalQuery{
+		Status:    req.GetStatus(),
+		CreatedBy: req.GetCreatedBy(),
+		Batch:     req.GetBatchId(),
+		From:      req.GetFrom(),
+		To:        req.GetTo(),
+	}
+	if req.GetAccount() != 0 {
+		query.Account = strconv.FormatInt(req.GetAccount(), 10)
+	}
+	return query
+}
+
+func journalEntryMessage(entry JournalEntry) *ledgerpb.JournalEntry {
+	response := journalEntryResponse(entry)
+	message := &ledgerpb.JournalEntry{
+		TransactionId:   response.TransactionID.String(),
+		DebitAccount:    int64(response.AccountDebitNumber),
+		CreditAccount:   int64(response.AccountCreditNumber),
+		Date:            timestamppb.New(response.Date),
+		Amount:          int64(response.Amount),
+		Description:     response.Description,
+		Status:          response.Status,
+		CreatedBy:       response.CreatedBy,
+		ReviewedBy:      response.ReviewedBy,
+		RejectionReason: response.RejectionReason,
+		ReversalOf:      optionalUUID(response.ReversalOf),
+		TransactionType: response.TransactionType,
+		BatchId:         optionalUUID(response.BatchID),
+	}
+	if response.ReviewedAt != nil {
+		message.ReviewedAt = timestamppb.New(*response.ReviewedAt)
+	}
+	return message
+}
+
+func optionalUUID(id *uuid.UUID) string {
+	if id == nil {
+		return ""
+	}
+	return id.String()
+}
+
+func (s *ledgerServer) GetProfitAndLoss(ctx context.Context, req *ledgerpb.ProfitAndLossRequest) (*ledgerpb.ProfitAndLoss, error) {
+	var date *time.Time
+	if req.GetDate() != "" {
+		parsedDate, err := time.Parse("2006-01-02", req.GetDate())
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "Invalid date format")
+		}
+		date = &parsedDate
+	}
+	data, err := profitAndLost(s.db.WithContext(ctx), date)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	totalIncomes, _ := data["total_incomes"].(int)
+	totalExpenses, _ := data["total_expenses"].(int)
+	return &ledgerpb.ProfitAndLoss{
+		Incomes:       reportLines(data["incomes"]),
+		Expenses:      reportLines(data["expenses"]),
+		TotalIncomes:  int64(totalIncomes),
+		TotalExpenses: int64(totalExpenses),
+	}, nil
+}
+
+func (s *ledgerServer) GetBalanceSheet(ctx context.Context, req *ledgerpb.BalanceSheetRequest) (*ledgerpb.BalanceSheet, error) {
+	drilldown, err := parseDrilldown(req.GetDrilldown())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	data, err := balanceSheet(s.db.WithContext(ctx), drilldown)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &ledgerpb.BalanceSheet{
+		Assets:      reportLines(data["assets"]),
+		Liabilities: reportLines(data["liabilities"]),
+		Equity:      reportLines(data["equity"]),
+	}, nil
+}
+
+// reportLines converts the account lines of profitAndLost and balanceSheet,
+// including a control account's drilled-down sub-ledger.
+func reportLines(value interface{}) []*ledgerpb.ReportLine {
+	lines, _ := value.([]map[string]interface{})
+	messages := make([]*ledgerpb.ReportLine, 0, len(lines))
+	for _, line := range lines {
+		message := &ledgerpb.ReportLine{}
+		message.AccountName, _ = line["account_name"].(string)
+		message.ControlAccount, _ = line["control_account"].(bool)
+		if number, ok := line["account_number"].(int); ok {
+			message.AccountNumber = int64(number)
+		}
+		if balance, ok := line["balance"].(int); ok {
+			message.Balance = int64(balance)
+		}
+		if size, ok := line["sub_ledger_size"].(int); ok {
+			message.SubLedgerSize = int64(size)
+		}
+		if accounts, ok := line["accounts"]; ok {
+			message.Accounts = reportLines(accounts)
+		}
+		messages = append(messages, message)
+	}
+	return messages
+}
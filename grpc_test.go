@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"ledger_api/ledgerpb"
+)
+
+// testGRPCClient serves newGRPCServer over an in-memory listener and
+// returns a client connected to it.
+func testGRPCClient(t *testing.T, fake func(*fakeDB)) ledgerpb.LedgerServiceClient {
+	t.Helper()
+	db, scripted := newFakeDB(t)
+	fake(scripted)
+	auth, err := NewAuthenticator(&AuthConfig{Mode: AuthModeLocal, Secret: []byte("test-secret"), UserClaim: "user_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	server := newGRPCServer(db, auth, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ledgerpb.NewLedgerServiceClient(conn)
+}
+
+func testToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	claims["sub"] = "user-1"
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestGRPCPostJournalEntryRefusals(t *testing.T) {
+	t.Setenv("TELLER_POSTING_LIMIT", "5000")
+
+	teller := testToken(t, jwt.MapClaims{"roles": []string{RoleTeller}})
+	for _, tc := range []struct {
+		name          string
+		authorization string
+		status        string
+		amount        int64
+		want          codes.Code
+		// set when the refusal must come from the posting limit rather
+		// than the interceptor
+		message string
+	}{
+		{name: "no token", amount: 100, want: codes.Unauthenticated},
+		{name: "not a bearer token", authorization: teller, amount: 100, want: codes.Unauthenticated},
+		{name: "token with a bad signature", authorization: "Bearer " + teller[:len(teller)-4] + "AAAA", amount: 100, want: codes.Unauthenticated},
+		{name: "role that cannot post", authorization: "Bearer " + testToken(t, jwt.MapClaims{"roles": []string{RoleViewer}}),
+			amount: 100, want: codes.PermissionDenied},
+		{name: "teller over the posting limit", authorization: "Bearer " + teller, amount: 5001, want: codes.PermissionDenied,
+			message: "posting limit of 5000"},
+		{name: "scope-only token over the posting limit", authorization: "Bearer " + testToken(t, jwt.MapClaims{"scope": "journal:post"}),
+			amount: 5001, want: codes.PermissionDenied, message: "posting limit of 5000"},
+		{name: "frozen account", authorization: "Bearer " + teller, status: AccountStatusFrozen, amount: 100, want: codes.FailedPrecondition},
+		{name: "amount that is not positive", authorization: "Bearer " + teller, amount: -5, want: codes.InvalidArgument},
+	} {
+		accountStatus := tc.status
+		if accountStatus == "" {
+			accountStatus = AccountStatusActive
+		}
+		var sent *fakeDB
+		client := testGRPCClient(t, func(fake *fakeDB) {
+			sent = fake
+			fake.returns(`FROM "chartofaccount"`, []string{"count"}, []driver.Value{int64(0)})
+			fake.returns(`FROM "account"`, []string{"accountid", "accountnumber", "status"},
+				[]driver.Value{"00000000-0000-0000-0000-0000000000a1", int64(1001), accountStatus})
+		})
+
+		ctx := context.Background()
+		if tc.authorization != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", tc.authorization)
+		}
+		_, err := client.PostJournalEntry(ctx, &ledgerpb.PostJournalEntryRequest{DebitAccount: 1001, CreditAccount: 2001, Amount: tc.amount})
+		if got := status.Code(err); got != tc.want || !strings.Contains(status.Convert(err).Message(), tc.message) {
+			t.Errorf("%s: got %v (%v), want %v %s", tc.name, got, err, tc.want, tc.message)
+		}
+		for _, query := range sent.queries() {
+			if strings.HasPrefix(query, "INSERT") || strings.HasPrefix(query, "UPDATE") {
+				t.Errorf("%s: refused call still wrote %s", tc.name, query)
+			}
+		}
+	}
+}
@@ -6,57 +6,136 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"net/http"
+	"strconv"
 	"time"
 )
 
-func CreateAccountHandler(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var data struct {
-			AccountID string `json:"coa_id"`
-			Name      string `json:"name"`
-		}
-		err := c.ShouldBindJSON(&data)
+// AccountInput is a new account as both the REST and gRPC APIs take it.
+type AccountInput struct {
+	COAID          string
+	Name           string
+	BalanceRule    string
+	OverdraftLimit int
+	Status         string
+	OwnerID        string
+}
+
+// createAccount opens an account under a chart of account with a zero
+// balance and, when OwnerID is set, its primary owner.
+func createAccount(db *gorm.DB, input AccountInput, actor AuditActor) (Account, error) {
+	accountID, err := uuid.Parse(input.COAID)
+	if err != nil {
+		return Account{}, errInvalidRequest("Invalid coa_id")
+	}
+	rule := balanceRuleRequest{BalanceRule: input.BalanceRule, OverdraftLimit: input.OverdraftLimit}
+	if err := rule.validate(true); err != nil {
+		return Account{}, errInvalidRequest(err.Error())
+	}
+	if input.Status != "" && input.Status != AccountStatusPending && input.Status != AccountStatusActive {
+		return Account{}, errInvalidRequest("New accounts must be pending or active")
+	}
+	var ownerID uuid.UUID
+	if input.OwnerID != "" {
+		ownerID, err = uuid.Parse(input.OwnerID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
-			return
+			return Account{}, errInvalidRequest("Invalid owner_id")
 		}
-		accountID, err := uuid.Parse(data.AccountID)
+	}
+	if AccountExists(db, input.Name) {
+		return Account{}, errInvalidRequest(fmt.Sprintf("Account with name=%s already exists", input.Name))
+	}
+	account, err := ReturnAccount(db, accountID)
+	if err != nil {
+		return Account{}, errInvalidRequest(fmt.Sprintf("Account with chart_of_account=%s does not exist", input.COAID))
+	}
+	accountNumber, err := generateAccountNumber(db, account)
+	if err != nil {
+		return Account{}, err
+	}
+	newAccount := Account{
+		COAID:          account.AccountID,
+		Name:           input.Name,
+		AccountNumber:  accountNumber,
+		BalanceRule:    input.BalanceRule,
+		OverdraftLimit: input.OverdraftLimit,
+		Status:         input.Status,
+		CreatedBy:      actor.UserID,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Omit(clause.Associations).Create(&newAccount).Error
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coa_id"})
-			return
+			return err
 		}
-		if AccountExists(db, data.Name) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Account with name=%s already exists", data.Name)})
-			return
+
+		// Create a new account balance record
+		newAccountBalance := AccountBalance{
+			AccountID: newAccount.AccountID,
+			Balance:   0, // Set the initial balance to 0
 		}
-		account, err := ReturnAccount(db, accountID)
+		err = tx.Create(&newAccountBalance).Error
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Account with chart_of_account=%s does not exist", data.AccountID)})
-			return
+			return err
 		}
-		accountNumber, err := generateAccountNumber(db, account)
+
+		err = recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionCreate,
+			EntityType: "account",
+			EntityID:   newAccount.AccountID.String(),
+			After:      newAccount,
+		})
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
-			return
-		}
-		newAccount := Account{
-			COA:           account,
-			Name:          data.Name,
-			AccountNumber: accountNumber,
+			return err
+		}
+		err = publishAccountCreated(tx, newAccount)
+		if err != nil || ownerID == uuid.Nil {
+			return err
+		}
+		return addAccountOwner(tx, AccountOwner{
+			AccountID:  newAccount.AccountID,
+			CustomerID: ownerID,
+			Role:       OwnerRolePrimary,
+			CanSign:    true,
+			CreatedBy:  actor.UserID,
+		}, actor)
+	})
+	return newAccount, err
+}
+
+func CreateAccountHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			AccountID      string `json:"coa_id"`
+			Name           string `json:"name"`
+			BalanceRule    string `json:"balance_rule"`
+			OverdraftLimit int    `json:"overdraft_limit"`
+			Status         string `json:"status"`
+			OwnerID        string `json:"owner_id"`
 		}
-		err = db.Create(&newAccount).Error
+		err := c.ShouldBindJSON(&data)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 			return
 		}
 
-		// Create a new account balance record
-		newAccountBalance := AccountBalance{
-			AccountID: newAccount.AccountID,
-			Balance:   0, // Set the initial balance to 0
+		_, err = createAccount(db, AccountInput{
+			COAID:          data.AccountID,
+			Name:           data.Name,
+			BalanceRule:    data.BalanceRule,
+			OverdraftLimit: data.OverdraftLimit,
+			Status:         data.Status,
+			OwnerID:        data.OwnerID,
+		}, auditActor(c))
+		var invalid errInvalidRequest
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, errCustomerNotFound) || errors.Is(err, errCustomerKYC) {
+			respondCustomerError(c, err, "Customer not found")
+			return
 		}
-		err = db.Create(&newAccountBalance).Error
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
@@ -67,6 +146,51 @@ func CreateAccountHandler(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
+// AccountTypeInput is a new account type and the account number range it
+// covers.
+type AccountTypeInput struct {
+	Name        string
+	Description string
+	StartRange  int
+	EndRange    int
+}
+
+func createAccountType(db *gorm.DB, input AccountTypeInput, actor AuditActor) (AccountType, error) {
+	if input.Name == "" || input.Description == "" || input.StartRange == 0 || input.EndRange == 0 {
+		return AccountType{}, errInvalidRequest("All fields are required")
+	}
+
+	existingAccountType := AccountType{}
+	err := db.Where("name = ?", input.Name).First(&existingAccountType).Error
+	if err == nil {
+		return AccountType{}, errInvalidRequest(fmt.Sprintf("Account type with this name: %s already exists", input.Name))
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return AccountType{}, errors.New("Database error")
+	}
+
+	newAccountType := AccountType{
+		Name:        input.Name,
+		Description: input.Description,
+		StartRange:  input.StartRange,
+		EndRange:    input.EndRange,
+		CreatedBy:   actor.UserID,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&newAccountType).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionCreate,
+			EntityType: "accounttype",
+			EntityID:   newAccountType.AccountID.String(),
+			After:      newAccountType,
+		})
+	})
+	return newAccountType, err
+}
+
 func CreateAccountTypeHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var data struct {
@@ -82,30 +206,17 @@ func CreateAccountTypeHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if data.Name == "" || data.Description == "" || data.StartRange == 0 || data.EndRange == 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required"})
-			return
-		}
-
-		existingAccountType := AccountType{}
-		err = db.Where("name = ?", data.Name).First(&existingAccountType).Error
-		if err == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Account type with this name: %s already exists", data.Name)})
-			return
-		}
-		if !errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-			return
-		}
-
-		newAccountType := AccountType{
+		_, err = createAccountType(db, AccountTypeInput{
 			Name:        data.Name,
 			Description: data.Description,
 			StartRange:  data.StartRange,
 			EndRange:    data.EndRange,
+		}, auditActor(c))
+		var invalid errInvalidRequest
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
-
-		err = db.Create(&newAccountType).Error
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
@@ -127,36 +238,107 @@ type ListAccountTypeResponse struct {
 	EndRange    int       `json:"end_range"`
 }
 
+func listAccountTypes(db *gorm.DB) ([]ListAccountTypeResponse, error) {
+	var accountTypes []AccountType
+	err := db.Find(&accountTypes).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var response []ListAccountTypeResponse
+	for _, accountType := range accountTypes {
+		response = append(response, ListAccountTypeResponse{
+			AccountID:   accountType.AccountID,
+			Name:        accountType.Name,
+			Description: accountType.Description,
+			StartRange:  accountType.StartRange,
+			EndRange:    accountType.EndRange,
+		})
+	}
+	return response, nil
+}
+
 func ListAccountTypeHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var accountTypes []AccountType
-		err := db.Find(&accountTypes).Error
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		response, err := listAccountTypes(db)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
 			return
 		}
 
-		var response []ListAccountTypeResponse
-		for _, accountType := range accountTypes {
-			response = append(response, ListAccountTypeResponse{
-				AccountID:   accountType.AccountID,
-				Name:        accountType.Name,
-				Description: accountType.Description,
-				StartRange:  accountType.StartRange,
-				EndRange:    accountType.EndRange,
-			})
+		if format != ExportFormatJSON {
+			exportAccountTypes(c, format, response)
+			return
 		}
 
 		c.JSON(http.StatusOK, SuccessResponse{Message:"Account Type List", StatusCode: http.StatusOK, Data: response})
 	}
 }
 
+// ChartOfAccountInput is a new chart of account under an account type.
+type ChartOfAccountInput struct {
+	AccountTypeID  string
+	AccountNumber  int
+	Name           string
+	BalanceRule    string
+	OverdraftLimit int
+}
+
+func createChartOfAccount(db *gorm.DB, input ChartOfAccountInput, actor AuditActor) (ChartOfAccount, error) {
+	accountTypeID, err := uuid.Parse(input.AccountTypeID)
+	if err != nil {
+		return ChartOfAccount{}, errInvalidRequest("Invalid account type ID")
+	}
+
+	if accountTypeID == uuid.Nil || input.AccountNumber == 0 || input.Name == "" {
+		return ChartOfAccount{}, errInvalidRequest("All fields are required")
+	}
+
+	if !AccountTypeExist(db, accountTypeID) {
+		return ChartOfAccount{}, errInvalidRequest("Account type does not exist")
+	}
+
+	rule := balanceRuleRequest{BalanceRule: input.BalanceRule, OverdraftLimit: input.OverdraftLimit}
+	if err := rule.validate(true); err != nil {
+		return ChartOfAccount{}, errInvalidRequest(err.Error())
+	}
+
+	coa := ChartOfAccount{
+		AccountTypeID:  accountTypeID,
+		AccountNumber:  input.AccountNumber,
+		Name:           input.Name,
+		BalanceRule:    input.BalanceRule,
+		OverdraftLimit: input.OverdraftLimit,
+		CreatedBy:      actor.UserID,
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&coa).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionCreate,
+			EntityType: "chartofaccount",
+			EntityID:   coa.AccountID.String(),
+			After:      coa,
+		})
+	})
+	return coa, err
+}
+
 func CreateChartOfAccountHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var data struct {
-			AccountTypeID string `json:"account_type_id"`
-			AccountNumber int    `json:"account_number"`
-			Name          string `json:"name"`
+			AccountTypeID  string `json:"account_type_id"`
+			AccountNumber  int    `json:"account_number"`
+			Name           string `json:"name"`
+			BalanceRule    string `json:"balance_rule"`
+			OverdraftLimit int    `json:"overdraft_limit"`
 		}
 
 		err := c.ShouldBindJSON(&data)
@@ -165,29 +347,18 @@ func CreateChartOfAccountHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		accountTypeID, err := uuid.Parse(data.AccountTypeID)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid account type ID"})
-			return
-		}
-
-		if accountTypeID == uuid.Nil || data.AccountNumber == 0 || data.Name == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "All fields are required"})
+		_, err = createChartOfAccount(db, ChartOfAccountInput{
+			AccountTypeID:  data.AccountTypeID,
+			AccountNumber:  data.AccountNumber,
+			Name:           data.Name,
+			BalanceRule:    data.BalanceRule,
+			OverdraftLimit: data.OverdraftLimit,
+		}, auditActor(c))
+		var invalid errInvalidRequest
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-
-		if !AccountTypeExist(db, accountTypeID) {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Account type does not exist"})
-			return
-		}
-
-		coa := ChartOfAccount{
-			AccountTypeID: accountTypeID,
-			AccountNumber: data.AccountNumber,
-			Name:          data.Name,
-		}
-
-		err = db.Create(&coa).Error
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 			return
@@ -201,27 +372,75 @@ func CreateChartOfAccountHandler(db *gorm.DB) gin.HandlerFunc {
 }
 
 type ListAccountResponse struct {
-	AccountID     uuid.UUID `json:"id"`
-	Name          string    `json:"name"`
-	AccountNumber int       `json:"account_number"`
+	AccountID      uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	AccountNumber  int       `json:"account_number"`
+	BalanceRule    string    `json:"balance_rule,omitempty"`
+	OverdraftLimit int       `json:"overdraft_limit,omitempty"`
+	Status         string    `json:"status"`
+	AccountBalances
+}
+
+// listAccounts returns every account with its balances, or only those
+// owned by customerID when it is set.
+func listAccounts(db *gorm.DB, customerID *uuid.UUID) ([]ListAccountResponse, error) {
+	query := db
+	if customerID != nil {
+		query = query.Where("accountid IN (SELECT accountid FROM accountowner WHERE customerid = ?)", *customerID)
+	}
+
+	var accounts []Account
+	err := query.Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := accountBalances(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var response []ListAccountResponse
+	for _, account := range accounts {
+		response = append(response, ListAccountResponse{
+			AccountID:       account.AccountID,
+			Name:            account.Name,
+			AccountNumber:   account.AccountNumber,
+			BalanceRule:     account.BalanceRule,
+			OverdraftLimit:  account.OverdraftLimit,
+			Status:          account.Status,
+			AccountBalances: balances[account.AccountID],
+		})
+	}
+	return response, nil
 }
 
 func ListAccountHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var accounts []Account
-		err := db.Find(&accounts).Error
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		var customerID *uuid.UUID
+		if customer := c.Query("customer_id"); customer != "" {
+			parsed, err := uuid.Parse(customer)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer_id", StatusCode: http.StatusBadRequest})
+				return
+			}
+			customerID = &parsed
+		}
+
+		response, err := listAccounts(db, customerID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
 			return
 		}
 
-		var response []ListAccountResponse
-		for _, account := range accounts {
-			response = append(response, ListAccountResponse{
-				AccountID:     account.AccountID,
-				Name:          account.Name,
-				AccountNumber: account.AccountNumber,
-			})
+		if format != ExportFormatJSON {
+			exportAccounts(c, format, response)
+			return
 		}
 
 		c.JSON(http.StatusOK, SuccessResponse{Message:"Account List", StatusCode: http.StatusOK, Data: response})
@@ -229,27 +448,51 @@ func ListAccountHandler(db *gorm.DB) gin.HandlerFunc {
 }
 
 type CharOfAccountResponse struct {
-	AccountID     uuid.UUID `json:"id"`
-	Name          string    `json:"name"`
-	AccountNumber int       `json:"account_number"`
+	AccountID      uuid.UUID  `json:"id"`
+	Name           string     `json:"name"`
+	AccountNumber  int        `json:"account_number"`
+	IsControl      bool       `json:"is_control,omitempty"`
+	ControlBalance int        `json:"control_balance,omitempty"`
+	InterestPlanID *uuid.UUID `json:"interest_plan_id,omitempty"`
+}
+
+func listChartOfAccounts(db *gorm.DB) ([]CharOfAccountResponse, error) {
+	var accounts []ChartOfAccount
+	err := db.Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var response []CharOfAccountResponse
+	for _, account := range accounts {
+		response = append(response, CharOfAccountResponse{
+			AccountID:      account.AccountID,
+			Name:           account.Name,
+			AccountNumber:  account.AccountNumber,
+			IsControl:      account.IsControl,
+			ControlBalance: account.ControlBalance,
+			InterestPlanID: account.InterestPlanID,
+		})
+	}
+	return response, nil
 }
 
 func ListChartOfAccountHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var accounts []ChartOfAccount
-		err := db.Find(&accounts).Error
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		response, err := listChartOfAccounts(db)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
 			return
 		}
 
-		var response []CharOfAccountResponse
-		for _, account := range accounts {
-			response = append(response, CharOfAccountResponse{
-				AccountID:     account.AccountID,
-				Name:          account.Name,
-				AccountNumber: account.AccountNumber,
-			})
+		if format != ExportFormatJSON {
+			exportChartOfAccounts(c, format, response)
+			return
 		}
 
 		c.JSON(http.StatusOK, SuccessResponse{Message:"Chart of Account List", StatusCode: http.StatusOK, Data: response})
@@ -270,71 +513,302 @@ func GetAccountIdByAccountNumber(db *gorm.DB, accountNumber uint) (string, error
 	return account.AccountID.String(), nil
 }
 
+// JournalEntryInput is an entry as submitted through the REST or gRPC API.
+type JournalEntryInput struct {
+	DebitAccount    int
+	CreditAccount   int
+	Amount          int
+	Description     string
+	TransactionType string
+}
+
+// JournalSubmission is the outcome of submitJournalEntry: the entry, whether
+// it is waiting for approval, and the fees charged when it was posted.
+type JournalSubmission struct {
+	Entry   JournalEntry
+	Pending bool
+	Fees    []ChargeApplication
+}
+
+// submitJournalEntry checks an entry against the accounts and the caller's
+// posting limit, then posts it or, when an approval rule applies, queues it
+// for approval.
+func submitJournalEntry(db *gorm.DB, input JournalEntryInput, roles []string, actor AuditActor) (*JournalSubmission, error) {
+	// checked here rather than left to request validation so that every
+	// transport refuses it before the posting limit and approval rules,
+	// which a negative amount would slip under
+	if input.Amount <= 0 {
+		return nil, refusePosting(errInvalidRequest("Amount must be greater than zero"))
+	}
+	if input.TransactionType == TransactionTypeFee {
+		return nil, refusePosting(errInvalidRequest("transaction_type fee is reserved for fee entries"))
+	}
+
+	for _, accountNumber := range []int{input.DebitAccount, input.CreditAccount} {
+		if err := checkNotControlAccount(db, accountNumber); err != nil {
+			return nil, refusePosting(err)
+		}
+	}
+
+	accountDebit, debitErr := getAccountNumber(db, input.DebitAccount)
+
+	if accountDebit == 0 || debitErr != nil {
+		return nil, refusePosting(errInvalidRequest("Invalid debit account number"))
+	}
+
+	accountCredit, creditErr := getAccountNumber(db, input.CreditAccount)
+	if accountCredit == 0 || creditErr != nil {
+		return nil, refusePosting(errInvalidRequest("Invalid credit account number"))
+	}
+
+	// refuse up front rather than queue an entry that can never post
+	if err := checkAccountPostable(db, accountDebit, "debit"); err != nil {
+		return nil, refusePosting(err)
+	}
+	if err := checkAccountPostable(db, accountCredit, "credit"); err != nil {
+		return nil, refusePosting(err)
+	}
+
+	if err := checkPostingLimit(roles, input.Amount); err != nil {
+		return nil, err
+	}
+
+	submission := &JournalSubmission{Entry: JournalEntry{
+		AccountCreditNumber: accountCredit,
+		AccountDebitNumber:  accountDebit,
+		Amount:              input.Amount,
+		Description:         input.Description,
+		Date:                time.Now(),
+		TransactionType:     input.TransactionType,
+		CreatedBy:           actor.UserID,
+	}}
+	entry := &submission.Entry
+
+	needsApproval, err := requiresApproval(db, roles, accountDebit, accountCredit, input.Amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if needsApproval {
+		entry.Status = JournalStatusPending
+		submission.Pending = true
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Omit(clause.Associations).Create(entry).Error; err != nil {
+				return err
+			}
+			recordQueued(tx)
+			return recordAudit(tx, actor, AuditEvent{
+				Action:     AuditActionSubmit,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				After:      entry,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+		return submission, nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := postJournalEntry(tx, entry); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionPost,
+			EntityType: "journalentry",
+			EntityID:   entry.TransactionID.String(),
+			After:      entry,
+		}); err != nil {
+			return err
+		}
+		var err error
+		submission.Fees, err = applyPostingCharges(tx, entry, actor)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return submission, nil
+}
+
 func CreateJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var data struct {
-			AccountCredit int    `json:"credit_account"`
-			AccountDebit  int    `json:"debit_account"`
-			Amount        int    `json:"amount"`
-			Description   string `json:"description"`
+			AccountCredit   int    `json:"credit_account"`
+			AccountDebit    int    `json:"debit_account"`
+			Amount          int    `json:"amount"`
+			Description     string `json:"description"`
+			TransactionType string `json:"transaction_type"`
 		}
 
 		err := c.ShouldBindJSON(&data)
 		if err != nil {
+			refusePosting(errInvalidRequest("Invalid request payload"))
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
 			return
 		}
 
-		accountDebit, debitErr := getAccountNumber(db, data.AccountDebit)
-
-		if accountDebit == 0 || debitErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid debit account number"})
+		submission, err := submitJournalEntry(db, JournalEntryInput{
+			DebitAccount:    data.AccountDebit,
+			CreditAccount:   data.AccountCredit,
+			Amount:          data.Amount,
+			Description:     data.Description,
+			TransactionType: data.TransactionType,
+		}, c.GetStringSlice("roles"), auditActor(c))
+		var invalid errInvalidRequest
+		var overLimit *PostingLimitError
+		switch {
+		case errors.As(err, &invalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
-		}
-
-		accountCredit, creditErr := getAccountNumber(db, data.AccountCredit)
-		if accountCredit == 0 || creditErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid credit account number"})
+		case errors.As(err, &overLimit):
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error(), StatusCode: http.StatusForbidden})
+			return
+		case err != nil:
+			respondPostingError(c, err)
 			return
 		}
 
-		processTransaction(db, accountDebit, accountCredit, data.Amount)
-
-		// Fetch current balances
-		entry := JournalEntry{
-			AccountCreditNumber: accountCredit,
-			AccountDebitNumber:  accountDebit,
-			Amount:              data.Amount,
-			Description:         data.Description,
-			Date:                time.Now(),
-		}
-
-		err = db.Create(&entry).Error
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+		if submission.Pending {
+			c.JSON(http.StatusAccepted, SuccessResponse{Message: "Journal entry is pending approval",
+				StatusCode: http.StatusAccepted, Data: gin.H{"transactionid": submission.Entry.TransactionID}})
 			return
 		}
 
 		response := SuccessResponse{Message: "Journal entry created successfully",
-			StatusCode: http.StatusOK}
+			StatusCode: http.StatusOK, Data: gin.H{"transactionid": submission.Entry.TransactionID, "fees": submission.Fees}}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
 
 type JournalEntryResponse struct {
-	TransactionID       uuid.UUID `json:"transactionid"`
-	AccountDebitNumber  int       `json:"accounttodebitid"`
-	AccountCreditNumber int       `json:"accounttocreditid"`
-	Date                time.Time `json:"date"`
-	Amount              int       `json:"amount"`
-	Description         string    `json:"description"`
+	TransactionID       uuid.UUID  `json:"transactionid"`
+	AccountDebitNumber  int        `json:"accounttodebitid"`
+	AccountCreditNumber int        `json:"accounttocreditid"`
+	Date                time.Time  `json:"date"`
+	Amount              int        `json:"amount"`
+	Description         string     `json:"description"`
+	Status              string     `json:"status"`
+	CreatedBy           string     `json:"created_by,omitempty"`
+	ReviewedBy          string     `json:"reviewed_by,omitempty"`
+	ReviewedAt          *time.Time `json:"reviewed_at,omitempty"`
+	RejectionReason     string     `json:"rejection_reason,omitempty"`
+	ReversalOf          *uuid.UUID `json:"reversal_of,omitempty"`
+	TransactionType     string     `json:"transaction_type,omitempty"`
+	BatchID             *uuid.UUID `json:"batch_id,omitempty"`
+}
+
+// JournalQuery holds the list filters shared by the journal endpoints, as
+// the raw strings they arrive in: status (default posted, "all" for every
+// status), account, created_by, batch, from and to.
+type JournalQuery struct {
+	Status    string
+	Account   string
+	CreatedBy string
+	Batch     string
+	From      string
+	To        string
+}
+
+func journalQuery(c *gin.Context) JournalQuery {
+	return JournalQuery{
+		Status:    c.Query("status"),
+		Account:   c.Query("account"),
+		CreatedBy: c.Query("created_by"),
+		Batch:     c.Query("batch"),
+		From:      c.Query("from"),
+		To:        c.Query("to"),
+	}
+}
+
+func (q JournalQuery) apply(db *gorm.DB) (*gorm.DB, error) {
+	status := q.Status
+	if status == "" {
+		status = JournalStatusPosted
+	}
+	if status != "all" {
+		db = db.Where("status = ?", status)
+	}
+	if q.Account != "" {
+		accountNumber, err := strconv.Atoi(q.Account)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid account number")
+		}
+		db = db.Where("accountdebitnumber = ? OR accountcreditnumber = ?", accountNumber, accountNumber)
+	}
+	if q.CreatedBy != "" {
+		db = db.Where("createdby = ?", q.CreatedBy)
+	}
+	if q.Batch != "" {
+		batchID, err := uuid.Parse(q.Batch)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid batch ID")
+		}
+		db = db.Where("batchid = ?", batchID)
+	}
+	if q.From != "" {
+		fromDate, err := time.Parse("2006-01-02", q.From)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid from date format")
+		}
+		db = db.Where("date >= ?", fromDate)
+	}
+	if q.To != "" {
+		toDate, err := time.Parse("2006-01-02", q.To)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid to date format")
+		}
+		db = db.Where("date < ?", toDate.AddDate(0, 0, 1))
+	}
+	return db, nil
+}
+
+// filterJournalEntries applies the journal list filters from the query
+// string.
+func filterJournalEntries(db *gorm.DB, c *gin.Context) (*gorm.DB, error) {
+	return journalQuery(c).apply(db)
+}
+
+func journalEntryResponse(entry JournalEntry) JournalEntryResponse {
+	return JournalEntryResponse{
+		TransactionID:       entry.TransactionID,
+		AccountDebitNumber:  entry.AccountDebitNumber,
+		AccountCreditNumber: entry.AccountCreditNumber,
+		Date:                entry.Date,
+		Amount:              entry.Amount,
+		Description:         entry.Description,
+		Status:              entry.Status,
+		CreatedBy:           entry.CreatedBy,
+		ReviewedBy:          entry.ReviewedBy,
+		ReviewedAt:          entry.ReviewedAt,
+		RejectionReason:     entry.RejectionReason,
+		ReversalOf:          entry.ReversalOf,
+		TransactionType:     entry.TransactionType,
+		BatchID:             entry.BatchID,
+	}
 }
 
 func ListJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		query, err := filterJournalEntries(db, c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+		if format != ExportFormatJSON {
+			streamJournalExport(c, format, query)
+			return
+		}
+
 		var entries []JournalEntry
-		err := db.Find(&entries).Error
+		err = query.Order("date").Find(&entries).Error
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
 			return
@@ -342,14 +816,7 @@ func ListJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
 
 		var response []JournalEntryResponse
 		for _, entry := range entries {
-			response = append(response, JournalEntryResponse{
-				TransactionID:       entry.TransactionID,
-				AccountDebitNumber:  entry.AccountDebitNumber,
-				AccountCreditNumber: entry.AccountCreditNumber,
-				Date:                entry.Date,
-				Amount:              entry.Amount,
-				Description:         entry.Description,
-			})
+			response = append(response, journalEntryResponse(entry))
 		}
 
 		c.JSON(http.StatusOK, response)
@@ -358,6 +825,11 @@ func ListJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
 
 func ProfitAndLossHandler(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
 		dateStr := c.Query("date")
 		var date *time.Time
 		if dateStr != "" {
@@ -375,55 +847,118 @@ func ProfitAndLossHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if format != ExportFormatJSON {
+			exportProfitAndLoss(c, format, date, profitAndLossData)
+			return
+		}
+
 		c.JSON(http.StatusOK, SuccessResponse{Message: "Profit and loss data retrieved successfully", StatusCode: http.StatusOK, Data: profitAndLossData})
 	}
 }
 
-func BalanceSheetHandler(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var accounts []Account
-		err := db.Find(&accounts).Error
+// balanceSheet groups the balances into assets, liabilities and equity by
+// account number, reporting each control account as a single line with
+// its sub-ledger included where drilldown asks for it.
+func balanceSheet(db *gorm.DB, drilldown func(accountNumber int) bool) (map[string]interface{}, error) {
+	var accounts []Account
+	err := db.Order("accountnumber").Find(&accounts).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// sub-ledger accounts are reported as one line per control account
+	var controlAccounts []ChartOfAccount
+	err = db.Where("iscontrol").Order("accountnumber").Find(&controlAccounts).Error
+	if err != nil {
+		return nil, err
+	}
+	controls := make(map[uuid.UUID]bool, len(controlAccounts))
+	for _, coa := range controlAccounts {
+		controls[coa.AccountID] = true
+	}
+	subLedgers := make(map[uuid.UUID][]map[string]interface{})
+
+	balanceSheetData := make(map[string]interface{})
+	assets := make([]map[string]interface{}, 0)
+	liabilities := make([]map[string]interface{}, 0)
+	equity := make([]map[string]interface{}, 0)
+	categorize := func(accountNumber int, accountData map[string]interface{}) {
+		// Categorize accounts based on their number ranges
+		if accountNumber >= 1000 && accountNumber <= 1999 {
+			assets = append(assets, accountData)
+		} else if accountNumber >= 2000 && accountNumber <= 2999 {
+			liabilities = append(liabilities, accountData)
+		} else if accountNumber >= 3000 && accountNumber <= 3999 {
+			equity = append(equity, accountData)
+		}
+	}
+
+	for _, account := range accounts {
+		var balance AccountBalance
+		err = db.Where("accountid =?", account.AccountID).First(&balance).Error
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
-			return
+			if err == gorm.ErrRecordNotFound {
+				// Handle accounts with no balance
+				continue
+			}
+			return nil, err
 		}
 
-		balanceSheetData := make(map[string]interface{})
-		assets := make([]map[string]interface{}, 0)
-		liabilities := make([]map[string]interface{}, 0)
-		equity := make([]map[string]interface{}, 0)
+		accountData := map[string]interface{}{
+			"account_name":   account.Name,
+			"account_number": account.AccountNumber,
+			"balance":        balance.Balance,
+		}
 
-		for _, account := range accounts {
-			var balance AccountBalance
-			err = db.Where("accountid =?", account.AccountID).First(&balance).Error
-			if err != nil {
-				if err == gorm.ErrRecordNotFound {
-					// Handle accounts with no balance
-					continue
-				}
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
-				return
-			}
+		if controls[account.COAID] {
+			subLedgers[account.COAID] = append(subLedgers[account.COAID], accountData)
+			continue
+		}
+		categorize(account.AccountNumber, accountData)
+	}
+	for _, coa := range controlAccounts {
+		controlData := map[string]interface{}{
+			"account_name":    coa.Name,
+			"account_number":  coa.AccountNumber,
+			"balance":         coa.ControlBalance,
+			"control_account": true,
+			"sub_ledger_size": len(subLedgers[coa.AccountID]),
+		}
+		if drilldown(coa.AccountNumber) {
+			controlData["accounts"] = subLedgers[coa.AccountID]
+		}
+		categorize(coa.AccountNumber, controlData)
+	}
 
-			accountData := map[string]interface{}{
-				"account_name":   account.Name,
-				"account_number": account.AccountNumber,
-				"balance":        balance.Balance,
-			}
+	balanceSheetData["assets"] = assets
+	balanceSheetData["liabilities"] = liabilities
+	balanceSheetData["equity"] = equity
+	return balanceSheetData, nil
+}
 
-			// Categorize accounts based on their number ranges
-			if account.AccountNumber >= 1000 && account.AccountNumber <= 1999 {
-				assets = append(assets, accountData)
-			} else if account.AccountNumber >= 2000 && account.AccountNumber <= 2999 {
-				liabilities = append(liabilities, accountData)
-			} else if account.AccountNumber >= 3000 && account.AccountNumber <= 3999 {
-				equity = append(equity, accountData)
-			}
+func BalanceSheetHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		drilldown, err := controlDrilldown(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
 		}
 
-		balanceSheetData["assets"] = assets
-		balanceSheetData["liabilities"] = liabilities
-		balanceSheetData["equity"] = equity
+		balanceSheetData, err := balanceSheet(db, drilldown)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		if format != ExportFormatJSON {
+			exportBalanceSheet(c, format, balanceSheetData)
+			return
+		}
 
 		c.JSON(http.StatusOK, SuccessResponse{Message: "Balance sheet data retrieved successfully", StatusCode: http.StatusOK, Data: balanceSheetData})
 
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const readinessCheckTimeout = 2 * time.Second
+
+type HealthCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthzHandler reports that the process is alive. It must not touch any
+// dependency so that a slow database never gets the pod restarted.
+func HealthzHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, SuccessResponse{Message: "ok", StatusCode: http.StatusOK})
+	}
+}
+
+// ReadyzHandler reports whether the service can take traffic: the database
+// answers, the schema is up to date and the auth service is reachable.
+func ReadyzHandler(db *gorm.DB, auth *Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+		defer cancel()
+
+		checks := []HealthCheck{
+			runCheck("database", func() error { return pingDB(ctx, db) }),
+			runCheck("migrations", func() error { return migrationsCurrent(db.WithContext(ctx)) }),
+			runCheck("journal_protection", func() error { return checkJournalProtection(db.WithContext(ctx)) }),
+			runCheck("auth_service", func() error { return auth.Reachable(ctx) }),
+		}
+
+		statusCode := http.StatusOK
+		message := "ready"
+		for _, check := range checks {
+			if check.Status != "ok" {
+				statusCode = http.StatusServiceUnavailable
+				message = "not ready"
+				break
+			}
+		}
+
+		c.JSON(statusCode, SuccessResponse{Message: message, StatusCode: statusCode, Data: checks})
+	}
+}
+
+func runCheck(name string, check func() error) HealthCheck {
+	if err := check(); err != nil {
+		return HealthCheck{Name: name, Status: "failed", Error: err.Error()}
+	}
+	return HealthCheck{Name: name, Status: "ok"}
+}
+
+func pingDB(ctx context.Context, db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func migrationsCurrent(db *gorm.DB) error {
+	pending, err := PendingMigrations(db)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending migrations, latest is %d", len(pending), latestMigrationVersion())
+	}
+	return nil
+}
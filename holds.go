@@ -0,0 +1,363 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultHoldExpiryInterval = time.Minute
+
+// a hold past its expiry stops counting straight away, even before the
+// expiry sweep has marked it expired
+const activeHoldCondition = "status = 'active' AND (expiresat IS NULL OR expiresat > now())"
+
+var (
+	errHoldNotActive       = errors.New("Hold is no longer active")
+	errHoldOnClosedAccount = errors.New("Holds cannot be placed on a closed account")
+)
+
+func validHoldType(holdType string) bool {
+	switch holdType {
+	case HoldTypePendingWithdrawal, HoldTypeLien, HoldTypeUnclearedCheque:
+		return true
+	}
+	return false
+}
+
+// heldAmount is the total of the account's active holds.
+func heldAmount(db *gorm.DB, accountID uuid.UUID) (int, error) {
+	var held int
+	err := db.Model(&AccountHold{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("accountid = ? AND "+activeHoldCondition, accountID).
+		Scan(&held).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to sum account holds: %v", err)
+	}
+	return held, nil
+}
+
+// AccountBalances pairs the ledger balance, which only journal postings
+// change, with the available balance left after active holds.
+type AccountBalances struct {
+	AccountID        uuid.UUID `json:"-" gorm:"column:accountid"`
+	LedgerBalance    int       `json:"ledger_balance" gorm:"column:ledgerbalance"`
+	Held             int       `json:"held" gorm:"column:held"`
+	AvailableBalance int       `json:"available_balance" gorm:"column:availablebalance"`
+}
+
+const accountBalancesSQL = `
+SELECT a.accountid,
+    COALESCE(b.balance, 0) AS ledgerbalance,
+    COALESCE(h.held, 0) AS held,
+    COALESCE(b.balance, 0) - COALESCE(h.held, 0) AS availablebalance
+FROM account a
+LEFT JOIN accountbalance b ON b.accountid = a.accountid
+LEFT JOIN (
+    SELECT accountid, SUM(amount) AS held FROM accounthold
+    WHERE ` + activeHoldCondition + `
+    GROUP BY accountid
+) h ON h.accountid = a.accountid`
+
+// accountBalances returns the balances of the given accounts, or of every
+// account when none are given.
+func accountBalances(db *gorm.DB, accountIDs ...uuid.UUID) (map[uuid.UUID]AccountBalances, error) {
+	var rows []AccountBalances
+	query := db.Raw(accountBalancesSQL)
+	if len(accountIDs) > 0 {
+		query = db.Raw(accountBalancesSQL+" WHERE a.accountid IN ?", accountIDs)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch account balances: %v", err)
+	}
+	balances := make(map[uuid.UUID]AccountBalances, len(rows))
+	for _, row := range rows {
+		balances[row.AccountID] = row
+	}
+	return balances, nil
+}
+
+type placeHoldRequest struct {
+	Amount    int        `json:"amount"`
+	HoldType  string     `json:"hold_type"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r placeHoldRequest) validate() error {
+	if r.Amount <= 0 {
+		return fmt.Errorf("amount must be positive")
+	}
+	if !validHoldType(r.HoldType) {
+		return fmt.Errorf("hold_type must be one of %s, %s or %s", HoldTypePendingWithdrawal, HoldTypeLien, HoldTypeUnclearedCheque)
+	}
+	if r.Reason == "" {
+		return fmt.Errorf("A hold reason is required")
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
+
+// PlaceHoldHandler reserves part of an account's available balance. The
+// balance row is locked for the check, the same as a posting, so a hold and a
+// debit cannot both spend the same funds.
+func PlaceHoldHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data placeHoldRequest
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if err := data.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var hold AccountHold
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var account Account
+			if err := tx.Where("accountid = ?", accountID).First(&account).Error; err != nil {
+				return err
+			}
+			if account.Status == AccountStatusClosed {
+				return errHoldOnClosedAccount
+			}
+
+			var balance AccountBalance
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", accountID).
+				Limit(1).
+				Find(&balance).Error
+			if err != nil {
+				return err
+			}
+
+			floor, err := balanceFloor(tx, accountID)
+			if err != nil {
+				return err
+			}
+			if floor != nil {
+				held, err := heldAmount(tx, accountID)
+				if err != nil {
+					return err
+				}
+				available := balance.Balance - held - *floor
+				if data.Amount > available {
+					return &InsufficientFundsError{AccountNumber: account.AccountNumber, Available: available, Requested: data.Amount}
+				}
+			}
+
+			hold = AccountHold{
+				AccountID: accountID,
+				Amount:    data.Amount,
+				HoldType:  data.HoldType,
+				Reason:    data.Reason,
+				Status:    HoldStatusActive,
+				ExpiresAt: data.ExpiresAt,
+				CreatedBy: c.GetString("userID"),
+				CreatedAt: time.Now(),
+			}
+			if err := tx.Create(&hold).Error; err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "accounthold",
+				EntityID:   hold.HoldID.String(),
+				After:      hold,
+			})
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: "Account not found", StatusCode: http.StatusNotFound})
+			case errors.Is(err, errHoldOnClosedAccount):
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			default:
+				respondPostingError(c, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Hold placed successfully", StatusCode: http.StatusCreated, Data: hold})
+	}
+}
+
+func ListAccountHoldsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		query := db.Where("accountid = ?", accountID).Order("createdat DESC")
+		switch status := c.DefaultQuery("status", HoldStatusActive); status {
+		case "all":
+		case HoldStatusActive:
+			query = query.Where(activeHoldCondition)
+		case HoldStatusReleased, HoldStatusExpired:
+			query = query.Where("status = ?", status)
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid status filter", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		holds := []AccountHold{}
+		if err := query.Find(&holds).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account Hold List", StatusCode: http.StatusOK, Data: holds})
+	}
+}
+
+// ReleaseHoldHandler returns held funds to the available balance, e.g. when a
+// pending withdrawal is cancelled or a cheque clears.
+func ReleaseHoldHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		holdID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid hold ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var hold AccountHold
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("holdid = ?", holdID).
+				First(&hold).Error
+			if err != nil {
+				return err
+			}
+			if hold.Status != HoldStatusActive || (hold.ExpiresAt != nil && !hold.ExpiresAt.After(time.Now())) {
+				return errHoldNotActive
+			}
+
+			before := hold
+			now := time.Now()
+			hold.Status = HoldStatusReleased
+			hold.ReleasedBy = c.GetString("userID")
+			hold.ReleasedAt = &now
+			err = tx.Model(&AccountHold{}).Where("holdid = ?", holdID).Updates(map[string]interface{}{
+				"status":     hold.Status,
+				"releasedby": hold.ReleasedBy,
+				"releasedat": hold.ReleasedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionRelease,
+				EntityType: "accounthold",
+				EntityID:   holdID.String(),
+				Before:     before,
+				After:      hold,
+			})
+		})
+		if err != nil {
+			if errors.Is(err, errHoldNotActive) {
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+				return
+			}
+			respondNotFoundOr500(c, err, "Hold not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Hold released successfully", StatusCode: http.StatusOK, Data: hold})
+	}
+}
+
+// expireHolds marks every active hold past its expiry as expired. Holds
+// already locked by a concurrent release are skipped and picked up next run.
+func expireHolds(db *gorm.DB, actor AuditActor) (int, error) {
+	expired := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var holds []AccountHold
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expiresat <= now()", HoldStatusActive).
+			Find(&holds).Error
+		if err != nil {
+			return err
+		}
+
+		for _, hold := range holds {
+			before := hold
+			hold.Status = HoldStatusExpired
+			err := tx.Model(&AccountHold{}).Where("holdid = ?", hold.HoldID).Update("status", hold.Status).Error
+			if err != nil {
+				return err
+			}
+			err = recordAudit(tx, actor, AuditEvent{
+				Action:     AuditActionExpire,
+				EntityType: "accounthold",
+				EntityID:   hold.HoldID.String(),
+				Before:     before,
+				After:      hold,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		expired = len(holds)
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire holds: %v", err)
+	}
+	return expired, nil
+}
+
+func ExpireHoldsHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		expired, err := expireHolds(db, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: fmt.Sprintf("%d holds expired", expired), StatusCode: http.StatusOK,
+			Data: gin.H{"expired": expired}})
+	}
+}
+
+// runHoldExpiry sweeps expired holds every interval until ctx is done.
+// Expired holds already stop counting against the available balance, so the
+// sweep only keeps the stored status and the audit log current.
+func runHoldExpiry(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	actor := AuditActor{UserID: "system", Method: "JOB", Endpoint: "hold-expiry"}
+	logger = logger.With("job", actor.Endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := expireHolds(db, actor); err != nil {
+				logger.Error("hold expiry failed", "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// A journal import is a file of lines, one account and one side per row.
+// Lines sharing a reference make one balanced entry, which is posted as
+// pairwise journal entries. The whole file is posted in one transaction,
+// and only when every row is valid.
+
+const (
+	ImportFormatCSV  = "csv"
+	ImportFormatXLSX = "xlsx"
+
+	maxImportSize  = 10 << 20
+	maxImportLines = 10000
+)
+
+var importColumns = []string{"reference", "date", "account", "debit", "credit", "description", "transaction_type"}
+
+var requiredImportColumns = []string{"reference", "date", "account"}
+
+type ImportLine struct {
+	Row             int
+	Reference       string
+	Date            time.Time
+	Account         int
+	Debit           int
+	Credit          int
+	Description     string
+	TransactionType string
+}
+
+type ImportRowError struct {
+	Row       int    `json:"row"`
+	Reference string `json:"reference,omitempty"`
+	Error     string `json:"error"`
+}
+
+type ImportReport struct {
+	BatchID      *uuid.UUID       `json:"batchid,omitempty"`
+	DryRun       bool             `json:"dry_run"`
+	Lines        int              `json:"lines"`
+	Entries      int              `json:"entries"`
+	Total        int              `json:"total"`
+	Transactions []uuid.UUID      `json:"transactions,omitempty"`
+	Errors       []ImportRowError `json:"errors"`
+}
+
+func (r *ImportReport) reject(row int, reference string, format string, args ...interface{}) {
+	r.Errors = append(r.Errors, ImportRowError{Row: row, Reference: reference, Error: fmt.Sprintf(format, args...)})
+}
+
+// importEntry is one journal entry to post, with the reference and first row
+// it came from for error reporting.
+type importEntry struct {
+	Row       int
+	Reference string
+	Entry     JournalEntry
+}
+
+// importFormat picks the format from an explicit name or the file extension.
+func importFormat(format string, filename string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(filename)), ".")
+	}
+	switch format {
+	case ImportFormatCSV, ImportFormatXLSX:
+		return format, nil
+	}
+	return "", fmt.Errorf("format must be %s or %s", ImportFormatCSV, ImportFormatXLSX)
+}
+
+// readImportRows returns the cells of a CSV file, or of the first sheet of
+// an XLSX workbook, header row included.
+func readImportRows(format string, r io.Reader) ([][]string, error) {
+	if format == ImportFormatCSV {
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		rows, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %v", err)
+		}
+		return rows, nil
+	}
+
+	workbook, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX: %v", err)
+	}
+	defer workbook.Close()
+	sheets := workbook.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, errors.New("workbook has no sheets")
+	}
+	// raw values, so amounts and dates are not run through the cell format
+	rows, err := workbook.GetRows(sheets[0], excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read XLSX: %v", err)
+	}
+	return rows, nil
+}
+
+// parseImportDate accepts YYYY-MM-DD, or the day serial number a spreadsheet
+// stores for date cells.
+func parseImportDate(value string) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date, nil
+	}
+	serial, err := strconv.ParseFloat(value, 64)
+	if err != nil || serial < 1 {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	date, err := excelize.ExcelDateToTime(serial, false)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD", value)
+	}
+	return utcDate(date), nil
+}
+
+func parseImportAmount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	amount, err := strconv.Atoi(value)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid amount %q, expected a whole non-negative number", value)
+	}
+	return amount, nil
+}
+
+// parseImportLines maps the header row onto importColumns and parses every
+// non-blank row. Row numbers count the header as row 1, as a spreadsheet does.
+func parseImportLines(rows [][]string, report *ImportReport) []ImportLine {
+	if len(rows) == 0 {
+		report.reject(1, "", "file is empty")
+		return nil
+	}
+
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		name = strings.ToLower(strings.TrimSpace(name))
+		for _, known := range importColumns {
+			if name == known {
+				columns[name] = i
+			}
+		}
+	}
+	for _, name := range requiredImportColumns {
+		if _, ok := columns[name]; !ok {
+			report.reject(1, "", "missing column %s", name)
+		}
+	}
+	_, hasDebit := columns["debit"]
+	_, hasCredit := columns["credit"]
+	if !hasDebit || !hasCredit {
+		report.reject(1, "", "missing column debit or credit")
+	}
+	if len(report.Errors) > 0 {
+		return nil
+	}
+
+	var lines []ImportLine
+	for i, row := range rows[1:] {
+		number := i + 2
+		cell := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(row) {
+				return strings.TrimSpace(row[index])
+			}
+			return ""
+		}
+		if strings.TrimSpace(strings.Join(row, "")) == "" {
+			continue
+		}
+
+		line := ImportLine{
+			Row:             number,
+			Reference:       cell("reference"),
+			Description:     cell("description"),
+			TransactionType: cell("transaction_type"),
+		}
+		var problems []string
+		if line.Reference == "" {
+			problems = append(problems, "reference is required")
+		}
+		var err error
+		if line.Date, err = parseImportDate(cell("date")); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if line.Account, err = strconv.Atoi(cell("account")); err != nil {
+			problems = append(problems, fmt.Sprintf("invalid account %q", cell("account")))
+		}
+		if line.Debit, err = parseImportAmount(cell("debit")); err != nil {
+			problems = append(problems, "debit: "+err.Error())
+		}
+		if line.Credit, err = parseImportAmount(cell("credit")); err != nil {
+			problems = append(problems, "credit: "+err.Error())
+		}
+		if (line.Debit > 0) == (line.Credit > 0) {
+			problems = append(problems, "exactly one of debit and credit must be positive")
+		}
+		if line.TransactionType == TransactionTypeFee {
+			problems = append(problems, "transaction_type fee is reserved for fee entries")
+		}
+		if len(problems) > 0 {
+			report.reject(number, line.Reference, "%s", strings.Join(problems, "; "))
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines)+len(report.Errors) > maxImportLines {
+		report.reject(1, "", "a file may hold at most %d lines", maxImportLines)
+	}
+	return lines
+}
+
+// checkImportLines validates each line against the ledger: the account must
+// exist, accept postings on its side and not be a control account, and the
+// date must be in an open period and not in the future.
+func checkImportLines(db *gorm.DB, lines []ImportLine, report *ImportReport) error {
+	through, err := closedThrough(db)
+	if err != nil {
+		return err
+	}
+	today := utcDate(time.Now())
+
+	accountErrors := map[string]error{}
+	checkAccount := func(number int, side string) error {
+		key := fmt.Sprintf("%d/%s", number, side)
+		if err, ok := accountErrors[key]; ok {
+			return err
+		}
+		var err error
+		if _, lookupErr := getAccountNumber(db, number); lookupErr != nil {
+			err = fmt.Errorf("account %d does not exist", number)
+		} else if controlErr := checkNotControlAccount(db, number); controlErr != nil {
+			err = controlErr
+		} else if statusErr := checkAccountPostable(db, number, side); statusErr != nil {
+			err = statusErr
+		}
+		accountErrors[key] = err
+		return err
+	}
+
+	for _, line := range lines {
+		side := "debit"
+		if line.Credit > 0 {
+			side = "credit"
+		}
+		var problems []string
+		if err := checkAccount(line.Account, side); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if line.Date.After(today) {
+			problems = append(problems, "date cannot be in the future")
+		}
+		if through != nil && !line.Date.After(*through) {
+			problems = append(problems, fmt.Sprintf("the books are closed through %s", through.Format("2006-01-02")))
+		}
+		if len(problems) > 0 {
+			report.reject(line.Row, line.Reference, "%s", strings.Join(problems, "; "))
+		}
+	}
+	return nil
+}
+
+// pairImportLines checks that each reference is one balanced entry on one
+// date and splits it into journal entries of one debit and one credit.
+func pairImportLines(lines []ImportLine, report *ImportReport) []importEntry {
+	groups := map[string][]ImportLine{}
+	var references []string
+	for _, line := range lines {
+		if _, ok := groups[line.Reference]; !ok {
+			references = append(references, line.Reference)
+		}
+		groups[line.Reference] = append(groups[line.Reference], line)
+	}
+
+	var entries []importEntry
+	for _, reference := range references {
+		group := groups[reference]
+		first := group[0]
+
+		var debits, credits []ImportLine
+		debitTotal, creditTotal := 0, 0
+		valid := true
+		for _, line := range group {
+			if !line.Date.Equal(first.Date) {
+				report.reject(line.Row, reference, "date differs from row %d of the same reference", first.Row)
+				valid = false
+			}
+			if line.Debit > 0 {
+				debits = append(debits, line)
+				debitTotal += line.Debit
+			} else {
+				credits = append(credits, line)
+				creditTotal += line.Credit
+			}
+		}
+		if len(debits) == 0 || len(credits) == 0 {
+			report.reject(first.Row, reference, "reference needs at least one debit and one credit line")
+			continue
+		}
+		if debitTotal != creditTotal {
+			report.reject(first.Row, reference, "reference is not balanced: debits %d, credits %d", debitTotal, creditTotal)
+			continue
+		}
+		if !valid {
+			continue
+		}
+
+		// match debits against credits in file order until both run out
+		d, k := 0, 0
+		debitLeft, creditLeft := debits[0].Debit, credits[0].Credit
+		for d < len(debits) && k < len(credits) {
+			amount := min(debitLeft, creditLeft)
+			description := debits[d].Description
+			if description == "" {
+				description = credits[k].Description
+			}
+			transactionType := debits[d].TransactionType
+			if transactionType == "" {
+				transactionType = credits[k].TransactionType
+			}
+			entries = append(entries, importEntry{Row: first.Row, Reference: reference, Entry: JournalEntry{
+				AccountDebitNumber:  debits[d].Account,
+				AccountCreditNumber: credits[k].Account,
+				Amount:              amount,
+				Description:         description,
+				Date:                first.Date,
+				TransactionType:     transactionType,
+			}})
+			debitLeft -= amount
+			creditLeft -= amount
+			if debitLeft == 0 {
+				if d++; d < len(debits) {
+					debitLeft = debits[d].Debit
+				}
+			}
+			if creditLeft == 0 {
+				if k++; k < len(credits) {
+					creditLeft = credits[k].Credit
+				}
+			}
+		}
+	}
+	return entries
+}
+
+type importPostingError struct {
+	Row       int
+	Reference string
+	Err       error
+}
+
+func (e *importPostingError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *importPostingError) Unwrap() error {
+	return e.Err
+}
+
+// importJournal validates a file of journal lines and, unless dryRun is set
+// or any row is invalid, posts all of it as one batch. Entries that would
+// need approval are refused: an import cannot bypass the approval queue.
+func importJournal(db *gorm.DB, format string, filename string, r io.Reader, roles []string, createdBy string, actor AuditActor, dryRun bool) (*ImportReport, error) {
+	report := &ImportReport{DryRun: dryRun, Errors: []ImportRowError{}}
+
+	rows, err := readImportRows(format, r)
+	if err != nil {
+		report.reject(0, "", "%v", err)
+		return report, nil
+	}
+	lines := parseImportLines(rows, report)
+	if err := checkImportLines(db, lines, report); err != nil {
+		return nil, err
+	}
+	entries := pairImportLines(lines, report)
+
+	report.Lines = len(lines)
+	report.Entries = len(entries)
+	approvals := 0
+	for _, entry := range entries {
+		report.Total += entry.Entry.Amount
+		needsApproval, err := requiresApproval(db, roles, entry.Entry.AccountDebitNumber, entry.Entry.AccountCreditNumber, entry.Entry.Amount)
+		if err != nil {
+			return nil, err
+		}
+		if needsApproval {
+			approvals++
+			report.reject(entry.Row, entry.Reference, "entry of %d from %d to %d needs approval, post it through POST /journalentry",
+				entry.Entry.Amount, entry.Entry.AccountDebitNumber, entry.Entry.AccountCreditNumber)
+		}
+	}
+	sort.SliceStable(report.Errors, func(i, j int) bool { return report.Errors[i].Row < report.Errors[j].Row })
+	if len(report.Errors) > 0 && !dryRun {
+		postingFailures.WithLabelValues("pending_approval").Add(float64(approvals))
+		postingFailures.WithLabelValues("invalid").Add(float64(len(report.Errors) - approvals))
+	}
+	if len(report.Errors) > 0 || dryRun {
+		return report, nil
+	}
+
+	batch := ImportBatch{
+		FileName:  filepath.Base(filename),
+		Format:    format,
+		Lines:     report.Lines,
+		Entries:   report.Entries,
+		Total:     report.Total,
+		CreatedBy: createdBy,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&batch).Error; err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionCreate,
+			EntityType: "importbatch",
+			EntityID:   batch.BatchID.String(),
+			After:      batch,
+		}); err != nil {
+			return err
+		}
+
+		for i := range entries {
+			entry := &entries[i].Entry
+			entry.BatchID = &batch.BatchID
+			entry.CreatedBy = createdBy
+			wrap := func(err error) error {
+				return &importPostingError{Row: entries[i].Row, Reference: entries[i].Reference, Err: err}
+			}
+			if err := postJournalEntry(tx, entry); err != nil {
+				return wrap(err)
+			}
+			if err := recordAudit(tx, actor, AuditEvent{
+				Action:     AuditActionPost,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				After:      entry,
+			}); err != nil {
+				return err
+			}
+			if _, err := applyPostingCharges(tx, entry, actor); err != nil {
+				return wrap(err)
+			}
+			report.Transactions = append(report.Transactions, entry.TransactionID)
+		}
+		return nil
+	})
+
+	// a posting refused mid-batch, for lack of funds say, is reported
+	// against its rows like any other validation failure
+	var refused *importPostingError
+	if errors.As(err, &refused) && isPostingRefusal(refused.Err) {
+		report.Transactions = nil
+		report.reject(refused.Row, refused.Reference, "%v", refused.Err)
+		return report, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	report.BatchID = &batch.BatchID
+	return report, nil
+}
+
+type ImportErrorResponse struct {
+	StatusCode int          `json:"status_code"`
+	Error      string       `json:"error"`
+	Report     ImportReport `json:"report"`
+}
+
+// ImportJournalHandler takes a multipart upload in the file field. The
+// format comes from the format field or the file extension; dry_run=true
+// validates without posting.
+func ImportJournalHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A file is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if header.Size > maxImportSize {
+			c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{Error: fmt.Sprintf("File exceeds %d bytes", maxImportSize), StatusCode: http.StatusRequestEntityTooLarge})
+			return
+		}
+		format, err := importFormat(c.PostForm("format"), header.Filename)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file", StatusCode: http.StatusBadRequest})
+			return
+		}
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxImportSize))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Failed to read file", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		dryRun := c.Query("dry_run") == "true"
+		report, err := importJournal(db, format, header.Filename, bytes.NewReader(content),
+			c.GetStringSlice("roles"), c.GetString("userID"), auditActor(c), dryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		if len(report.Errors) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, ImportErrorResponse{Error: fmt.Sprintf("%d rows are invalid, nothing was posted", len(report.Errors)),
+				StatusCode: http.StatusUnprocessableEntity, Report: *report})
+			return
+		}
+		if dryRun {
+			c.JSON(http.StatusOK, SuccessResponse{Message: "Import is valid", StatusCode: http.StatusOK, Data: report})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Journal imported successfully", StatusCode: http.StatusCreated, Data: report})
+	}
+}
+
+func GetImportBatchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		batchID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid batch ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var batch ImportBatch
+		if err := db.Where("batchid = ?", batchID).First(&batch).Error; err != nil {
+			respondNotFoundOr500(c, err, "Import batch not found")
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Import Batch", StatusCode: http.StatusOK, Data: batch})
+	}
+}
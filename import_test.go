@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type pairedEntry struct {
+	Debit, Credit, Amount int
+	Reference             string
+}
+
+func paired(entries []importEntry) []pairedEntry {
+	var got []pairedEntry
+	for _, entry := range entries {
+		got = append(got, pairedEntry{entry.Entry.AccountDebitNumber, entry.Entry.AccountCreditNumber, entry.Entry.Amount, entry.Reference})
+	}
+	return got
+}
+
+func TestPairImportLines(t *testing.T) {
+	day := date(2024, 5, 1)
+	lines := []ImportLine{
+		{Row: 2, Reference: "A", Date: day, Account: 1001, Debit: 500, Description: "rent"},
+		{Row: 3, Reference: "A", Date: day, Account: 2001, Credit: 500},
+		// one debit split over two credits
+		{Row: 4, Reference: "B", Date: day, Account: 1002, Debit: 300, TransactionType: "transfer"},
+		{Row: 5, Reference: "B", Date: day, Account: 2002, Credit: 100, Description: "first"},
+		{Row: 6, Reference: "B", Date: day, Account: 2003, Credit: 200},
+		// lines of a reference need not be next to each other
+		{Row: 7, Reference: "C", Date: day, Account: 1003, Debit: 50},
+		{Row: 8, Reference: "C", Date: day, Account: 1004, Debit: 70},
+		{Row: 9, Reference: "A2", Date: day, Account: 1005, Debit: 10},
+		{Row: 10, Reference: "C", Date: day, Account: 2004, Credit: 120},
+		{Row: 11, Reference: "A2", Date: day, Account: 2005, Credit: 10},
+	}
+
+	report := &ImportReport{}
+	entries := pairImportLines(lines, report)
+	if len(report.Errors) != 0 {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+	want := []pairedEntry{
+		{1001, 2001, 500, "A"},
+		{1002, 2002, 100, "B"},
+		{1002, 2003, 200, "B"},
+		{1003, 2004, 50, "C"},
+		{1004, 2004, 70, "C"},
+		{1005, 2005, 10, "A2"},
+	}
+	if got := paired(entries); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// descriptions and types fall back from the debit line to the credit line
+	if entries[0].Entry.Description != "rent" || entries[1].Entry.Description != "first" || entries[1].Entry.TransactionType != "transfer" {
+		t.Errorf("got descriptions %q and %q, type %q", entries[0].Entry.Description, entries[1].Entry.Description, entries[1].Entry.TransactionType)
+	}
+	for _, entry := range entries {
+		if !entry.Entry.Date.Equal(day) {
+			t.Errorf("entry %s dated %s, want %s", entry.Reference, entry.Entry.Date, day)
+		}
+	}
+}
+
+func TestPairImportLinesRejects(t *testing.T) {
+	day := date(2024, 5, 1)
+	lines := []ImportLine{
+		{Row: 2, Reference: "unbalanced", Date: day, Account: 1001, Debit: 500},
+		{Row: 3, Reference: "unbalanced", Date: day, Account: 2001, Credit: 400},
+		{Row: 4, Reference: "one-sided", Date: day, Account: 1002, Debit: 100},
+		{Row: 5, Reference: "dates", Date: day, Account: 1003, Debit: 100},
+		{Row: 6, Reference: "dates", Date: day.Add(24 * time.Hour), Account: 2003, Credit: 100},
+		{Row: 7, Reference: "ok", Date: day, Account: 1004, Debit: 100},
+		{Row: 8, Reference: "ok", Date: day, Account: 2004, Credit: 100},
+	}
+
+	report := &ImportReport{}
+	entries := pairImportLines(lines, report)
+	if got := paired(entries); !reflect.DeepEqual(got, []pairedEntry{{1004, 2004, 100, "ok"}}) {
+		t.Errorf("got %v, want only the ok reference", got)
+	}
+
+	want := []ImportRowError{
+		{Row: 2, Reference: "unbalanced", Error: "reference is not balanced: debits 500, credits 400"},
+		{Row: 4, Reference: "one-sided", Error: "reference needs at least one debit and one credit line"},
+		{Row: 6, Reference: "dates", Error: "date differs from row 5 of the same reference"},
+	}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("got errors %v, want %v", report.Errors, want)
+	}
+}
+
+func TestParseImportLinesRefusesFeeType(t *testing.T) {
+	rows := [][]string{
+		{"reference", "date", "account", "debit", "credit", "transaction_type"},
+		{"A", "2024-05-01", "1001", "100", "", "fee"},
+		{"A", "2024-05-01", "2001", "", "100", "transfer"},
+	}
+
+	report := &ImportReport{}
+	lines := parseImportLines(rows, report)
+	if len(lines) != 1 || lines[0].Row != 3 {
+		t.Errorf("got lines %v, want only row 3", lines)
+	}
+	want := []ImportRowError{{Row: 2, Reference: "A", Error: "transaction_type fee is reserved for fee entries"}}
+	if !reflect.DeepEqual(report.Errors, want) {
+		t.Errorf("got errors %v, want %v", report.Errors, want)
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+type IntegrityFinding struct {
+	Check      string `json:"check"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	EntityType string `json:"entity_type,omitempty"`
+	EntityID   string `json:"entity_id,omitempty"`
+}
+
+type IntegrityReport struct {
+	CheckedAt time.Time          `json:"checked_at"`
+	Valid     bool               `json:"valid"`
+	Checks    []string           `json:"checks"`
+	Summary   map[string]int     `json:"summary"`
+	Findings  []IntegrityFinding `json:"findings"`
+}
+
+func (r *IntegrityReport) add(finding IntegrityFinding) {
+	r.Findings = append(r.Findings, finding)
+	r.Summary[finding.Severity]++
+	if finding.Severity == SeverityError {
+		r.Valid = false
+	}
+}
+
+type integrityCheck struct {
+	name string
+	run  func(db *gorm.DB, report *IntegrityReport) error
+}
+
+var integrityChecks = []integrityCheck{
+	{"journal_accounts_exist", checkJournalAccounts},
+	{"debits_equal_credits", checkDebitsEqualCredits},
+	{"one_balance_per_account", checkOneBalancePerAccount},
+	{"account_numbers_in_range", checkAccountRanges},
+	{"chart_account_types_exist", checkChartAccountTypes},
+	{"control_accounts_balance", checkControlAccounts},
+	{"journal_protection", checkProtectionInstalled},
+	{"audit_chain", checkAuditChain},
+}
+
+// verifyLedgerIntegrity runs every integrity check against a single
+// read-only snapshot, so the report describes one consistent state of the
+// books even while postings continue.
+func verifyLedgerIntegrity(db *gorm.DB) (*IntegrityReport, error) {
+	report := &IntegrityReport{
+		CheckedAt: time.Now(),
+		Valid:     true,
+		Summary:   map[string]int{SeverityError: 0, SeverityWarning: 0, SeverityInfo: 0},
+		Findings:  []IntegrityFinding{},
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, check := range integrityChecks {
+			report.Checks = append(report.Checks, check.name)
+			if err := check.run(tx, report); err != nil {
+				return fmt.Errorf("%s: %v", check.name, err)
+			}
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func checkJournalAccounts(db *gorm.DB, report *IntegrityReport) error {
+	var rows []struct {
+		TransactionID       string `gorm:"column:transactionid"`
+		AccountDebitNumber  int    `gorm:"column:accountdebitnumber"`
+		AccountCreditNumber int    `gorm:"column:accountcreditnumber"`
+		DebitExists         bool   `gorm:"column:debitexists"`
+		CreditExists        bool   `gorm:"column:creditexists"`
+	}
+	err := db.Raw(`
+SELECT j.transactionid, j.accountdebitnumber, j.accountcreditnumber,
+    EXISTS (SELECT 1 FROM account a WHERE a.accountnumber = j.accountdebitnumber) AS debitexists,
+    EXISTS (SELECT 1 FROM account a WHERE a.accountnumber = j.accountcreditnumber) AS creditexists
+FROM journalentry j
+WHERE NOT EXISTS (SELECT 1 FROM account a WHERE a.accountnumber = j.accountdebitnumber)
+   OR NOT EXISTS (SELECT 1 FROM account a WHERE a.accountnumber = j.accountcreditnumber)`).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		if !row.DebitExists {
+			report.add(IntegrityFinding{
+				Check:      "journal_accounts_exist",
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("debit account %d does not exist", row.AccountDebitNumber),
+				EntityType: "journalentry",
+				EntityID:   row.TransactionID,
+			})
+		}
+		if !row.CreditExists {
+			report.add(IntegrityFinding{
+				Check:      "journal_accounts_exist",
+				Severity:   SeverityError,
+				Message:    fmt.Sprintf("credit account %d does not exist", row.AccountCreditNumber),
+				EntityType: "journalentry",
+				EntityID:   row.TransactionID,
+			})
+		}
+	}
+	return nil
+}
+
+func checkDebitsEqualCredits(db *gorm.DB, report *IntegrityReport) error {
+	var totals struct {
+		Debits   int64 `gorm:"column:debits"`
+		Credits  int64 `gorm:"column:credits"`
+		Balances int64 `gorm:"column:balances"`
+	}
+	err := db.Raw(`
+SELECT
+    (SELECT COALESCE(SUM(j.amount), 0) FROM journalentry j
+        JOIN account a ON a.accountnumber = j.accountdebitnumber WHERE j.status = 'posted') AS debits,
+    (SELECT COALESCE(SUM(j.amount), 0) FROM journalentry j
+        JOIN account a ON a.accountnumber = j.accountcreditnumber WHERE j.status = 'posted') AS credits,
+    (SELECT COALESCE(SUM(balance), 0) FROM accountbalance) AS balances`).Scan(&totals).Error
+	if err != nil {
+		return err
+	}
+
+	if totals.Debits != totals.Credits {
+		report.add(IntegrityFinding{
+			Check:    "debits_equal_credits",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("posted debits %d do not equal posted credits %d", totals.Debits, totals.Credits),
+		})
+	}
+	// every posting moves the same amount between two balances
+	if totals.Balances != 0 {
+		report.add(IntegrityFinding{
+			Check:    "debits_equal_credits",
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("account balances sum to %d instead of zero", totals.Balances),
+		})
+	}
+
+	var nonPositive []string
+	err = db.Model(&JournalEntry{}).Where("amount <= 0").Pluck("transactionid", &nonPositive).Error
+	if err != nil {
+		return err
+	}
+	for _, transactionID := range nonPositive {
+		report.add(IntegrityFinding{
+			Check:      "debits_equal_credits",
+			Severity:   SeverityWarning,
+			Message:    "journal entry amount is not positive",
+			EntityType: "journalentry",
+			EntityID:   transactionID,
+		})
+	}
+	return nil
+}
+
+func checkOneBalancePerAccount(db *gorm.DB, report *IntegrityReport) error {
+	var rows []struct {
+		AccountID     string `gorm:"column:accountid"`
+		AccountNumber int    `gorm:"column:accountnumber"`
+		Balances      int    `gorm:"column:balances"`
+	}
+	err := db.Raw(`
+SELECT a.accountid, a.accountnumber, COUNT(b.balanceid) AS balances
+FROM account a
+LEFT JOIN accountbalance b ON b.accountid = a.accountid
+GROUP BY a.accountid, a.accountnumber
+HAVING COUNT(b.balanceid) <> 1`).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		report.add(IntegrityFinding{
+			Check:      "one_balance_per_account",
+			Severity:   SeverityError,
+			Message:    fmt.Sprintf("account %d has %d balance records", row.AccountNumber, row.Balances),
+			EntityType: "account",
+			EntityID:   row.AccountID,
+		})
+	}
+
+	var orphaned []string
+	err = db.Raw(`SELECT b.balanceid FROM accountbalance b
+		WHERE NOT EXISTS (SELECT 1 FROM account a WHERE a.accountid = b.accountid)`).Scan(&orphaned).Error
+	if err != nil {
+		return err
+	}
+	for _, balanceID := range orphaned {
+		report.add(IntegrityFinding{
+			Check:      "one_balance_per_account",
+			Severity:   SeverityWarning,
+			Message:    "balance record belongs to no account",
+			EntityType: "accountbalance",
+			EntityID:   balanceID,
+		})
+	}
+	return nil
+}
+
+func checkAccountRanges(db *gorm.DB, report *IntegrityReport) error {
+	var accounts []struct {
+		AccountID     string  `gorm:"column:accountid"`
+		AccountNumber int     `gorm:"column:accountnumber"`
+		COAFound      bool    `gorm:"column:coafound"`
+		TypeName      *string `gorm:"column:typename"`
+		StartRange    *int    `gorm:"column:startrange"`
+		EndRange      *int    `gorm:"column:endrange"`
+	}
+	err := db.Raw(`
+SELECT a.accountid, a.accountnumber, c.accountid IS NOT NULL AS coafound,
+    t.name AS typename, t.startrange, t.endrange
+FROM account a
+LEFT JOIN chartofaccount c ON c.accountid = a.coaid
+LEFT JOIN accounttype t ON t.accountid = c.accounttypeid
+WHERE c.accountid IS NULL
+   OR (t.accountid IS NOT NULL AND a.accountnumber NOT BETWEEN t.startrange AND t.endrange)`).Scan(&accounts).Error
+	if err != nil {
+		return err
+	}
+	for _, account := range accounts {
+		finding := IntegrityFinding{
+			Check:      "account_numbers_in_range",
+			Severity:   SeverityError,
+			EntityType: "account",
+			EntityID:   account.AccountID,
+		}
+		if !account.COAFound {
+			finding.Message = fmt.Sprintf("account %d references a missing chart of account", account.AccountNumber)
+		} else {
+			finding.Message = fmt.Sprintf("account %d is outside the %s range %d-%d",
+				account.AccountNumber, *account.TypeName, *account.StartRange, *account.EndRange)
+		}
+		report.add(finding)
+	}
+
+	var charts []struct {
+		AccountID     string `gorm:"column:accountid"`
+		AccountNumber int    `gorm:"column:accountnumber"`
+		TypeName      string `gorm:"column:typename"`
+		StartRange    int    `gorm:"column:startrange"`
+		EndRange      int    `gorm:"column:endrange"`
+	}
+	err = db.Raw(`
+SELECT c.accountid, c.accountnumber, t.name AS typename, t.startrange, t.endrange
+FROM chartofaccount c
+JOIN accounttype t ON t.accountid = c.accounttypeid
+WHERE c.accountnumber NOT BETWEEN t.startrange AND t.endrange`).Scan(&charts).Error
+	if err != nil {
+		return err
+	}
+	for _, chart := range charts {
+		report.add(IntegrityFinding{
+			Check:      "account_numbers_in_range",
+			Severity:   SeverityError,
+			Message:    fmt.Sprintf("chart of account %d is outside the %s range %d-%d", chart.AccountNumber, chart.TypeName, chart.StartRange, chart.EndRange),
+			EntityType: "chartofaccount",
+			EntityID:   chart.AccountID,
+		})
+	}
+	return nil
+}
+
+func checkChartAccountTypes(db *gorm.DB, report *IntegrityReport) error {
+	var rows []struct {
+		AccountID     string `gorm:"column:accountid"`
+		AccountNumber int    `gorm:"column:accountnumber"`
+	}
+	err := db.Raw(`
+SELECT c.accountid, c.accountnumber
+FROM chartofaccount c
+LEFT JOIN accounttype t ON t.accountid = c.accounttypeid
+WHERE t.accountid IS NULL`).Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		report.add(IntegrityFinding{
+			Check:      "chart_account_types_exist",
+			Severity:   SeverityError,
+			Message:    fmt.Sprintf("chart of account %d references a missing account type", row.AccountNumber),
+			EntityType: "chartofaccount",
+			EntityID:   row.AccountID,
+		})
+	}
+	return nil
+}
+
+func checkProtectionInstalled(db *gorm.DB, report *IntegrityReport) error {
+	if err := checkJournalProtection(db); err != nil {
+		report.add(IntegrityFinding{Check: "journal_protection", Severity: SeverityError, Message: err.Error()})
+	}
+	return nil
+}
+
+func checkAuditChain(db *gorm.DB, report *IntegrityReport) error {
+	result, err := verifyAuditChain(db)
+	if err != nil {
+		return err
+	}
+	if !result.Valid {
+		report.add(IntegrityFinding{
+			Check:      "audit_chain",
+			Severity:   SeverityError,
+			Message:    fmt.Sprintf("audit chain broken at sequence %d: %s", result.BrokenAt, result.FailureReason),
+			EntityType: "auditlog",
+		})
+		return nil
+	}
+	report.add(IntegrityFinding{
+		Check:    "audit_chain",
+		Severity: SeverityInfo,
+		Message:  fmt.Sprintf("audit chain intact through sequence %d, head hash %s", result.HeadSequence, result.HeadHash),
+	})
+	return nil
+}
+
+func LedgerIntegrityHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := verifyLedgerIntegrity(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		message := "Ledger is consistent"
+		if !report.Valid {
+			message = "Ledger integrity errors found"
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: report})
+	}
+}
@@ -0,0 +1,765 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultInterestAccrualInterval = time.Hour
+	maxInterestRecalculationDays   = 366
+)
+
+// AccountFailure is an account a batch run could not post to. The rest of
+// the batch still goes ahead.
+type AccountFailure struct {
+	AccountNumber int    `json:"account_number"`
+	Error         string `json:"error"`
+}
+
+// InterestPlanRun is the outcome of accruing one plan for one day. Accrued
+// is the day's rounded total; Posted and Settled are what this run added to
+// the ledger, which is zero when a rerun finds nothing has changed.
+type InterestPlanRun struct {
+	PlanID   uuid.UUID        `json:"planid"`
+	Name     string           `json:"name"`
+	Date     time.Time        `json:"date"`
+	Accounts int              `json:"accounts"`
+	Accrued  int              `json:"accrued"`
+	Posted   int              `json:"posted"`
+	Settled  int              `json:"settled"`
+	Failures []AccountFailure `json:"failures,omitempty"`
+}
+
+type InterestRunReport struct {
+	RunAt    time.Time         `json:"run_at"`
+	Runs     []InterestPlanRun `json:"runs"`
+	Posted   int               `json:"posted"`
+	Settled  int               `json:"settled"`
+	Failures int               `json:"failures"`
+}
+
+func (r *InterestRunReport) add(run InterestPlanRun) {
+	r.Posted += run.Posted
+	r.Settled += run.Settled
+	r.Failures += len(run.Failures)
+	if run.Accrued != 0 || run.Posted != 0 || run.Settled != 0 || len(run.Failures) > 0 {
+		r.Runs = append(r.Runs, run)
+	}
+}
+
+type interestBalance struct {
+	AccountID     uuid.UUID `gorm:"column:accountid"`
+	AccountNumber int       `gorm:"column:accountnumber"`
+	Balance       int       `gorm:"column:balance"`
+}
+
+// end-of-day balances are rebuilt from the journal so back-dated postings
+// are picked up when a day is recalculated
+const interestBalancesSQL = `
+SELECT a.accountid, a.accountnumber,
+    COALESCE((SELECT SUM(amount) FROM journalentry
+        WHERE accountcreditnumber = a.accountnumber AND status = 'posted' AND date < ?), 0)
+  - COALESCE((SELECT SUM(amount) FROM journalentry
+        WHERE accountdebitnumber = a.accountnumber AND status = 'posted' AND date < ?), 0) AS balance
+FROM account a
+JOIN chartofaccount coa ON coa.accountid = a.coaid
+WHERE coa.interestplanid = ?
+ORDER BY a.accountnumber`
+
+type interestDue struct {
+	AccountID     uuid.UUID `gorm:"column:accountid"`
+	AccountNumber int       `gorm:"column:accountnumber"`
+	Amount        float64   `gorm:"column:amount"`
+	Settled       int       `gorm:"column:settled"`
+}
+
+const interestDueSQL = `
+SELECT ia.accountid, a.accountnumber, SUM(ia.amount) AS amount, COALESCE(s.amount, 0) AS settled
+FROM interestaccrual ia
+JOIN account a ON a.accountid = ia.accountid
+LEFT JOIN interestsettlement s ON s.accountid = ia.accountid AND s.periodend = ?
+WHERE ia.planid = ? AND ia.accrualdate BETWEEN ? AND ?
+GROUP BY ia.accountid, a.accountnumber, s.amount
+ORDER BY a.accountnumber`
+
+func utcDate(t time.Time) time.Time {
+	year, month, day := t.UTC().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func validDayCount(dayCount string) bool {
+	switch dayCount {
+	case DayCount30360, DayCountActual365, DayCountActualActual:
+		return true
+	}
+	return false
+}
+
+func validSettlementFrequency(frequency string) bool {
+	switch frequency {
+	case SettlementMonthly, SettlementQuarterly, SettlementAnnually:
+		return true
+	}
+	return false
+}
+
+// dayFraction is the share of a year one day of interest covers. 30/360
+// treats every month as 30 days, so the 31st earns nothing and the last day
+// of February makes up the missing days.
+func dayFraction(dayCount string, day time.Time) float64 {
+	switch dayCount {
+	case DayCount30360:
+		if day.Day() == 31 {
+			return 0
+		}
+		if day.Month() == time.February && day.AddDate(0, 0, 1).Month() == time.March {
+			return float64(31-day.Day()) / 360
+		}
+		return 1.0 / 360
+	case DayCountActualActual:
+		return 1 / float64(time.Date(day.Year(), time.December, 31, 0, 0, 0, 0, time.UTC).YearDay())
+	}
+	return 1.0 / 365
+}
+
+// tierRate is the rate of the highest tier the balance reaches; the whole
+// balance earns that rate. tiers must be sorted by MinBalance.
+func tierRate(tiers []InterestTier, balance int) int {
+	rate := 0
+	for _, tier := range tiers {
+		if balance >= tier.MinBalance {
+			rate = tier.RateBps
+		}
+	}
+	return rate
+}
+
+// settlementPeriod returns the first and last day of the calendar month,
+// quarter or year containing day.
+func settlementPeriod(frequency string, day time.Time) (time.Time, time.Time) {
+	months := 1
+	switch frequency {
+	case SettlementQuarterly:
+		months = 3
+	case SettlementAnnually:
+		months = 12
+	}
+	startMonth := time.Month((int(day.Month())-1)/months*months + 1)
+	start := time.Date(day.Year(), startMonth, 1, 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, months, -1)
+}
+
+// accrualSides returns the debit and credit accounts for a positive accrual:
+// deposit interest is an expense owed to the customer, loan interest is
+// income owed by them.
+func accrualSides(plan InterestPlan) (int, int) {
+	if plan.Kind == InterestKindLoan {
+		return plan.AccruedInterestAccount, plan.InterestAccount
+	}
+	return plan.InterestAccount, plan.AccruedInterestAccount
+}
+
+// settlementSides returns the debit and credit accounts that clear an
+// account's accrued interest at period end.
+func settlementSides(plan InterestPlan, accountNumber int) (int, int) {
+	if plan.Kind == InterestKindLoan {
+		return accountNumber, plan.AccruedInterestAccount
+	}
+	if plan.Settlement == InterestSettlementPayout && plan.PayoutAccount != nil {
+		return plan.AccruedInterestAccount, *plan.PayoutAccount
+	}
+	return plan.AccruedInterestAccount, accountNumber
+}
+
+// postInterestEntry posts amount from debit to credit, swapping the sides
+// when a recalculation has to take interest back.
+func postInterestEntry(tx *gorm.DB, debit, credit, amount int, description string, date time.Time, actor AuditActor) error {
+	if amount == 0 {
+		return nil
+	}
+	if amount < 0 {
+		debit, credit, amount = credit, debit, -amount
+		description += " (reversal)"
+	}
+	entry := JournalEntry{
+		AccountDebitNumber:  debit,
+		AccountCreditNumber: credit,
+		Amount:              amount,
+		Description:         description,
+		Date:                date,
+		CreatedBy:           actor.UserID,
+	}
+	if err := postJournalEntry(systemPosting(tx), &entry); err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionPost,
+		EntityType: "journalentry",
+		EntityID:   entry.TransactionID.String(),
+		After:      entry,
+	})
+}
+
+// accruePlan computes one day's interest for every account under the plan's
+// charts of account and posts the difference from what was already posted
+// for that day, so reruns and back-valued recalculations never post twice.
+// On the last day of a settlement period it also settles the period. The
+// plan row is locked so the scheduler and a manual run cannot interleave.
+func accruePlan(db *gorm.DB, plan InterestPlan, day time.Time, actor AuditActor) (InterestPlanRun, error) {
+	run := InterestPlanRun{PlanID: plan.PlanID, Name: plan.Name, Date: day}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("planid = ?", plan.PlanID).First(&InterestPlan{}).Error
+		if err != nil {
+			return err
+		}
+
+		var balances []interestBalance
+		next := day.AddDate(0, 0, 1)
+		if err := tx.Raw(interestBalancesSQL, next, next, plan.PlanID).Scan(&balances).Error; err != nil {
+			return fmt.Errorf("failed to compute end of day balances: %v", err)
+		}
+
+		now := time.Now()
+		fraction := dayFraction(plan.DayCount, day)
+		accruals := []InterestAccrual{}
+		for _, b := range balances {
+			principal := b.Balance
+			if plan.Kind == InterestKindLoan {
+				principal = -b.Balance
+			}
+			if principal <= 0 {
+				continue
+			}
+			rate := tierRate(plan.Tiers, principal)
+			amount := float64(principal) * float64(rate) / 10000 * fraction
+			if amount == 0 {
+				continue
+			}
+			accruals = append(accruals, InterestAccrual{
+				AccountID:    b.AccountID,
+				AccrualDate:  day,
+				PlanID:       plan.PlanID,
+				Balance:      b.Balance,
+				RateBps:      rate,
+				Amount:       amount,
+				CalculatedAt: now,
+			})
+		}
+		run.Accounts = len(accruals)
+
+		if err := tx.Where("planid = ? AND accrualdate = ?", plan.PlanID, day).Delete(&InterestAccrual{}).Error; err != nil {
+			return err
+		}
+		if len(accruals) > 0 {
+			err := tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(&accruals, 500).Error
+			if err != nil {
+				return fmt.Errorf("failed to record accruals: %v", err)
+			}
+		}
+
+		var total float64
+		for _, accrual := range accruals {
+			total += accrual.Amount
+		}
+		run.Accrued = int(math.Round(total))
+
+		var previous InterestRun
+		err = tx.Where("planid = ? AND accrualdate = ?", plan.PlanID, day).First(&previous).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		run.Posted = run.Accrued - previous.Posted
+
+		debit, credit := accrualSides(plan)
+		description := fmt.Sprintf("Interest accrual %s %s", plan.Name, day.Format("2006-01-02"))
+		if err := postInterestEntry(tx, debit, credit, run.Posted, description, day, actor); err != nil {
+			return err
+		}
+		record := InterestRun{
+			PlanID:      plan.PlanID,
+			AccrualDate: day,
+			Posted:      run.Accrued,
+			Adjustment:  previous.Adjustment,
+			RunAt:       now,
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&record).Error; err != nil {
+			return err
+		}
+
+		start, end := settlementPeriod(plan.SettlementFrequency, day)
+		if !day.Equal(end) {
+			return nil
+		}
+		return settlePlan(tx, plan, start, &record, &run, actor)
+	})
+	return run, err
+}
+
+// settlePlan capitalizes or pays out each account's interest for the period
+// ending on run's date. Each account is rounded once for the whole period
+// and any earlier settlement of the same period is topped up or taken back.
+// An account that cannot take the posting, e.g. a frozen one, is reported
+// and retried when the period end is run again. Finally the difference
+// between the daily rounded postings and the per-account amounts is posted
+// so the accrued interest account clears.
+func settlePlan(tx *gorm.DB, plan InterestPlan, start time.Time, record *InterestRun, run *InterestPlanRun, actor AuditActor) error {
+	end := record.AccrualDate
+
+	var dues []interestDue
+	if err := tx.Raw(interestDueSQL, end, plan.PlanID, start, end).Scan(&dues).Error; err != nil {
+		return fmt.Errorf("failed to total accrued interest: %v", err)
+	}
+
+	settleDate := end.AddDate(0, 0, 1)
+	totalDue := 0
+	for _, due := range dues {
+		amount := int(math.Round(due.Amount))
+		totalDue += amount
+		delta := amount - due.Settled
+		if delta == 0 {
+			continue
+		}
+
+		err := tx.Transaction(func(stx *gorm.DB) error {
+			debit, credit := settlementSides(plan, due.AccountNumber)
+			description := fmt.Sprintf("Interest %s %s to %s", plan.Settlement, start.Format("2006-01-02"), end.Format("2006-01-02"))
+			if err := postInterestEntry(stx, debit, credit, delta, description, settleDate, actor); err != nil {
+				return err
+			}
+			settlement := InterestSettlement{
+				AccountID: due.AccountID,
+				PeriodEnd: end,
+				PlanID:    plan.PlanID,
+				Amount:    amount,
+				SettledAt: time.Now(),
+			}
+			return stx.Clauses(clause.OnConflict{UpdateAll: true}).Create(&settlement).Error
+		})
+		if err != nil {
+			run.Failures = append(run.Failures, AccountFailure{AccountNumber: due.AccountNumber, Error: err.Error()})
+			continue
+		}
+		run.Settled += delta
+	}
+
+	var posted int
+	err := tx.Model(&InterestRun{}).
+		Where("planid = ? AND accrualdate BETWEEN ? AND ?", plan.PlanID, start, end).
+		Select("COALESCE(SUM(posted), 0)").
+		Scan(&posted).Error
+	if err != nil {
+		return err
+	}
+	adjustment := totalDue - posted
+	if adjustment == record.Adjustment {
+		return nil
+	}
+
+	debit, credit := accrualSides(plan)
+	description := fmt.Sprintf("Interest rounding %s %s to %s", plan.Name, start.Format("2006-01-02"), end.Format("2006-01-02"))
+	if err := postInterestEntry(tx, debit, credit, adjustment-record.Adjustment, description, end, actor); err != nil {
+		return err
+	}
+	record.Adjustment = adjustment
+	return tx.Model(&InterestRun{}).
+		Where("planid = ? AND accrualdate = ?", plan.PlanID, end).
+		Update("adjustment", adjustment).Error
+}
+
+func loadInterestPlans(db *gorm.DB) ([]InterestPlan, error) {
+	var plans []InterestPlan
+	err := db.Preload("Tiers", func(db *gorm.DB) *gorm.DB {
+		return db.Order("minbalance")
+	}).Order("name").Find(&plans).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to load interest plans: %v", err)
+	}
+	return plans, nil
+}
+
+// recalculateInterest reruns every day from from to to. A settlement period
+// the range ends inside is run to its end when that day has passed, so
+// back-valued changes reach the settled amounts too.
+func recalculateInterest(db *gorm.DB, from, to time.Time, actor AuditActor) (*InterestRunReport, error) {
+	plans, err := loadInterestPlans(db)
+	if err != nil {
+		return nil, err
+	}
+
+	yesterday := utcDate(time.Now()).AddDate(0, 0, -1)
+	report := &InterestRunReport{RunAt: time.Now(), Runs: []InterestPlanRun{}}
+	for _, plan := range plans {
+		last := to
+		if _, end := settlementPeriod(plan.SettlementFrequency, to); !end.After(yesterday) {
+			last = end
+		}
+		for day := from; !day.After(last); day = day.AddDate(0, 0, 1) {
+			run, err := accruePlan(db, plan, day, actor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to accrue %s for %s: %v", plan.Name, day.Format("2006-01-02"), err)
+			}
+			report.add(run)
+		}
+	}
+	return report, nil
+}
+
+// accrueDueInterest runs every day each plan has not been run for, up to and
+// including yesterday. A new plan starts on the day it was created.
+func accrueDueInterest(db *gorm.DB, actor AuditActor) (*InterestRunReport, error) {
+	plans, err := loadInterestPlans(db)
+	if err != nil {
+		return nil, err
+	}
+
+	yesterday := utcDate(time.Now()).AddDate(0, 0, -1)
+	report := &InterestRunReport{RunAt: time.Now(), Runs: []InterestPlanRun{}}
+	for _, plan := range plans {
+		var last sql.NullTime
+		err := db.Model(&InterestRun{}).Where("planid = ?", plan.PlanID).Select("MAX(accrualdate)").Scan(&last).Error
+		if err != nil {
+			return nil, err
+		}
+		from := utcDate(plan.CreatedAt)
+		if last.Valid {
+			from = utcDate(last.Time).AddDate(0, 0, 1)
+		}
+		for day := from; !day.After(yesterday); day = day.AddDate(0, 0, 1) {
+			run, err := accruePlan(db, plan, day, actor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to accrue %s for %s: %v", plan.Name, day.Format("2006-01-02"), err)
+			}
+			report.add(run)
+		}
+	}
+	return report, nil
+}
+
+// runInterestAccrual catches every plan up to yesterday every interval until
+// ctx is done.
+func runInterestAccrual(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	actor := AuditActor{UserID: "system", Method: "JOB", Endpoint: "interest-accrual"}
+	logger = logger.With("job", actor.Endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := accrueDueInterest(db, actor)
+			if err != nil {
+				logger.Error("interest accrual failed", "error", err)
+				continue
+			}
+			if report.Failures > 0 {
+				logger.Warn("interest could not be settled", "accounts", report.Failures)
+			}
+		}
+	}
+}
+
+func CreateInterestPlanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Name                   string         `json:"name"`
+			Kind                   string         `json:"kind"`
+			DayCount               string         `json:"day_count"`
+			Tiers                  []InterestTier `json:"tiers"`
+			AccruedInterestAccount int            `json:"accrued_interest_account"`
+			InterestAccount        int            `json:"interest_account"`
+			Settlement             string         `json:"settlement"`
+			SettlementFrequency    string         `json:"settlement_frequency"`
+			PayoutAccount          *int           `json:"payout_account"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.Settlement == "" {
+			data.Settlement = InterestSettlementCapitalize
+		}
+		if data.SettlementFrequency == "" {
+			data.SettlementFrequency = SettlementMonthly
+		}
+
+		var problems []string
+		if data.Name == "" {
+			problems = append(problems, "name is required")
+		}
+		if data.Kind != InterestKindDeposit && data.Kind != InterestKindLoan {
+			problems = append(problems, fmt.Sprintf("kind must be %s or %s", InterestKindDeposit, InterestKindLoan))
+		}
+		if !validDayCount(data.DayCount) {
+			problems = append(problems, fmt.Sprintf("day_count must be one of %s, %s or %s", DayCount30360, DayCountActual365, DayCountActualActual))
+		}
+		if len(data.Tiers) == 0 {
+			problems = append(problems, "at least one tier is required")
+		}
+		sort.Slice(data.Tiers, func(i, j int) bool { return data.Tiers[i].MinBalance < data.Tiers[j].MinBalance })
+		for i, tier := range data.Tiers {
+			if tier.MinBalance < 0 || tier.RateBps < 0 {
+				problems = append(problems, "tier min_balance and rate_bps cannot be negative")
+				break
+			}
+			if i > 0 && tier.MinBalance == data.Tiers[i-1].MinBalance {
+				problems = append(problems, fmt.Sprintf("more than one tier starts at %d", tier.MinBalance))
+				break
+			}
+		}
+		if _, err := getAccountNumber(db, data.AccruedInterestAccount); err != nil {
+			problems = append(problems, "Invalid accrued_interest_account")
+		}
+		if _, err := getAccountNumber(db, data.InterestAccount); err != nil {
+			problems = append(problems, "Invalid interest_account")
+		}
+		if !validSettlementFrequency(data.SettlementFrequency) {
+			problems = append(problems, fmt.Sprintf("settlement_frequency must be one of %s, %s or %s", SettlementMonthly, SettlementQuarterly, SettlementAnnually))
+		}
+		switch data.Settlement {
+		case InterestSettlementCapitalize:
+			data.PayoutAccount = nil
+		case InterestSettlementPayout:
+			if data.Kind == InterestKindLoan {
+				problems = append(problems, "loan interest can only be capitalized")
+			} else if data.PayoutAccount == nil {
+				problems = append(problems, "payout_account is required to pay interest out")
+			} else if _, err := getAccountNumber(db, *data.PayoutAccount); err != nil {
+				problems = append(problems, "Invalid payout_account")
+			}
+		default:
+			problems = append(problems, fmt.Sprintf("settlement must be %s or %s", InterestSettlementCapitalize, InterestSettlementPayout))
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		plan := InterestPlan{
+			Name:                   data.Name,
+			Kind:                   data.Kind,
+			DayCount:               data.DayCount,
+			AccruedInterestAccount: data.AccruedInterestAccount,
+			InterestAccount:        data.InterestAccount,
+			Settlement:             data.Settlement,
+			SettlementFrequency:    data.SettlementFrequency,
+			PayoutAccount:          data.PayoutAccount,
+			Tiers:                  data.Tiers,
+			CreatedBy:              c.GetString("userID"),
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&plan).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "interestplan",
+				EntityID:   plan.PlanID.String(),
+				After:      plan,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Interest plan created successfully", StatusCode: http.StatusCreated, Data: plan})
+	}
+}
+
+func ListInterestPlanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		plans, err := loadInterestPlans(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Interest Plan List", StatusCode: http.StatusOK, Data: plans})
+	}
+}
+
+// SetChartInterestPlanHandler attaches an interest plan to every account
+// under a chart of account, or detaches it when plan_id is empty.
+func SetChartInterestPlanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		coaID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid chart of account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			PlanID string `json:"plan_id"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		var planID *uuid.UUID
+		if data.PlanID != "" {
+			parsed, err := uuid.Parse(data.PlanID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid plan_id", StatusCode: http.StatusBadRequest})
+				return
+			}
+			if err := db.Where("planid = ?", parsed).First(&InterestPlan{}).Error; err != nil {
+				respondNotFoundOr500(c, err, "Interest plan not found")
+				return
+			}
+			planID = &parsed
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var coa ChartOfAccount
+			if err := tx.Where("accountid = ?", coaID).First(&coa).Error; err != nil {
+				return err
+			}
+			before := coa
+			coa.InterestPlanID = planID
+			if err := tx.Model(&ChartOfAccount{}).Where("accountid = ?", coaID).Update("interestplanid", planID).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "chartofaccount",
+				EntityID:   coaID.String(),
+				Before:     before,
+				After:      coa,
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Chart of account not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Chart of account interest plan updated successfully", StatusCode: http.StatusOK})
+	}
+}
+
+func parseInterestDate(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	day, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day, nil
+}
+
+// InterestAccrualHandler reruns interest for a range of past days, by
+// default yesterday. Use it after back-dated postings or approvals.
+func InterestAccrualHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			From string `json:"from"`
+			To   string `json:"to"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&data); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+				return
+			}
+		}
+
+		yesterday := utcDate(time.Now()).AddDate(0, 0, -1)
+		to, err := parseInterestDate(data.To, yesterday)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date format", StatusCode: http.StatusBadRequest})
+			return
+		}
+		from, err := parseInterestDate(data.From, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date format", StatusCode: http.StatusBadRequest})
+			return
+		}
+		switch {
+		case to.After(yesterday):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Interest can only be run for days that have ended", StatusCode: http.StatusBadRequest})
+			return
+		case from.After(to):
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must not be after to", StatusCode: http.StatusBadRequest})
+			return
+		case to.Sub(from) >= maxInterestRecalculationDays*24*time.Hour:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("At most %d days can be run at once", maxInterestRecalculationDays), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		report, err := recalculateInterest(db, from, to, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: fmt.Sprintf("Interest run from %s to %s", from.Format("2006-01-02"), to.Format("2006-01-02")),
+			StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+// AccountInterestHandler lists an account's daily accruals and settlements,
+// by default for the current month.
+func AccountInterestHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		today := utcDate(time.Now())
+		from, err := parseInterestDate(c.Query("from"), today.AddDate(0, 0, 1-today.Day()))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid from date format", StatusCode: http.StatusBadRequest})
+			return
+		}
+		to, err := parseInterestDate(c.Query("to"), today)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid to date format", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		if err := db.Where("accountid = ?", accountID).First(&Account{}).Error; err != nil {
+			respondNotFoundOr500(c, err, "Account not found")
+			return
+		}
+
+		accruals := []InterestAccrual{}
+		err = db.Where("accountid = ? AND accrualdate BETWEEN ? AND ?", accountID, from, to).Order("accrualdate").Find(&accruals).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		settlements := []InterestSettlement{}
+		err = db.Where("accountid = ? AND periodend BETWEEN ? AND ?", accountID, from, to).Order("periodend").Find(&settlements).Error
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		var accrued float64
+		for _, accrual := range accruals {
+			accrued += accrual.Amount
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account Interest", StatusCode: http.StatusOK, Data: gin.H{
+			"from":        from,
+			"to":          to,
+			"accrued":     math.Round(accrued*100) / 100,
+			"accruals":    accruals,
+			"settlements": settlements,
+		}})
+	}
+}
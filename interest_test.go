@@ -0,0 +1,73 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+func TestSettlementPeriod(t *testing.T) {
+	for _, tc := range []struct {
+		frequency  string
+		day        time.Time
+		start, end time.Time
+	}{
+		{SettlementMonthly, date(2024, 2, 10), date(2024, 2, 1), date(2024, 2, 29)},
+		{SettlementMonthly, date(2023, 12, 31), date(2023, 12, 1), date(2023, 12, 31)},
+		{SettlementQuarterly, date(2024, 5, 15), date(2024, 4, 1), date(2024, 6, 30)},
+		{SettlementQuarterly, date(2024, 12, 31), date(2024, 10, 1), date(2024, 12, 31)},
+		{SettlementAnnually, date(2024, 7, 4), date(2024, 1, 1), date(2024, 12, 31)},
+	} {
+		start, end := settlementPeriod(tc.frequency, tc.day)
+		if !start.Equal(tc.start) || !end.Equal(tc.end) {
+			t.Errorf("%s period of %s: got %s to %s, want %s to %s", tc.frequency, tc.day.Format("2006-01-02"),
+				start.Format("2006-01-02"), end.Format("2006-01-02"), tc.start.Format("2006-01-02"), tc.end.Format("2006-01-02"))
+		}
+	}
+}
+
+func TestDayFraction30360(t *testing.T) {
+	// every month adds up to 30 days, however long it is
+	for _, month := range []time.Time{date(2023, 2, 1), date(2024, 2, 1), date(2024, 1, 1), date(2024, 4, 1)} {
+		total := 0.0
+		for day := month; day.Month() == month.Month(); day = day.AddDate(0, 0, 1) {
+			total += dayFraction(DayCount30360, day)
+		}
+		if math.Abs(total-30.0/360) > 1e-9 {
+			t.Errorf("%s: 30/360 month adds up to %v days, want 30", month.Format("2006-01"), total*360)
+		}
+	}
+}
+
+func TestDayFractionActual(t *testing.T) {
+	if got := dayFraction(DayCountActual365, date(2024, 3, 1)); got != 1.0/365 {
+		t.Errorf("actual/365 in a leap year: got %v, want 1/365", got)
+	}
+	if got := dayFraction(DayCountActualActual, date(2024, 3, 1)); got != 1.0/366 {
+		t.Errorf("actual/actual in a leap year: got %v, want 1/366", got)
+	}
+	if got := dayFraction(DayCountActualActual, date(2023, 3, 1)); got != 1.0/365 {
+		t.Errorf("actual/actual in a common year: got %v, want 1/365", got)
+	}
+}
+
+func TestTierRate(t *testing.T) {
+	tiers := []InterestTier{{MinBalance: 0, RateBps: 100}, {MinBalance: 10000, RateBps: 200}, {MinBalance: 50000, RateBps: 300}}
+	for balance, want := range map[int]int{-500: 0, 0: 100, 9999: 100, 10000: 200, 75000: 300} {
+		if got := tierRate(tiers, balance); got != want {
+			t.Errorf("balance %d: got %d bps, want %d", balance, got, want)
+		}
+	}
+}
+
+func TestUTCDate(t *testing.T) {
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	got := utcDate(time.Date(2024, 3, 1, 1, 30, 0, 0, nairobi))
+	if !got.Equal(date(2024, 2, 29)) {
+		t.Errorf("got %s, want the UTC day 2024-02-29", got)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPostedEntryImmutable = errors.New("posted journal entries are immutable, post a reversal instead")
+
+// journal protections installed by migration 4 and checked at startup
+var journalProtectionTriggers = []string{
+	"journalentry_protect_posted",
+	"journalentry_no_truncate",
+	"auditlog_no_modify",
+	"auditlog_no_truncate",
+}
+
+// BeforeUpdate refuses to touch an entry that is already posted in the
+// database. Pending entries may still be posted or rejected.
+func (j *JournalEntry) BeforeUpdate(tx *gorm.DB) error {
+	return j.checkMutable(tx)
+}
+
+func (j *JournalEntry) BeforeDelete(tx *gorm.DB) error {
+	return j.checkMutable(tx)
+}
+
+func (j *JournalEntry) checkMutable(tx *gorm.DB) error {
+	if j.TransactionID == uuid.Nil {
+		return ErrPostedEntryImmutable
+	}
+
+	var status string
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&JournalEntry{}).
+		Select("status").
+		Where("transactionid = ?", j.TransactionID).
+		Scan(&status).Error
+	if err != nil {
+		return err
+	}
+	if status == JournalStatusPosted {
+		return ErrPostedEntryImmutable
+	}
+	return nil
+}
+
+// checkJournalProtection verifies that the database triggers guarding the
+// journal and the audit log are installed and enabled.
+func checkJournalProtection(db *gorm.DB) error {
+	var installed []string
+	err := db.Raw(`SELECT tgname FROM pg_trigger
+		WHERE tgname IN ? AND NOT tgisinternal AND tgenabled <> 'D'`, journalProtectionTriggers).
+		Scan(&installed).Error
+	if err != nil {
+		return fmt.Errorf("failed to read triggers: %v", err)
+	}
+
+	found := make(map[string]bool, len(installed))
+	for _, name := range installed {
+		found[name] = true
+	}
+	for _, name := range journalProtectionTriggers {
+		if !found[name] {
+			return fmt.Errorf("trigger %s is missing or disabled", name)
+		}
+	}
+	return nil
+}
+
+func ReverseJournalEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		transactionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid transaction ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil || data.Reason == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A reversal reason is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var reversal JournalEntry
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var original JournalEntry
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("transactionid = ?", transactionID).
+				First(&original).Error
+			if err != nil {
+				return err
+			}
+			if original.Status != JournalStatusPosted {
+				return errNotReversible("Only posted entries can be reversed")
+			}
+			if original.ReversalOf != nil {
+				return errNotReversible("A reversal cannot itself be reversed, post a new entry instead")
+			}
+
+			var existing int64
+			err = tx.Model(&JournalEntry{}).Where("reversalof = ?", original.TransactionID).Count(&existing).Error
+			if err != nil {
+				return err
+			}
+			if existing > 0 {
+				return errNotReversible("Journal entry has already been reversed")
+			}
+
+			reversal = newReversal(original, data.Reason, c.GetString("userID"))
+			if err := postJournalEntry(systemPosting(tx), &reversal); err != nil {
+				return err
+			}
+			err = publishEvent(tx, EventJournalReversed, original.TransactionID.String(), gin.H{
+				"transactionid": original.TransactionID,
+				"reversal":      reversal.TransactionID,
+				"amount":        original.Amount,
+				"reason":        data.Reason,
+			})
+			if err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionReverse,
+				EntityType: "journalentry",
+				EntityID:   original.TransactionID.String(),
+				Before:     original,
+				After:      reversal,
+			})
+		})
+		if err != nil {
+			var notReversible errNotReversible
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: "Journal entry not found", StatusCode: http.StatusNotFound})
+			case errors.As(err, &notReversible):
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			default:
+				respondPostingError(c, err)
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Journal entry reversed successfully", StatusCode: http.StatusOK,
+			Data: gin.H{"transactionid": reversal.TransactionID}})
+	}
+}
+
+// newReversal is the entry that undoes original, with its sides swapped,
+// dated today.
+func newReversal(original JournalEntry, reason string, createdBy string) JournalEntry {
+	return JournalEntry{
+		AccountDebitNumber:  original.AccountCreditNumber,
+		AccountCreditNumber: original.AccountDebitNumber,
+		Amount:              original.Amount,
+		Description:         fmt.Sprintf("Reversal of %s: %s", original.TransactionID, reason),
+		Date:                time.Now(),
+		CreatedBy:           createdBy,
+		ReversalOf:          &original.TransactionID,
+	}
+}
+
+type errNotReversible string
+
+func (e errNotReversible) Error() string {
+	return string(e)
+}
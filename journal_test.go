@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestNewReversal(t *testing.T) {
+	original := JournalEntry{TransactionID: uuid.MustParse(testEntryID), AccountDebitNumber: 1001, AccountCreditNumber: 2001,
+		Amount: 5000, Status: JournalStatusPosted, CreatedBy: "maker", Date: date(2024, 1, 15)}
+
+	reversal := newReversal(original, "duplicate", "checker")
+	if reversal.AccountDebitNumber != 2001 || reversal.AccountCreditNumber != 1001 || reversal.Amount != 5000 {
+		t.Errorf("got debit %d credit %d amount %d, want debit 2001 credit 1001 amount 5000",
+			reversal.AccountDebitNumber, reversal.AccountCreditNumber, reversal.Amount)
+	}
+	if reversal.ReversalOf == nil || *reversal.ReversalOf != original.TransactionID {
+		t.Errorf("reversal points at %v, want %s", reversal.ReversalOf, original.TransactionID)
+	}
+	if reversal.TransactionID != uuid.Nil || reversal.CreatedBy != "checker" || !strings.Contains(reversal.Description, "duplicate") {
+		t.Errorf("got %+v, want a new entry by checker giving the reason", reversal)
+	}
+}
+
+func TestReverseRefusals(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reversalOf := "00000000-0000-0000-0000-0000000000e0"
+
+	for _, tc := range []struct {
+		name       string
+		status     string
+		reversalOf interface{}
+		reversals  int64
+		want       int
+	}{
+		{name: "already reversed", status: JournalStatusPosted, reversals: 1, want: http.StatusConflict},
+		{name: "a reversal", status: JournalStatusPosted, reversalOf: reversalOf, want: http.StatusConflict},
+		{name: "pending", status: JournalStatusPending, want: http.StatusConflict},
+		{name: "rejected", status: JournalStatusRejected, want: http.StatusConflict},
+		{name: "missing", want: http.StatusNotFound},
+	} {
+		db, fake := newFakeDB(t)
+		fake.returns(`SELECT count(*) FROM "journalentry"`, []string{"count"}, []driver.Value{tc.reversals})
+		if tc.status != "" {
+			fake.returns(`SELECT * FROM "journalentry"`,
+				[]string{"transactionid", "accountdebitnumber", "accountcreditnumber", "amount", "status", "reversalof"},
+				[]driver.Value{testEntryID, int64(1001), int64(2001), int64(5000), tc.status, tc.reversalOf})
+		}
+		router := gin.New()
+		router.POST("/journal/:id/reverse", func(c *gin.Context) { c.Set("userID", "checker") }, ReverseJournalEntryHandler(db))
+
+		request := httptest.NewRequest(http.MethodPost, "/journal/"+testEntryID+"/reverse", strings.NewReader(`{"reason":"duplicate"}`))
+		request.Header.Set("Content-Type", "application/json")
+		response := httptest.NewRecorder()
+		router.ServeHTTP(response, request)
+
+		if response.Code != tc.want {
+			t.Errorf("%s: got %d %s, want %d", tc.name, response.Code, response.Body, tc.want)
+		}
+		for _, query := range fake.queries() {
+			if strings.HasPrefix(query, "UPDATE") || strings.HasPrefix(query, "INSERT") {
+				t.Errorf("%s: refused reversal still wrote %s", tc.name, query)
+			}
+		}
+	}
+}
+
+func TestPostedEntriesAreImmutable(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		status string
+		entry  JournalEntry
+		want   error
+	}{
+		{name: "posted", status: JournalStatusPosted, entry: JournalEntry{TransactionID: uuid.MustParse(testEntryID)}, want: ErrPostedEntryImmutable},
+		{name: "pending", status: JournalStatusPending, entry: JournalEntry{TransactionID: uuid.MustParse(testEntryID)}},
+		{name: "rejected", status: JournalStatusRejected, entry: JournalEntry{TransactionID: uuid.MustParse(testEntryID)}},
+		// without an ID the update could reach any row
+		{name: "no transaction ID", status: JournalStatusPending, want: ErrPostedEntryImmutable},
+	} {
+		for _, write := range []string{"update", "delete"} {
+			db, fake := newFakeDB(t)
+			fake.returns(`SELECT "status" FROM "journalentry"`, []string{"status"}, []driver.Value{tc.status})
+
+			entry := tc.entry
+			var err error
+			if write == "update" {
+				err = db.Model(&entry).Update("description", "changed").Error
+			} else {
+				err = db.Delete(&entry).Error
+			}
+			if !errors.Is(err, tc.want) {
+				t.Errorf("%s %s: got %v, want %v", write, tc.name, err, tc.want)
+			}
+			wrote := false
+			for _, query := range fake.queries() {
+				wrote = wrote || strings.HasPrefix(query, "UPDATE") || strings.HasPrefix(query, "DELETE")
+			}
+			if wrote != (tc.want == nil) {
+				t.Errorf("%s %s: sent a write %v, want %v", write, tc.name, wrote, tc.want == nil)
+			}
+		}
+	}
+}
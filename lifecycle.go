@@ -0,0 +1,455 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AccountStatusPending      = "pending"
+	AccountStatusActive       = "active"
+	AccountStatusDormant      = "dormant"
+	AccountStatusFrozenDebit  = "frozen_debit"
+	AccountStatusFrozenCredit = "frozen_credit"
+	AccountStatusFrozen       = "frozen"
+	AccountStatusClosed       = "closed"
+)
+
+// closingSweepKey marks the account being closed on the sweep's session so
+// the sweep can empty it even while it is dormant
+const closingSweepKey = "ledger:closing_sweep"
+
+// systemPostingKey marks a session whose postings the ledger makes on its
+// own account, such as interest, fees and reversals, so they do not count as
+// customer activity
+const systemPostingKey = "ledger:system_posting"
+
+// systemPosting returns a session of tx whose postings are marked with
+// systemPostingKey. The settings go through Session so each query on it
+// starts from a clean statement; after a bare Set on a transaction, queries
+// would stack each other's conditions.
+func systemPosting(tx *gorm.DB) *gorm.DB {
+	return tx.Set(systemPostingKey, true).Session(&gorm.Session{})
+}
+
+const (
+	defaultDormancyPeriod        = 365 * 24 * time.Hour
+	defaultDormancyCheckInterval = 24 * time.Hour
+)
+
+// accountTransitions lists the states each state may move to. Closed is
+// final, and a frozen account has to be unfrozen before it can be closed.
+var accountTransitions = map[string][]string{
+	AccountStatusPending:      {AccountStatusActive, AccountStatusClosed},
+	AccountStatusActive:       {AccountStatusDormant, AccountStatusFrozenDebit, AccountStatusFrozenCredit, AccountStatusFrozen, AccountStatusClosed},
+	AccountStatusDormant:      {AccountStatusActive, AccountStatusFrozenDebit, AccountStatusFrozenCredit, AccountStatusFrozen, AccountStatusClosed},
+	AccountStatusFrozenDebit:  {AccountStatusActive, AccountStatusFrozenCredit, AccountStatusFrozen},
+	AccountStatusFrozenCredit: {AccountStatusActive, AccountStatusFrozenDebit, AccountStatusFrozen},
+	AccountStatusFrozen:       {AccountStatusActive, AccountStatusFrozenDebit, AccountStatusFrozenCredit},
+	AccountStatusClosed:       {},
+}
+
+func canTransition(from, to string) bool {
+	for _, allowed := range accountTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// statusAccepts reports whether an account in status may take a posting on
+// side. Dormant accounts still receive credits but need reactivating before
+// funds can leave them.
+func statusAccepts(status, side string) bool {
+	switch status {
+	case AccountStatusActive:
+		return true
+	case AccountStatusDormant, AccountStatusFrozenDebit:
+		return side == "credit"
+	case AccountStatusFrozenCredit:
+		return side == "debit"
+	default:
+		return false
+	}
+}
+
+type AccountStatusError struct {
+	AccountNumber int
+	Status        string
+	Side          string
+}
+
+func (e *AccountStatusError) Error() string {
+	return fmt.Sprintf("Account %d is %s and does not accept %ss", e.AccountNumber, e.Status, e.Side)
+}
+
+type errAccountTransition string
+
+func (e errAccountTransition) Error() string {
+	return string(e)
+}
+
+// checkAccountPostable refuses a posting the account's status does not allow.
+// Inside a transaction the account row is locked, so a status change waits
+// for postings already in flight and the reverse. The lock is exclusive
+// rather than shared so the posting can later record activity on the row
+// without waiting on another posting's share lock.
+func checkAccountPostable(db *gorm.DB, accountNumber int, side string) error {
+	if closing, ok := db.Get(closingSweepKey); ok && closing == accountNumber {
+		return nil
+	}
+
+	var account Account
+	err := db.Clauses(clause.Locking{Strength: "NO KEY UPDATE"}).
+		Where("accountnumber = ?", accountNumber).
+		First(&account).Error
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s account status: %v", side, err)
+	}
+	if !statusAccepts(account.Status, side) {
+		return &AccountStatusError{AccountNumber: accountNumber, Status: account.Status, Side: side}
+	}
+	return nil
+}
+
+// checkAccountsPostable runs checkAccountPostable on both sides of a
+// posting, locking the lower account number first so two postings between
+// the same accounts in opposite directions cannot deadlock.
+func checkAccountsPostable(db *gorm.DB, debitAccountNumber, creditAccountNumber int) error {
+	checks := []struct {
+		accountNumber int
+		side          string
+	}{
+		{debitAccountNumber, "debit"},
+		{creditAccountNumber, "credit"},
+	}
+	if creditAccountNumber < debitAccountNumber {
+		checks[0], checks[1] = checks[1], checks[0]
+	}
+	for _, check := range checks {
+		if err := checkAccountPostable(db, check.accountNumber, check.side); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordAccountActivity marks customer-initiated activity on the accounts,
+// which resets the dormancy clock. postJournalEntry calls it for every
+// posting not made on a session marked with systemPostingKey, after
+// checkAccountsPostable has locked the rows. Only accounts a customer owns
+// can go dormant, so the bank's own accounts are left alone.
+func recordAccountActivity(tx *gorm.DB, accountNumbers ...int) error {
+	err := tx.Model(&Account{}).
+		Where("accountnumber IN ?", accountNumbers).
+		Where("EXISTS (SELECT 1 FROM accountowner o WHERE o.accountid = account.accountid)").
+		Update("lastactivityat", time.Now()).Error
+	if err != nil {
+		return fmt.Errorf("failed to record account activity: %v", err)
+	}
+	return nil
+}
+
+// ChangeAccountStatusHandler moves an account through its lifecycle. Closing
+// needs a zero balance and no active holds; a non-zero balance can be swept
+// to sweep_account in the same transaction.
+func ChangeAccountStatusHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		accountID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var data struct {
+			Status       string `json:"status"`
+			Reason       string `json:"reason"`
+			SweepAccount int    `json:"sweep_account"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if _, ok := accountTransitions[data.Status]; !ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid account status", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if data.Reason == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A reason for the status change is required", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var account Account
+		var sweep *JournalEntry
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", accountID).
+				First(&account).Error
+			if err != nil {
+				return err
+			}
+			if !canTransition(account.Status, data.Status) {
+				return errAccountTransition(fmt.Sprintf("Account cannot move from %s to %s", account.Status, data.Status))
+			}
+
+			if data.Status == AccountStatusClosed {
+				sweep, err = prepareClose(tx, account, data.SweepAccount, data.Reason, c.GetString("userID"))
+				if err != nil {
+					return err
+				}
+				if sweep != nil {
+					err = recordAudit(tx, auditActor(c), AuditEvent{
+						Action:     AuditActionPost,
+						EntityType: "journalentry",
+						EntityID:   sweep.TransactionID.String(),
+						After:      sweep,
+					})
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			before := account
+			now := time.Now()
+			account.Status = data.Status
+			account.StatusReason = data.Reason
+			account.StatusChangedAt = &now
+			err = tx.Model(&Account{}).Where("accountid = ?", accountID).Updates(map[string]interface{}{
+				"status":          account.Status,
+				"statusreason":    account.StatusReason,
+				"statuschangedat": account.StatusChangedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "account",
+				EntityID:   accountID.String(),
+				Before:     before,
+				After:      account,
+			})
+		})
+		if err != nil {
+			var transition errAccountTransition
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, ErrorResponse{Error: "Account not found", StatusCode: http.StatusNotFound})
+			case errors.As(err, &transition):
+				c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			default:
+				respondPostingError(c, err)
+			}
+			return
+		}
+
+		response := gin.H{"status": account.Status}
+		if sweep != nil {
+			response["sweep_transactionid"] = sweep.TransactionID
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Account status updated successfully", StatusCode: http.StatusOK, Data: response})
+	}
+}
+
+// prepareClose checks that account can be closed and, when it still holds a
+// balance, posts a sweep of the whole balance to sweepAccount.
+func prepareClose(tx *gorm.DB, account Account, sweepAccount int, reason, userID string) (*JournalEntry, error) {
+	held, err := heldAmount(tx, account.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	if held > 0 {
+		return nil, errAccountTransition("Release or expire the account's active holds before closing it")
+	}
+
+	var balance AccountBalance
+	err = tx.Where("accountid = ?", account.AccountID).Limit(1).Find(&balance).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch account balance: %v", err)
+	}
+	if balance.Balance == 0 {
+		return nil, nil
+	}
+	if sweepAccount == 0 {
+		return nil, errAccountTransition(fmt.Sprintf("Account balance is %d, it must be zero to close or a sweep_account must be given", balance.Balance))
+	}
+	if sweepAccount == account.AccountNumber {
+		return nil, errAccountTransition("An account cannot be swept into itself")
+	}
+	if _, err := getAccountNumber(tx, sweepAccount); err != nil {
+		return nil, errAccountTransition("Invalid sweep account number")
+	}
+
+	// a positive balance is funds held for the account holder, so it moves
+	// out with a debit; a negative balance is settled from the sweep account
+	sweep := &JournalEntry{
+		AccountDebitNumber:  account.AccountNumber,
+		AccountCreditNumber: sweepAccount,
+		Amount:              balance.Balance,
+		Description:         fmt.Sprintf("Closing sweep of account %d: %s", account.AccountNumber, reason),
+		Date:                time.Now(),
+		CreatedBy:           userID,
+	}
+	if balance.Balance < 0 {
+		sweep.AccountDebitNumber, sweep.AccountCreditNumber = sweepAccount, account.AccountNumber
+		sweep.Amount = -balance.Balance
+	}
+	if err := postJournalEntry(systemPosting(tx.Set(closingSweepKey, account.AccountNumber)), sweep); err != nil {
+		return nil, err
+	}
+	return sweep, nil
+}
+
+type DormantAccount struct {
+	AccountID      uuid.UUID `json:"account_id" gorm:"column:accountid"`
+	AccountNumber  int       `json:"account_number" gorm:"column:accountnumber"`
+	Name           string    `json:"name" gorm:"column:name"`
+	LastActivityAt time.Time `json:"last_activity_at" gorm:"column:lastactivity"`
+	Flagged        bool      `json:"flagged" gorm:"-"`
+}
+
+type DormancyReport struct {
+	CheckedAt time.Time        `json:"checked_at"`
+	Cutoff    time.Time        `json:"cutoff"`
+	Accounts  []DormantAccount `json:"accounts"`
+	Flagged   int              `json:"flagged"`
+}
+
+// accounts never posted to count from the day they were opened
+// dormancyCandidatesSQL only considers accounts a customer owns: the bank's
+// own accounts, such as income, control and loan accounts, never go dormant
+const dormancyCandidatesSQL = `
+SELECT accountid, accountnumber, name, COALESCE(lastactivityat, createdat) AS lastactivity
+FROM account
+WHERE status = 'active' AND COALESCE(lastactivityat, createdat) < ?
+AND EXISTS (SELECT 1 FROM accountowner o WHERE o.accountid = account.accountid)`
+
+// detectDormantAccounts finds active accounts without customer activity
+// since now minus inactiveFor and, when flag is set, moves them to dormant.
+// Each account is rechecked under a row lock so activity that lands after
+// the scan keeps it active.
+func detectDormantAccounts(db *gorm.DB, inactiveFor time.Duration, flag bool, actor AuditActor) (*DormancyReport, error) {
+	now := time.Now()
+	report := &DormancyReport{CheckedAt: now, Cutoff: now.Add(-inactiveFor), Accounts: []DormantAccount{}}
+
+	err := db.Raw(dormancyCandidatesSQL+" ORDER BY accountnumber", report.Cutoff).Scan(&report.Accounts).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find dormant accounts: %v", err)
+	}
+	if !flag {
+		return report, nil
+	}
+
+	for i := range report.Accounts {
+		candidate := &report.Accounts[i]
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var account Account
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("accountid = ?", candidate.AccountID).
+				First(&account).Error
+			if err != nil {
+				return err
+			}
+			lastActivity := account.CreatedAt
+			if account.LastActivityAt != nil {
+				lastActivity = *account.LastActivityAt
+			}
+			if account.Status != AccountStatusActive || !lastActivity.Before(report.Cutoff) {
+				return nil
+			}
+
+			before := account
+			account.Status = AccountStatusDormant
+			account.StatusReason = fmt.Sprintf("No customer activity since %s", lastActivity.Format("2006-01-02"))
+			account.StatusChangedAt = &now
+			err = tx.Model(&Account{}).Where("accountid = ?", account.AccountID).Updates(map[string]interface{}{
+				"status":          account.Status,
+				"statusreason":    account.StatusReason,
+				"statuschangedat": account.StatusChangedAt,
+			}).Error
+			if err != nil {
+				return err
+			}
+			candidate.Flagged = true
+			return recordAudit(tx, actor, AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "account",
+				EntityID:   account.AccountID.String(),
+				Before:     before,
+				After:      account,
+			})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to flag account %d as dormant: %v", candidate.AccountNumber, err)
+		}
+		if candidate.Flagged {
+			report.Flagged++
+		}
+	}
+	return report, nil
+}
+
+// DormancyHandler lists dormancy candidates on GET and flags them on POST.
+// inactive_for overrides DORMANCY_PERIOD for the request.
+func DormancyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inactiveFor := envDuration("DORMANCY_PERIOD", defaultDormancyPeriod)
+		if value := c.Query("inactive_for"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid inactive_for duration", StatusCode: http.StatusBadRequest})
+				return
+			}
+			inactiveFor = parsed
+		}
+
+		report, err := detectDormantAccounts(db, inactiveFor, c.Request.Method == http.MethodPost, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		message := fmt.Sprintf("%d accounts without customer activity", len(report.Accounts))
+		if c.Request.Method == http.MethodPost {
+			message = fmt.Sprintf("%d accounts flagged as dormant", report.Flagged)
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+// runDormancyDetector flags dormant accounts every interval until ctx is
+// done.
+func runDormancyDetector(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval, inactiveFor time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	actor := AuditActor{UserID: "system", Method: "JOB", Endpoint: "dormancy"}
+	logger = logger.With("job", actor.Endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := detectDormantAccounts(db, inactiveFor, true, actor)
+			if err != nil {
+				logger.Error("dormancy detection failed", "error", err)
+				continue
+			}
+			if report.Flagged > 0 {
+				logger.Info("accounts flagged as dormant", "accounts", report.Flagged)
+			}
+		}
+	}
+}
@@ -0,0 +1,1139 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	LoanComponentPenalty   = "penalty"
+	LoanComponentInterest  = "interest"
+	LoanComponentPrincipal = "principal"
+)
+
+const defaultAllocationOrder = "penalty,interest,principal"
+
+var periodsPerYear = map[string]int{
+	LoanFrequencyWeekly:      52,
+	LoanFrequencyFortnightly: 26,
+	LoanFrequencyMonthly:     12,
+}
+
+type errLoanState string
+
+func (e errLoanState) Error() string {
+	return string(e)
+}
+
+// parseAllocationOrder checks that order names penalty, interest and
+// principal exactly once each.
+func parseAllocationOrder(order string) ([]string, error) {
+	components := strings.Split(order, ",")
+	seen := map[string]bool{}
+	for i, component := range components {
+		component = strings.TrimSpace(component)
+		components[i] = component
+		switch component {
+		case LoanComponentPenalty, LoanComponentInterest, LoanComponentPrincipal:
+		default:
+			return nil, fmt.Errorf("unknown allocation component %q", component)
+		}
+		if seen[component] {
+			return nil, fmt.Errorf("allocation component %q is repeated", component)
+		}
+		seen[component] = true
+	}
+	if len(seen) != 3 {
+		return nil, fmt.Errorf("allocation order must name penalty, interest and principal")
+	}
+	return components, nil
+}
+
+// installmentDueDate is the date installment number falls due. Monthly dates
+// keep the start day, clamped to the end of shorter months.
+func installmentDueDate(start time.Time, frequency string, number int) time.Time {
+	switch frequency {
+	case LoanFrequencyWeekly:
+		return start.AddDate(0, 0, 7*number)
+	case LoanFrequencyFortnightly:
+		return start.AddDate(0, 0, 14*number)
+	}
+	firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(number), 1, 0, 0, 0, 0, start.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+	day := start.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, 0, 0, 0, 0, start.Location())
+}
+
+// generateSchedule splits a loan into installments. Flat loans charge
+// interest on the original principal for the whole term; reducing loans
+// charge each period on the outstanding principal with equal installments.
+// Rounding differences land on the last installment so the schedule always
+// repays the principal exactly.
+func generateSchedule(loan Loan) []LoanInstallment {
+	periods := float64(periodsPerYear[loan.Frequency])
+	rate := float64(loan.RateBps) / 10000 / periods
+	installments := make([]LoanInstallment, 0, loan.Term)
+
+	switch loan.Method {
+	case LoanMethodFlat:
+		totalInterest := int(math.Round(float64(loan.Principal) * rate * float64(loan.Term)))
+		principalEach := loan.Principal / loan.Term
+		interestEach := totalInterest / loan.Term
+		for number := 1; number <= loan.Term; number++ {
+			installment := LoanInstallment{
+				LoanID:       loan.LoanID,
+				Number:       number,
+				DueDate:      installmentDueDate(loan.StartDate, loan.Frequency, number),
+				PrincipalDue: principalEach,
+				InterestDue:  interestEach,
+			}
+			if number == loan.Term {
+				installment.PrincipalDue = loan.Principal - principalEach*(loan.Term-1)
+				installment.InterestDue = totalInterest - interestEach*(loan.Term-1)
+			}
+			installments = append(installments, installment)
+		}
+
+	case LoanMethodReducing:
+		payment := float64(loan.Principal) / float64(loan.Term)
+		if rate > 0 {
+			payment = float64(loan.Principal) * rate / (1 - math.Pow(1+rate, -float64(loan.Term)))
+		}
+		outstanding := loan.Principal
+		for number := 1; number <= loan.Term; number++ {
+			interest := int(math.Round(float64(outstanding) * rate))
+			principal := int(math.Round(payment)) - interest
+			if number == loan.Term || principal > outstanding {
+				principal = outstanding
+			}
+			outstanding -= principal
+			installments = append(installments, LoanInstallment{
+				LoanID:       loan.LoanID,
+				Number:       number,
+				DueDate:      installmentDueDate(loan.StartDate, loan.Frequency, number),
+				PrincipalDue: principal,
+				InterestDue:  interest,
+			})
+		}
+	}
+	return installments
+}
+
+func (i LoanInstallment) owed(component string) int {
+	switch component {
+	case LoanComponentPenalty:
+		return i.PenaltyDue - i.PenaltyPaid
+	case LoanComponentInterest:
+		return i.InterestDue - i.InterestPaid
+	default:
+		return i.PrincipalDue - i.PrincipalPaid
+	}
+}
+
+func (i *LoanInstallment) pay(component string, amount int) {
+	switch component {
+	case LoanComponentPenalty:
+		i.PenaltyPaid += amount
+	case LoanComponentInterest:
+		i.InterestPaid += amount
+	default:
+		i.PrincipalPaid += amount
+	}
+}
+
+func (i LoanInstallment) outstanding() int {
+	return i.owed(LoanComponentPenalty) + i.owed(LoanComponentInterest) + i.owed(LoanComponentPrincipal)
+}
+
+// allocateRepayment settles installments oldest first, paying each one's
+// components in order before moving to the next. A payment larger than the
+// amount due prepays later installments in schedule order. It returns the
+// total applied to each component and the amount left over.
+func allocateRepayment(installments []LoanInstallment, amount int, order []string) (map[string]int, int) {
+	allocated := map[string]int{}
+	now := time.Now()
+	for i := range installments {
+		installment := &installments[i]
+		for _, component := range order {
+			take := installment.owed(component)
+			if take > amount {
+				take = amount
+			}
+			if take <= 0 {
+				continue
+			}
+			installment.pay(component, take)
+			allocated[component] += take
+			amount -= take
+		}
+		if installment.outstanding() == 0 && installment.PaidAt == nil {
+			installment.PaidAt = &now
+		}
+		if amount == 0 {
+			break
+		}
+	}
+	return allocated, amount
+}
+
+func CreateLoanProductHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Name                  string `json:"name"`
+			RateBps               int    `json:"rate_bps"`
+			Method                string `json:"method"`
+			Term                  int    `json:"term"`
+			Frequency             string `json:"frequency"`
+			AllocationOrder       string `json:"allocation_order"`
+			LoanCOAID             string `json:"loan_coa_id"`
+			InterestIncomeAccount int    `json:"interest_income_account"`
+			PenaltyIncomeAccount  int    `json:"penalty_income_account"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.AllocationOrder == "" {
+			data.AllocationOrder = defaultAllocationOrder
+		}
+
+		var problems []string
+		if data.Name == "" {
+			problems = append(problems, "name is required")
+		}
+		if data.RateBps < 0 {
+			problems = append(problems, "rate_bps cannot be negative")
+		}
+		if data.Method != LoanMethodFlat && data.Method != LoanMethodReducing {
+			problems = append(problems, fmt.Sprintf("method must be %s or %s", LoanMethodFlat, LoanMethodReducing))
+		}
+		if data.Term <= 0 {
+			problems = append(problems, "term must be positive")
+		}
+		if _, ok := periodsPerYear[data.Frequency]; !ok {
+			problems = append(problems, fmt.Sprintf("frequency must be one of %s, %s or %s", LoanFrequencyWeekly, LoanFrequencyFortnightly, LoanFrequencyMonthly))
+		}
+		if _, err := parseAllocationOrder(data.AllocationOrder); err != nil {
+			problems = append(problems, err.Error())
+		}
+		coaID, err := uuid.Parse(data.LoanCOAID)
+		if err != nil {
+			problems = append(problems, "Invalid loan_coa_id")
+		} else if _, err := ReturnAccount(db, coaID); err != nil {
+			problems = append(problems, "loan_coa_id does not exist")
+		}
+		if _, err := getAccountNumber(db, data.InterestIncomeAccount); err != nil {
+			problems = append(problems, "Invalid interest_income_account")
+		}
+		if _, err := getAccountNumber(db, data.PenaltyIncomeAccount); err != nil {
+			problems = append(problems, "Invalid penalty_income_account")
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		product := LoanProduct{
+			Name:                  data.Name,
+			RateBps:               data.RateBps,
+			Method:                data.Method,
+			Term:                  data.Term,
+			Frequency:             data.Frequency,
+			AllocationOrder:       data.AllocationOrder,
+			LoanCOAID:             coaID,
+			InterestIncomeAccount: data.InterestIncomeAccount,
+			PenaltyIncomeAccount:  data.PenaltyIncomeAccount,
+			CreatedBy:             c.GetString("userID"),
+		}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&product).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "loanproduct",
+				EntityID:   product.ProductID.String(),
+				After:      product,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Loan product created successfully", StatusCode: http.StatusCreated, Data: product})
+	}
+}
+
+func ListLoanProductHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		products := []LoanProduct{}
+		if err := db.Order("name").Find(&products).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan Product List", StatusCode: http.StatusOK, Data: products})
+	}
+}
+
+// openLoanAccount creates the receivable account for a loan under its
+// product's chart of account. Disbursement takes it below zero, so it is
+// always unrestricted whatever the chart of account's rule.
+func openLoanAccount(tx *gorm.DB, product LoanProduct, loanID uuid.UUID, customerID *uuid.UUID, userID string, actor AuditActor) (Account, error) {
+	coa, err := ReturnAccount(tx, product.LoanCOAID)
+	if err != nil {
+		return Account{}, err
+	}
+	accountNumber, err := generateAccountNumber(tx, coa)
+	if err != nil {
+		return Account{}, err
+	}
+
+	account := Account{
+		COAID:         coa.AccountID,
+		Name:          fmt.Sprintf("%s loan %s", product.Name, loanID.String()[:8]),
+		AccountNumber: accountNumber,
+		BalanceRule:   BalanceRuleUnrestricted,
+		CreatedBy:     userID,
+	}
+	if err := tx.Omit(clause.Associations).Create(&account).Error; err != nil {
+		return Account{}, err
+	}
+	if err := tx.Create(&AccountBalance{AccountID: account.AccountID}).Error; err != nil {
+		return Account{}, err
+	}
+	err = recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionCreate,
+		EntityType: "account",
+		EntityID:   account.AccountID.String(),
+		After:      account,
+	})
+	if err != nil {
+		return account, err
+	}
+	err = publishAccountCreated(tx, account)
+	if err != nil || customerID == nil {
+		return account, err
+	}
+	return account, addAccountOwner(tx, AccountOwner{
+		AccountID:  account.AccountID,
+		CustomerID: *customerID,
+		Role:       OwnerRolePrimary,
+		CanSign:    true,
+		CreatedBy:  userID,
+	}, actor)
+}
+
+// CreateLoanHandler books a loan on a product and generates its schedule.
+// Nothing is posted until the loan is disbursed.
+func CreateLoanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			ProductID           string `json:"product_id"`
+			CustomerID          string `json:"customer_id"`
+			Principal           int    `json:"principal"`
+			DisbursementAccount int    `json:"disbursement_account"`
+			StartDate           string `json:"start_date"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		productID, err := uuid.Parse(data.ProductID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid product_id", StatusCode: http.StatusBadRequest})
+			return
+		}
+		var customerID *uuid.UUID
+		if data.CustomerID != "" {
+			parsed, err := uuid.Parse(data.CustomerID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer_id", StatusCode: http.StatusBadRequest})
+				return
+			}
+			customerID = &parsed
+		}
+		if data.Principal <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "principal must be positive", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if _, err := getAccountNumber(db, data.DisbursementAccount); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid disbursement_account", StatusCode: http.StatusBadRequest})
+			return
+		}
+		startDate := time.Now().Truncate(24 * time.Hour)
+		if data.StartDate != "" {
+			startDate, err = time.Parse("2006-01-02", data.StartDate)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid start_date format", StatusCode: http.StatusBadRequest})
+				return
+			}
+		}
+
+		var product LoanProduct
+		if err := db.Where("productid = ?", productID).First(&product).Error; err != nil {
+			respondNotFoundOr500(c, err, "Loan product not found")
+			return
+		}
+
+		loan := Loan{
+			LoanID:              uuid.New(),
+			ProductID:           product.ProductID,
+			CustomerID:          customerID,
+			Principal:           data.Principal,
+			RateBps:             product.RateBps,
+			Method:              product.Method,
+			Term:                product.Term,
+			Frequency:           product.Frequency,
+			StartDate:           startDate,
+			DisbursementAccount: data.DisbursementAccount,
+			Status:              LoanStatusPending,
+			CreatedBy:           c.GetString("userID"),
+		}
+		schedule := generateSchedule(loan)
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			account, err := openLoanAccount(tx, product, loan.LoanID, customerID, loan.CreatedBy, auditActor(c))
+			if err != nil {
+				return err
+			}
+			loan.AccountID = account.AccountID
+			if err := tx.Create(&loan).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&schedule).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "loan",
+				EntityID:   loan.LoanID.String(),
+				After:      loan,
+			})
+		})
+		if err != nil {
+			respondCustomerError(c, err, "Loan chart of account not found")
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Loan created successfully", StatusCode: http.StatusCreated,
+			Data: gin.H{"loan": loan, "schedule": schedule}})
+	}
+}
+
+func lockLoan(tx *gorm.DB, c *gin.Context) (*Loan, error) {
+	loanID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var loan Loan
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("loanid = ?", loanID).First(&loan).Error
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+func loanAccountNumber(tx *gorm.DB, loan *Loan) (int, error) {
+	var account Account
+	if err := tx.Where("accountid = ?", loan.AccountID).First(&account).Error; err != nil {
+		return 0, fmt.Errorf("failed to fetch loan account: %v", err)
+	}
+	return account.AccountNumber, nil
+}
+
+func respondLoanError(c *gin.Context, err error) {
+	var state errLoanState
+	var overLimit *PostingLimitError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Loan not found", StatusCode: http.StatusNotFound})
+	case errors.As(err, &state):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+	case errors.As(err, &overLimit):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error(), StatusCode: http.StatusForbidden})
+	default:
+		respondPostingError(c, err)
+	}
+}
+
+// DisburseLoanHandler pays the principal out of the disbursement account
+// into the loan's receivable account. The disbursement is held to the
+// caller's posting limit and the approval rules like any journal entry; when
+// a rule applies it waits in the approval queue and the loan becomes active
+// once it is approved.
+func DisburseLoanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roles := c.GetStringSlice("roles")
+		var loan *Loan
+		var entry JournalEntry
+		pending := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			loan, err = lockLoan(tx, c)
+			if err != nil {
+				return err
+			}
+			if loan.Status != LoanStatusPending {
+				return errLoanState("Loan has already been disbursed")
+			}
+			if loan.DisbursementID != nil {
+				return errLoanState("Loan disbursement is already pending approval")
+			}
+			receivable, err := loanAccountNumber(tx, loan)
+			if err != nil {
+				return err
+			}
+			if err := checkPostingLimit(roles, loan.Principal); err != nil {
+				return err
+			}
+
+			entry = JournalEntry{
+				AccountDebitNumber:  receivable,
+				AccountCreditNumber: loan.DisbursementAccount,
+				Amount:              loan.Principal,
+				Description:         fmt.Sprintf("Disbursement of loan %s", loan.LoanID),
+				Date:                time.Now(),
+				CreatedBy:           c.GetString("userID"),
+			}
+			pending, err = requiresApproval(tx, roles, receivable, loan.DisbursementAccount, loan.Principal)
+			if err != nil {
+				return err
+			}
+			if pending {
+				return queueDisbursement(tx, loan, &entry, auditActor(c))
+			}
+
+			if err := postJournalEntry(tx, &entry); err != nil {
+				return err
+			}
+			if err := recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionPost,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				After:      entry,
+			}); err != nil {
+				return err
+			}
+			if _, err := applyPostingCharges(tx, &entry, auditActor(c)); err != nil {
+				return err
+			}
+			return activateLoan(tx, loan, &entry, auditActor(c))
+		})
+		if err != nil {
+			respondLoanError(c, err)
+			return
+		}
+
+		if pending {
+			c.JSON(http.StatusAccepted, SuccessResponse{Message: "Loan disbursement is pending approval", StatusCode: http.StatusAccepted,
+				Data: gin.H{"loanid": loan.LoanID, "transactionid": entry.TransactionID}})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan disbursed successfully", StatusCode: http.StatusOK,
+			Data: gin.H{"loanid": loan.LoanID, "transactionid": entry.TransactionID}})
+	}
+}
+
+// queueDisbursement stores entry as pending approval and links it to the
+// loan, which stays pending until the entry is reviewed.
+func queueDisbursement(tx *gorm.DB, loan *Loan, entry *JournalEntry, actor AuditActor) error {
+	// refuse up front rather than queue a disbursement that can never post
+	if err := checkAccountsPostable(tx, entry.AccountDebitNumber, entry.AccountCreditNumber); err != nil {
+		return refusePosting(err)
+	}
+
+	entry.Status = JournalStatusPending
+	if err := tx.Omit(clause.Associations).Create(entry).Error; err != nil {
+		return err
+	}
+	recordQueued(tx)
+	if err := recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionSubmit,
+		EntityType: "journalentry",
+		EntityID:   entry.TransactionID.String(),
+		After:      entry,
+	}); err != nil {
+		return err
+	}
+
+	before := *loan
+	loan.DisbursementID = &entry.TransactionID
+	if err := tx.Model(&Loan{}).Where("loanid = ?", loan.LoanID).Update("disbursementid", loan.DisbursementID).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loan",
+		EntityID:   loan.LoanID.String(),
+		Before:     before,
+		After:      loan,
+	})
+}
+
+// activateLoan marks loan as disbursed by entry, which has been posted.
+func activateLoan(tx *gorm.DB, loan *Loan, entry *JournalEntry, actor AuditActor) error {
+	before := *loan
+	now := time.Now()
+	loan.Status = LoanStatusActive
+	loan.DisbursementID = &entry.TransactionID
+	loan.DisbursedBy = entry.CreatedBy
+	loan.DisbursedAt = &now
+	err := tx.Model(&Loan{}).Where("loanid = ?", loan.LoanID).Updates(map[string]interface{}{
+		"status":         loan.Status,
+		"disbursementid": loan.DisbursementID,
+		"disbursedby":    loan.DisbursedBy,
+		"disbursedat":    loan.DisbursedAt,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loan",
+		EntityID:   loan.LoanID.String(),
+		Before:     before,
+		After:      loan,
+	})
+}
+
+// reviewedDisbursement finishes the loan waiting on entry, if any, once a
+// checker has reviewed it: an approved disbursement activates the loan and a
+// rejected one frees it to be disbursed again.
+func reviewedDisbursement(tx *gorm.DB, entry *JournalEntry, actor AuditActor) error {
+	var loan Loan
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("disbursementid = ? AND status = ?", entry.TransactionID, LoanStatusPending).
+		Limit(1).Find(&loan)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	if entry.Status == JournalStatusPosted {
+		return activateLoan(tx, &loan, entry, actor)
+	}
+
+	before := loan
+	loan.DisbursementID = nil
+	if err := tx.Model(&Loan{}).Where("loanid = ?", loan.LoanID).Update("disbursementid", nil).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loan",
+		EntityID:   loan.LoanID.String(),
+		Before:     before,
+		After:      loan,
+	})
+}
+
+// checkRepaymentAccount holds a repayment to the rules a journal entry of
+// the same total would meet: payment_account may not be a control account,
+// must accept debits, and the total may not exceed the caller's posting
+// limit. Approval rules are applied by RepayLoanHandler.
+func checkRepaymentAccount(tx *gorm.DB, roles []string, paymentAccount, receivable, amount int) error {
+	if err := checkNotControlAccount(tx, paymentAccount); err != nil {
+		return refusePosting(err)
+	}
+	if err := checkAccountsPostable(tx, paymentAccount, receivable); err != nil {
+		return refusePosting(err)
+	}
+	return checkPostingLimit(roles, amount)
+}
+
+// settleRepayment allocates a repayment whose entry has been posted across
+// the loan's schedule in the product's order. The entry credits the whole
+// amount to the loan's receivable account; the interest and penalty parts
+// are then moved from there to their income accounts, where they are
+// recognised when they are paid. The loan is closed once every installment
+// is paid.
+func settleRepayment(tx *gorm.DB, loan *Loan, repayment *LoanRepayment, actor AuditActor) error {
+	if loan.Status != LoanStatusActive {
+		return errLoanState(fmt.Sprintf("Loan is %s and cannot take repayments", loan.Status))
+	}
+
+	var product LoanProduct
+	if err := tx.Where("productid = ?", loan.ProductID).First(&product).Error; err != nil {
+		return err
+	}
+	order, err := parseAllocationOrder(product.AllocationOrder)
+	if err != nil {
+		return err
+	}
+	var installments []LoanInstallment
+	if err := tx.Where("loanid = ?", loan.LoanID).Order("number").Find(&installments).Error; err != nil {
+		return err
+	}
+	allocated, leftover := allocateRepayment(installments, repayment.Amount, order)
+	if leftover > 0 {
+		return errLoanState(fmt.Sprintf("Repayment exceeds the outstanding balance by %d", leftover))
+	}
+
+	receivable, err := loanAccountNumber(tx, loan)
+	if err != nil {
+		return err
+	}
+	income := map[string]int{
+		LoanComponentPenalty:  product.PenaltyIncomeAccount,
+		LoanComponentInterest: product.InterestIncomeAccount,
+	}
+	for _, component := range order {
+		if allocated[component] == 0 || component == LoanComponentPrincipal {
+			continue
+		}
+		entry := JournalEntry{
+			AccountDebitNumber:  receivable,
+			AccountCreditNumber: income[component],
+			Amount:              allocated[component],
+			Description:         fmt.Sprintf("Loan %s repayment: %s", loan.LoanID, component),
+			Date:                time.Now(),
+			CreatedBy:           repayment.CreatedBy,
+		}
+		if err := postJournalEntry(systemPosting(tx), &entry); err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     AuditActionPost,
+			EntityType: "journalentry",
+			EntityID:   entry.TransactionID.String(),
+			After:      entry,
+		}); err != nil {
+			return err
+		}
+	}
+
+	closed := true
+	for _, installment := range installments {
+		if err := tx.Save(&installment).Error; err != nil {
+			return err
+		}
+		if installment.outstanding() > 0 {
+			closed = false
+		}
+	}
+
+	before := *repayment
+	repayment.Status = LoanRepaymentStatusPosted
+	repayment.Principal = allocated[LoanComponentPrincipal]
+	repayment.Interest = allocated[LoanComponentInterest]
+	repayment.Penalty = allocated[LoanComponentPenalty]
+	err = tx.Model(&LoanRepayment{}).Where("repaymentid = ?", repayment.RepaymentID).Updates(map[string]interface{}{
+		"status":    repayment.Status,
+		"principal": repayment.Principal,
+		"interest":  repayment.Interest,
+		"penalty":   repayment.Penalty,
+	}).Error
+	if err != nil {
+		return err
+	}
+	if err := recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loanrepayment",
+		EntityID:   repayment.RepaymentID.String(),
+		Before:     before,
+		After:      repayment,
+	}); err != nil {
+		return err
+	}
+
+	if !closed {
+		return nil
+	}
+	loanBefore := *loan
+	loan.Status = LoanStatusClosed
+	if err := tx.Model(&Loan{}).Where("loanid = ?", loan.LoanID).Update("status", loan.Status).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loan",
+		EntityID:   loan.LoanID.String(),
+		Before:     loanBefore,
+		After:      loan,
+	})
+}
+
+// reviewedRepayment finishes the repayment waiting on entry, if any, once a
+// checker has reviewed it: an approved repayment is allocated across the
+// schedule and a rejected one is marked rejected.
+func reviewedRepayment(tx *gorm.DB, entry *JournalEntry, actor AuditActor) error {
+	var repayment LoanRepayment
+	result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("transactionid = ? AND status = ?", entry.TransactionID, LoanRepaymentStatusPending).
+		Limit(1).Find(&repayment)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	if entry.Status == JournalStatusPosted {
+		var loan Loan
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("loanid = ?", repayment.LoanID).First(&loan).Error
+		if err != nil {
+			return err
+		}
+		return settleRepayment(tx, &loan, &repayment, actor)
+	}
+
+	before := repayment
+	repayment.Status = LoanRepaymentStatusRejected
+	if err := tx.Model(&LoanRepayment{}).Where("repaymentid = ?", repayment.RepaymentID).Update("status", repayment.Status).Error; err != nil {
+		return err
+	}
+	return recordAudit(tx, actor, AuditEvent{
+		Action:     AuditActionUpdate,
+		EntityType: "loanrepayment",
+		EntityID:   repayment.RepaymentID.String(),
+		Before:     before,
+		After:      repayment,
+	})
+}
+
+// RepayLoanHandler takes a repayment from payment_account into the loan's
+// receivable account and allocates it across the schedule with
+// settleRepayment. The repayment is held to the caller's posting limit and
+// the approval rules like any journal entry; when a rule applies its entry
+// waits in the approval queue and the repayment is allocated once it is
+// approved.
+func RepayLoanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Amount         int `json:"amount"`
+			PaymentAccount int `json:"payment_account"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.Amount <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "amount must be positive", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if _, err := getAccountNumber(db, data.PaymentAccount); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid payment_account", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		roles := c.GetStringSlice("roles")
+		var repayment LoanRepayment
+		var loan *Loan
+		pending := false
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			loan, err = lockLoan(tx, c)
+			if err != nil {
+				return err
+			}
+			if loan.Status != LoanStatusActive {
+				return errLoanState(fmt.Sprintf("Loan is %s and cannot take repayments", loan.Status))
+			}
+			// refuse an overpayment up front; it is allocated again when
+			// the repayment is settled
+			var installments []LoanInstallment
+			if err := tx.Where("loanid = ?", loan.LoanID).Order("number").Find(&installments).Error; err != nil {
+				return err
+			}
+			outstanding := 0
+			for _, installment := range installments {
+				outstanding += installment.outstanding()
+			}
+			if data.Amount > outstanding {
+				return errLoanState(fmt.Sprintf("Repayment exceeds the outstanding balance by %d", data.Amount-outstanding))
+			}
+
+			receivable, err := loanAccountNumber(tx, loan)
+			if err != nil {
+				return err
+			}
+			if err := checkRepaymentAccount(tx, roles, data.PaymentAccount, receivable, data.Amount); err != nil {
+				return err
+			}
+			pending, err = requiresApproval(tx, roles, data.PaymentAccount, receivable, data.Amount)
+			if err != nil {
+				return err
+			}
+
+			entry := JournalEntry{
+				AccountDebitNumber:  data.PaymentAccount,
+				AccountCreditNumber: receivable,
+				Amount:              data.Amount,
+				Description:         fmt.Sprintf("Loan %s repayment", loan.LoanID),
+				Date:                time.Now(),
+				CreatedBy:           c.GetString("userID"),
+			}
+			action := AuditActionPost
+			if pending {
+				entry.Status = JournalStatusPending
+				action = AuditActionSubmit
+				if err = tx.Omit(clause.Associations).Create(&entry).Error; err == nil {
+					recordQueued(tx)
+				}
+			} else {
+				err = postJournalEntry(tx, &entry)
+			}
+			if err != nil {
+				return err
+			}
+			if err := recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     action,
+				EntityType: "journalentry",
+				EntityID:   entry.TransactionID.String(),
+				After:      entry,
+			}); err != nil {
+				return err
+			}
+
+			repayment = LoanRepayment{
+				LoanID:         loan.LoanID,
+				Amount:         data.Amount,
+				PaymentAccount: data.PaymentAccount,
+				Status:         LoanRepaymentStatusPending,
+				TransactionID:  &entry.TransactionID,
+				CreatedBy:      c.GetString("userID"),
+				CreatedAt:      time.Now(),
+			}
+			if err := tx.Create(&repayment).Error; err != nil {
+				return err
+			}
+			if err := recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "loanrepayment",
+				EntityID:   repayment.RepaymentID.String(),
+				After:      repayment,
+			}); err != nil {
+				return err
+			}
+			if pending {
+				return nil
+			}
+			if _, err := applyPostingCharges(tx, &entry, auditActor(c)); err != nil {
+				return err
+			}
+			return settleRepayment(tx, loan, &repayment, auditActor(c))
+		})
+		if err != nil {
+			respondLoanError(c, err)
+			return
+		}
+
+		if pending {
+			c.JSON(http.StatusAccepted, SuccessResponse{Message: "Loan repayment is pending approval", StatusCode: http.StatusAccepted,
+				Data: gin.H{"repayment": repayment, "loan_status": loan.Status}})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan repayment posted successfully", StatusCode: http.StatusOK,
+			Data: gin.H{"repayment": repayment, "loan_status": loan.Status}})
+	}
+}
+
+// ChargeLoanPenaltyHandler adds a penalty to the oldest overdue installment.
+// Like interest, it is only posted to income when it is paid.
+func ChargeLoanPenaltyHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Amount int    `json:"amount"`
+			Reason string `json:"reason"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.Amount <= 0 || data.Reason == "" {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A positive amount and a reason are required", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var installment LoanInstallment
+		err := db.Transaction(func(tx *gorm.DB) error {
+			loan, err := lockLoan(tx, c)
+			if err != nil {
+				return err
+			}
+			if loan.Status != LoanStatusActive {
+				return errLoanState(fmt.Sprintf("Loan is %s and cannot be charged a penalty", loan.Status))
+			}
+
+			var installments []LoanInstallment
+			err = tx.Where("loanid = ? AND duedate < ?", loan.LoanID, time.Now().Truncate(24*time.Hour)).
+				Order("number").
+				Find(&installments).Error
+			if err != nil {
+				return err
+			}
+			found := false
+			for _, candidate := range installments {
+				if candidate.outstanding() > 0 {
+					installment, found = candidate, true
+					break
+				}
+			}
+			if !found {
+				return errLoanState("Loan has no overdue installment to charge")
+			}
+
+			before := installment
+			installment.PenaltyDue += data.Amount
+			err = tx.Model(&LoanInstallment{}).
+				Where("loanid = ? AND number = ?", installment.LoanID, installment.Number).
+				Update("penaltydue", installment.PenaltyDue).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "loaninstallment",
+				EntityID:   fmt.Sprintf("%s/%d", installment.LoanID, installment.Number),
+				Before:     before,
+				After:      installment,
+			})
+		})
+		if err != nil {
+			respondLoanError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan penalty charged successfully", StatusCode: http.StatusOK, Data: installment})
+	}
+}
+
+func ListLoanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Order("createdat DESC")
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+		if customer := c.Query("customer_id"); customer != "" {
+			customerID, err := uuid.Parse(customer)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid customer_id", StatusCode: http.StatusBadRequest})
+				return
+			}
+			query = query.Where("customerid = ?", customerID)
+		}
+
+		loans := []Loan{}
+		if err := query.Find(&loans).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan List", StatusCode: http.StatusOK, Data: loans})
+	}
+}
+
+// GetLoanHandler returns a loan with its repayment history.
+func GetLoanHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		loanID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid loan ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var loan Loan
+		if err := db.Where("loanid = ?", loanID).First(&loan).Error; err != nil {
+			respondNotFoundOr500(c, err, "Loan not found")
+			return
+		}
+		repayments := []LoanRepayment{}
+		if err := db.Where("loanid = ?", loanID).Order("createdat").Find(&repayments).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan", StatusCode: http.StatusOK,
+			Data: gin.H{"loan": loan, "repayments": repayments}})
+	}
+}
+
+type ScheduleLine struct {
+	LoanInstallment
+	TotalDue    int    `json:"total_due"`
+	TotalPaid   int    `json:"total_paid"`
+	Outstanding int    `json:"outstanding"`
+	Status      string `json:"status"`
+}
+
+type LoanSchedule struct {
+	Loan         Loan           `json:"loan"`
+	Installments []ScheduleLine `json:"installments"`
+	TotalDue     int            `json:"total_due"`
+	TotalPaid    int            `json:"total_paid"`
+	Outstanding  int            `json:"outstanding"`
+	Overdue      int            `json:"overdue"`
+}
+
+// LoanScheduleHandler shows due, paid and outstanding per installment.
+func LoanScheduleHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		format, ok := requestedExport(c)
+		if !ok {
+			return
+		}
+
+		loanID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid loan ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var schedule LoanSchedule
+		if err := db.Where("loanid = ?", loanID).First(&schedule.Loan).Error; err != nil {
+			respondNotFoundOr500(c, err, "Loan not found")
+			return
+		}
+		var installments []LoanInstallment
+		if err := db.Where("loanid = ?", loanID).Order("number").Find(&installments).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		today := time.Now().Truncate(24 * time.Hour)
+		schedule.Installments = make([]ScheduleLine, 0, len(installments))
+		for _, installment := range installments {
+			line := ScheduleLine{
+				LoanInstallment: installment,
+				TotalDue:        installment.PrincipalDue + installment.InterestDue + installment.PenaltyDue,
+				TotalPaid:       installment.PrincipalPaid + installment.InterestPaid + installment.PenaltyPaid,
+				Outstanding:     installment.outstanding(),
+			}
+			switch {
+			case line.Outstanding == 0:
+				line.Status = "paid"
+			case installment.DueDate.Before(today):
+				line.Status = "overdue"
+				schedule.Overdue += line.Outstanding
+			case line.TotalPaid > 0:
+				line.Status = "partial"
+			default:
+				line.Status = "upcoming"
+			}
+			schedule.TotalDue += line.TotalDue
+			schedule.TotalPaid += line.TotalPaid
+			schedule.Outstanding += line.Outstanding
+			schedule.Installments = append(schedule.Installments, line)
+		}
+
+		if format != ExportFormatJSON {
+			accountNumber, err := loanAccountNumber(db, &schedule.Loan)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+				return
+			}
+			exportLoanSchedule(c, format, accountNumber, schedule)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Loan Schedule", StatusCode: http.StatusOK, Data: schedule})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func scheduleTotals(installments []LoanInstallment) (principal, interest int) {
+	for _, installment := range installments {
+		principal += installment.PrincipalDue
+		interest += installment.InterestDue
+	}
+	return principal, interest
+}
+
+func TestGenerateScheduleFlat(t *testing.T) {
+	loan := Loan{Principal: 120000, RateBps: 1200, Method: LoanMethodFlat, Term: 12, Frequency: LoanFrequencyMonthly,
+		StartDate: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}
+	installments := generateSchedule(loan)
+	if len(installments) != 12 {
+		t.Fatalf("got %d installments, want 12", len(installments))
+	}
+	for _, installment := range installments {
+		if installment.PrincipalDue != 10000 || installment.InterestDue != 1200 {
+			t.Errorf("installment %d: got principal %d interest %d, want 10000 and 1200",
+				installment.Number, installment.PrincipalDue, installment.InterestDue)
+		}
+	}
+	if due := installments[0].DueDate; !due.Equal(time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("first installment due %s, want 2024-02-15", due.Format("2006-01-02"))
+	}
+}
+
+func TestGenerateScheduleRoundingLandsOnLastInstallment(t *testing.T) {
+	loan := Loan{Principal: 1000, RateBps: 0, Method: LoanMethodFlat, Term: 3, Frequency: LoanFrequencyWeekly,
+		StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	installments := generateSchedule(loan)
+	var got []int
+	for _, installment := range installments {
+		got = append(got, installment.PrincipalDue)
+	}
+	if !reflect.DeepEqual(got, []int{333, 333, 334}) {
+		t.Errorf("got principal %v, want [333 333 334]", got)
+	}
+	if due := installments[2].DueDate; !due.Equal(time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("last installment due %s, want 2024-01-22", due.Format("2006-01-02"))
+	}
+}
+
+func TestGenerateScheduleReducing(t *testing.T) {
+	loan := Loan{Principal: 120000, RateBps: 1200, Method: LoanMethodReducing, Term: 12, Frequency: LoanFrequencyMonthly,
+		StartDate: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}
+	installments := generateSchedule(loan)
+	if len(installments) != 12 {
+		t.Fatalf("got %d installments, want 12", len(installments))
+	}
+
+	first := installments[0]
+	if first.InterestDue != 1200 || first.PrincipalDue+first.InterestDue != 10662 {
+		t.Errorf("first installment: got principal %d interest %d, want a payment of 10662 with 1200 interest",
+			first.PrincipalDue, first.InterestDue)
+	}
+	for _, installment := range installments[1:] {
+		if installment.InterestDue >= first.InterestDue {
+			t.Errorf("installment %d: interest %d should fall as principal is repaid", installment.Number, installment.InterestDue)
+		}
+	}
+	if principal, _ := scheduleTotals(installments); principal != loan.Principal {
+		t.Errorf("schedule repays %d, want the principal %d", principal, loan.Principal)
+	}
+
+	// monthly dates keep the start day, clamped to shorter months
+	for number, want := range map[int]string{1: "2024-02-29", 2: "2024-03-31", 3: "2024-04-30"} {
+		if got := installments[number-1].DueDate.Format("2006-01-02"); got != want {
+			t.Errorf("installment %d due %s, want %s", number, got, want)
+		}
+	}
+}
+
+func TestGenerateScheduleReducingWithoutInterest(t *testing.T) {
+	loan := Loan{Principal: 1000, RateBps: 0, Method: LoanMethodReducing, Term: 4, Frequency: LoanFrequencyFortnightly,
+		StartDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	principal, interest := scheduleTotals(generateSchedule(loan))
+	if principal != 1000 || interest != 0 {
+		t.Errorf("got principal %d interest %d, want 1000 and 0", principal, interest)
+	}
+}
+
+func testInstallments() []LoanInstallment {
+	return []LoanInstallment{
+		{Number: 1, PrincipalDue: 100, InterestDue: 10, PenaltyDue: 5},
+		{Number: 2, PrincipalDue: 100, InterestDue: 10},
+	}
+}
+
+func TestAllocateRepayment(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		amount    int
+		order     []string
+		allocated map[string]int
+		left      int
+		paid      []bool
+	}{
+		{
+			name:      "oldest installment first, then the next",
+			amount:    120,
+			order:     []string{LoanComponentPenalty, LoanComponentInterest, LoanComponentPrincipal},
+			allocated: map[string]int{LoanComponentPenalty: 5, LoanComponentInterest: 15, LoanComponentPrincipal: 100},
+			paid:      []bool{true, false},
+		},
+		{
+			name:      "components in the product's order",
+			amount:    50,
+			order:     []string{LoanComponentPrincipal, LoanComponentInterest, LoanComponentPenalty},
+			allocated: map[string]int{LoanComponentPrincipal: 50},
+			paid:      []bool{false, false},
+		},
+		{
+			name:      "overpayment is left over",
+			amount:    300,
+			order:     []string{LoanComponentPenalty, LoanComponentInterest, LoanComponentPrincipal},
+			allocated: map[string]int{LoanComponentPenalty: 5, LoanComponentInterest: 20, LoanComponentPrincipal: 200},
+			left:      75,
+			paid:      []bool{true, true},
+		},
+	} {
+		installments := testInstallments()
+		allocated, left := allocateRepayment(installments, tc.amount, tc.order)
+		if !reflect.DeepEqual(allocated, tc.allocated) || left != tc.left {
+			t.Errorf("%s: got %v with %d left, want %v with %d left", tc.name, allocated, left, tc.allocated, tc.left)
+		}
+		for i, installment := range installments {
+			if paid := installment.PaidAt != nil; paid != tc.paid[i] {
+				t.Errorf("%s: installment %d paid = %v, want %v", tc.name, installment.Number, paid, tc.paid[i])
+			}
+		}
+	}
+}
+
+func TestAllocateRepaymentSkipsPaidComponents(t *testing.T) {
+	installments := testInstallments()
+	installments[0].PenaltyPaid = 5
+	installments[0].InterestPaid = 10
+	allocated, left := allocateRepayment(installments, 30, []string{LoanComponentPenalty, LoanComponentInterest, LoanComponentPrincipal})
+	want := map[string]int{LoanComponentPrincipal: 30}
+	if !reflect.DeepEqual(allocated, want) || left != 0 {
+		t.Errorf("got %v with %d left, want %v", allocated, left, want)
+	}
+	if installments[0].PrincipalPaid != 30 {
+		t.Errorf("got %d principal paid on the first installment, want 30", installments[0].PrincipalPaid)
+	}
+}
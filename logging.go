@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// Logs are JSON lines on stderr, leaving stdout to the CLI reports. Every
+// line written for a request carries its request_id, which is also returned
+// in the X-Request-ID header and forwarded to the auth service, so one ID
+// follows a call end to end.
+// Nothing written through newLogger can carry a secret, a token or
+// customer PII: attributes with a sensitive name are blanked and bearer
+// tokens, JWTs and credentials inside any string are masked.
+
+const redacted = "[REDACTED]"
+
+// logLevel is shared by every logger built by newLogger, so changing it
+// takes effect immediately. It starts at LOG_LEVEL and can be changed with
+// PUT /admin/loglevel.
+var logLevel = new(slog.LevelVar)
+
+// sensitiveKeys are blanked wherever they appear in an attribute name,
+// with hyphens read as underscores so header names match too.
+var sensitiveKeys = []string{"password", "secret", "token", "authorization", "cookie", "api_key", "apikey", "dsn", "signature"}
+
+// piiKeys are customer details blanked when an attribute has exactly this
+// name.
+var piiKeys = map[string]bool{"email": true, "phone": true, "address": true, "id_number": true, "id_type": true}
+
+var secretPatterns = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]+`), "Bearer " + redacted},
+	{regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`), redacted},
+	{regexp.MustCompile(`://[^/\s:@]+:[^/\s@]+@`), "://" + redacted + "@"},
+	{regexp.MustCompile(`(?i)\b(password|secret|token|access_token|api_key|key|signature|sig)=[^&\s]+`), "$1=" + redacted},
+}
+
+func newLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       logLevel,
+		ReplaceAttr: redactAttr,
+	}))
+}
+
+// setLogLevel parses debug, info, warn or error.
+func setLogLevel(name string) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("Invalid log level %q: must be debug, info, warn or error", name)
+	}
+	logLevel.Set(level)
+	return nil
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	key := strings.ReplaceAll(strings.ToLower(attr.Key), "-", "_")
+	if piiKeys[key] {
+		return slog.String(attr.Key, redacted)
+	}
+	for _, sensitive := range sensitiveKeys {
+		if strings.Contains(key, sensitive) {
+			return slog.String(attr.Key, redacted)
+		}
+	}
+
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redactString(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, redactString(err.Error()))
+		}
+	}
+	return attr
+}
+
+// redactString masks credentials embedded in free text such as error
+// messages and URLs.
+func redactString(s string) string {
+	for _, secret := range secretPatterns {
+		s = secret.pattern.ReplaceAllString(s, secret.replacement)
+	}
+	return s
+}
+
+type requestIDKey struct{}
+
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// newRequestID keeps a caller's X-Request-ID when it is safe to echo and
+// log, and makes one up otherwise.
+func newRequestID(header string) string {
+	if requestIDPattern.MatchString(header) {
+		return header
+	}
+	return uuid.NewString()
+}
+
+// RequestIDMiddleware gives every request an ID and a logger carrying it,
+// and writes one access line per request once it is answered. Probes and
+// metrics scrapes are logged at debug so they do not drown everything else.
+func RequestIDMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		id := newRequestID(c.GetHeader("X-Request-ID"))
+		c.Set("requestID", id)
+		c.Set("logger", logger.With("request_id", id))
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(withRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		case c.FullPath() == "/healthz" || c.FullPath() == "/readyz" || c.FullPath() == "/metrics":
+			level = slog.LevelDebug
+		}
+		loggerFrom(c).Log(c.Request.Context(), level, "request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", c.Request.URL.Path,
+			"status", status,
+			"duration_ms", time.Since(start).Milliseconds(),
+			"client_ip", c.ClientIP(),
+			"user_id", c.GetString("userID"),
+		)
+	}
+}
+
+// loggerFrom returns the request's logger, or the default logger outside
+// RequestIDMiddleware.
+func loggerFrom(c *gin.Context) *slog.Logger {
+	if logger, ok := c.Get("logger"); ok {
+		return logger.(*slog.Logger)
+	}
+	return slog.Default()
+}
+
+// RecoveryMiddleware logs a panic with its stack and answers 500, in place
+// of gin's recovery, which writes the raw request headers to stderr.
+func RecoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, recovered interface{}) {
+		loggerFrom(c).Error("panic", "error", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "Internal server error", StatusCode: http.StatusInternalServerError})
+	})
+}
+
+func GetLogLevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Log level", StatusCode: http.StatusOK,
+			Data: gin.H{"level": strings.ToLower(logLevel.Level().String())}})
+	}
+}
+
+func SetLogLevelHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Level string `json:"level" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		previous := logLevel.Level()
+		if err := setLogLevel(input.Level); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+			return
+		}
+		loggerFrom(c).Warn("log level changed", "from", previous.String(), "to", logLevel.Level().String(), "user_id", c.GetString("userID"))
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Log level updated", StatusCode: http.StatusOK,
+			Data: gin.H{"level": strings.ToLower(logLevel.Level().String())}})
+	}
+}
+
+// gormLogWriter sends gorm's warnings, errors and slow queries to the
+// default logger. Queries are logged with placeholders, never values.
+type gormLogWriter struct{}
+
+func (gormLogWriter) Printf(format string, args ...interface{}) {
+	slog.Default().Warn(fmt.Sprintf(format, args...), "component", "gorm")
+}
+
+func newGormLogger() gormlogger.Interface {
+	return gormlogger.New(gormLogWriter{}, gormlogger.Config{
+		SlowThreshold:             envDuration("DB_SLOW_QUERY", 200*time.Millisecond),
+		LogLevel:                  gormlogger.Warn,
+		IgnoreRecordNotFoundError: true,
+		ParameterizedQueries:      true,
+	})
+}
+
+// fatal logs err and exits, for failures main cannot carry on from.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
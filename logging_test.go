@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestRedactString(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"bearer token", "auth failed for Bearer abc.def-123", "auth failed for Bearer " + redacted},
+		{"lower case bearer", "header was bearer abc123", "header was Bearer " + redacted},
+		{"bare JWT", "token eyJhbGciOiJSUzI1NiJ9.eyJzdWIiOiIxIn0.c2ln expired", "token " + redacted + " expired"},
+		{"URL credentials", "dial postgres://ledger:hunter2@db:5432/ledger", "dial postgres://" + redacted + "@db:5432/ledger"},
+		{"query parameters", "GET /x?api_key=k1&page=2&token=t1", "GET /x?api_key=" + redacted + "&page=2&token=" + redacted},
+		{"connection string", "host=db password=hunter2 sslmode=disable", "host=db password=" + redacted + " sslmode=disable"},
+		{"nothing to hide", "account 1001 is frozen", "account 1001 is frozen"},
+	} {
+		if got := redactString(tc.in); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRedactAttr(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		attr slog.Attr
+		want slog.Value
+	}{
+		{"sensitive key", slog.String("password", "hunter2"), slog.StringValue(redacted)},
+		{"sensitive key inside a name", slog.String("X-Api-Key", "k1"), slog.StringValue(redacted)},
+		{"sensitive key of any kind", slog.Int("refresh_token", 42), slog.StringValue(redacted)},
+		{"PII key", slog.String("Email", "jane@example.com"), slog.StringValue(redacted)},
+		{"PII only as the whole name", slog.String("email_verified", "true"), slog.StringValue("true")},
+		{"secret in a string", slog.String("error", "bad header Bearer abc"), slog.StringValue("bad header Bearer " + redacted)},
+		{"secret in an error", slog.Any("error", errors.New("dial postgres://u:p@db")), slog.StringValue("dial postgres://" + redacted + "@db")},
+		{"other values kept", slog.Int("status", 200), slog.IntValue(200)},
+	} {
+		got := redactAttr(nil, tc.attr)
+		if got.Key != tc.attr.Key || !got.Value.Equal(tc.want) {
+			t.Errorf("%s: got %s=%v, want %s=%v", tc.name, got.Key, got.Value, tc.attr.Key, tc.want)
+		}
+	}
+}
+
+func TestNewLoggerRedacts(t *testing.T) {
+	var out bytes.Buffer
+	newLogger(&out).With("request_id", "req-1").Info("login",
+		slog.Group("user", "email", "jane@example.com", "id", "user-1"),
+		"authorization", "Bearer abc")
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("log line is not JSON: %v: %s", err, out.String())
+	}
+	user, _ := line["user"].(map[string]interface{})
+	if user["email"] != redacted || user["id"] != "user-1" {
+		t.Errorf("got user group %v, want email redacted and id kept", user)
+	}
+	if line["authorization"] != redacted || line["request_id"] != "req-1" {
+		t.Errorf("got %s", out.String())
+	}
+}
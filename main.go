@@ -1,29 +1,301 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
+const defaultShutdownTimeout = 30 * time.Second
+
 func main() {
+	logger := newLogger(os.Stderr)
+	slog.SetDefault(logger)
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		if err := setLogLevel(level); err != nil {
+			logger.Warn("ignoring LOG_LEVEL", "error", err)
+		}
+	}
 
 	db, err := ConnectDB()
 	if err != nil {
-		panic(err)
+		fatal(logger, "failed to connect to database", err)
+	}
+	if err := registerDBMetrics(db); err != nil {
+		fatal(logger, "failed to register database metrics", err)
+	}
+	if os.Getenv("AUTO_MIGRATE") != "false" {
+		if err := RunMigrations(db); err != nil {
+			fatal(logger, "failed to run migrations", err)
+		}
+	}
+	if err := checkJournalProtection(db); err != nil {
+		fatal(logger, "journal protection self-check failed", err)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] != "serve" {
+		os.Exit(runCommand(db, os.Args[1:]))
+	}
+
+	auth, err := NewAuthenticator(NewAuthConfig())
+	if err != nil {
+		fatal(logger, "failed to configure authentication", err)
+	}
+
+	router := gin.New()
+	router.Use(RequestIDMiddleware(logger), MetricsMiddleware(), RecoveryMiddleware())
+
+	// probes are registered outside the authenticated group
+	router.GET("/healthz", HealthzHandler())
+	router.GET("/readyz", ReadyzHandler(db, auth))
+	router.GET("/openapi.json", OpenAPIHandler())
+	router.GET("/docs/*filepath", SwaggerUIHandler())
+
+	// metrics get a listener of their own when METRICS_ADDR is set
+	metricsAddr := os.Getenv("METRICS_ADDR")
+	var metricsServer *http.Server
+	if metricsAddr != "" {
+		metricsServer = newMetricsServer(metricsAddr)
+	} else {
+		router.GET("/metrics", gin.WrapH(MetricsHandler()))
+	}
+
+	api := apiGroup{router.Group("/")}
+	api.Use(JWTAuthMiddleware(auth), JSONMiddleware())
+
+	api.POST("/account", CreateAccountHandler(db))
+	api.POST("/accounttype", CreateAccountTypeHandler(db))
+	api.POST("/coa", CreateChartOfAccountHandler(db))
+	api.PUT("/coa/:id/balancerule", SetChartBalanceRuleHandler(db))
+	api.PUT("/coa/:id/control", SetControlAccountHandler(db))
+	api.PUT("/coa/:id/interestplan", SetChartInterestPlanHandler(db))
+	api.POST("/interestplan", CreateInterestPlanHandler(db))
+	api.PUT("/account/:id/balancerule", SetAccountBalanceRuleHandler(db))
+	api.POST("/journalentry", CreateJournalEntryHandler(db))
+	api.POST("/journalentry/:id/approve", ApproveJournalEntryHandler(db))
+	api.POST("/journalentry/:id/reject", RejectJournalEntryHandler(db))
+	api.POST("/journalentry/:id/reverse", ReverseJournalEntryHandler(db))
+	api.PUT("/account/:id/status", ChangeAccountStatusHandler(db))
+	api.POST("/account/:id/owner", AddAccountOwnerHandler(db))
+	api.DELETE("/account/:id/owner/:customerid", RemoveAccountOwnerHandler(db))
+	api.PUT("/account/:id/mandate", SetAccountMandateHandler(db))
+	api.POST("/customer", CreateCustomerHandler(db))
+	api.PUT("/customer/:id/kyc", ReviewCustomerKYCHandler(db))
+	api.POST("/account/:id/hold", PlaceHoldHandler(db))
+	api.POST("/hold/:id/release", ReleaseHoldHandler(db))
+	api.POST("/loanproduct", CreateLoanProductHandler(db))
+	api.POST("/loan", CreateLoanHandler(db))
+	api.POST("/loan/:id/disburse", DisburseLoanHandler(db))
+	api.POST("/loan/:id/repayment", RepayLoanHandler(db))
+	api.POST("/loan/:id/penalty", ChargeLoanPenaltyHandler(db))
+	api.POST("/charge", CreateChargeHandler(db))
+	api.PUT("/charge/:id/active", SetChargeActiveHandler(db))
+	api.POST("/account/:id/waiver", CreateWaiverHandler(db))
+	api.POST("/waiver/:id/revoke", RevokeWaiverHandler(db))
+	api.POST("/journalentry/import", ImportJournalHandler(db))
+	api.POST("/period/close", ClosePeriodHandler(db))
+	api.POST("/recurring", CreateRecurringEntryHandler(db))
+	api.POST("/recurring/:id/pause", SetRecurringStatusHandler(db, RecurringStatusPaused))
+	api.POST("/recurring/:id/resume", SetRecurringStatusHandler(db, RecurringStatusActive))
+	api.POST("/account/:id/statement", ImportStatementHandler(db))
+	api.POST("/account/:id/statement/match", AutoMatchStatementHandler(db))
+	api.POST("/statementline/:id/match", MatchStatementLineHandler(db))
+	api.POST("/statementline/:id/unmatch", UnmatchStatementLineHandler(db))
+	api.POST("/webhook", CreateWebhookHandler(db))
+	api.PUT("/webhook/:id", UpdateWebhookHandler(db))
+	api.DELETE("/webhook/:id", DeleteWebhookHandler(db))
+	api.POST("/webhookdelivery/:id/retry", RetryWebhookDeliveryHandler(db))
+	api.POST("/approvalrule", CreateApprovalRuleHandler(db))
+
+	api.GET("/account", ListAccountHandler(db))
+	api.GET("/account/:id/owner", ListAccountOwnersHandler(db))
+	api.GET("/customer", ListCustomerHandler(db))
+	api.GET("/customer/:id", GetCustomerHandler(db))
+	api.GET("/customer/:id/accounts", ListCustomerAccountsHandler(db))
+	api.GET("/account/:id/interest", AccountInterestHandler(db))
+	api.GET("/interestplan", ListInterestPlanHandler(db))
+	api.GET("/charge", ListChargeHandler(db))
+	api.GET("/account/:id/waiver", ListWaiverHandler(db))
+	api.GET("/account/:id/fees", ListAccountFeesHandler(db))
+	api.GET("/importbatch/:id", GetImportBatchHandler(db))
+	api.GET("/period", GetPeriodHandler(db))
+	api.GET("/recurring", ListRecurringEntryHandler(db))
+	api.GET("/recurring/:id", GetRecurringEntryHandler(db))
+	api.GET("/recurring/:id/preview", PreviewRecurringEntryHandler(db))
+	api.GET("/account/:id/statement", ListStatementHandler(db))
+	api.GET("/statement/:id", GetStatementHandler(db))
+	api.GET("/account/:id/reconciliation", BankReconciliationHandler(db))
+	api.GET("/event", ListEventHandler(db))
+	api.GET("/webhook", ListWebhookHandler(db))
+	api.GET("/webhook/:id/delivery", ListWebhookDeliveryHandler(db))
+	api.GET("/webhookdelivery/dead", ListDeadLetterHandler(db))
+	api.GET("/account/:id/hold", ListAccountHoldsHandler(db))
+	api.GET("/coa", ListChartOfAccountHandler(db))
+	api.GET("/coa/control", ControlAccountReportHandler(db))
+	api.GET("/loanproduct", ListLoanProductHandler(db))
+	api.GET("/loan", ListLoanHandler(db))
+	api.GET("/loan/:id", GetLoanHandler(db))
+	api.GET("/loan/:id/schedule", LoanScheduleHandler(db))
+	api.GET("/accounttype", ListAccountTypeHandler(db))
+	api.GET("/journalentry", ListJournalEntryHandler(db))
+	api.GET("/approvalrule", ListApprovalRuleHandler(db))
+	api.GET("/audit", ListAuditLogHandler(db))
+	api.GET("/audit/verify", VerifyAuditLogHandler(db))
+	api.GET("/admin/reconcile", ReconcileBalancesHandler(db))
+	api.POST("/admin/reconcile", ReconcileBalancesHandler(db))
+	api.POST("/admin/control", ControlAccountReportHandler(db))
+	api.GET("/admin/integrity", LedgerIntegrityHandler(db))
+	api.POST("/admin/holds/expire", ExpireHoldsHandler(db))
+	api.POST("/admin/interest", InterestAccrualHandler(db))
+	api.POST("/admin/fees/maintenance", MaintenanceFeeHandler(db))
+	api.POST("/admin/recurring/run", RecurringRunHandler(db))
+	api.POST("/admin/webhooks/dispatch", WebhookDispatchHandler(db))
+	api.GET("/admin/loglevel", GetLogLevelHandler())
+	api.PUT("/admin/loglevel", SetLogLevelHandler())
+	api.GET("/admin/dormancy", DormancyHandler(db))
+	api.POST("/admin/dormancy", DormancyHandler(db))
+	api.GET("/profitandloss", ProfitAndLossHandler(db))
+	api.GET("/balancesheet", BalanceSheetHandler(db))
+
+	if err := checkAPIRoutes(router.Routes()); err != nil {
+		fatal(logger, "routes and OpenAPI document disagree", err)
+	}
+	if _, err := openAPISpec(); err != nil {
+		fatal(logger, "failed to build OpenAPI document", err)
+	}
+
+	addr := os.Getenv("HTTP_ADDR")
+	if addr == "" {
+		addr = ":8000"
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	grpcAddr := os.Getenv("GRPC_ADDR")
+	if grpcAddr == "" {
+		grpcAddr = defaultGRPCAddr
+	}
+	grpcListener, err := net.Listen("tcp", grpcAddr)
+	if err != nil {
+		fatal(logger, fmt.Sprintf("failed to listen for gRPC on %s", grpcAddr), err)
+	}
+	grpcServer := newGRPCServer(db, auth, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// background jobs stop at their next tick once ctx is cancelled; a
+	// batch already running is waited for before the database is closed
+	var jobs sync.WaitGroup
+	runJob := func(job func()) {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			job()
+		}()
+	}
+	runJob(func() {
+		runHoldExpiry(ctx, db, logger, envDuration("HOLD_EXPIRY_INTERVAL", defaultHoldExpiryInterval))
+	})
+	runJob(func() {
+		runDormancyDetector(ctx, db, logger, envDuration("DORMANCY_CHECK_INTERVAL", defaultDormancyCheckInterval),
+			envDuration("DORMANCY_PERIOD", defaultDormancyPeriod))
+	})
+	runJob(func() {
+		runInterestAccrual(ctx, db, logger, envDuration("INTEREST_ACCRUAL_INTERVAL", defaultInterestAccrualInterval))
+	})
+	runJob(func() {
+		runMaintenanceFees(ctx, db, logger, envDuration("MAINTENANCE_FEE_INTERVAL", defaultMaintenanceFeeInterval))
+	})
+	runJob(func() {
+		runRecurringEntries(ctx, db, logger, envDuration("RECURRING_INTERVAL", defaultRecurringInterval))
+	})
+	runJob(func() {
+		runWebhookDispatcher(ctx, db, logger, envDuration("WEBHOOK_INTERVAL", defaultWebhookInterval))
+	})
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal(logger, "server error", err)
+		}
+	}()
+	go func() {
+		if err := grpcServer.Serve(grpcListener); err != nil {
+			fatal(logger, "gRPC server error", err)
+		}
+	}()
+	if metricsServer != nil {
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fatal(logger, "metrics server error", err)
+			}
+		}()
 	}
-	router := gin.Default()
-	router.Use(JWTAuthMiddleware(), JSONMiddleware())
 
-	router.POST("/account", CreateAccountHandler(db))
-	router.POST("/accounttype", CreateAccountTypeHandler(db))
-	router.POST("/coa", CreateChartOfAccountHandler(db))
-	router.POST("journalentry", CreateJournalEntryHandler(db))
+	<-ctx.Done()
+	stop()
+	logger.Info("shutting down, draining in-flight requests")
 
-	router.GET("/account", ListAccountHandler(db))
-	router.GET("/coa", ListChartOfAccountHandler(db))
-	router.GET("/accounttype", ListAccountTypeHandler(db))
-	router.GET("/journalentry", ListJournalEntryHandler(db))
-	router.GET("/profitandloss", ProfitAndLossHandler(db))
-	router.GET("/balancesheet", BalanceSheetHandler(db))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("graceful shutdown did not complete", "error", err)
+	}
+	if metricsServer != nil {
+		metricsServer.Shutdown(shutdownCtx)
+	}
+	// GracefulStop waits for open streams, so give up on them with the
+	// HTTP drain deadline
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		grpcServer.Stop()
+	}
 
-	router.Run(":8000")
+	jobsDone := make(chan struct{})
+	go func() {
+		jobs.Wait()
+		close(jobsDone)
+	}()
+	select {
+	case <-jobsDone:
+	case <-shutdownCtx.Done():
+		logger.Warn("background jobs still running at the shutdown deadline, closing the database under them")
+	}
+
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// envDuration reads a duration such as "45s" from the environment.
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("invalid duration, using the default", "name", name, "value", value, "default", fallback.String())
+		return fallback
+	}
+	return duration
 }
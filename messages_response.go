@@ -1,5 +1,13 @@
 package main
 
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
 // Success Response
 type SuccessResponse struct {
 	StatusCode int         `json:"status_code"`
@@ -13,4 +21,43 @@ type ErrorResponse struct {
 	Error      string `json:"error"`
 }
 
+// errInvalidRequest is a problem with the caller's input found by logic
+// shared between the REST and gRPC APIs; REST answers it with a 400.
+type errInvalidRequest string
 
+func (e errInvalidRequest) Error() string {
+	return string(e)
+}
+
+func respondNotFoundOr500(c *gin.Context, err error, notFound string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: notFound, StatusCode: http.StatusNotFound})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+}
+
+// respondPostingError maps failures from postJournalEntry to a response;
+// refusals are the caller's problem, anything else is ours.
+func respondPostingError(c *gin.Context, err error) {
+	var invalid errInvalidRequest
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error(), StatusCode: http.StatusBadRequest})
+		return
+	}
+	if isPostingRefusal(err) {
+		c.JSON(http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnprocessableEntity})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+}
+
+// isPostingRefusal reports whether postJournalEntry refused the entry for
+// insufficient funds, account status, a control account or a closed period.
+func isPostingRefusal(err error) bool {
+	var insufficient *InsufficientFundsError
+	var status *AccountStatusError
+	var control *ControlAccountError
+	var closed *PeriodClosedError
+	return errors.As(err, &insufficient) || errors.As(err, &status) || errors.As(err, &control) || errors.As(err, &closed)
+}
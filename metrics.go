@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+// Metrics are served in the Prometheus text format at /metrics, without
+// authentication. They are served on the main HTTP port unless
+// METRICS_ADDR names a port of their own, which keeps them off the public
+// listener.
+
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	httpRequests = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ledger_http_requests_total",
+		Help: "HTTP requests answered, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	httpRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ledger_http_request_duration_seconds",
+		Help:    "Time to answer HTTP requests, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	authRequestDuration = promauto.With(metricsRegistry).NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ledger_auth_request_duration_seconds",
+		Help:    "Time taken by calls to the auth service, by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	authRequestFailures = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ledger_auth_request_failures_total",
+		Help: "Calls to the auth service that failed, by operation and reason.",
+	}, []string{"operation", "reason"})
+
+	journalPostings = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ledger_journal_postings_total",
+		Help: "Committed journal postings, by account type and side.",
+	}, []string{"account_type", "side"})
+
+	journalPostedAmount = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ledger_journal_posted_amount_total",
+		Help: "Sum of committed journal posting amounts, by account type and side.",
+	}, []string{"account_type", "side"})
+
+	postingFailures = promauto.With(metricsRegistry).NewCounterVec(prometheus.CounterOpts{
+		Name: "ledger_posting_failures_total",
+		Help: "Journal postings refused, failed or held for approval, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// registerDBMetrics exports the connection pool statistics of db.
+func registerDBMetrics(db *gorm.DB) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return metricsRegistry.Register(collectors.NewDBStatsCollector(sqlDB, "ledger"))
+}
+
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{})
+}
+
+// MetricsMiddleware counts and times every request. Requests that match no
+// route share one label so scans of random paths cannot blow up the
+// series count.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpRequestDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeAuthCall records the latency of one call to the auth service and
+// whether it failed. A 4xx answer is the service doing its job, such as
+// rejecting a bad token, so only transport errors and 5xx count as
+// failures.
+func observeAuthCall(operation string, start time.Time, response *http.Response, err error) {
+	authRequestDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	switch {
+	case err != nil:
+		authRequestFailures.WithLabelValues(operation, "unreachable").Inc()
+	case response.StatusCode >= http.StatusInternalServerError:
+		authRequestFailures.WithLabelValues(operation, "server_error").Inc()
+	}
+}
+
+// postingFailureReason names the reason a posting was refused, for the
+// reason label.
+func postingFailureReason(err error) string {
+	var invalid errInvalidRequest
+	var limit *PostingLimitError
+	var insufficient *InsufficientFundsError
+	var status *AccountStatusError
+	var control *ControlAccountError
+	var closed *PeriodClosedError
+	switch {
+	case errors.As(err, &invalid):
+		return "invalid"
+	case errors.As(err, &limit):
+		return "posting_limit"
+	case errors.As(err, &insufficient):
+		return "insufficient_funds"
+	case errors.As(err, &status):
+		return "account_status"
+	case errors.As(err, &control):
+		return "control_account"
+	case errors.As(err, &closed):
+		return "period_closed"
+	}
+	return "error"
+}
+
+// refusePosting counts err as the reason a posting was refused before it
+// reached postJournalEntry, which counts its own, and returns it.
+func refusePosting(err error) error {
+	postingFailures.WithLabelValues(postingFailureReason(err)).Inc()
+	return err
+}
+
+// recordQueued counts an entry held for approval once the transaction
+// queueing it commits.
+func recordQueued(tx *gorm.DB) {
+	afterCommit(tx, func() {
+		postingFailures.WithLabelValues("pending_approval").Inc()
+	})
+}
+
+// recordPosting counts entry by the account type of each side once the
+// transaction posting it commits. An account whose type cannot be read is
+// counted as "unknown" rather than failing the posting: the lookup runs in
+// a savepoint, so a failed statement is rolled back on its own instead of
+// aborting the transaction.
+func recordPosting(tx *gorm.DB, entry *JournalEntry) {
+	var rows []struct {
+		AccountNumber int    `gorm:"column:accountnumber"`
+		Name          string `gorm:"column:name"`
+	}
+	err := tx.Transaction(func(stx *gorm.DB) error {
+		return stx.Raw(`SELECT a.accountnumber, t.name
+			FROM account a
+			JOIN chartofaccount c ON c.accountid = a.coaid
+			JOIN accounttype t ON t.accountid = c.accounttypeid
+			WHERE a.accountnumber IN ?`, []int{entry.AccountDebitNumber, entry.AccountCreditNumber}).Scan(&rows).Error
+	})
+	if err != nil {
+		slog.Warn("failed to read account types for posting metrics", "error", err)
+		rows = nil
+	}
+	types := map[int]string{}
+	for _, row := range rows {
+		types[row.AccountNumber] = row.Name
+	}
+	accountType := func(number int) string {
+		if name, ok := types[number]; ok {
+			return name
+		}
+		return "unknown"
+	}
+	debitType, creditType, amount := accountType(entry.AccountDebitNumber), accountType(entry.AccountCreditNumber), float64(entry.Amount)
+
+	afterCommit(tx, func() {
+		journalPostings.WithLabelValues(debitType, "debit").Inc()
+		journalPostedAmount.WithLabelValues(debitType, "debit").Add(amount)
+		journalPostings.WithLabelValues(creditType, "credit").Inc()
+		journalPostedAmount.WithLabelValues(creditType, "credit").Add(amount)
+	})
+}
+
+// commitHookPool wraps gorm's connection pool so that transactions it
+// begins can run work just before and after they commit, which gorm
+// itself has no hook for. Counting a posting inside its transaction would
+// also count the ones a later failure rolls back, such as the rest of an
+// import batch.
+type commitHookPool struct {
+	gorm.ConnPool
+}
+
+// withCommitHooks lets transactions begun on db use beforeCommit and
+// afterCommit.
+func withCommitHooks(db *gorm.DB) {
+	db.ConnPool = &commitHookPool{ConnPool: db.ConnPool}
+	db.Statement.ConnPool = db.ConnPool
+}
+
+func (p *commitHookPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	beginner, ok := p.ConnPool.(gorm.TxBeginner)
+	if !ok {
+		return nil, gorm.ErrInvalidTransaction
+	}
+	tx, err := beginner.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &commitHookTx{Tx: tx, savepoints: map[string]hookMark{}}, nil
+}
+
+func (p *commitHookPool) GetDBConn() (*sql.DB, error) {
+	if sqlDB, ok := p.ConnPool.(*sql.DB); ok {
+		return sqlDB, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+type commitHookTx struct {
+	*sql.Tx
+	appends []func() error
+	hooks   []func()
+	// savepoints maps each savepoint to the work registered before it, so
+	// rolling back to it drops the work added since
+	savepoints map[string]hookMark
+}
+
+type hookMark struct {
+	appends, hooks int
+}
+
+// ExecContext watches the statements gorm uses for nested transactions.
+// It relies on the postgres dialector's SavePoint and RollbackTo sending
+// exactly "SAVEPOINT <name>" and "ROLLBACK TO SAVEPOINT <name>"; if a gorm
+// upgrade changes them, hooks of rolled back nested transactions would run,
+// which TestCommitHooks catches.
+func (t *commitHookTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	result, err := t.Tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return result, err
+	}
+	switch {
+	case strings.HasPrefix(query, "SAVEPOINT "):
+		t.savepoints[strings.TrimPrefix(query, "SAVEPOINT ")] = hookMark{appends: len(t.appends), hooks: len(t.hooks)}
+	case strings.HasPrefix(query, "ROLLBACK TO SAVEPOINT "):
+		if mark, ok := t.savepoints[strings.TrimPrefix(query, "ROLLBACK TO SAVEPOINT ")]; ok {
+			t.appends = t.appends[:mark.appends]
+			t.hooks = t.hooks[:mark.hooks]
+		}
+	}
+	return result, nil
+}
+
+func (t *commitHookTx) Commit() error {
+	// gorm does not roll back a transaction whose commit failed
+	for _, fn := range t.appends {
+		if err := fn(); err != nil {
+			t.Tx.Rollback()
+			return err
+		}
+	}
+	if err := t.Tx.Commit(); err != nil {
+		return err
+	}
+	for _, hook := range t.hooks {
+		hook()
+	}
+	return nil
+}
+
+// beforeCommit runs fn as the last work of the transaction tx belongs to,
+// just before it commits; an error from fn rolls the transaction back. It
+// reports false, and never runs fn, when tx is not such a transaction.
+func beforeCommit(tx *gorm.DB, fn func() error) bool {
+	hooked, ok := tx.Statement.ConnPool.(*commitHookTx)
+	if ok {
+		hooked.appends = append(hooked.appends, fn)
+	}
+	return ok
+}
+
+// afterCommit runs fn once the transaction tx belongs to commits, and
+// never if it rolls back. Outside a transaction fn runs at once.
+func afterCommit(tx *gorm.DB, fn func()) {
+	if hooked, ok := tx.Statement.ConnPool.(*commitHookTx); ok {
+		hooked.hooks = append(hooked.hooks, fn)
+		return
+	}
+	fn()
+}
+
+// newMetricsServer serves /metrics alone on addr.
+func newMetricsServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", MetricsHandler())
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestCommitHooks(t *testing.T) {
+	db, _ := newFakeDB(t)
+
+	var ran []string
+	hook := func(tx *gorm.DB, name string) {
+		afterCommit(tx, func() { ran = append(ran, name) })
+	}
+	failed := errors.New("failed")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		hook(tx, "outer")
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			hook(tx, "nested committed")
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			hook(tx, "nested rolled back")
+			return failed
+		}); !errors.Is(err, failed) {
+			return fmt.Errorf("nested transaction returned %v", err)
+		}
+		hook(tx, "after rollback")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"outer", "nested committed", "after rollback"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("committed transaction ran %v, want %v", ran, want)
+	}
+
+	ran = nil
+	err = db.Transaction(func(tx *gorm.DB) error {
+		hook(tx, "rolled back")
+		return failed
+	})
+	if !errors.Is(err, failed) || len(ran) != 0 {
+		t.Errorf("rolled back transaction returned %v and ran %v, want no hooks", err, ran)
+	}
+
+	ran = nil
+	hook(db, "no transaction")
+	if !reflect.DeepEqual(ran, []string{"no transaction"}) {
+		t.Errorf("outside a transaction ran %v, want the hook at once", ran)
+	}
+}
+
+func TestBeforeCommit(t *testing.T) {
+	db, fake := newFakeDB(t)
+
+	var ran []string
+	register := func(tx *gorm.DB, name string, err error) {
+		if !beforeCommit(tx, func() error {
+			ran = append(ran, name)
+			return err
+		}) {
+			t.Fatalf("%s: transaction has no commit hooks", name)
+		}
+	}
+	failed := errors.New("failed")
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		register(tx, "outer", nil)
+		afterCommit(tx, func() { ran = append(ran, "after commit") })
+		if err := tx.Transaction(func(tx *gorm.DB) error {
+			register(tx, "nested rolled back", nil)
+			return failed
+		}); !errors.Is(err, failed) {
+			return fmt.Errorf("nested transaction returned %v", err)
+		}
+		register(tx, "last", nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"outer", "last", "after commit"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("committed transaction ran %v, want %v", ran, want)
+	}
+
+	ran = nil
+	err = db.Transaction(func(tx *gorm.DB) error {
+		register(tx, "failing", failed)
+		register(tx, "skipped", nil)
+		afterCommit(tx, func() { ran = append(ran, "after commit") })
+		return nil
+	})
+	queries := fake.queries()
+	if !errors.Is(err, failed) || !reflect.DeepEqual(ran, []string{"failing"}) || queries[len(queries)-1] != "ROLLBACK" {
+		t.Errorf("failing append returned %v, ran %v and ended with %q, want it rolled back", err, ran, queries[len(queries)-1])
+	}
+
+	if beforeCommit(db, func() error { return nil }) {
+		t.Error("beforeCommit accepted work outside a transaction")
+	}
+}
+
+func TestPostingFailureReason(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{errInvalidRequest("Amount must be greater than zero"), "invalid"},
+		{&PostingLimitError{Limit: 1000}, "posting_limit"},
+		{&InsufficientFundsError{}, "insufficient_funds"},
+		{&AccountStatusError{}, "account_status"},
+		{&ControlAccountError{}, "control_account"},
+		{&PeriodClosedError{}, "period_closed"},
+		{&importPostingError{Row: 4, Err: &InsufficientFundsError{}}, "insufficient_funds"},
+		{errors.New("connection reset"), "error"},
+	} {
+		if got := postingFailureReason(tc.err); got != tc.want {
+			t.Errorf("%T: got %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
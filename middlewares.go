@@ -1,16 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	jwt "github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gin-gonic/gin"
 	_ "github.com/lib/pq"
 	"net/http"
-	"os"
 	"strings"
-	// "io"
 )
 
 // content-type middleware
@@ -21,10 +16,9 @@ func JSONMiddleware() gin.HandlerFunc {
 	}
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+func JWTAuthMiddleware(auth *Authenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString := c.Request.Header.Get("Authorization")
-		tokenRequest := c.Request.Header.Get("Authorization")
 		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "No token provided", StatusCode: http.StatusUnauthorized})
 			c.Abort()
@@ -38,74 +32,27 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 		}
 
 		tokenString = tokenString[len("Bearer "):]
-		// fmt.Println("Token string:", tokenString)
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			secret := []byte(os.Getenv("SECRET"))
-			fmt.Println("Using secret:", string(secret))
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				fmt.Printf("Unexpected signing method: %v\n", token.Header["alg"])
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			// fmt.Printf("Token claims: %+v\n", token.Claims)
-			return secret, nil
-		})
 
+		result, err := auth.Authenticate(c.Request.Context(), tokenString)
 		if err != nil {
-			fmt.Println("Token parsing error:", err)
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnauthorized})
-			c.Abort()
-			return
-		}
-
-		if _, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			// fmt.Printf("Token is valid. Claims: %+v\n", claims)
-			payload := map[string]string{"token": tokenString}
-			fmt.Println("payload", payload)
-			jsonPayload, err := json.Marshal(payload)
-			// fmt.Println("jsonPayload", jsonPayload)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Error encoding payload", StatusCode: http.StatusInternalServerError})
-				c.Abort()
-				return
+			var tokenErr *authError
+			if errors.As(err, &tokenErr) {
+				c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error(), StatusCode: http.StatusUnauthorized})
+			} else if errors.Is(err, errAuthUnavailable) {
+				loggerFrom(c).Error("auth service unavailable")
+				c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: err.Error(), StatusCode: http.StatusServiceUnavailable})
+			} else {
+				loggerFrom(c).Error("auth service error", "error", err)
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
 			}
-
-			authURL := os.Getenv("AUTH_URL")
-			request, err := http.NewRequest(http.MethodPost, authURL, bytes.NewBuffer(jsonPayload))
-			request.Header.Set("Authorization", tokenRequest)
-
-			client := &http.Client{}
-			response, err := client.Do(request)
-			// fmt.Println("response", response)
-
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Error contacting auth service", StatusCode: http.StatusInternalServerError})
-				c.Abort()
-				return
-			}
-			defer response.Body.Close()
-
-			if response.StatusCode != http.StatusOK {
-				c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token", StatusCode: http.StatusUnauthorized})
-				c.Abort()
-				return
-			}
-
-			var result map[string]interface{}
-			err = json.NewDecoder(response.Body).Decode(&result)
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Error decoding response", StatusCode: http.StatusInternalServerError})
-				c.Abort()
-				return
-			}
-
-			c.Set("userID", result["user_id"])
-			c.Next()
-		} else {
-			fmt.Println("Token claims invalid or token is not valid")
-			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "Invalid token", StatusCode: http.StatusUnauthorized})
 			c.Abort()
 			return
 		}
+
+		c.Set("userID", result.UserID)
+		c.Set("roles", result.Roles)
+		c.Set("scopes", result.Scopes)
+		c.Set("claims", result.Claims)
+		c.Next()
 	}
 }
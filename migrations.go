@@ -0,0 +1,715 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is a single versioned schema change. Migrations are applied in
+// order and recorded in the schemamigrations table.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+type SchemaMigration struct {
+	Version   int       `gorm:"column:version;primarykey"`
+	Name      string    `gorm:"column:name"`
+	AppliedAt time.Time `gorm:"column:appliedat"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schemamigrations"
+}
+
+// arbitrary key so that only one replica migrates at a time
+const migrationLockKey = 7310421
+
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "baseline",
+		SQL: `
+CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
+
+CREATE TABLE IF NOT EXISTS accounttype (
+    accountid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255),
+    description TEXT,
+    startrange INT,
+    endrange INT
+);
+
+CREATE TABLE IF NOT EXISTS chartofaccount (
+    accountid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accounttypeid UUID REFERENCES accounttype(accountid),
+    accountnumber INT,
+    name VARCHAR(255)
+);
+
+CREATE TABLE IF NOT EXISTS account (
+    accountid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255),
+    accountnumber INT UNIQUE,
+    coaid UUID REFERENCES chartofaccount(accountid)
+);
+
+CREATE TABLE IF NOT EXISTS accountbalance (
+    balanceid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accountid UUID UNIQUE REFERENCES account(accountid),
+    balance INT DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS journalentry (
+    transactionid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accountdebitnumber INT,
+    accountcreditnumber INT,
+    date TIMESTAMP,
+    amount INT,
+    description TEXT
+);
+`,
+	},
+	{
+		Version: 2,
+		Name:    "journal approval",
+		SQL: `
+ALTER TABLE journalentry
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'posted',
+    ADD COLUMN IF NOT EXISTS createdby VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS reviewedby VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS reviewedat TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS rejectionreason TEXT;
+
+CREATE INDEX IF NOT EXISTS journalentry_status_idx ON journalentry (status);
+
+CREATE TABLE IF NOT EXISTS approvalrule (
+    ruleid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accounttypeid UUID REFERENCES accounttype(accountid),
+    role VARCHAR(50),
+    threshold INT NOT NULL
+);
+`,
+	},
+	{
+		Version: 3,
+		Name:    "audit trail",
+		SQL: `
+ALTER TABLE accounttype
+    ADD COLUMN IF NOT EXISTS createdby VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS createdat TIMESTAMPTZ;
+ALTER TABLE chartofaccount
+    ADD COLUMN IF NOT EXISTS createdby VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS createdat TIMESTAMPTZ;
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS createdby VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS createdat TIMESTAMPTZ;
+ALTER TABLE journalentry
+    ADD COLUMN IF NOT EXISTS createdat TIMESTAMPTZ;
+
+CREATE TABLE IF NOT EXISTS auditlog (
+    auditid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    sequence BIGINT NOT NULL UNIQUE,
+    actor VARCHAR(255),
+    occurredat TIMESTAMPTZ NOT NULL,
+    method VARCHAR(10),
+    endpoint VARCHAR(255),
+    action VARCHAR(50) NOT NULL,
+    entitytype VARCHAR(50) NOT NULL,
+    entityid VARCHAR(255),
+    before TEXT,
+    after TEXT,
+    requestid VARCHAR(255),
+    prevhash VARCHAR(64),
+    hash VARCHAR(64) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS auditlog_entity_idx ON auditlog (entitytype, entityid);
+CREATE INDEX IF NOT EXISTS auditlog_actor_idx ON auditlog (actor);
+
+CREATE OR REPLACE FUNCTION auditlog_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'auditlog is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS auditlog_no_modify ON auditlog;
+CREATE TRIGGER auditlog_no_modify BEFORE UPDATE OR DELETE ON auditlog
+    FOR EACH ROW EXECUTE PROCEDURE auditlog_append_only();
+
+DROP TRIGGER IF EXISTS auditlog_no_truncate ON auditlog;
+CREATE TRIGGER auditlog_no_truncate BEFORE TRUNCATE ON auditlog
+    FOR EACH STATEMENT EXECUTE PROCEDURE auditlog_append_only();
+`,
+	},
+	{
+		Version: 4,
+		Name:    "immutable posted journal",
+		SQL: `
+ALTER TABLE journalentry
+    ADD COLUMN IF NOT EXISTS reversalof UUID REFERENCES journalentry(transactionid);
+
+CREATE UNIQUE INDEX IF NOT EXISTS journalentry_reversalof_idx ON journalentry (reversalof)
+    WHERE reversalof IS NOT NULL;
+
+CREATE OR REPLACE FUNCTION journalentry_protect_posted() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'TRUNCATE' THEN
+        RAISE EXCEPTION 'journalentry cannot be truncated';
+    END IF;
+    IF OLD.status = 'posted' THEN
+        RAISE EXCEPTION 'posted journal entry % is immutable, post a reversal instead', OLD.transactionid;
+    END IF;
+    IF TG_OP = 'DELETE' THEN
+        RETURN OLD;
+    END IF;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS journalentry_protect_posted ON journalentry;
+CREATE TRIGGER journalentry_protect_posted BEFORE UPDATE OR DELETE ON journalentry
+    FOR EACH ROW EXECUTE PROCEDURE journalentry_protect_posted();
+
+DROP TRIGGER IF EXISTS journalentry_no_truncate ON journalentry;
+CREATE TRIGGER journalentry_no_truncate BEFORE TRUNCATE ON journalentry
+    FOR EACH STATEMENT EXECUTE PROCEDURE journalentry_protect_posted();
+`,
+	},
+	{
+		Version: 5,
+		Name:    "balance rules",
+		SQL: `
+ALTER TABLE chartofaccount
+    ADD COLUMN IF NOT EXISTS balancerule VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS overdraftlimit INT NOT NULL DEFAULT 0;
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS balancerule VARCHAR(20) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS overdraftlimit INT NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 6,
+		Name:    "account holds",
+		SQL: `
+CREATE TABLE IF NOT EXISTS accounthold (
+    holdid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    amount INT NOT NULL CHECK (amount > 0),
+    holdtype VARCHAR(30) NOT NULL,
+    reason TEXT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    expiresat TIMESTAMPTZ,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    releasedby VARCHAR(255),
+    releasedat TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS accounthold_active_idx ON accounthold (accountid) WHERE status = 'active';
+`,
+	},
+	{
+		Version: 7,
+		Name:    "account lifecycle",
+		SQL: `
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS statusreason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS statuschangedat TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS lastactivityat TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS account_status_idx ON account (status);
+`,
+	},
+	{
+		Version: 8,
+		Name:    "customers and account ownership",
+		SQL: `
+CREATE TABLE IF NOT EXISTS customer (
+    customerid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    customertype VARCHAR(20) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    idtype VARCHAR(30) NOT NULL,
+    idnumber VARCHAR(100) NOT NULL,
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    phone VARCHAR(50) NOT NULL DEFAULT '',
+    address TEXT NOT NULL DEFAULT '',
+    kycstatus VARCHAR(20) NOT NULL DEFAULT 'pending',
+    kycreviewedby VARCHAR(255),
+    kycreviewedat TIMESTAMPTZ,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (idtype, idnumber)
+);
+
+CREATE TABLE IF NOT EXISTS accountowner (
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    customerid UUID NOT NULL REFERENCES customer(customerid),
+    role VARCHAR(20) NOT NULL,
+    cansign BOOLEAN NOT NULL DEFAULT true,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (accountid, customerid)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS accountowner_primary_idx ON accountowner (accountid) WHERE role = 'primary';
+CREATE INDEX IF NOT EXISTS accountowner_customer_idx ON accountowner (customerid);
+
+ALTER TABLE account
+    ADD COLUMN IF NOT EXISTS mandate VARCHAR(20) NOT NULL DEFAULT 'any',
+    ADD COLUMN IF NOT EXISTS requiredsignatories INT NOT NULL DEFAULT 1;
+`,
+	},
+	{
+		Version: 9,
+		Name:    "control accounts",
+		SQL: `
+ALTER TABLE chartofaccount
+    ADD COLUMN IF NOT EXISTS iscontrol BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS controlbalance INT NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		Version: 10,
+		Name:    "loans",
+		SQL: `
+CREATE TABLE IF NOT EXISTS loanproduct (
+    productid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    ratebps INT NOT NULL CHECK (ratebps >= 0),
+    method VARCHAR(20) NOT NULL,
+    term INT NOT NULL CHECK (term > 0),
+    frequency VARCHAR(20) NOT NULL,
+    allocationorder VARCHAR(100) NOT NULL,
+    loancoaid UUID NOT NULL REFERENCES chartofaccount(accountid),
+    interestincomeaccount INT NOT NULL,
+    penaltyincomeaccount INT NOT NULL,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS loan (
+    loanid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    productid UUID NOT NULL REFERENCES loanproduct(productid),
+    accountid UUID NOT NULL UNIQUE REFERENCES account(accountid),
+    customerid UUID REFERENCES customer(customerid),
+    principal INT NOT NULL CHECK (principal > 0),
+    ratebps INT NOT NULL,
+    method VARCHAR(20) NOT NULL,
+    term INT NOT NULL,
+    frequency VARCHAR(20) NOT NULL,
+    startdate DATE NOT NULL,
+    disbursementaccount INT NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    disbursementid UUID,
+    disbursedby VARCHAR(255),
+    disbursedat TIMESTAMPTZ,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS loaninstallment (
+    loanid UUID NOT NULL REFERENCES loan(loanid),
+    number INT NOT NULL,
+    duedate DATE NOT NULL,
+    principaldue INT NOT NULL,
+    interestdue INT NOT NULL,
+    penaltydue INT NOT NULL DEFAULT 0,
+    principalpaid INT NOT NULL DEFAULT 0,
+    interestpaid INT NOT NULL DEFAULT 0,
+    penaltypaid INT NOT NULL DEFAULT 0,
+    paidat TIMESTAMPTZ,
+    PRIMARY KEY (loanid, number)
+);
+
+CREATE TABLE IF NOT EXISTS loanrepayment (
+    repaymentid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    loanid UUID NOT NULL REFERENCES loan(loanid),
+    amount INT NOT NULL CHECK (amount > 0),
+    paymentaccount INT NOT NULL,
+    principal INT NOT NULL,
+    interest INT NOT NULL,
+    penalty INT NOT NULL,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS loanrepayment_loan_idx ON loanrepayment (loanid);
+`,
+	},
+	{
+		Version: 11,
+		Name:    "interest accrual",
+		SQL: `
+CREATE TABLE IF NOT EXISTS interestplan (
+    planid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    kind VARCHAR(20) NOT NULL,
+    daycount VARCHAR(20) NOT NULL,
+    accruedinterestaccount INT NOT NULL,
+    interestaccount INT NOT NULL,
+    settlement VARCHAR(20) NOT NULL,
+    settlementfrequency VARCHAR(20) NOT NULL,
+    payoutaccount INT,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS interestplantier (
+    planid UUID NOT NULL REFERENCES interestplan(planid),
+    minbalance INT NOT NULL CHECK (minbalance >= 0),
+    ratebps INT NOT NULL CHECK (ratebps >= 0),
+    PRIMARY KEY (planid, minbalance)
+);
+
+ALTER TABLE chartofaccount ADD COLUMN IF NOT EXISTS interestplanid UUID REFERENCES interestplan(planid);
+
+CREATE TABLE IF NOT EXISTS interestaccrual (
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    accrualdate DATE NOT NULL,
+    planid UUID NOT NULL REFERENCES interestplan(planid),
+    balance INT NOT NULL,
+    ratebps INT NOT NULL,
+    amount NUMERIC(20, 6) NOT NULL,
+    calculatedat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (accountid, accrualdate)
+);
+
+CREATE INDEX IF NOT EXISTS interestaccrual_plan_idx ON interestaccrual (planid, accrualdate);
+
+CREATE TABLE IF NOT EXISTS interestrun (
+    planid UUID NOT NULL REFERENCES interestplan(planid),
+    accrualdate DATE NOT NULL,
+    posted INT NOT NULL,
+    adjustment INT NOT NULL DEFAULT 0,
+    runat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (planid, accrualdate)
+);
+
+CREATE TABLE IF NOT EXISTS interestsettlement (
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    periodend DATE NOT NULL,
+    planid UUID NOT NULL REFERENCES interestplan(planid),
+    amount INT NOT NULL,
+    settledat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (accountid, periodend)
+);
+`,
+	},
+	{
+		Version: 12,
+		Name:    "fees and charges",
+		SQL: `
+ALTER TABLE journalentry ADD COLUMN IF NOT EXISTS transactiontype VARCHAR(50) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS charge (
+    chargeid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    trigger VARCHAR(20) NOT NULL,
+    transactiontype VARCHAR(50) NOT NULL DEFAULT '',
+    coaid UUID REFERENCES chartofaccount(accountid),
+    side VARCHAR(10) NOT NULL DEFAULT '',
+    method VARCHAR(20) NOT NULL,
+    amount INT NOT NULL DEFAULT 0,
+    ratebps INT NOT NULL DEFAULT 0,
+    minamount INT NOT NULL DEFAULT 0,
+    maxamount INT NOT NULL DEFAULT 0,
+    frequency VARCHAR(20) NOT NULL DEFAULT '',
+    incomeaccount INT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS chargetier (
+    chargeid UUID NOT NULL REFERENCES charge(chargeid),
+    minamount INT NOT NULL CHECK (minamount >= 0),
+    amount INT NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (chargeid, minamount)
+);
+
+CREATE TABLE IF NOT EXISTS chargewaiver (
+    waiverid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    chargeid UUID REFERENCES charge(chargeid),
+    reason TEXT NOT NULL,
+    expiresat TIMESTAMPTZ,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revokedby VARCHAR(255),
+    revokedat TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS chargewaiver_account_idx ON chargewaiver (accountid) WHERE revokedat IS NULL;
+
+CREATE TABLE IF NOT EXISTS chargeapplication (
+    applicationid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    chargeid UUID NOT NULL REFERENCES charge(chargeid),
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    sourceid UUID REFERENCES journalentry(transactionid),
+    periodend DATE,
+    amount INT NOT NULL,
+    transactionid UUID REFERENCES journalentry(transactionid),
+    waiverid UUID REFERENCES chargewaiver(waiverid),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS chargeapplication_account_idx ON chargeapplication (accountid, createdat);
+
+CREATE UNIQUE INDEX IF NOT EXISTS chargeapplication_period_idx ON chargeapplication (chargeid, accountid, periodend)
+    WHERE periodend IS NOT NULL;
+`,
+	},
+	{
+		Version: 13,
+		Name:    "recurring journal entries",
+		SQL: `
+CREATE TABLE IF NOT EXISTS recurringentry (
+    templateid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    debitaccount INT NOT NULL,
+    creditaccount INT NOT NULL,
+    amount INT NOT NULL CHECK (amount > 0),
+    description TEXT NOT NULL DEFAULT '',
+    transactiontype VARCHAR(50) NOT NULL DEFAULT '',
+    schedule VARCHAR(30) NOT NULL,
+    dayofmonth INT NOT NULL DEFAULT 0,
+    intervalmonths INT NOT NULL DEFAULT 1 CHECK (intervalmonths > 0),
+    startdate DATE NOT NULL,
+    enddate DATE,
+    nextrundate DATE,
+    status VARCHAR(20) NOT NULL DEFAULT 'active',
+    lasterror TEXT NOT NULL DEFAULT '',
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS recurringentry_due_idx ON recurringentry (nextrundate) WHERE status = 'active';
+
+CREATE TABLE IF NOT EXISTS recurringposting (
+    templateid UUID NOT NULL REFERENCES recurringentry(templateid),
+    occurrencedate DATE NOT NULL,
+    transactionid UUID NOT NULL REFERENCES journalentry(transactionid),
+    postedat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (templateid, occurrencedate)
+);
+`,
+	},
+	{
+		Version: 14,
+		Name:    "period closing and journal import",
+		SQL: `
+CREATE TABLE IF NOT EXISTS periodclose (
+    closeid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    closedthrough DATE NOT NULL,
+    closedby VARCHAR(255),
+    closedat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS importbatch (
+    batchid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    format VARCHAR(10) NOT NULL,
+    lines INT NOT NULL,
+    entries INT NOT NULL,
+    total BIGINT NOT NULL,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE journalentry ADD COLUMN IF NOT EXISTS batchid UUID REFERENCES importbatch(batchid);
+
+CREATE INDEX IF NOT EXISTS journalentry_batch_idx ON journalentry (batchid) WHERE batchid IS NOT NULL;
+`,
+	},
+	{
+		Version: 15,
+		Name:    "bank statements and reconciliation",
+		SQL: `
+CREATE TABLE IF NOT EXISTS bankstatement (
+    statementid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    format VARCHAR(10) NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    bankaccount VARCHAR(64) NOT NULL DEFAULT '',
+    currency VARCHAR(3) NOT NULL DEFAULT '',
+    openingbalance BIGINT NOT NULL,
+    closingbalance BIGINT NOT NULL,
+    fromdate DATE NOT NULL,
+    todate DATE NOT NULL,
+    filename VARCHAR(255) NOT NULL DEFAULT '',
+    importedby VARCHAR(255),
+    importedat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (accountid, reference, fromdate, todate)
+);
+
+CREATE TABLE IF NOT EXISTS bankstatementline (
+    lineid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    statementid UUID NOT NULL REFERENCES bankstatement(statementid),
+    accountid UUID NOT NULL REFERENCES account(accountid),
+    valuedate DATE NOT NULL,
+    bookingdate DATE NOT NULL,
+    amount BIGINT NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    bankreference VARCHAR(255) NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    transactionid UUID REFERENCES journalentry(transactionid),
+    matchmethod VARCHAR(10),
+    matchedby VARCHAR(255),
+    matchedat TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS bankstatementline_account_idx ON bankstatementline (accountid, valuedate);
+
+-- a line the bank has already sent is not imported twice
+CREATE UNIQUE INDEX IF NOT EXISTS bankstatementline_bankref_idx ON bankstatementline (accountid, bankreference)
+    WHERE bankreference <> '';
+
+-- a journal entry is matched to at most one statement line
+CREATE UNIQUE INDEX IF NOT EXISTS bankstatementline_transaction_idx ON bankstatementline (transactionid)
+    WHERE transactionid IS NOT NULL;
+`,
+	},
+	{
+		Version: 16,
+		Name:    "event outbox and webhooks",
+		SQL: `
+CREATE TABLE IF NOT EXISTS outboxevent (
+    eventid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    sequence BIGSERIAL NOT NULL UNIQUE,
+    eventtype VARCHAR(64) NOT NULL,
+    aggregateid VARCHAR(64) NOT NULL,
+    payload TEXT NOT NULL,
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    fannedoutat TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outboxevent_pending_idx ON outboxevent (sequence) WHERE fannedoutat IS NULL;
+
+CREATE TABLE IF NOT EXISTS webhooksubscription (
+    subscriptionid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    url TEXT NOT NULL,
+    events TEXT NOT NULL,
+    secret VARCHAR(128) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    createdby VARCHAR(255),
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updatedat TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhookdelivery (
+    deliveryid UUID DEFAULT uuid_generate_v4() PRIMARY KEY,
+    subscriptionid UUID NOT NULL REFERENCES webhooksubscription(subscriptionid) ON DELETE CASCADE,
+    eventid UUID NOT NULL REFERENCES outboxevent(eventid),
+    status VARCHAR(10) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    nextattemptat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    lastattemptat TIMESTAMPTZ,
+    laststatus INT,
+    lasterror TEXT NOT NULL DEFAULT '',
+    deliveredat TIMESTAMPTZ,
+    createdat TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (subscriptionid, eventid)
+);
+
+CREATE INDEX IF NOT EXISTS webhookdelivery_due_idx ON webhookdelivery (nextattemptat) WHERE status = 'pending';
+`,
+	},
+	{
+		Version: 17,
+		Name:    "recurring entry approval",
+		SQL: `
+ALTER TABLE recurringentry
+    ADD COLUMN IF NOT EXISTS requiresapproval BOOLEAN NOT NULL DEFAULT FALSE;
+`,
+	},
+	{
+		Version: 18,
+		Name:    "loan repayment approval",
+		SQL: `
+ALTER TABLE loanrepayment
+    ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'posted',
+    ADD COLUMN IF NOT EXISTS transactionid UUID REFERENCES journalentry(transactionid);
+
+CREATE INDEX IF NOT EXISTS loanrepayment_transaction_idx ON loanrepayment (transactionid);
+`,
+	},
+	{
+		Version: 19,
+		Name:    "recurring entry posting roles",
+		SQL: `
+ALTER TABLE recurringentry
+    ADD COLUMN IF NOT EXISTS postingroles TEXT NOT NULL DEFAULT '',
+    DROP COLUMN IF EXISTS requiresapproval;
+`,
+	},
+}
+
+func latestMigrationVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// RunMigrations applies every migration that has not been recorded yet.
+func RunMigrations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return fmt.Errorf("failed to create schemamigrations table: %v", err)
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+
+		applied, err := appliedMigrations(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if applied[m.Version] {
+				continue
+			}
+			if err := tx.Exec(m.SQL).Error; err != nil {
+				return fmt.Errorf("migration %d (%s) failed: %v", m.Version, m.Name, err)
+			}
+			record := SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+			if err := tx.Create(&record).Error; err != nil {
+				return fmt.Errorf("failed to record migration %d: %v", m.Version, err)
+			}
+		}
+		return nil
+	})
+}
+
+// PendingMigrations returns the migrations not yet applied to db.
+func PendingMigrations(db *gorm.DB) ([]Migration, error) {
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, m := range migrations {
+		if !applied[m.Version] {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+func appliedMigrations(db *gorm.DB) (map[int]bool, error) {
+	var records []SchemaMigration
+	if err := db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to read schemamigrations: %v", err)
+	}
+
+	applied := make(map[int]bool, len(records))
+	for _, r := range records {
+		applied[r.Version] = true
+	}
+	return applied, nil
+}
@@ -12,6 +12,8 @@ type AccountType struct {
 	Description string    `json:"description" gorm:"column:description"`
 	StartRange  int       `json:"start_range" gorm:"column:startrange"`
 	EndRange    int       `json:"end_range" gorm:"column:endrange"`
+	CreatedBy   string    `json:"created_by" gorm:"column:createdby"`
+	CreatedAt   time.Time `json:"created_at" gorm:"column:createdat"`
 }
 
 func (AccountType) TableName() string {
@@ -19,10 +21,17 @@ func (AccountType) TableName() string {
 }
 
 type ChartOfAccount struct {
-	AccountID     uuid.UUID `json:"accountid" gorm:"column:accountid;default:uuid_generate_v4()"`
-	AccountTypeID uuid.UUID `json:"accounttypeid" gorm:"column:accounttypeid"`
-	AccountNumber int       `json:"accountnumber" gorm:"column:accountnumber"`
-	Name          string    `json:"name" gorm:"column:name"`
+	AccountID      uuid.UUID  `json:"accountid" gorm:"column:accountid;default:uuid_generate_v4()"`
+	AccountTypeID  uuid.UUID  `json:"accounttypeid" gorm:"column:accounttypeid"`
+	AccountNumber  int        `json:"accountnumber" gorm:"column:accountnumber"`
+	Name           string     `json:"name" gorm:"column:name"`
+	BalanceRule    string     `json:"balance_rule" gorm:"column:balancerule"`
+	OverdraftLimit int        `json:"overdraft_limit" gorm:"column:overdraftlimit"`
+	IsControl      bool       `json:"is_control" gorm:"column:iscontrol"`
+	ControlBalance int        `json:"control_balance" gorm:"column:controlbalance"`
+	InterestPlanID *uuid.UUID `json:"interest_plan_id" gorm:"column:interestplanid"`
+	CreatedBy      string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:createdat"`
 }
 
 func (ChartOfAccount) TableName() string {
@@ -30,11 +39,21 @@ func (ChartOfAccount) TableName() string {
 }
 
 type Account struct {
-	AccountID     uuid.UUID      `json:"accountid" gorm:"column:accountid;default:uuid_generate_v4()"`
-	Name          string         `json:"name" gorm:"column:name"`
-	COAID         uuid.UUID      `json:"coa_id" gorm:"column:coaid"`
-	COA           ChartOfAccount `gorm:"foreignKey:COAID;references:AccountID"`
-	AccountNumber int            `json:"account_number" gorm:"column:accountnumber"`
+	AccountID           uuid.UUID      `json:"accountid" gorm:"column:accountid;default:uuid_generate_v4()"`
+	Name                string         `json:"name" gorm:"column:name"`
+	COAID               uuid.UUID      `json:"coa_id" gorm:"column:coaid"`
+	COA                 ChartOfAccount `gorm:"foreignKey:COAID;references:AccountID"`
+	AccountNumber       int            `json:"account_number" gorm:"column:accountnumber"`
+	BalanceRule         string         `json:"balance_rule" gorm:"column:balancerule"`
+	OverdraftLimit      int            `json:"overdraft_limit" gorm:"column:overdraftlimit"`
+	Status              string         `json:"status" gorm:"column:status;default:active"`
+	StatusReason        string         `json:"status_reason" gorm:"column:statusreason"`
+	StatusChangedAt     *time.Time     `json:"status_changed_at" gorm:"column:statuschangedat"`
+	LastActivityAt      *time.Time     `json:"last_activity_at" gorm:"column:lastactivityat"`
+	Mandate             string         `json:"mandate" gorm:"column:mandate;default:any"`
+	RequiredSignatories int            `json:"required_signatories" gorm:"column:requiredsignatories;default:1"`
+	CreatedBy           string         `json:"created_by" gorm:"column:createdby"`
+	CreatedAt           time.Time      `json:"created_at" gorm:"column:createdat"`
 }
 
 func (Account) TableName() string {
@@ -51,17 +70,590 @@ func (AccountBalance) TableName() string {
 	return "accountbalance"
 }
 
+const (
+	HoldTypePendingWithdrawal = "pending_withdrawal"
+	HoldTypeLien              = "lien"
+	HoldTypeUnclearedCheque   = "uncleared_cheque"
+
+	HoldStatusActive   = "active"
+	HoldStatusReleased = "released"
+	HoldStatusExpired  = "expired"
+)
+
+// AccountHold reserves part of an account's balance without posting to the
+// journal. Active holds reduce the available balance until they are released
+// or reach ExpiresAt.
+type AccountHold struct {
+	HoldID     uuid.UUID  `json:"holdid" gorm:"column:holdid;default:uuid_generate_v4();primarykey"`
+	AccountID  uuid.UUID  `json:"accountid" gorm:"column:accountid"`
+	Amount     int        `json:"amount" gorm:"column:amount"`
+	HoldType   string     `json:"hold_type" gorm:"column:holdtype"`
+	Reason     string     `json:"reason" gorm:"column:reason"`
+	Status     string     `json:"status" gorm:"column:status"`
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"column:expiresat"`
+	CreatedBy  string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"column:createdat"`
+	ReleasedBy string     `json:"released_by" gorm:"column:releasedby"`
+	ReleasedAt *time.Time `json:"released_at" gorm:"column:releasedat"`
+}
+
+func (AccountHold) TableName() string {
+	return "accounthold"
+}
+
+const (
+	CustomerTypeIndividual   = "individual"
+	CustomerTypeOrganization = "organization"
+
+	KYCStatusPending  = "pending"
+	KYCStatusVerified = "verified"
+	KYCStatusRejected = "rejected"
+
+	OwnerRolePrimary   = "primary"
+	OwnerRoleJoint     = "joint"
+	OwnerRoleSignatory = "signatory"
+)
+
+type Customer struct {
+	CustomerID    uuid.UUID  `json:"customerid" gorm:"column:customerid;default:uuid_generate_v4();primarykey"`
+	CustomerType  string     `json:"customer_type" gorm:"column:customertype"`
+	Name          string     `json:"name" gorm:"column:name"`
+	IDType        string     `json:"id_type" gorm:"column:idtype"`
+	IDNumber      string     `json:"id_number" gorm:"column:idnumber"`
+	Email         string     `json:"email" gorm:"column:email"`
+	Phone         string     `json:"phone" gorm:"column:phone"`
+	Address       string     `json:"address" gorm:"column:address"`
+	KYCStatus     string     `json:"kyc_status" gorm:"column:kycstatus;default:pending"`
+	KYCReviewedBy string     `json:"kyc_reviewed_by" gorm:"column:kycreviewedby"`
+	KYCReviewedAt *time.Time `json:"kyc_reviewed_at" gorm:"column:kycreviewedat"`
+	CreatedBy     string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"column:createdat"`
+}
+
+func (Customer) TableName() string {
+	return "customer"
+}
+
+// AccountOwner links a customer to an account. Owners with CanSign count
+// towards the account's signatory mandate.
+type AccountOwner struct {
+	AccountID  uuid.UUID `json:"accountid" gorm:"column:accountid;primarykey"`
+	CustomerID uuid.UUID `json:"customerid" gorm:"column:customerid;primarykey"`
+	Role       string    `json:"role" gorm:"column:role"`
+	CanSign    bool      `json:"can_sign" gorm:"column:cansign"`
+	CreatedBy  string    `json:"created_by" gorm:"column:createdby"`
+	CreatedAt  time.Time `json:"created_at" gorm:"column:createdat"`
+}
+
+func (AccountOwner) TableName() string {
+	return "accountowner"
+}
+
 type JournalEntry struct {
-	TransactionID       uuid.UUID `json:"transactionid" gorm:"column:transactionid;default:uuid_generate_v4()"`
-	AccountDebitNumber  int       `json:"accounttodebitid" gorm:"column:accountdebitnumber"`
-	AccountCreditNumber int       `json:"accounttocreditid" gorm:"column:accountcreditnumber"`
-	AccountDebit        Account   `json:"accounttodebit" gorm:"column:accountdebitnumber;references:AccountNumber;foreignKey:AccountDebitNumber"`
-	AccountCredit       Account   `json:"accounttocredit" gorm:"column:accountcreditnumber;references:AccountNumber;foreignKey:AccountCreditNumber"`
-	Date                time.Time `json:"date" gorm:"column:date"`
-	Amount              int       `json:"amount" gorm:"column:amount"`
-	Description         string    `json:"description" gorm:"column:description"`
+	TransactionID       uuid.UUID  `json:"transactionid" gorm:"column:transactionid;default:uuid_generate_v4();primarykey"`
+	AccountDebitNumber  int        `json:"accounttodebitid" gorm:"column:accountdebitnumber"`
+	AccountCreditNumber int        `json:"accounttocreditid" gorm:"column:accountcreditnumber"`
+	AccountDebit        Account    `json:"accounttodebit" gorm:"column:accountdebitnumber;references:AccountNumber;foreignKey:AccountDebitNumber"`
+	AccountCredit       Account    `json:"accounttocredit" gorm:"column:accountcreditnumber;references:AccountNumber;foreignKey:AccountCreditNumber"`
+	Date                time.Time  `json:"date" gorm:"column:date"`
+	Amount              int        `json:"amount" gorm:"column:amount"`
+	Description         string     `json:"description" gorm:"column:description"`
+	Status              string     `json:"status" gorm:"column:status;default:posted"`
+	CreatedBy           string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"column:createdat"`
+	ReviewedBy          string     `json:"reviewed_by" gorm:"column:reviewedby"`
+	ReviewedAt          *time.Time `json:"reviewed_at" gorm:"column:reviewedat"`
+	RejectionReason     string     `json:"rejection_reason" gorm:"column:rejectionreason"`
+	ReversalOf          *uuid.UUID `json:"reversal_of" gorm:"column:reversalof"`
+	TransactionType     string     `json:"transaction_type" gorm:"column:transactiontype"`
+	BatchID             *uuid.UUID `json:"batch_id" gorm:"column:batchid"`
 }
 
 func (JournalEntry) TableName() string {
 	return "journalentry"
 }
+
+const (
+	JournalStatusPending  = "pending"
+	JournalStatusPosted   = "posted"
+	JournalStatusRejected = "rejected"
+)
+
+// ApprovalRule sends journal entries above Threshold to the approval queue.
+// AccountTypeID limits the rule to entries touching an account of that type
+// and Role to entries made by a user with that role; unset criteria match
+// every entry.
+type ApprovalRule struct {
+	RuleID        uuid.UUID  `json:"ruleid" gorm:"column:ruleid;default:uuid_generate_v4();primarykey"`
+	AccountTypeID *uuid.UUID `json:"accounttypeid" gorm:"column:accounttypeid"`
+	Role          string     `json:"role" gorm:"column:role"`
+	Threshold     int        `json:"threshold" gorm:"column:threshold"`
+}
+
+func (ApprovalRule) TableName() string {
+	return "approvalrule"
+}
+
+const (
+	LoanMethodFlat     = "flat"
+	LoanMethodReducing = "reducing"
+
+	LoanFrequencyWeekly      = "weekly"
+	LoanFrequencyFortnightly = "fortnightly"
+	LoanFrequencyMonthly     = "monthly"
+
+	LoanStatusPending = "pending"
+	LoanStatusActive  = "active"
+	LoanStatusClosed  = "closed"
+
+	LoanRepaymentStatusPending  = "pending"
+	LoanRepaymentStatusPosted   = "posted"
+	LoanRepaymentStatusRejected = "rejected"
+)
+
+// LoanProduct holds the terms new loans are issued on. RateBps is the annual
+// rate in basis points; AllocationOrder is a comma separated order of
+// penalty, interest and principal for repayments.
+type LoanProduct struct {
+	ProductID             uuid.UUID `json:"productid" gorm:"column:productid;default:uuid_generate_v4();primarykey"`
+	Name                  string    `json:"name" gorm:"column:name"`
+	RateBps               int       `json:"rate_bps" gorm:"column:ratebps"`
+	Method                string    `json:"method" gorm:"column:method"`
+	Term                  int       `json:"term" gorm:"column:term"`
+	Frequency             string    `json:"frequency" gorm:"column:frequency"`
+	AllocationOrder       string    `json:"allocation_order" gorm:"column:allocationorder"`
+	LoanCOAID             uuid.UUID `json:"loan_coa_id" gorm:"column:loancoaid"`
+	InterestIncomeAccount int       `json:"interest_income_account" gorm:"column:interestincomeaccount"`
+	PenaltyIncomeAccount  int       `json:"penalty_income_account" gorm:"column:penaltyincomeaccount"`
+	CreatedBy             string    `json:"created_by" gorm:"column:createdby"`
+	CreatedAt             time.Time `json:"created_at" gorm:"column:createdat"`
+}
+
+func (LoanProduct) TableName() string {
+	return "loanproduct"
+}
+
+// Loan copies its product's terms so later product changes do not alter
+// loans already issued. AccountID is the loan's receivable account.
+type Loan struct {
+	LoanID              uuid.UUID  `json:"loanid" gorm:"column:loanid;default:uuid_generate_v4();primarykey"`
+	ProductID           uuid.UUID  `json:"productid" gorm:"column:productid"`
+	AccountID           uuid.UUID  `json:"accountid" gorm:"column:accountid"`
+	CustomerID          *uuid.UUID `json:"customerid" gorm:"column:customerid"`
+	Principal           int        `json:"principal" gorm:"column:principal"`
+	RateBps             int        `json:"rate_bps" gorm:"column:ratebps"`
+	Method              string     `json:"method" gorm:"column:method"`
+	Term                int        `json:"term" gorm:"column:term"`
+	Frequency           string     `json:"frequency" gorm:"column:frequency"`
+	StartDate           time.Time  `json:"start_date" gorm:"column:startdate"`
+	DisbursementAccount int        `json:"disbursement_account" gorm:"column:disbursementaccount"`
+	Status              string     `json:"status" gorm:"column:status;default:pending"`
+	DisbursementID      *uuid.UUID `json:"disbursement_id" gorm:"column:disbursementid"`
+	DisbursedBy         string     `json:"disbursed_by" gorm:"column:disbursedby"`
+	DisbursedAt         *time.Time `json:"disbursed_at" gorm:"column:disbursedat"`
+	CreatedBy           string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"column:createdat"`
+}
+
+func (Loan) TableName() string {
+	return "loan"
+}
+
+type LoanInstallment struct {
+	LoanID        uuid.UUID  `json:"-" gorm:"column:loanid;primarykey"`
+	Number        int        `json:"number" gorm:"column:number;primarykey"`
+	DueDate       time.Time  `json:"due_date" gorm:"column:duedate"`
+	PrincipalDue  int        `json:"principal_due" gorm:"column:principaldue"`
+	InterestDue   int        `json:"interest_due" gorm:"column:interestdue"`
+	PenaltyDue    int        `json:"penalty_due" gorm:"column:penaltydue"`
+	PrincipalPaid int        `json:"principal_paid" gorm:"column:principalpaid"`
+	InterestPaid  int        `json:"interest_paid" gorm:"column:interestpaid"`
+	PenaltyPaid   int        `json:"penalty_paid" gorm:"column:penaltypaid"`
+	PaidAt        *time.Time `json:"paid_at" gorm:"column:paidat"`
+}
+
+func (LoanInstallment) TableName() string {
+	return "loaninstallment"
+}
+
+type LoanRepayment struct {
+	RepaymentID    uuid.UUID  `json:"repaymentid" gorm:"column:repaymentid;default:uuid_generate_v4();primarykey"`
+	LoanID         uuid.UUID  `json:"loanid" gorm:"column:loanid"`
+	Amount         int        `json:"amount" gorm:"column:amount"`
+	PaymentAccount int        `json:"payment_account" gorm:"column:paymentaccount"`
+	Principal      int        `json:"principal" gorm:"column:principal"`
+	Interest       int        `json:"interest" gorm:"column:interest"`
+	Penalty        int        `json:"penalty" gorm:"column:penalty"`
+	Status         string     `json:"status" gorm:"column:status"`
+	TransactionID  *uuid.UUID `json:"transactionid" gorm:"column:transactionid"`
+	CreatedBy      string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:createdat"`
+}
+
+func (LoanRepayment) TableName() string {
+	return "loanrepayment"
+}
+
+const (
+	InterestKindDeposit = "deposit"
+	InterestKindLoan    = "loan"
+
+	DayCount30360        = "30/360"
+	DayCountActual365    = "actual/365"
+	DayCountActualActual = "actual/actual"
+
+	InterestSettlementCapitalize = "capitalize"
+	InterestSettlementPayout     = "payout"
+
+	SettlementMonthly   = "monthly"
+	SettlementQuarterly = "quarterly"
+	SettlementAnnually  = "annually"
+)
+
+// InterestPlan is the interest product attached to a chart of account.
+// Deposit plans accrue on credit balances into a payable account; loan plans
+// accrue on debit balances into a receivable account. Accruals are settled
+// at the end of every SettlementFrequency period.
+type InterestPlan struct {
+	PlanID                 uuid.UUID      `json:"planid" gorm:"column:planid;default:uuid_generate_v4();primarykey"`
+	Name                   string         `json:"name" gorm:"column:name"`
+	Kind                   string         `json:"kind" gorm:"column:kind"`
+	DayCount               string         `json:"day_count" gorm:"column:daycount"`
+	AccruedInterestAccount int            `json:"accrued_interest_account" gorm:"column:accruedinterestaccount"`
+	InterestAccount        int            `json:"interest_account" gorm:"column:interestaccount"`
+	Settlement             string         `json:"settlement" gorm:"column:settlement"`
+	SettlementFrequency    string         `json:"settlement_frequency" gorm:"column:settlementfrequency"`
+	PayoutAccount          *int           `json:"payout_account" gorm:"column:payoutaccount"`
+	Tiers                  []InterestTier `json:"tiers" gorm:"foreignKey:PlanID;references:PlanID"`
+	CreatedBy              string         `json:"created_by" gorm:"column:createdby"`
+	CreatedAt              time.Time      `json:"created_at" gorm:"column:createdat"`
+}
+
+func (InterestPlan) TableName() string {
+	return "interestplan"
+}
+
+// InterestTier applies RateBps, an annual rate in basis points, to balances
+// of at least MinBalance.
+type InterestTier struct {
+	PlanID     uuid.UUID `json:"-" gorm:"column:planid;primarykey"`
+	MinBalance int       `json:"min_balance" gorm:"column:minbalance;primarykey;autoIncrement:false"`
+	RateBps    int       `json:"rate_bps" gorm:"column:ratebps"`
+}
+
+func (InterestTier) TableName() string {
+	return "interestplantier"
+}
+
+// InterestAccrual is one account's interest for one day, kept unrounded so
+// settlement rounds once per period.
+type InterestAccrual struct {
+	AccountID    uuid.UUID `json:"accountid" gorm:"column:accountid;primarykey"`
+	AccrualDate  time.Time `json:"accrual_date" gorm:"column:accrualdate;primarykey"`
+	PlanID       uuid.UUID `json:"planid" gorm:"column:planid"`
+	Balance      int       `json:"balance" gorm:"column:balance"`
+	RateBps      int       `json:"rate_bps" gorm:"column:ratebps"`
+	Amount       float64   `json:"amount" gorm:"column:amount"`
+	CalculatedAt time.Time `json:"calculated_at" gorm:"column:calculatedat"`
+}
+
+func (InterestAccrual) TableName() string {
+	return "interestaccrual"
+}
+
+// InterestRun records what has been posted to the ledger for a plan and
+// day, so a rerun only posts the difference. Adjustment is the rounding
+// correction posted when the period is settled.
+type InterestRun struct {
+	PlanID      uuid.UUID `json:"planid" gorm:"column:planid;primarykey"`
+	AccrualDate time.Time `json:"accrual_date" gorm:"column:accrualdate;primarykey"`
+	Posted      int       `json:"posted" gorm:"column:posted"`
+	Adjustment  int       `json:"adjustment" gorm:"column:adjustment"`
+	RunAt       time.Time `json:"run_at" gorm:"column:runat"`
+}
+
+func (InterestRun) TableName() string {
+	return "interestrun"
+}
+
+type InterestSettlement struct {
+	AccountID uuid.UUID `json:"accountid" gorm:"column:accountid;primarykey"`
+	PeriodEnd time.Time `json:"period_end" gorm:"column:periodend;primarykey"`
+	PlanID    uuid.UUID `json:"planid" gorm:"column:planid"`
+	Amount    int       `json:"amount" gorm:"column:amount"`
+	SettledAt time.Time `json:"settled_at" gorm:"column:settledat"`
+}
+
+func (InterestSettlement) TableName() string {
+	return "interestsettlement"
+}
+
+const (
+	ChargeTriggerPosting     = "posting"
+	ChargeTriggerMaintenance = "maintenance"
+
+	ChargeMethodFlat       = "flat"
+	ChargeMethodPercentage = "percentage"
+	ChargeMethodTiered     = "tiered"
+
+	// TransactionTypeFee marks the fee entries takeCharge posts. It is
+	// reserved: entries submitted, imported or scheduled with it are refused.
+	TransactionTypeFee = "fee"
+)
+
+// Charge defines a fee. Posting charges add a fee line when a journal entry
+// matches TransactionType and, if set, the chart of account of the account
+// on Side; that account pays the fee. Maintenance charges are taken from
+// every account under COAID once per Frequency period.
+type Charge struct {
+	ChargeID        uuid.UUID    `json:"chargeid" gorm:"column:chargeid;default:uuid_generate_v4();primarykey"`
+	Name            string       `json:"name" gorm:"column:name"`
+	Trigger         string       `json:"trigger" gorm:"column:trigger"`
+	TransactionType string       `json:"transaction_type" gorm:"column:transactiontype"`
+	COAID           *uuid.UUID   `json:"coa_id" gorm:"column:coaid"`
+	Side            string       `json:"side" gorm:"column:side"`
+	Method          string       `json:"method" gorm:"column:method"`
+	Amount          int          `json:"amount" gorm:"column:amount"`
+	RateBps         int          `json:"rate_bps" gorm:"column:ratebps"`
+	MinAmount       int          `json:"min_amount" gorm:"column:minamount"`
+	MaxAmount       int          `json:"max_amount" gorm:"column:maxamount"`
+	Tiers           []ChargeTier `json:"tiers" gorm:"foreignKey:ChargeID;references:ChargeID"`
+	Frequency       string       `json:"frequency" gorm:"column:frequency"`
+	IncomeAccount   int          `json:"income_account" gorm:"column:incomeaccount"`
+	Active          bool         `json:"active" gorm:"column:active;default:true"`
+	CreatedBy       string       `json:"created_by" gorm:"column:createdby"`
+	CreatedAt       time.Time    `json:"created_at" gorm:"column:createdat"`
+}
+
+func (Charge) TableName() string {
+	return "charge"
+}
+
+// ChargeTier charges Amount on transactions, or balances for maintenance
+// charges, of at least MinAmount.
+type ChargeTier struct {
+	ChargeID  uuid.UUID `json:"-" gorm:"column:chargeid;primarykey"`
+	MinAmount int       `json:"min_amount" gorm:"column:minamount;primarykey;autoIncrement:false"`
+	Amount    int       `json:"amount" gorm:"column:amount"`
+}
+
+func (ChargeTier) TableName() string {
+	return "chargetier"
+}
+
+// ChargeWaiver exempts an account from one charge, or from every charge
+// when ChargeID is nil, until it expires or is revoked.
+type ChargeWaiver struct {
+	WaiverID  uuid.UUID  `json:"waiverid" gorm:"column:waiverid;default:uuid_generate_v4();primarykey"`
+	AccountID uuid.UUID  `json:"accountid" gorm:"column:accountid"`
+	ChargeID  *uuid.UUID `json:"chargeid" gorm:"column:chargeid"`
+	Reason    string     `json:"reason" gorm:"column:reason"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"column:expiresat"`
+	CreatedBy string     `json:"created_by" gorm:"column:createdby"`
+	CreatedAt time.Time  `json:"created_at" gorm:"column:createdat"`
+	RevokedBy string     `json:"revoked_by" gorm:"column:revokedby"`
+	RevokedAt *time.Time `json:"revoked_at" gorm:"column:revokedat"`
+}
+
+func (ChargeWaiver) TableName() string {
+	return "chargewaiver"
+}
+
+// ChargeApplication records a fee taken, or waived, from an account.
+// SourceID is the journal entry that triggered a posting charge; PeriodEnd
+// is the period a maintenance charge covers.
+type ChargeApplication struct {
+	ApplicationID uuid.UUID  `json:"applicationid" gorm:"column:applicationid;default:uuid_generate_v4();primarykey"`
+	ChargeID      uuid.UUID  `json:"chargeid" gorm:"column:chargeid"`
+	AccountID     uuid.UUID  `json:"accountid" gorm:"column:accountid"`
+	SourceID      *uuid.UUID `json:"sourceid" gorm:"column:sourceid"`
+	PeriodEnd     *time.Time `json:"period_end" gorm:"column:periodend"`
+	Amount        int        `json:"amount" gorm:"column:amount"`
+	TransactionID *uuid.UUID `json:"transactionid" gorm:"column:transactionid"`
+	WaiverID      *uuid.UUID `json:"waiverid" gorm:"column:waiverid"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"column:createdat"`
+}
+
+func (ChargeApplication) TableName() string {
+	return "chargeapplication"
+}
+
+const (
+	ScheduleDayOfMonth      = "day_of_month"
+	ScheduleLastBusinessDay = "last_business_day"
+
+	RecurringStatusActive    = "active"
+	RecurringStatusPaused    = "paused"
+	RecurringStatusCompleted = "completed"
+)
+
+// RecurringEntry is a journal entry template posted every IntervalMonths
+// months, on DayOfMonth or on the last business day of the month, from
+// StartDate until EndDate. NextRunDate is the next occurrence not yet posted.
+type RecurringEntry struct {
+	TemplateID      uuid.UUID  `json:"templateid" gorm:"column:templateid;default:uuid_generate_v4();primarykey"`
+	Name            string     `json:"name" gorm:"column:name"`
+	DebitAccount    int        `json:"debit_account" gorm:"column:debitaccount"`
+	CreditAccount   int        `json:"credit_account" gorm:"column:creditaccount"`
+	Amount          int        `json:"amount" gorm:"column:amount"`
+	Description     string     `json:"description" gorm:"column:description"`
+	TransactionType string     `json:"transaction_type" gorm:"column:transactiontype"`
+	Schedule        string     `json:"schedule" gorm:"column:schedule"`
+	DayOfMonth      int        `json:"day_of_month" gorm:"column:dayofmonth"`
+	IntervalMonths  int        `json:"interval_months" gorm:"column:intervalmonths"`
+	StartDate       time.Time  `json:"start_date" gorm:"column:startdate"`
+	EndDate         *time.Time `json:"end_date" gorm:"column:enddate"`
+	NextRunDate     *time.Time `json:"next_run_date" gorm:"column:nextrundate"`
+	Status          string     `json:"status" gorm:"column:status;default:active"`
+	// PostingRoles are the roles, comma separated, of the user who created
+	// or last resumed the template; each occurrence is checked against the
+	// approval rules with them
+	PostingRoles string    `json:"posting_roles" gorm:"column:postingroles"`
+	LastError    string    `json:"last_error" gorm:"column:lasterror"`
+	CreatedBy    string    `json:"created_by" gorm:"column:createdby"`
+	CreatedAt    time.Time `json:"created_at" gorm:"column:createdat"`
+}
+
+func (RecurringEntry) TableName() string {
+	return "recurringentry"
+}
+
+// RecurringPosting records the journal entry posted for one occurrence; its
+// primary key is what stops an occurrence being posted twice.
+type RecurringPosting struct {
+	TemplateID     uuid.UUID `json:"templateid" gorm:"column:templateid;primarykey"`
+	OccurrenceDate time.Time `json:"occurrence_date" gorm:"column:occurrencedate;primarykey"`
+	TransactionID  uuid.UUID `json:"transactionid" gorm:"column:transactionid"`
+	PostedAt       time.Time `json:"posted_at" gorm:"column:postedat"`
+}
+
+func (RecurringPosting) TableName() string {
+	return "recurringposting"
+}
+
+// PeriodClose moves the date through which the books are closed. The latest
+// row is in force; no entry dated on or before it can be posted.
+type PeriodClose struct {
+	CloseID       uuid.UUID `json:"closeid" gorm:"column:closeid;default:uuid_generate_v4();primarykey"`
+	ClosedThrough time.Time `json:"closed_through" gorm:"column:closedthrough"`
+	ClosedBy      string    `json:"closed_by" gorm:"column:closedby"`
+	ClosedAt      time.Time `json:"closed_at" gorm:"column:closedat"`
+}
+
+func (PeriodClose) TableName() string {
+	return "periodclose"
+}
+
+// ImportBatch is one uploaded file of journal lines. Every entry posted from
+// it carries its BatchID.
+type ImportBatch struct {
+	BatchID   uuid.UUID `json:"batchid" gorm:"column:batchid;default:uuid_generate_v4();primarykey"`
+	FileName  string    `json:"filename" gorm:"column:filename"`
+	Format    string    `json:"format" gorm:"column:format"`
+	Lines     int       `json:"lines" gorm:"column:lines"`
+	Entries   int       `json:"entries" gorm:"column:entries"`
+	Total     int       `json:"total" gorm:"column:total"`
+	CreatedBy string    `json:"created_by" gorm:"column:createdby"`
+	CreatedAt time.Time `json:"created_at" gorm:"column:createdat"`
+}
+
+func (ImportBatch) TableName() string {
+	return "importbatch"
+}
+
+// BankStatement is one statement imported for a ledger account that
+// mirrors a bank account. Balances are in minor units, positive when the
+// bank holds money for us.
+type BankStatement struct {
+	StatementID    uuid.UUID           `json:"statementid" gorm:"column:statementid;default:uuid_generate_v4();primarykey"`
+	AccountID      uuid.UUID           `json:"accountid" gorm:"column:accountid"`
+	Format         string              `json:"format" gorm:"column:format"`
+	Reference      string              `json:"reference" gorm:"column:reference"`
+	BankAccount    string              `json:"bank_account" gorm:"column:bankaccount"`
+	Currency       string              `json:"currency" gorm:"column:currency"`
+	OpeningBalance int                 `json:"opening_balance" gorm:"column:openingbalance"`
+	ClosingBalance int                 `json:"closing_balance" gorm:"column:closingbalance"`
+	FromDate       time.Time           `json:"from_date" gorm:"column:fromdate"`
+	ToDate         time.Time           `json:"to_date" gorm:"column:todate"`
+	FileName       string              `json:"filename" gorm:"column:filename"`
+	ImportedBy     string              `json:"imported_by" gorm:"column:importedby"`
+	ImportedAt     time.Time           `json:"imported_at" gorm:"column:importedat"`
+	Lines          []BankStatementLine `json:"lines,omitempty" gorm:"foreignKey:StatementID;references:StatementID"`
+}
+
+func (BankStatement) TableName() string {
+	return "bankstatement"
+}
+
+// BankStatementLine is one movement on a statement. TransactionID is the
+// journal entry it has been matched to.
+type BankStatementLine struct {
+	LineID        uuid.UUID  `json:"lineid" gorm:"column:lineid;default:uuid_generate_v4();primarykey"`
+	StatementID   uuid.UUID  `json:"statementid" gorm:"column:statementid"`
+	AccountID     uuid.UUID  `json:"accountid" gorm:"column:accountid"`
+	ValueDate     time.Time  `json:"value_date" gorm:"column:valuedate"`
+	BookingDate   time.Time  `json:"booking_date" gorm:"column:bookingdate"`
+	Amount        int        `json:"amount" gorm:"column:amount"`
+	Reference     string     `json:"reference" gorm:"column:reference"`
+	BankReference string     `json:"bank_reference" gorm:"column:bankreference"`
+	Description   string     `json:"description" gorm:"column:description"`
+	TransactionID *uuid.UUID `json:"transactionid" gorm:"column:transactionid"`
+	MatchMethod   *string    `json:"match_method" gorm:"column:matchmethod"`
+	MatchedBy     *string    `json:"matched_by" gorm:"column:matchedby"`
+	MatchedAt     *time.Time `json:"matched_at" gorm:"column:matchedat"`
+}
+
+func (BankStatementLine) TableName() string {
+	return "bankstatementline"
+}
+
+// OutboxEvent is a domain event written in the same transaction as the
+// change it describes. Payload holds the JSON of the event data.
+type OutboxEvent struct {
+	EventID     uuid.UUID  `gorm:"column:eventid;default:uuid_generate_v4();primarykey"`
+	Sequence    int64      `gorm:"column:sequence;->"`
+	EventType   string     `gorm:"column:eventtype"`
+	AggregateID string     `gorm:"column:aggregateid"`
+	Payload     string     `gorm:"column:payload"`
+	CreatedAt   time.Time  `gorm:"column:createdat"`
+	FannedOutAt *time.Time `gorm:"column:fannedoutat"`
+}
+
+func (OutboxEvent) TableName() string {
+	return "outboxevent"
+}
+
+// WebhookSubscription is an endpoint that receives the listed event types,
+// stored comma separated; "*" subscribes to every event.
+type WebhookSubscription struct {
+	SubscriptionID uuid.UUID `gorm:"column:subscriptionid;default:uuid_generate_v4();primarykey"`
+	URL            string    `gorm:"column:url"`
+	Events         string    `gorm:"column:events"`
+	Secret         string    `gorm:"column:secret"`
+	Active         bool      `gorm:"column:active"`
+	CreatedBy      string    `gorm:"column:createdby"`
+	CreatedAt      time.Time `gorm:"column:createdat"`
+	UpdatedAt      time.Time `gorm:"column:updatedat"`
+}
+
+func (WebhookSubscription) TableName() string {
+	return "webhooksubscription"
+}
+
+type WebhookDelivery struct {
+	DeliveryID     uuid.UUID  `json:"deliveryid" gorm:"column:deliveryid;default:uuid_generate_v4();primarykey"`
+	SubscriptionID uuid.UUID  `json:"subscriptionid" gorm:"column:subscriptionid"`
+	EventID        uuid.UUID  `json:"eventid" gorm:"column:eventid"`
+	Status         string     `json:"status" gorm:"column:status"`
+	Attempts       int        `json:"attempts" gorm:"column:attempts"`
+	NextAttemptAt  time.Time  `json:"next_attempt_at" gorm:"column:nextattemptat"`
+	LastAttemptAt  *time.Time `json:"last_attempt_at" gorm:"column:lastattemptat"`
+	LastStatus     *int       `json:"last_status" gorm:"column:laststatus"`
+	LastError      string     `json:"last_error" gorm:"column:lasterror"`
+	DeliveredAt    *time.Time `json:"delivered_at" gorm:"column:deliveredat"`
+	CreatedAt      time.Time  `json:"created_at" gorm:"column:createdat"`
+}
+
+func (WebhookDelivery) TableName() string {
+	return "webhookdelivery"
+}
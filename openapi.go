@@ -0,0 +1,953 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	swaggerFiles "github.com/swaggo/files/v2"
+)
+
+// The OpenAPI document is built from apiOperations, one entry per route
+// registered in main.go; checkAPIRoutes refuses to start when the two
+// disagree. Authenticated routes are registered through apiGroup, which
+// takes each route's permission from here too. Request bodies are spelled
+// out here and enforced by validateRequest, so a handler only sees bodies
+// with the right field names and types and every required field present.
+// The data in a response is described from the Go value the handler
+// returns.
+
+// apiOperation describes one route.
+type apiOperation struct {
+	Summary      string
+	Tag          string
+	Permission   Permission
+	Public       bool
+	Query        []*openapi3.Parameter
+	Body         *openapi3.Schema
+	BodyOptional bool
+	// Upload is the multipart/form-data body of a file upload
+	Upload *openapi3.Schema
+	Status int
+	// Data is a value of the type the handler returns as data, nil when the
+	// response carries none
+	Data interface{}
+	// Bare marks a handler that answers with Data itself rather than a
+	// SuccessResponse
+	Bare bool
+	// Export marks a route that also answers ?format=csv, xlsx or pdf
+	Export bool
+	// Queued marks a route that answers 202 when an approval rule holds the
+	// posting for review
+	Queued bool
+}
+
+func stringSchema() *openapi3.Schema  { return openapi3.NewStringSchema() }
+func integerSchema() *openapi3.Schema { return openapi3.NewIntegerSchema() }
+func dateSchema() *openapi3.Schema    { return openapi3.NewStringSchema().WithFormat("date") }
+
+func enumSchema(values ...string) *openapi3.Schema {
+	schema := openapi3.NewStringSchema()
+	for _, value := range values {
+		schema.Enum = append(schema.Enum, value)
+	}
+	return schema
+}
+
+func describe(schema *openapi3.Schema, description string) *openapi3.Schema {
+	schema.Description = description
+	return schema
+}
+
+func positiveSchema() *openapi3.Schema {
+	return openapi3.NewIntegerSchema().WithMin(1)
+}
+
+func requiredString() *openapi3.Schema {
+	return openapi3.NewStringSchema().WithMinLength(1)
+}
+
+// body is a request body object that allows no other fields.
+func body(required []string, properties map[string]*openapi3.Schema) *openapi3.Schema {
+	schema := openapi3.NewObjectSchema().WithProperties(properties)
+	schema.Required = required
+	noMore := false
+	schema.AdditionalProperties = openapi3.AdditionalProperties{Has: &noMore}
+	return schema
+}
+
+func queryParam(name string, schema *openapi3.Schema, description string) *openapi3.Parameter {
+	return openapi3.NewQueryParameter(name).WithSchema(schema).WithDescription(description)
+}
+
+func upload(description string, formats ...string) *openapi3.Schema {
+	return openapi3.NewObjectSchema().
+		WithProperty("file", openapi3.NewStringSchema().WithFormat("binary")).
+		WithProperty("format", describe(enumSchema(formats...), description)).
+		WithRequired([]string{"file"})
+}
+
+var (
+	balanceRuleSchema = enumSchema(BalanceRuleNoOverdraft, BalanceRuleOverdraftLimit, BalanceRuleUnrestricted)
+	frequencySchema   = enumSchema(SettlementMonthly, SettlementQuarterly, SettlementAnnually)
+	reasonBody        = body([]string{"reason"}, map[string]*openapi3.Schema{"reason": requiredString()})
+	journalFilters    = []*openapi3.Parameter{
+		queryParam("status", stringSchema(), "posted (default), pending, rejected or all"),
+		queryParam("account", integerSchema(), "entries debiting or crediting this account number"),
+		queryParam("created_by", stringSchema(), "entries created by this user"),
+		queryParam("batch", openapi3.NewUUIDSchema(), "entries from this import batch"),
+		queryParam("from", dateSchema(), "first date, inclusive"),
+		queryParam("to", dateSchema(), "last date, inclusive"),
+	}
+	limitParam      = queryParam("limit", integerSchema().WithMin(1).WithMax(1000), "page size, 100 by default")
+	toleranceParams = []*openapi3.Parameter{
+		queryParam("amount_tolerance", integerSchema().WithMin(0), "largest amount difference to auto-match, RECON_AMOUNT_TOLERANCE by default"),
+		queryParam("date_tolerance_days", integerSchema().WithMin(0), "largest date difference to auto-match, RECON_DATE_TOLERANCE_DAYS by default"),
+	}
+)
+
+// apiOperations is keyed by method and gin path, e.g. "GET /account/:id/hold".
+var apiOperations = map[string]apiOperation{
+	"GET /healthz": {Summary: "Liveness probe", Tag: "health", Public: true},
+	"GET /readyz":  {Summary: "Readiness probe: database, migrations and auth service", Tag: "health", Public: true, Data: []HealthCheck{}},
+
+	"POST /accounttype": {Summary: "Create an account type", Tag: "chart of accounts", Permission: PermChartWrite,
+		Body: body([]string{"name", "description", "start_range", "end_range"}, map[string]*openapi3.Schema{
+			"name":        requiredString(),
+			"description": requiredString(),
+			"start_range": positiveSchema(),
+			"end_range":   positiveSchema(),
+		})},
+	"GET /accounttype": {Summary: "List account types", Tag: "chart of accounts", Permission: PermLedgerRead,
+		Data: []ListAccountTypeResponse{}, Export: true},
+	"POST /coa": {Summary: "Create a chart of account", Tag: "chart of accounts", Permission: PermChartWrite,
+		Body: body([]string{"account_type_id", "account_number", "name"}, map[string]*openapi3.Schema{
+			"account_type_id": openapi3.NewUUIDSchema(),
+			"account_number":  positiveSchema(),
+			"name":            requiredString(),
+			"balance_rule":    balanceRuleSchema,
+			"overdraft_limit": integerSchema().WithMin(0),
+		})},
+	"GET /coa": {Summary: "List the chart of accounts", Tag: "chart of accounts", Permission: PermLedgerRead,
+		Data: []CharOfAccountResponse{}, Export: true},
+	"GET /coa/control": {Summary: "Prove control accounts against their sub-ledgers", Tag: "chart of accounts", Permission: PermLedgerRead,
+		Data: ControlAccountReport{}, Export: true},
+	"PUT /coa/:id/balancerule": {Summary: "Set the default balance rule of a chart of account", Tag: "chart of accounts", Permission: PermChartWrite,
+		Body: body([]string{"balance_rule"}, map[string]*openapi3.Schema{
+			"balance_rule":    balanceRuleSchema,
+			"overdraft_limit": integerSchema().WithMin(0),
+		})},
+	"PUT /coa/:id/control": {Summary: "Make a chart of account a control account, or not", Tag: "chart of accounts", Permission: PermChartWrite,
+		Body: body([]string{"is_control"}, map[string]*openapi3.Schema{"is_control": openapi3.NewBoolSchema()}),
+		Data: ChartOfAccount{}},
+	"PUT /coa/:id/interestplan": {Summary: "Attach an interest plan to a chart of account; an empty plan_id detaches it", Tag: "interest", Permission: PermChartWrite,
+		Body: body(nil, map[string]*openapi3.Schema{"plan_id": stringSchema()})},
+
+	"POST /account": {Summary: "Open an account", Tag: "accounts", Permission: PermAccountWrite,
+		Body: body([]string{"coa_id", "name"}, map[string]*openapi3.Schema{
+			"coa_id":          openapi3.NewUUIDSchema(),
+			"name":            requiredString(),
+			"balance_rule":    balanceRuleSchema,
+			"overdraft_limit": integerSchema().WithMin(0),
+			"status":          enumSchema(AccountStatusPending, AccountStatusActive),
+			"owner_id":        openapi3.NewUUIDSchema(),
+		})},
+	"GET /account": {Summary: "List accounts with their balances", Tag: "accounts", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("customer_id", openapi3.NewUUIDSchema(), "only accounts this customer owns")},
+		Data:  []ListAccountResponse{}, Export: true},
+	"PUT /account/:id/balancerule": {Summary: "Override the balance rule of an account; an empty balance_rule removes the override", Tag: "accounts", Permission: PermAccountLimits,
+		Body: body(nil, map[string]*openapi3.Schema{
+			"balance_rule":    enumSchema("", BalanceRuleNoOverdraft, BalanceRuleOverdraftLimit, BalanceRuleUnrestricted),
+			"overdraft_limit": integerSchema().WithMin(0),
+		})},
+	"PUT /account/:id/status": {Summary: "Change the status of an account", Tag: "accounts", Permission: PermAccountStatus,
+		Body: body([]string{"status", "reason"}, map[string]*openapi3.Schema{
+			"status": enumSchema(AccountStatusPending, AccountStatusActive, AccountStatusDormant, AccountStatusFrozenDebit,
+				AccountStatusFrozenCredit, AccountStatusFrozen, AccountStatusClosed),
+			"reason":        requiredString(),
+			"sweep_account": describe(integerSchema(), "account to sweep the remaining balance into when closing"),
+		}),
+		Data: gin.H{}},
+	"GET /account/:id/hold": {Summary: "List the holds on an account", Tag: "holds", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("status", stringSchema(), "active (default), released, expired or all")},
+		Data:  []AccountHold{}},
+	"POST /account/:id/hold": {Summary: "Place a hold on an account", Tag: "holds", Permission: PermHoldManage, Status: http.StatusCreated,
+		Body: body([]string{"amount", "hold_type", "reason"}, map[string]*openapi3.Schema{
+			"amount":     positiveSchema(),
+			"hold_type":  enumSchema(HoldTypePendingWithdrawal, HoldTypeLien, HoldTypeUnclearedCheque),
+			"reason":     requiredString(),
+			"expires_at": openapi3.NewDateTimeSchema(),
+		}),
+		Data: AccountHold{}},
+	"POST /hold/:id/release": {Summary: "Release a hold", Tag: "holds", Permission: PermHoldManage, Data: AccountHold{}},
+	"GET /account/:id/owner": {Summary: "List the owners of an account", Tag: "customers", Permission: PermLedgerRead, Data: []AccountOwner{}},
+	"POST /account/:id/owner": {Summary: "Add an owner to an account", Tag: "customers", Permission: PermCustomerWrite, Status: http.StatusCreated,
+		Body: body([]string{"customer_id", "role"}, map[string]*openapi3.Schema{
+			"customer_id": openapi3.NewUUIDSchema(),
+			"role":        enumSchema(OwnerRolePrimary, OwnerRoleJoint, OwnerRoleSignatory),
+			"can_sign":    openapi3.NewBoolSchema(),
+		}),
+		Data: AccountOwner{}},
+	"DELETE /account/:id/owner/:customerid": {Summary: "Remove an owner from an account", Tag: "customers", Permission: PermCustomerWrite},
+	"PUT /account/:id/mandate": {Summary: "Set who must sign for an account", Tag: "customers", Permission: PermCustomerWrite,
+		Body: body([]string{"mandate"}, map[string]*openapi3.Schema{
+			"mandate":              enumSchema(MandateAny, MandateAll, MandateNOfM),
+			"required_signatories": describe(integerSchema(), "signatures needed for n_of_m"),
+		}),
+		Data: struct {
+			Mandate             string `json:"mandate"`
+			RequiredSignatories int    `json:"required_signatories"`
+		}{}},
+	"GET /account/:id/interest": {Summary: "Interest accrued and settled on an account", Tag: "interest", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("from", dateSchema(), "first date"), queryParam("to", dateSchema(), "last date")},
+		Data: struct {
+			From        string               `json:"from"`
+			To          string               `json:"to"`
+			Accrued     float64              `json:"accrued"`
+			Accruals    []InterestAccrual    `json:"accruals"`
+			Settlements []InterestSettlement `json:"settlements"`
+		}{}},
+	"GET /account/:id/waiver": {Summary: "List the fee waivers of an account", Tag: "fees", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("all", openapi3.NewBoolSchema(), "include revoked and expired waivers")},
+		Data:  []ChargeWaiver{}},
+	"POST /account/:id/waiver": {Summary: "Waive one charge, or every charge, for an account", Tag: "fees", Permission: PermFeeWaive, Status: http.StatusCreated,
+		Body: body([]string{"reason"}, map[string]*openapi3.Schema{
+			"charge_id":  openapi3.NewUUIDSchema(),
+			"reason":     requiredString(),
+			"expires_at": openapi3.NewDateTimeSchema(),
+		}),
+		Data: ChargeWaiver{}},
+	"GET /account/:id/fees": {Summary: "List the fees charged to an account", Tag: "fees", Permission: PermLedgerRead, Data: []ChargeApplication{}},
+	"POST /account/:id/statement": {Summary: "Import an MT940, CAMT.053 or OFX bank statement", Tag: "bank reconciliation", Permission: PermBankReconcile, Status: http.StatusCreated,
+		Query:  toleranceParams,
+		Upload: upload("detected from the file when omitted", StatementFormatMT940, StatementFormatCAMT053, StatementFormatOFX),
+		Data:   StatementImportReport{}},
+	"POST /account/:id/statement/match": {Summary: "Auto-match the open statement lines of an account", Tag: "bank reconciliation", Permission: PermBankReconcile,
+		Query: toleranceParams,
+		Data: struct {
+			Matched   int            `json:"matched"`
+			Unmatched int            `json:"unmatched"`
+			Tolerance MatchTolerance `json:"tolerance"`
+		}{}},
+	"GET /account/:id/statement": {Summary: "List the bank statements of an account", Tag: "bank reconciliation", Permission: PermLedgerRead, Data: []BankStatement{}},
+	"GET /account/:id/reconciliation": {Summary: "Reconcile an account against its bank statements", Tag: "bank reconciliation", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("date", dateSchema(), "reconcile as of this date, today by default")},
+		Data:  BankReconciliation{}, Export: true},
+	"GET /statement/:id": {Summary: "Get a bank statement with its lines", Tag: "bank reconciliation", Permission: PermLedgerRead, Data: BankStatement{}},
+	"POST /statementline/:id/match": {Summary: "Match a statement line to a journal entry by hand", Tag: "bank reconciliation", Permission: PermBankReconcile,
+		Body: body([]string{"transactionid"}, map[string]*openapi3.Schema{"transactionid": openapi3.NewUUIDSchema()}),
+		Data: BankStatementLine{}},
+	"POST /statementline/:id/unmatch": {Summary: "Undo the match of a statement line", Tag: "bank reconciliation", Permission: PermBankReconcile, Data: BankStatementLine{}},
+
+	"POST /customer": {Summary: "Create a customer", Tag: "customers", Permission: PermCustomerWrite, Status: http.StatusCreated,
+		Body: body([]string{"customer_type", "name", "id_type", "id_number"}, map[string]*openapi3.Schema{
+			"customer_type": enumSchema(CustomerTypeIndividual, CustomerTypeOrganization),
+			"name":          requiredString(),
+			"id_type":       requiredString(),
+			"id_number":     requiredString(),
+			"email":         stringSchema(),
+			"phone":         stringSchema(),
+			"address":       stringSchema(),
+		}),
+		Data: Customer{}},
+	"GET /customer": {Summary: "List customers", Tag: "customers", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{
+			queryParam("customer_type", enumSchema(CustomerTypeIndividual, CustomerTypeOrganization), ""),
+			queryParam("kyc_status", enumSchema(KYCStatusPending, KYCStatusVerified, KYCStatusRejected), ""),
+		},
+		Data: []Customer{}},
+	"GET /customer/:id":          {Summary: "Get a customer", Tag: "customers", Permission: PermLedgerRead, Data: Customer{}},
+	"GET /customer/:id/accounts": {Summary: "List the accounts a customer owns", Tag: "customers", Permission: PermLedgerRead, Data: []CustomerAccountResponse{}},
+	"PUT /customer/:id/kyc": {Summary: "Record the outcome of a KYC review", Tag: "customers", Permission: PermKYCReview,
+		Body: body([]string{"kyc_status"}, map[string]*openapi3.Schema{
+			"kyc_status": enumSchema(KYCStatusPending, KYCStatusVerified, KYCStatusRejected),
+		}),
+		Data: Customer{}},
+
+	"POST /journalentry": {Summary: "Post a journal entry, or queue it for approval", Tag: "journal", Permission: PermJournalPost, Queued: true,
+		Body: body([]string{"debit_account", "credit_account", "amount"}, map[string]*openapi3.Schema{
+			"debit_account":    integerSchema(),
+			"credit_account":   integerSchema(),
+			"amount":           positiveSchema(),
+			"description":      stringSchema(),
+			"transaction_type": describe(stringSchema(), "selects the posting charges"),
+		}),
+		Data: struct {
+			TransactionID uuid.UUID           `json:"transactionid"`
+			Fees          []ChargeApplication `json:"fees"`
+		}{}},
+	"GET /journalentry": {Summary: "List journal entries", Tag: "journal", Permission: PermLedgerRead,
+		Query: journalFilters, Data: []JournalEntryResponse{}, Bare: true, Export: true},
+	"POST /journalentry/:id/approve": {Summary: "Approve and post a pending entry", Tag: "journal", Permission: PermJournalApprove},
+	"POST /journalentry/:id/reject":  {Summary: "Reject a pending entry", Tag: "journal", Permission: PermJournalApprove, Body: reasonBody},
+	"POST /journalentry/:id/reverse": {Summary: "Reverse a posted entry", Tag: "journal", Permission: PermJournalReverse, Body: reasonBody,
+		Data: struct {
+			TransactionID uuid.UUID `json:"transactionid"`
+		}{}},
+	"POST /journalentry/import": {Summary: "Import journal entries from CSV or XLSX", Tag: "journal", Permission: PermJournalImport, Status: http.StatusCreated,
+		Query:  []*openapi3.Parameter{queryParam("dry_run", openapi3.NewBoolSchema(), "validate the file without posting")},
+		Upload: upload("taken from the file extension when omitted", ImportFormatCSV, ImportFormatXLSX),
+		Data:   ImportReport{}},
+	"GET /importbatch/:id": {Summary: "Get an import batch", Tag: "journal", Permission: PermLedgerRead, Data: ImportBatch{}},
+	"POST /period/close": {Summary: "Close the books through a date", Tag: "journal", Permission: PermPeriodClose, Status: http.StatusCreated,
+		Body: body([]string{"through"}, map[string]*openapi3.Schema{"through": dateSchema()}),
+		Data: PeriodClose{}},
+	"GET /period": {Summary: "Get the date the books are closed through", Tag: "journal", Permission: PermLedgerRead,
+		Data: struct {
+			ClosedThrough *string `json:"closed_through"`
+		}{}},
+	"POST /approvalrule": {Summary: "Create an approval rule", Tag: "journal", Permission: PermApprovalRules,
+		Body: body([]string{"threshold"}, map[string]*openapi3.Schema{
+			"account_type_id": openapi3.NewUUIDSchema(),
+			"role":            enumSchema(RoleViewer, RoleTeller, RoleAccountant, RoleAdmin),
+			"threshold":       positiveSchema(),
+		}),
+		Data: ApprovalRule{}},
+	"GET /approvalrule": {Summary: "List approval rules", Tag: "journal", Permission: PermLedgerRead, Data: []ApprovalRule{}},
+
+	"POST /interestplan": {Summary: "Create an interest plan", Tag: "interest", Permission: PermChartWrite, Status: http.StatusCreated,
+		Body: body([]string{"name", "kind", "day_count", "tiers", "accrued_interest_account", "interest_account"}, map[string]*openapi3.Schema{
+			"name":      requiredString(),
+			"kind":      enumSchema(InterestKindDeposit, InterestKindLoan),
+			"day_count": enumSchema(DayCount30360, DayCountActual365, DayCountActualActual),
+			"tiers": openapi3.NewArraySchema().WithMinItems(1).WithItems(body([]string{"min_balance", "rate_bps"}, map[string]*openapi3.Schema{
+				"min_balance": integerSchema().WithMin(0),
+				"rate_bps":    integerSchema().WithMin(0),
+			})),
+			"accrued_interest_account": integerSchema(),
+			"interest_account":         integerSchema(),
+			"settlement":               enumSchema(InterestSettlementCapitalize, InterestSettlementPayout),
+			"settlement_frequency":     frequencySchema,
+			"payout_account":           integerSchema().WithNullable(),
+		}),
+		Data: InterestPlan{}},
+	"GET /interestplan": {Summary: "List interest plans", Tag: "interest", Permission: PermLedgerRead, Data: []InterestPlan{}},
+
+	"POST /loanproduct": {Summary: "Create a loan product", Tag: "loans", Permission: PermLoanProducts, Status: http.StatusCreated,
+		Body: body([]string{"name", "method", "term", "frequency", "loan_coa_id", "interest_income_account", "penalty_income_account"}, map[string]*openapi3.Schema{
+			"name":                    requiredString(),
+			"rate_bps":                integerSchema().WithMin(0),
+			"method":                  enumSchema(LoanMethodFlat, LoanMethodReducing),
+			"term":                    positiveSchema(),
+			"frequency":               enumSchema(LoanFrequencyWeekly, LoanFrequencyFortnightly, LoanFrequencyMonthly),
+			"allocation_order":        describe(stringSchema(), "comma-separated order of penalty, interest and principal"),
+			"loan_coa_id":             openapi3.NewUUIDSchema(),
+			"interest_income_account": integerSchema(),
+			"penalty_income_account":  integerSchema(),
+		}),
+		Data: LoanProduct{}},
+	"GET /loanproduct": {Summary: "List loan products", Tag: "loans", Permission: PermLedgerRead, Data: []LoanProduct{}},
+	"POST /loan": {Summary: "Create a loan with its repayment schedule", Tag: "loans", Permission: PermLoanWrite, Status: http.StatusCreated,
+		Body: body([]string{"product_id", "principal", "disbursement_account"}, map[string]*openapi3.Schema{
+			"product_id":           openapi3.NewUUIDSchema(),
+			"customer_id":          openapi3.NewUUIDSchema(),
+			"principal":            positiveSchema(),
+			"disbursement_account": integerSchema(),
+			"start_date":           dateSchema(),
+		}),
+		Data: struct {
+			Loan     Loan              `json:"loan"`
+			Schedule []LoanInstallment `json:"schedule"`
+		}{}},
+	"GET /loan": {Summary: "List loans", Tag: "loans", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{
+			queryParam("status", stringSchema(), ""),
+			queryParam("customer_id", openapi3.NewUUIDSchema(), ""),
+		},
+		Data: []Loan{}},
+	"GET /loan/:id": {Summary: "Get a loan with its repayments", Tag: "loans", Permission: PermLedgerRead,
+		Data: struct {
+			Loan       Loan            `json:"loan"`
+			Repayments []LoanRepayment `json:"repayments"`
+		}{}},
+	"GET /loan/:id/schedule": {Summary: "Due, paid and outstanding per installment", Tag: "loans", Permission: PermLedgerRead,
+		Data: LoanSchedule{}, Export: true},
+	"POST /loan/:id/disburse": {Summary: "Disburse a pending loan, or queue the disbursement for approval", Tag: "loans", Permission: PermLoanManage, Queued: true,
+		Data: struct {
+			LoanID        uuid.UUID `json:"loanid"`
+			TransactionID uuid.UUID `json:"transactionid"`
+		}{}},
+	"POST /loan/:id/repayment": {Summary: "Post a loan repayment, or queue it for approval", Tag: "loans", Permission: PermLoanWrite, Queued: true,
+		Body: body([]string{"amount", "payment_account"}, map[string]*openapi3.Schema{
+			"amount":          positiveSchema(),
+			"payment_account": integerSchema(),
+		}),
+		Data: struct {
+			Repayment  LoanRepayment `json:"repayment"`
+			LoanStatus string        `json:"loan_status"`
+		}{}},
+	"POST /loan/:id/penalty": {Summary: "Charge a penalty on a loan", Tag: "loans", Permission: PermLoanManage,
+		Body: body([]string{"amount", "reason"}, map[string]*openapi3.Schema{
+			"amount": positiveSchema(),
+			"reason": requiredString(),
+		}),
+		Data: LoanInstallment{}},
+
+	"POST /charge": {Summary: "Create a posting or maintenance charge", Tag: "fees", Permission: PermChargeManage, Status: http.StatusCreated,
+		Body: body([]string{"name", "trigger", "method", "income_account"}, map[string]*openapi3.Schema{
+			"name":             requiredString(),
+			"trigger":          enumSchema(ChargeTriggerPosting, ChargeTriggerMaintenance),
+			"transaction_type": stringSchema(),
+			"coa_id":           openapi3.NewUUIDSchema(),
+			"side":             enumSchema("debit", "credit"),
+			"method":           enumSchema(ChargeMethodFlat, ChargeMethodPercentage, ChargeMethodTiered),
+			"amount":           integerSchema().WithMin(0),
+			"rate_bps":         integerSchema().WithMin(0),
+			"min_amount":       integerSchema().WithMin(0),
+			"max_amount":       integerSchema().WithMin(0),
+			"tiers": openapi3.NewArraySchema().WithItems(body([]string{"min_amount", "amount"}, map[string]*openapi3.Schema{
+				"min_amount": integerSchema().WithMin(0),
+				"amount":     integerSchema().WithMin(0),
+			})),
+			"frequency":      frequencySchema,
+			"income_account": integerSchema(),
+		}),
+		Data: Charge{}},
+	"GET /charge": {Summary: "List charges", Tag: "fees", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("trigger", enumSchema(ChargeTriggerPosting, ChargeTriggerMaintenance), "")},
+		Data:  []Charge{}},
+	"PUT /charge/:id/active": {Summary: "Activate or deactivate a charge", Tag: "fees", Permission: PermChargeManage,
+		Body: body([]string{"active"}, map[string]*openapi3.Schema{"active": openapi3.NewBoolSchema()})},
+	"POST /waiver/:id/revoke": {Summary: "Revoke a fee waiver", Tag: "fees", Permission: PermFeeWaive},
+
+	"POST /recurring": {Summary: "Create a recurring entry", Tag: "recurring entries", Permission: PermRecurringManage, Status: http.StatusCreated,
+		Body: body([]string{"name", "debit_account", "credit_account", "amount", "schedule", "start_date"}, map[string]*openapi3.Schema{
+			"name":             requiredString(),
+			"debit_account":    integerSchema(),
+			"credit_account":   integerSchema(),
+			"amount":           positiveSchema(),
+			"description":      stringSchema(),
+			"transaction_type": stringSchema(),
+			"schedule":         enumSchema(ScheduleDayOfMonth, ScheduleLastBusinessDay),
+			"day_of_month":     integerSchema().WithMin(0).WithMax(31),
+			"interval_months":  integerSchema().WithMin(0),
+			"start_date":       dateSchema(),
+			"end_date":         dateSchema(),
+		}),
+		Data: RecurringEntry{}},
+	"GET /recurring": {Summary: "List recurring entries", Tag: "recurring entries", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("status", stringSchema(), "")},
+		Data:  []RecurringEntry{}},
+	"GET /recurring/:id": {Summary: "Get a recurring entry with its postings", Tag: "recurring entries", Permission: PermLedgerRead,
+		Data: struct {
+			Template RecurringEntry     `json:"template"`
+			Postings []RecurringPosting `json:"postings"`
+		}{}},
+	"GET /recurring/:id/preview": {Summary: "Upcoming occurrences of a recurring entry", Tag: "recurring entries", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("count", integerSchema().WithMin(1), "number of occurrences")},
+		Data: []struct {
+			Date          string `json:"date"`
+			DebitAccount  int    `json:"debit_account"`
+			CreditAccount int    `json:"credit_account"`
+			Amount        int    `json:"amount"`
+			Description   string `json:"description"`
+		}{}},
+	"POST /recurring/:id/pause":  {Summary: "Pause a recurring entry", Tag: "recurring entries", Permission: PermRecurringManage, Data: RecurringEntry{}},
+	"POST /recurring/:id/resume": {Summary: "Resume a recurring entry", Tag: "recurring entries", Permission: PermRecurringManage, Data: RecurringEntry{}},
+
+	"GET /event": {Summary: "Read the event outbox in order", Tag: "events", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{
+			queryParam("after", integerSchema().WithMin(0), "last sequence already read"),
+			queryParam("type", enumSchema(eventTypes...), ""),
+			limitParam,
+		},
+		Data: []EventResponse{}},
+	"POST /webhook": {Summary: "Subscribe an endpoint to events", Tag: "events", Permission: PermWebhookManage, Status: http.StatusCreated,
+		Body: body([]string{"url", "events"}, map[string]*openapi3.Schema{
+			"url":    requiredString(),
+			"events": openapi3.NewArraySchema().WithMinItems(1).WithItems(enumSchema(append([]string{"*"}, eventTypes...)...)),
+			"secret": describe(stringSchema().WithMinLength(16), "generated when omitted"),
+		}),
+		Data: WebhookSubscriptionResponse{}},
+	"GET /webhook": {Summary: "List webhook subscriptions", Tag: "events", Permission: PermWebhookManage, Data: []WebhookSubscriptionResponse{}},
+	"PUT /webhook/:id": {Summary: "Change a webhook subscription", Tag: "events", Permission: PermWebhookManage,
+		Body: body(nil, map[string]*openapi3.Schema{
+			"url":    requiredString(),
+			"events": openapi3.NewArraySchema().WithMinItems(1).WithItems(enumSchema(append([]string{"*"}, eventTypes...)...)),
+			"active": openapi3.NewBoolSchema(),
+		}),
+		Data: WebhookSubscriptionResponse{}},
+	"DELETE /webhook/:id": {Summary: "Delete a webhook subscription and its deliveries", Tag: "events", Permission: PermWebhookManage},
+	"GET /webhook/:id/delivery": {Summary: "List the deliveries of a subscription", Tag: "events", Permission: PermWebhookManage,
+		Query: []*openapi3.Parameter{queryParam("status", enumSchema(WebhookStatusPending, WebhookStatusDelivered, WebhookStatusDead), ""), limitParam},
+		Data:  []WebhookDeliveryResponse{}},
+	"GET /webhookdelivery/dead": {Summary: "List dead-lettered deliveries", Tag: "events", Permission: PermWebhookManage,
+		Query: []*openapi3.Parameter{limitParam}, Data: []WebhookDeliveryResponse{}},
+	"POST /webhookdelivery/:id/retry": {Summary: "Queue a dead-lettered delivery again", Tag: "events", Permission: PermWebhookManage, Data: WebhookDelivery{}},
+
+	"GET /audit": {Summary: "Read the audit log", Tag: "audit", Permission: PermAuditRead,
+		Query: []*openapi3.Parameter{
+			queryParam("from", dateSchema(), ""),
+			queryParam("to", dateSchema(), ""),
+			queryParam("limit", integerSchema().WithMin(1), ""),
+			queryParam("offset", integerSchema().WithMin(0), ""),
+		},
+		Data: []AuditLogResponse{}},
+	"GET /audit/verify": {Summary: "Verify the audit log hash chain", Tag: "audit", Permission: PermAuditRead, Data: AuditVerification{}},
+
+	"GET /admin/reconcile": {Summary: "Compare balances with the journal", Tag: "admin", Permission: PermLedgerAdmin, Data: ReconciliationReport{}},
+	"POST /admin/reconcile": {Summary: "Compare balances with the journal; ?repair=true fixes them", Tag: "admin", Permission: PermLedgerAdmin,
+		Query: []*openapi3.Parameter{queryParam("repair", openapi3.NewBoolSchema(), "")},
+		Data:  ReconciliationReport{}},
+	"POST /admin/control": {Summary: "Prove control accounts; ?repair=true resets drifted balances", Tag: "admin", Permission: PermLedgerAdmin,
+		Query: []*openapi3.Parameter{queryParam("repair", openapi3.NewBoolSchema(), "")},
+		Data:  ControlAccountReport{}, Export: true},
+	"GET /admin/integrity": {Summary: "Check the ledger for integrity problems", Tag: "admin", Permission: PermLedgerAdmin, Data: IntegrityReport{}},
+	"POST /admin/holds/expire": {Summary: "Expire lapsed holds now", Tag: "admin", Permission: PermLedgerAdmin,
+		Data: struct {
+			Expired int `json:"expired"`
+		}{}},
+	"POST /admin/interest": {Summary: "Run or rerun interest accrual for a date range", Tag: "admin", Permission: PermLedgerAdmin,
+		Body: body(nil, map[string]*openapi3.Schema{
+			"from": dateSchema(),
+			"to":   dateSchema(),
+		}),
+		BodyOptional: true,
+		Data:         InterestRunReport{}},
+	"POST /admin/fees/maintenance": {Summary: "Charge maintenance fees now", Tag: "admin", Permission: PermLedgerAdmin,
+		Query: []*openapi3.Parameter{queryParam("date", dateSchema(), "charge as of this date, today by default")},
+		Data:  MaintenanceFeeReport{}},
+	"POST /admin/recurring/run":     {Summary: "Post due recurring entries now", Tag: "admin", Permission: PermLedgerAdmin, Data: RecurringRunReport{}},
+	"POST /admin/webhooks/dispatch": {Summary: "Dispatch pending webhook deliveries now", Tag: "admin", Permission: PermLedgerAdmin, Data: WebhookRunReport{}},
+	"GET /admin/loglevel": {Summary: "Get the log level", Tag: "admin", Permission: PermLedgerAdmin,
+		Data: struct {
+			Level string `json:"level"`
+		}{}},
+	"PUT /admin/loglevel": {Summary: "Change the log level until the next restart", Tag: "admin", Permission: PermLedgerAdmin,
+		Body: body([]string{"level"}, map[string]*openapi3.Schema{"level": enumSchema("debug", "info", "warn", "error")}),
+		Data: struct {
+			Level string `json:"level"`
+		}{}},
+	"GET /admin/dormancy": {Summary: "List accounts that would be flagged dormant", Tag: "admin", Permission: PermLedgerAdmin,
+		Query: []*openapi3.Parameter{queryParam("inactive_for", stringSchema(), "a duration such as 8760h, DORMANCY_PERIOD by default")},
+		Data:  DormancyReport{}},
+	"POST /admin/dormancy": {Summary: "Flag inactive accounts dormant", Tag: "admin", Permission: PermLedgerAdmin,
+		Query: []*openapi3.Parameter{queryParam("inactive_for", stringSchema(), "a duration such as 8760h, DORMANCY_PERIOD by default")},
+		Data:  DormancyReport{}},
+
+	"GET /profitandloss": {Summary: "Profit and loss", Tag: "reports", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("date", dateSchema(), "a single day, all dates by default")},
+		Data:  reportSchema("incomes", "expenses", "total_incomes", "total_expenses"), Export: true},
+	"GET /balancesheet": {Summary: "Balance sheet", Tag: "reports", Permission: PermLedgerRead,
+		Query: []*openapi3.Parameter{queryParam("drilldown", stringSchema(), "all, or a control account number, to list sub-ledger accounts")},
+		Data:  reportSchema("assets", "liabilities", "equity"), Export: true},
+}
+
+// reportSchema describes the line-per-account reports, whose data is a
+// map of sections and totals rather than a Go type.
+func reportSchema(fields ...string) *openapi3.Schema {
+	line := openapi3.NewObjectSchema().WithProperties(map[string]*openapi3.Schema{
+		"account_name":    stringSchema(),
+		"account_number":  integerSchema(),
+		"balance":         integerSchema(),
+		"control_account": openapi3.NewBoolSchema(),
+		"sub_ledger_size": integerSchema(),
+		"accounts":        openapi3.NewArraySchema().WithItems(openapi3.NewObjectSchema()),
+	})
+	schema := openapi3.NewObjectSchema()
+	for _, field := range fields {
+		if strings.HasPrefix(field, "total_") {
+			schema.WithProperty(field, integerSchema())
+			continue
+		}
+		schema.WithProperty(field, openapi3.NewArraySchema().WithItems(line))
+	}
+	return schema
+}
+
+var (
+	uuidType    = reflect.TypeOf(uuid.UUID{})
+	openAPIOnce sync.Once
+	openAPIDoc  *openapi3.T
+	openAPIErr  error
+)
+
+// openAPISpec builds the document on first use.
+func openAPISpec() (*openapi3.T, error) {
+	openAPIOnce.Do(func() {
+		openapi3.DefineStringFormat("uuid", `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+		openAPIDoc, openAPIErr = buildOpenAPISpec()
+	})
+	return openAPIDoc, openAPIErr
+}
+
+func buildOpenAPISpec() (*openapi3.T, error) {
+	errorSchema := openapi3.NewObjectSchema().WithProperties(map[string]*openapi3.Schema{
+		"status_code": integerSchema(),
+		"error":       stringSchema(),
+	})
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:       "Ledger API",
+			Version:     "1.0.0",
+			Description: "Double-entry ledger. Every route except the probes needs a bearer token; x-permission names the permission it needs.",
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			Schemas: openapi3.Schemas{"ErrorResponse": openapi3.NewSchemaRef("", errorSchema)},
+			SecuritySchemes: openapi3.SecuritySchemes{
+				"bearerAuth": &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+			},
+		},
+		Security: openapi3.SecurityRequirements{{"bearerAuth": []string{}}},
+	}
+
+	generator := openapi3gen.NewGenerator(openapi3gen.SchemaCustomizer(
+		func(name string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+			if t == uuidType {
+				*schema = *openapi3.NewUUIDSchema()
+			}
+			return nil
+		}))
+	errorRef := &openapi3.ResponseRef{Value: openapi3.NewResponse().
+		WithDescription("error").
+		WithJSONSchemaRef(openapi3.NewSchemaRef("#/components/schemas/ErrorResponse", errorSchema))}
+
+	keys := make([]string, 0, len(apiOperations))
+	for key := range apiOperations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		op := apiOperations[key]
+		method, path, _ := strings.Cut(key, " ")
+
+		operation := openapi3.NewOperation()
+		operation.Summary = op.Summary
+		operation.Tags = []string{op.Tag}
+		operation.OperationID = operationID(method, path)
+		if op.Public {
+			operation.Security = &openapi3.SecurityRequirements{}
+		} else {
+			operation.Extensions = map[string]interface{}{"x-permission": string(op.Permission)}
+		}
+
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				operation.AddParameter(openapi3.NewPathParameter(segment[1:]).WithSchema(openapi3.NewUUIDSchema()))
+			}
+		}
+		for _, param := range op.Query {
+			operation.AddParameter(param)
+		}
+		if op.Export {
+			operation.AddParameter(queryParam("format", enumSchema(ExportFormatJSON, ExportFormatCSV, ExportFormatXLSX, ExportFormatPDF),
+				"export format; the Accept header is used when omitted"))
+		}
+
+		if op.Body != nil {
+			requestBody := openapi3.NewRequestBody().WithJSONSchema(op.Body).WithRequired(!op.BodyOptional)
+			operation.RequestBody = &openapi3.RequestBodyRef{Value: requestBody}
+		}
+		if op.Upload != nil {
+			requestBody := openapi3.NewRequestBody().WithRequired(true).
+				WithContent(openapi3.Content{"multipart/form-data": openapi3.NewMediaType().WithSchema(op.Upload)})
+			operation.RequestBody = &openapi3.RequestBodyRef{Value: requestBody}
+		}
+
+		data, err := dataSchema(generator, op.Data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", key, err)
+		}
+		content := data
+		if !op.Bare {
+			content = openapi3.NewObjectSchema().WithProperties(map[string]*openapi3.Schema{
+				"status_code": integerSchema(),
+				"message":     stringSchema(),
+			})
+			if data != nil {
+				content.WithProperty("data", data)
+			}
+		}
+		response := openapi3.NewResponse().WithDescription(op.Summary).WithJSONSchema(content)
+		if op.Export {
+			for _, format := range []string{ExportFormatCSV, ExportFormatXLSX, ExportFormatPDF} {
+				response.Content[exportContentTypes[format]] = openapi3.NewMediaType().
+					WithSchema(openapi3.NewStringSchema().WithFormat("binary"))
+			}
+		}
+		status := op.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		operation.Responses = openapi3.NewResponses(
+			openapi3.WithStatus(status, &openapi3.ResponseRef{Value: response}),
+			openapi3.WithName("default", errorRef.Value),
+		)
+		if op.Queued {
+			operation.Responses.Set("202", &openapi3.ResponseRef{Value: openapi3.NewResponse().
+				WithDescription("the posting is pending approval").
+				WithJSONSchema(content)})
+		}
+
+		doc.AddOperation(openAPIPath(path), method, operation)
+	}
+	return doc, nil
+}
+
+func dataSchema(generator *openapi3gen.Generator, data interface{}) (*openapi3.Schema, error) {
+	switch data := data.(type) {
+	case nil:
+		return nil, nil
+	case *openapi3.Schema:
+		return data, nil
+	}
+	ref, err := generator.NewSchemaRefForValue(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ref.Value, nil
+}
+
+// openAPIPath turns a gin path into an OpenAPI one: /loan/:id -> /loan/{id}.
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID names an operation after its route, e.g. post_account_id_hold.
+func operationID(method string, path string) string {
+	id := strings.ToLower(method)
+	for _, segment := range strings.Split(path, "/") {
+		if segment = strings.TrimPrefix(segment, ":"); segment != "" {
+			id += "_" + segment
+		}
+	}
+	return id
+}
+
+// checkAPIRoutes reports the routes without an operation and the
+// operations without a route.
+func checkAPIRoutes(routes gin.RoutesInfo) error {
+	var problems []string
+	registered := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		if route.Path == "/openapi.json" || route.Path == "/metrics" || strings.HasPrefix(route.Path, "/docs") {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if _, ok := apiOperations[key]; !ok {
+			problems = append(problems, key+" is not described")
+		}
+	}
+	for key := range apiOperations {
+		if !registered[key] {
+			problems = append(problems, key+" is described but not routed")
+		}
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// apiGroup registers authenticated routes behind the permission and the
+// request schema their apiOperations entry gives them, so neither can differ
+// between the router and the OpenAPI document.
+type apiGroup struct {
+	*gin.RouterGroup
+}
+
+func (g apiGroup) GET(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodGet, path, handler)
+}
+
+func (g apiGroup) POST(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodPost, path, handler)
+}
+
+func (g apiGroup) PUT(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodPut, path, handler)
+}
+
+func (g apiGroup) DELETE(path string, handler gin.HandlerFunc) {
+	g.handle(http.MethodDelete, path, handler)
+}
+
+// handle panics on a route apiOperations does not give a permission, as
+// gin does on a malformed route, so the mistake stops the service at start.
+func (g apiGroup) handle(method, path string, handler gin.HandlerFunc) {
+	key := method + " " + strings.TrimSuffix(g.BasePath(), "/") + path
+	op, ok := apiOperations[key]
+	if !ok || op.Public || op.Permission == "" {
+		panic(key + " has no permission in apiOperations")
+	}
+	g.Handle(method, path, RequirePermission(op.Permission), validateRequest(op), handler)
+}
+
+// validateRequest checks a JSON request body against op's schema before the
+// handler binds it, answering 400 with every problem found. It runs after
+// RequirePermission, so a caller without the permission gets 403 whatever
+// they send.
+func validateRequest(op apiOperation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if op.Body == nil {
+			c.Next()
+			return
+		}
+
+		raw, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+
+		if len(bytes.TrimSpace(raw)) == 0 {
+			if op.BodyOptional {
+				c.Next()
+				return
+			}
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "A request body is required", StatusCode: http.StatusBadRequest})
+			c.Abort()
+			return
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			c.Abort()
+			return
+		}
+		if problems := validateBody(op.Body, value); len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// validateBody returns one "field: reason" line per schema violation.
+func validateBody(schema *openapi3.Schema, value interface{}) []string {
+	if _, err := openAPISpec(); err != nil {
+		return []string{err.Error()}
+	}
+	err := schema.VisitJSON(value, openapi3.MultiErrors(), openapi3.EnableFormatValidation())
+	if err == nil {
+		return nil
+	}
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+	var problems []string
+	for _, err := range errs {
+		problems = append(problems, describeSchemaError(err)...)
+	}
+	return problems
+}
+
+func describeSchemaError(err error) []string {
+	var nested openapi3.MultiError
+	if errors.As(err, &nested) {
+		var problems []string
+		for _, err := range nested {
+			problems = append(problems, describeSchemaError(err)...)
+		}
+		return problems
+	}
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		return []string{err.Error()}
+	}
+	field := strings.Join(schemaErr.JSONPointer(), ".")
+	reason := schemaErr.Reason
+	switch {
+	case schemaErr.SchemaField == "required":
+		return []string{field + ": is required"}
+	case schemaErr.SchemaField == "properties" && strings.HasSuffix(reason, " is unsupported"):
+		// the pointer is the object, the reason names the property
+		_, name, _ := strings.Cut(reason, "\"")
+		name, _, _ = strings.Cut(name, "\"")
+		if field != "" {
+			name = field + "." + name
+		}
+		return []string{name + ": is not a known field"}
+	case schemaErr.SchemaField == "format":
+		if example, ok := formatExamples[schemaErr.Schema.Format]; ok {
+			reason = "must look like " + example
+		}
+	}
+	if field == "" {
+		return []string{reason}
+	}
+	return []string{field + ": " + reason}
+}
+
+var formatExamples = map[string]string{
+	"date":      "2024-01-31",
+	"date-time": "2024-01-31T17:00:00Z",
+	"uuid":      "0b9e8a52-4a53-4c36-9e2e-2b8f1f6d0d7e",
+}
+
+// OpenAPIHandler serves the OpenAPI document.
+func OpenAPIHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		doc, err := openAPISpec()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, doc)
+	}
+}
+
+const swaggerInitializer = `window.onload = function() {
+  window.ui = SwaggerUIBundle({
+    url: "/openapi.json",
+    dom_id: "#swagger-ui",
+    deepLinking: true,
+    persistAuthorization: true,
+    presets: [SwaggerUIBundle.presets.apis, SwaggerUIStandalonePreset],
+    layout: "StandaloneLayout"
+  });
+};
+`
+
+// SwaggerUIHandler serves the bundled Swagger UI under /docs, pointed at
+// /openapi.json.
+func SwaggerUIHandler() gin.HandlerFunc {
+	files := http.StripPrefix("/docs", http.FileServer(http.FS(swaggerFiles.FS)))
+	return func(c *gin.Context) {
+		switch c.Param("filepath") {
+		case "":
+			c.Redirect(http.StatusMovedPermanently, "/docs/")
+			return
+		case "/":
+			// the file server answers the directory with index.html
+			files.ServeHTTP(c.Writer, c.Request)
+			return
+		case "/swagger-initializer.js":
+			c.Data(http.StatusOK, "application/javascript", []byte(swaggerInitializer))
+			return
+		}
+		if _, err := fs.Stat(swaggerFiles.FS, strings.TrimPrefix(c.Param("filepath"), "/")); err != nil {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Not found", StatusCode: http.StatusNotFound})
+			return
+		}
+		files.ServeHTTP(c.Writer, c.Request)
+	}
+}
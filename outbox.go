@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Domain events are written to the outbox by the transaction that makes
+// the change, so an event exists exactly when the change committed. The
+// webhook dispatcher delivers them from there; GET /event lets a consumer
+// read them in order instead of polling the journal.
+
+const (
+	EventAccountCreated  = "account.created"
+	EventJournalPosted   = "journal.posted"
+	EventJournalReversed = "journal.reversed"
+	EventPeriodClosed    = "period.closed"
+
+	defaultEventPageSize = 100
+)
+
+var eventTypes = []string{EventAccountCreated, EventJournalPosted, EventJournalReversed, EventPeriodClosed}
+
+// publishEvent adds an event to the outbox. It must be called with the
+// transaction that performs the change; the event is written when that
+// transaction commits.
+func publishEvent(tx *gorm.DB, eventType string, aggregateID string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	// written under the audit lock, which is held until commit, so
+	// sequences become visible in the order they were taken and a reader
+	// paging by sequence never skips an event
+	return appendAtCommit(tx, func(tx *gorm.DB) error {
+		event := OutboxEvent{
+			EventType:   eventType,
+			AggregateID: aggregateID,
+			Payload:     string(payload),
+			CreatedAt:   time.Now(),
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to write outbox event: %v", err)
+		}
+		return nil
+	})
+}
+
+func publishAccountCreated(tx *gorm.DB, account Account) error {
+	return publishEvent(tx, EventAccountCreated, account.AccountID.String(), gin.H{
+		"accountid":      account.AccountID,
+		"account_number": account.AccountNumber,
+		"name":           account.Name,
+		"coa_id":         account.COAID,
+		"status":         account.Status,
+		"balance_rule":   account.BalanceRule,
+		"created_by":     account.CreatedBy,
+	})
+}
+
+func journalEventData(entry *JournalEntry) gin.H {
+	return gin.H{
+		"transactionid":     entry.TransactionID,
+		"accounttodebitid":  entry.AccountDebitNumber,
+		"accounttocreditid": entry.AccountCreditNumber,
+		"amount":            entry.Amount,
+		"date":              entry.Date,
+		"description":       entry.Description,
+		"transaction_type":  entry.TransactionType,
+		"reversal_of":       entry.ReversalOf,
+		"batch_id":          entry.BatchID,
+		"created_by":        entry.CreatedBy,
+	}
+}
+
+// EventResponse is the shape of an event both on GET /event and in a
+// webhook body.
+type EventResponse struct {
+	EventID     uuid.UUID       `json:"id"`
+	Sequence    int64           `json:"sequence"`
+	EventType   string          `json:"type"`
+	AggregateID string          `json:"aggregate_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func eventResponse(event OutboxEvent) EventResponse {
+	return EventResponse{
+		EventID:     event.EventID,
+		Sequence:    event.Sequence,
+		EventType:   event.EventType,
+		AggregateID: event.AggregateID,
+		CreatedAt:   event.CreatedAt,
+		Data:        rawJSON(event.Payload),
+	}
+}
+
+// ListEventHandler pages through the outbox in sequence order. A consumer
+// keeps the last sequence it has seen and passes it as after.
+func ListEventHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		after, err := strconv.ParseInt(c.DefaultQuery("after", "0"), 10, 64)
+		if err != nil || after < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid after sequence", StatusCode: http.StatusBadRequest})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultEventPageSize)))
+		if err != nil || limit <= 0 || limit > 1000 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 1000", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		query := db.Where("sequence > ?", after)
+		if eventType := c.Query("type"); eventType != "" {
+			query = query.Where("eventtype = ?", eventType)
+		}
+		var events []OutboxEvent
+		if err := query.Order("sequence").Limit(limit).Find(&events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		response := make([]EventResponse, 0, len(events))
+		for _, event := range events {
+			response = append(response, eventResponse(event))
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Events", StatusCode: http.StatusOK, Data: response})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Closing a period moves a single close-through date forward. Entries dated
+// on or before it are refused by postJournalEntry, whichever path they come
+// from, so reports for a closed period cannot change.
+
+type PeriodClosedError struct {
+	Date          time.Time
+	ClosedThrough time.Time
+}
+
+func (e *PeriodClosedError) Error() string {
+	return fmt.Sprintf("The books are closed through %s, entries dated %s cannot be posted",
+		e.ClosedThrough.Format("2006-01-02"), e.Date.Format("2006-01-02"))
+}
+
+type errPeriodClose string
+
+func (e errPeriodClose) Error() string {
+	return string(e)
+}
+
+// closedThrough returns the date the books are closed through, or nil while
+// no period has been closed.
+func closedThrough(db *gorm.DB) (*time.Time, error) {
+	var period PeriodClose
+	err := db.Order("closedthrough DESC").Limit(1).Find(&period).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to read closed period: %v", err)
+	}
+	if period.CloseID == uuid.Nil {
+		return nil, nil
+	}
+	through := utcDate(period.ClosedThrough)
+	return &through, nil
+}
+
+// checkPeriodOpen refuses a date on or before the close-through date.
+func checkPeriodOpen(db *gorm.DB, date time.Time) error {
+	through, err := closedThrough(db)
+	if err != nil {
+		return err
+	}
+	if through != nil && !utcDate(date).After(*through) {
+		return &PeriodClosedError{Date: date, ClosedThrough: *through}
+	}
+	return nil
+}
+
+func GetPeriodHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		through, err := closedThrough(db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Closed Period", StatusCode: http.StatusOK, Data: gin.H{"closed_through": through}})
+	}
+}
+
+// ClosePeriodHandler closes the books through a past date. Closing only
+// moves forward; a closed period is corrected with entries in an open one.
+func ClosePeriodHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Through string `json:"through"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		through, err := time.Parse("2006-01-02", data.Through)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "through is required as YYYY-MM-DD", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if !through.Before(utcDate(time.Now())) {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Only past dates can be closed", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		period := PeriodClose{ClosedThrough: through, ClosedBy: c.GetString("userID"), ClosedAt: time.Now()}
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// serialises closes so the date can only move forward
+			if err := tx.Exec("LOCK TABLE periodclose IN EXCLUSIVE MODE").Error; err != nil {
+				return err
+			}
+			current, err := closedThrough(tx)
+			if err != nil {
+				return err
+			}
+			if current != nil && !through.After(*current) {
+				return errPeriodClose(fmt.Sprintf("The books are already closed through %s", current.Format("2006-01-02")))
+			}
+			if err := tx.Create(&period).Error; err != nil {
+				return err
+			}
+			err = recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "periodclose",
+				EntityID:   period.CloseID.String(),
+				Before:     gin.H{"closed_through": current},
+				After:      period,
+			})
+			if err != nil {
+				return err
+			}
+			return publishEvent(tx, EventPeriodClosed, period.CloseID.String(), gin.H{
+				"closed_through": through.Format("2006-01-02"),
+				"previous":       current,
+				"closed_by":      period.ClosedBy,
+			})
+		})
+		var conflict errPeriodClose
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Period closed", StatusCode: http.StatusCreated, Data: period})
+	}
+}
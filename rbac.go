@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Permission string
+
+const (
+	PermLedgerRead      Permission = "ledger:read"
+	PermAccountWrite    Permission = "account:write"
+	PermChartWrite      Permission = "chart:write"
+	PermJournalPost     Permission = "journal:post"
+	PermJournalReverse  Permission = "journal:reverse"
+	PermJournalApprove  Permission = "journal:approve"
+	PermPeriodClose     Permission = "period:close"
+	PermApprovalRules   Permission = "approval:manage"
+	PermAuditRead       Permission = "audit:read"
+	PermLedgerAdmin     Permission = "ledger:admin"
+	PermAccountLimits   Permission = "account:limits"
+	PermHoldManage      Permission = "hold:manage"
+	PermAccountStatus   Permission = "account:status"
+	PermCustomerWrite   Permission = "customer:write"
+	PermKYCReview       Permission = "kyc:review"
+	PermLoanProducts    Permission = "loan:products"
+	PermLoanWrite       Permission = "loan:write"
+	PermLoanManage      Permission = "loan:manage"
+	PermChargeManage    Permission = "charge:manage"
+	PermFeeWaive        Permission = "fee:waive"
+	PermRecurringManage Permission = "recurring:manage"
+	PermJournalImport   Permission = "journal:import"
+	PermBankReconcile   Permission = "bank:reconcile"
+	PermWebhookManage   Permission = "webhook:manage"
+)
+
+const (
+	RoleViewer     = "viewer"
+	RoleTeller     = "teller"
+	RoleAccountant = "accountant"
+	RoleAdmin      = "admin"
+)
+
+const defaultTellerPostingLimit = 100000
+
+var rolePermissions = map[string][]Permission{
+	RoleViewer:     {PermLedgerRead},
+	RoleTeller:     {PermLedgerRead, PermAccountWrite, PermJournalPost, PermHoldManage, PermCustomerWrite, PermLoanWrite},
+	RoleAccountant: {PermLedgerRead, PermAccountWrite, PermJournalPost, PermJournalReverse, PermJournalApprove, PermPeriodClose, PermAuditRead, PermAccountLimits, PermHoldManage, PermAccountStatus, PermCustomerWrite, PermKYCReview, PermLoanWrite, PermLoanManage, PermFeeWaive, PermRecurringManage, PermJournalImport, PermBankReconcile},
+	RoleAdmin:      {PermLedgerRead, PermAccountWrite, PermJournalPost, PermJournalReverse, PermJournalApprove, PermPeriodClose, PermChartWrite, PermApprovalRules, PermAuditRead, PermLedgerAdmin, PermAccountLimits, PermHoldManage, PermAccountStatus, PermCustomerWrite, PermKYCReview, PermLoanProducts, PermLoanWrite, PermLoanManage, PermChargeManage, PermFeeWaive, PermRecurringManage, PermJournalImport, PermBankReconcile, PermWebhookManage},
+}
+
+// RequirePermission rejects the request unless one of the caller's roles or
+// scopes grants p. It must run after JWTAuthMiddleware.
+func RequirePermission(p Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !hasPermission(c, p) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: fmt.Sprintf("Permission %s required", p), StatusCode: http.StatusForbidden})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func hasPermission(c *gin.Context, p Permission) bool {
+	return grants(c.GetStringSlice("roles"), c.GetStringSlice("scopes"), p)
+}
+
+// grants reports whether any of the roles, or one of the token scopes,
+// carries the permission.
+func grants(roles, scopes []string, p Permission) bool {
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	for _, scope := range scopes {
+		if Permission(scope) == p {
+			return true
+		}
+	}
+	return false
+}
+
+// PostingLimitError is returned when an entry is larger than the caller's
+// posting limit.
+type PostingLimitError struct {
+	Limit int
+}
+
+func (e *PostingLimitError) Error() string {
+	return fmt.Sprintf("Amount exceeds posting limit of %d", e.Limit)
+}
+
+// postingLimit returns the largest amount a caller with these roles may
+// post in a single journal entry, or false when the caller has no limit.
+// Only accountants and admins are unlimited. Everyone else who can post,
+// tellers and tokens granted journal:post through a scope alike, is held to
+// TELLER_POSTING_LIMIT.
+func postingLimit(roles []string) (int, bool) {
+	for _, role := range roles {
+		if role == RoleAccountant || role == RoleAdmin {
+			return 0, false
+		}
+	}
+
+	limit, err := strconv.Atoi(os.Getenv("TELLER_POSTING_LIMIT"))
+	if err != nil {
+		return defaultTellerPostingLimit, true
+	}
+	return limit, true
+}
+
+// checkPostingLimit refuses an amount over the caller's posting limit.
+func checkPostingLimit(roles []string, amount int) error {
+	if limit, limited := postingLimit(roles); limited && amount > limit {
+		return refusePosting(&PostingLimitError{Limit: limit})
+	}
+	return nil
+}
+
+// rolesFromClaims reads roles from a "roles" array or "role" string claim.
+func rolesFromClaims(claims map[string]interface{}) []string {
+	var roles []string
+	switch value := claims["roles"].(type) {
+	case []interface{}:
+		for _, role := range value {
+			if s, ok := role.(string); ok {
+				roles = append(roles, strings.ToLower(s))
+			}
+		}
+	case []string:
+		for _, role := range value {
+			roles = append(roles, strings.ToLower(role))
+		}
+	}
+	if role, ok := claims["role"].(string); ok && role != "" {
+		roles = append(roles, strings.ToLower(role))
+	}
+	return roles
+}
+
+// scopesFromClaims reads OAuth-style scopes from a space separated "scope"
+// claim or a "scopes" array.
+func scopesFromClaims(claims map[string]interface{}) []string {
+	var scopes []string
+	if scope, ok := claims["scope"].(string); ok {
+		scopes = append(scopes, strings.Fields(scope)...)
+	}
+	if values, ok := claims["scopes"].([]interface{}); ok {
+		for _, scope := range values {
+			if s, ok := scope.(string); ok {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
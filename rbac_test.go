@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+func TestPostingLimit(t *testing.T) {
+	t.Setenv("TELLER_POSTING_LIMIT", "5000")
+
+	for _, tc := range []struct {
+		name    string
+		roles   []string
+		limited bool
+	}{
+		{"teller", []string{RoleTeller}, true},
+		{"no roles", nil, true},
+		{"viewer", []string{RoleViewer}, true},
+		{"accountant", []string{RoleAccountant}, false},
+		{"admin", []string{RoleAdmin}, false},
+		{"teller and accountant", []string{RoleTeller, RoleAccountant}, false},
+	} {
+		limit, limited := postingLimit(tc.roles)
+		if limited != tc.limited || (limited && limit != 5000) {
+			t.Errorf("%s: got limit %d, %v, want limited %v at 5000", tc.name, limit, limited, tc.limited)
+		}
+	}
+}
+
+func TestScopeOnlyTokenIsHeldToPostingLimit(t *testing.T) {
+	t.Setenv("TELLER_POSTING_LIMIT", "5000")
+	auth, err := NewAuthenticator(&AuthConfig{Mode: AuthModeLocal, Secret: []byte("test-secret"), UserClaim: "user_id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "service-1", "scope": "ledger:read journal:post"}).
+		SignedString([]byte("test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := auth.Authenticate(context.Background(), token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !grants(result.Roles, result.Scopes, PermJournalPost) {
+		t.Fatalf("scope-only token with roles %v scopes %v cannot post", result.Roles, result.Scopes)
+	}
+
+	if err := checkPostingLimit(result.Roles, 5000); err != nil {
+		t.Errorf("amount at the limit refused: %v", err)
+	}
+	var overLimit *PostingLimitError
+	if err := checkPostingLimit(result.Roles, 5001); !errors.As(err, &overLimit) || overLimit.Limit != 5000 {
+		t.Errorf("amount over the limit: got %v, want a PostingLimitError at 5000", err)
+	}
+}
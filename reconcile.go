@@ -0,0 +1,193 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BalanceDiscrepancy is an account whose stored AccountBalance differs from
+// the balance implied by its posted journal entries. Drift is recorded minus
+// computed.
+type BalanceDiscrepancy struct {
+	AccountID      uuid.UUID `json:"account_id"`
+	AccountNumber  int       `json:"account_number"`
+	Name           string    `json:"name"`
+	Recorded       int       `json:"recorded"`
+	Computed       int       `json:"computed"`
+	Drift          int       `json:"drift"`
+	MissingBalance bool      `json:"missing_balance,omitempty"`
+	Repaired       bool      `json:"repaired"`
+}
+
+type ReconciliationReport struct {
+	CheckedAt     time.Time            `json:"checked_at"`
+	Accounts      int                  `json:"accounts"`
+	Discrepancies []BalanceDiscrepancy `json:"discrepancies"`
+	TotalDrift    int                  `json:"total_drift"`
+	Repaired      int                  `json:"repaired"`
+}
+
+type computedBalance struct {
+	AccountID     uuid.UUID     `gorm:"column:accountid"`
+	AccountNumber int           `gorm:"column:accountnumber"`
+	Name          string        `gorm:"column:name"`
+	Recorded      sql.NullInt64 `gorm:"column:recorded"`
+	Computed      int           `gorm:"column:computed"`
+}
+
+// balances follow processTransaction: credits add, debits subtract
+const computedBalanceSQL = `
+SELECT a.accountid, a.accountnumber, a.name, b.balance AS recorded,
+    COALESCE((SELECT SUM(amount) FROM journalentry
+        WHERE accountcreditnumber = a.accountnumber AND status = 'posted'), 0)
+  - COALESCE((SELECT SUM(amount) FROM journalentry
+        WHERE accountdebitnumber = a.accountnumber AND status = 'posted'), 0) AS computed
+FROM account a
+LEFT JOIN accountbalance b ON b.accountid = a.accountid`
+
+// reconcileBalances compares every account's stored balance with its journal
+// history. The scan runs in a read-only snapshot so it never blocks postings;
+// repairs then lock one balance row at a time and recompute it before
+// writing, so a posting that lands between the scan and the repair is not
+// lost.
+func reconcileBalances(db *gorm.DB, repair bool, actor AuditActor) (*ReconciliationReport, error) {
+	report := &ReconciliationReport{CheckedAt: time.Now(), Discrepancies: []BalanceDiscrepancy{}}
+
+	var rows []computedBalance
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Raw(computedBalanceSQL + " ORDER BY a.accountnumber").Scan(&rows).Error
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute balances: %v", err)
+	}
+	report.Accounts = len(rows)
+
+	for _, row := range rows {
+		if row.Recorded.Valid && int(row.Recorded.Int64) == row.Computed {
+			continue
+		}
+
+		discrepancy := BalanceDiscrepancy{
+			AccountID:      row.AccountID,
+			AccountNumber:  row.AccountNumber,
+			Name:           row.Name,
+			Recorded:       int(row.Recorded.Int64),
+			Computed:       row.Computed,
+			Drift:          int(row.Recorded.Int64) - row.Computed,
+			MissingBalance: !row.Recorded.Valid,
+		}
+
+		if repair {
+			repaired, err := repairBalance(db, row.AccountID, actor)
+			if err != nil {
+				return nil, fmt.Errorf("failed to repair account %d: %v", row.AccountNumber, err)
+			}
+			if repaired != nil {
+				discrepancy = *repaired
+				discrepancy.Repaired = true
+				report.Repaired++
+			} else {
+				// fixed itself between the scan and the repair
+				continue
+			}
+		}
+
+		report.Discrepancies = append(report.Discrepancies, discrepancy)
+		report.TotalDrift += abs(discrepancy.Drift)
+	}
+
+	return report, nil
+}
+
+// repairBalance recomputes one account under a row lock and overwrites its
+// balance, returning nil when there was nothing left to fix.
+func repairBalance(db *gorm.DB, accountID uuid.UUID, actor AuditActor) (*BalanceDiscrepancy, error) {
+	var result *BalanceDiscrepancy
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var balance AccountBalance
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("accountid = ?", accountID).
+			Limit(1).
+			Find(&balance).Error
+		if err != nil {
+			return err
+		}
+
+		var row computedBalance
+		err = tx.Raw(computedBalanceSQL+" WHERE a.accountid = ?", accountID).Scan(&row).Error
+		if err != nil {
+			return err
+		}
+		if balance.BalanceID != uuid.Nil && balance.Balance == row.Computed {
+			return nil
+		}
+
+		before := balance
+		discrepancy := BalanceDiscrepancy{
+			AccountID:      accountID,
+			AccountNumber:  row.AccountNumber,
+			Name:           row.Name,
+			Recorded:       balance.Balance,
+			Computed:       row.Computed,
+			Drift:          balance.Balance - row.Computed,
+			MissingBalance: balance.BalanceID == uuid.Nil,
+		}
+
+		if balance.BalanceID == uuid.Nil {
+			balance = AccountBalance{AccountID: accountID, Balance: row.Computed}
+			err = tx.Create(&balance).Error
+		} else {
+			balance.Balance = row.Computed
+			err = tx.Model(&AccountBalance{}).Where("balanceid = ?", balance.BalanceID).Update("balance", row.Computed).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		event := AuditEvent{
+			Action:     AuditActionRepair,
+			EntityType: "accountbalance",
+			EntityID:   accountID.String(),
+			After:      balance,
+		}
+		if !discrepancy.MissingBalance {
+			event.Before = before
+		}
+		if err := recordAudit(tx, actor, event); err != nil {
+			return err
+		}
+
+		result = &discrepancy
+		return nil
+	})
+	return result, err
+}
+
+func ReconcileBalancesHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repair := c.Query("repair") == "true"
+		if repair && c.Request.Method != http.MethodPost {
+			c.JSON(http.StatusMethodNotAllowed, ErrorResponse{Error: "Repairs must be requested with POST", StatusCode: http.StatusMethodNotAllowed})
+			return
+		}
+
+		report, err := reconcileBalances(db, repair, auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		message := "Balances reconcile with the journal"
+		if len(report.Discrepancies) > 0 {
+			message = fmt.Sprintf("%d accounts drifted from the journal", len(report.Discrepancies))
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: report})
+	}
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultRecurringInterval = time.Minute
+	defaultPreviewCount      = 12
+	maxPreviewCount          = 60
+)
+
+type errRecurringState string
+
+func (e errRecurringState) Error() string {
+	return string(e)
+}
+
+// occurrenceIn is the template's posting date in the given month. A day of
+// month past the end of a short month falls on its last day; business days
+// are Monday to Friday, without public holidays.
+func (r RecurringEntry) occurrenceIn(year int, month time.Month) time.Time {
+	last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+	if r.Schedule == ScheduleLastBusinessDay {
+		for last.Weekday() == time.Saturday || last.Weekday() == time.Sunday {
+			last = last.AddDate(0, 0, -1)
+		}
+		return last
+	}
+	if r.DayOfMonth < last.Day() {
+		return time.Date(year, month, r.DayOfMonth, 0, 0, 0, 0, time.UTC)
+	}
+	return last
+}
+
+// occurrenceOnOrAfter returns the first occurrence on or after from, counting
+// IntervalMonths from the month of StartDate, or nil once EndDate has passed.
+func (r RecurringEntry) occurrenceOnOrAfter(from time.Time) *time.Time {
+	start := utcDate(r.StartDate)
+	if from.Before(start) {
+		from = start
+	}
+	months := (from.Year()-start.Year())*12 + int(from.Month()) - int(start.Month())
+	months -= months % r.IntervalMonths
+	for {
+		month := time.Date(start.Year(), start.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+		occurrence := r.occurrenceIn(month.Year(), month.Month())
+		if !occurrence.Before(from) {
+			if r.EndDate != nil && occurrence.After(utcDate(*r.EndDate)) {
+				return nil
+			}
+			return &occurrence
+		}
+		months += r.IntervalMonths
+	}
+}
+
+type RecurringRun struct {
+	TemplateID uuid.UUID   `json:"templateid"`
+	Name       string      `json:"name"`
+	Posted     []time.Time `json:"posted"`
+	Queued     []time.Time `json:"queued,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+type RecurringRunReport struct {
+	RunAt   time.Time      `json:"run_at"`
+	Posted  int            `json:"posted"`
+	Queued  int            `json:"queued"`
+	Entries []RecurringRun `json:"entries"`
+}
+
+var errRecurringBusy = errors.New("recurring entry is being posted elsewhere")
+
+// applyPostingRules holds the user creating or resuming the template to the
+// posting limit submitJournalEntry applies to a single entry, and keeps
+// their roles so that each occurrence can be checked against the approval
+// rules in force when it falls due.
+func (r *RecurringEntry) applyPostingRules(roles []string) error {
+	if err := checkPostingLimit(roles, r.Amount); err != nil {
+		return err
+	}
+	r.PostingRoles = strings.Join(roles, ",")
+	return nil
+}
+
+// postingRoles returns the roles occurrences are checked against.
+func (r *RecurringEntry) postingRoles() []string {
+	if r.PostingRoles == "" {
+		return nil
+	}
+	return strings.Split(r.PostingRoles, ",")
+}
+
+// postNextOccurrence posts the template's next due occurrence, or queues it
+// for approval, records it and moves NextRunDate on, all in one
+// transaction. It returns the date handled, or nil when nothing is due, and
+// whether it was queued. The template row is locked with SKIP LOCKED so two
+// instances of the service never post the same occurrence.
+func postNextOccurrence(db *gorm.DB, templateID uuid.UUID, today time.Time, actor AuditActor) (*time.Time, bool, error) {
+	var posted *time.Time
+	var queued bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var template RecurringEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("templateid = ? AND status = ?", templateID, RecurringStatusActive).
+			First(&template).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errRecurringBusy
+		}
+		if err != nil {
+			return err
+		}
+		if template.NextRunDate == nil || template.NextRunDate.After(today) {
+			return nil
+		}
+
+		// the rules are read for every occurrence, so a rule or threshold
+		// added after the template was created applies to it too
+		queued, err = requiresApproval(tx, template.postingRoles(), template.DebitAccount, template.CreditAccount, template.Amount)
+		if err != nil {
+			return err
+		}
+
+		occurrence := utcDate(*template.NextRunDate)
+		entry := JournalEntry{
+			AccountDebitNumber:  template.DebitAccount,
+			AccountCreditNumber: template.CreditAccount,
+			Amount:              template.Amount,
+			Description:         template.Description,
+			Date:                occurrence,
+			TransactionType:     template.TransactionType,
+			CreatedBy:           template.CreatedBy,
+		}
+		action := AuditActionPost
+		if queued {
+			entry.Status = JournalStatusPending
+			action = AuditActionSubmit
+			if err = tx.Omit(clause.Associations).Create(&entry).Error; err == nil {
+				recordQueued(tx)
+			}
+		} else {
+			err = postJournalEntry(tx, &entry)
+		}
+		if err != nil {
+			return err
+		}
+		if err := recordAudit(tx, actor, AuditEvent{
+			Action:     action,
+			EntityType: "journalentry",
+			EntityID:   entry.TransactionID.String(),
+			After:      entry,
+		}); err != nil {
+			return err
+		}
+		// a queued occurrence is charged when it is approved
+		if !queued {
+			if _, err := applyPostingCharges(tx, &entry, actor); err != nil {
+				return err
+			}
+		}
+		record := RecurringPosting{
+			TemplateID:     template.TemplateID,
+			OccurrenceDate: occurrence,
+			TransactionID:  entry.TransactionID,
+			PostedAt:       time.Now(),
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"nextrundate": nil, "lasterror": ""}
+		if next := template.occurrenceOnOrAfter(occurrence.AddDate(0, 0, 1)); next != nil {
+			updates["nextrundate"] = *next
+		} else {
+			updates["status"] = RecurringStatusCompleted
+		}
+		if err := tx.Model(&RecurringEntry{}).Where("templateid = ?", template.TemplateID).Updates(updates).Error; err != nil {
+			return err
+		}
+		posted = &occurrence
+		return nil
+	})
+	return posted, queued, err
+}
+
+// postDueRecurringEntries posts every occurrence that has fallen due up to
+// today, oldest first, so occurrences missed while the service was down are
+// caught up with their own dates. A template whose posting fails keeps its
+// next run date and the error, and is retried on the next run.
+func postDueRecurringEntries(db *gorm.DB, logger *slog.Logger, actor AuditActor) (*RecurringRunReport, error) {
+	today := utcDate(time.Now())
+	report := &RecurringRunReport{RunAt: time.Now(), Entries: []RecurringRun{}}
+
+	var templates []RecurringEntry
+	err := db.Where("status = ? AND nextrundate <= ?", RecurringStatusActive, today).Order("nextrundate, name").Find(&templates).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to find due recurring entries: %v", err)
+	}
+
+	for _, template := range templates {
+		run := RecurringRun{TemplateID: template.TemplateID, Name: template.Name, Posted: []time.Time{}}
+		for {
+			posted, queued, err := postNextOccurrence(db, template.TemplateID, today, actor)
+			if errors.Is(err, errRecurringBusy) {
+				break
+			}
+			if err != nil {
+				run.Error = err.Error()
+				err = db.Model(&RecurringEntry{}).Where("templateid = ?", template.TemplateID).Update("lasterror", run.Error).Error
+				if err != nil {
+					logger.Error("failed to record recurring entry error", "template", template.Name, "error", err)
+				}
+				break
+			}
+			if posted == nil {
+				break
+			}
+			if queued {
+				run.Queued = append(run.Queued, *posted)
+			} else {
+				run.Posted = append(run.Posted, *posted)
+			}
+		}
+		report.Posted += len(run.Posted)
+		report.Queued += len(run.Queued)
+		if len(run.Posted) > 0 || len(run.Queued) > 0 || run.Error != "" {
+			report.Entries = append(report.Entries, run)
+		}
+	}
+	return report, nil
+}
+
+// runRecurringEntries posts due recurring entries every interval until ctx
+// is done.
+func runRecurringEntries(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	actor := AuditActor{UserID: "system", Method: "JOB", Endpoint: "recurring-entries"}
+	logger = logger.With("job", actor.Endpoint)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := postDueRecurringEntries(db, logger, actor)
+			if err != nil {
+				logger.Error("recurring entries failed", "error", err)
+				continue
+			}
+			for _, run := range report.Entries {
+				if run.Error != "" {
+					logger.Warn("recurring entry not posted", "template", run.Name, "error", run.Error)
+				}
+			}
+		}
+	}
+}
+
+func RecurringRunHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := postDueRecurringEntries(db, loggerFrom(c), auditActor(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: fmt.Sprintf("%d recurring entries posted", report.Posted), StatusCode: http.StatusOK, Data: report})
+	}
+}
+
+func CreateRecurringEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			Name            string `json:"name"`
+			DebitAccount    int    `json:"debit_account"`
+			CreditAccount   int    `json:"credit_account"`
+			Amount          int    `json:"amount"`
+			Description     string `json:"description"`
+			TransactionType string `json:"transaction_type"`
+			Schedule        string `json:"schedule"`
+			DayOfMonth      int    `json:"day_of_month"`
+			IntervalMonths  int    `json:"interval_months"`
+			StartDate       string `json:"start_date"`
+			EndDate         string `json:"end_date"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+		if data.IntervalMonths == 0 {
+			data.IntervalMonths = 1
+		}
+
+		var problems []string
+		if data.Name == "" {
+			problems = append(problems, "name is required")
+		}
+		if data.Amount <= 0 {
+			problems = append(problems, "amount must be positive")
+		}
+		if data.DebitAccount == data.CreditAccount {
+			problems = append(problems, "debit_account and credit_account must differ")
+		}
+		if data.TransactionType == TransactionTypeFee {
+			problems = append(problems, "transaction_type fee is reserved for fee entries")
+		}
+		for _, account := range []struct {
+			field  string
+			number int
+		}{{"debit_account", data.DebitAccount}, {"credit_account", data.CreditAccount}} {
+			if _, err := getAccountNumber(db, account.number); err != nil {
+				problems = append(problems, "Invalid "+account.field)
+			} else if err := checkNotControlAccount(db, account.number); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		switch data.Schedule {
+		case ScheduleDayOfMonth:
+			if data.DayOfMonth < 1 || data.DayOfMonth > 31 {
+				problems = append(problems, "day_of_month must be between 1 and 31")
+			}
+		case ScheduleLastBusinessDay:
+			data.DayOfMonth = 0
+		default:
+			problems = append(problems, fmt.Sprintf("schedule must be %s or %s", ScheduleDayOfMonth, ScheduleLastBusinessDay))
+		}
+		if data.IntervalMonths < 0 {
+			problems = append(problems, "interval_months must be positive")
+		}
+		startDate, err := time.Parse("2006-01-02", data.StartDate)
+		if err != nil {
+			problems = append(problems, "start_date is required as YYYY-MM-DD")
+		}
+		var endDate *time.Time
+		if data.EndDate != "" {
+			parsed, err := time.Parse("2006-01-02", data.EndDate)
+			if err != nil {
+				problems = append(problems, "Invalid end_date format")
+			} else if parsed.Before(startDate) {
+				problems = append(problems, "end_date cannot be before start_date")
+			} else {
+				endDate = &parsed
+			}
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		template := RecurringEntry{
+			Name:            data.Name,
+			DebitAccount:    data.DebitAccount,
+			CreditAccount:   data.CreditAccount,
+			Amount:          data.Amount,
+			Description:     data.Description,
+			TransactionType: data.TransactionType,
+			Schedule:        data.Schedule,
+			DayOfMonth:      data.DayOfMonth,
+			IntervalMonths:  data.IntervalMonths,
+			StartDate:       startDate,
+			EndDate:         endDate,
+			Status:          RecurringStatusActive,
+			CreatedBy:       c.GetString("userID"),
+		}
+		template.NextRunDate = template.occurrenceOnOrAfter(startDate)
+		if template.NextRunDate == nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "The schedule has no occurrence before end_date", StatusCode: http.StatusBadRequest})
+			return
+		}
+		if err := template.applyPostingRules(c.GetStringSlice("roles")); err != nil {
+			respondRecurringError(c, err)
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&template).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "recurringentry",
+				EntityID:   template.TemplateID.String(),
+				After:      template,
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Recurring entry created successfully", StatusCode: http.StatusCreated, Data: template})
+	}
+}
+
+func ListRecurringEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Order("name")
+		if status := c.Query("status"); status != "" {
+			query = query.Where("status = ?", status)
+		}
+
+		templates := []RecurringEntry{}
+		if err := query.Find(&templates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Recurring Entry List", StatusCode: http.StatusOK, Data: templates})
+	}
+}
+
+// GetRecurringEntryHandler returns a template with the occurrences posted so
+// far.
+func GetRecurringEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid recurring entry ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var template RecurringEntry
+		if err := db.Where("templateid = ?", templateID).First(&template).Error; err != nil {
+			respondNotFoundOr500(c, err, "Recurring entry not found")
+			return
+		}
+		postings := []RecurringPosting{}
+		if err := db.Where("templateid = ?", templateID).Order("occurrencedate").Find(&postings).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Recurring Entry", StatusCode: http.StatusOK,
+			Data: gin.H{"template": template, "postings": postings}})
+	}
+}
+
+// resumeDate is where a paused template picks up again: occurrences that
+// fell due while it was paused are skipped, not caught up.
+func (r RecurringEntry) resumeDate(today time.Time) *time.Time {
+	from := today
+	if r.NextRunDate != nil && r.NextRunDate.After(today) {
+		from = utcDate(*r.NextRunDate)
+	}
+	return r.occurrenceOnOrAfter(from)
+}
+
+// PreviewRecurringEntryHandler lists the next count occurrences without
+// posting anything. A paused template shows what resuming it today would
+// post.
+func PreviewRecurringEntryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid recurring entry ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		count := defaultPreviewCount
+		if value := c.Query("count"); value != "" {
+			count, err = strconv.Atoi(value)
+			if err != nil || count < 1 || count > maxPreviewCount {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("count must be between 1 and %d", maxPreviewCount), StatusCode: http.StatusBadRequest})
+				return
+			}
+		}
+
+		var template RecurringEntry
+		if err := db.Where("templateid = ?", templateID).First(&template).Error; err != nil {
+			respondNotFoundOr500(c, err, "Recurring entry not found")
+			return
+		}
+
+		next := template.NextRunDate
+		if template.Status == RecurringStatusPaused {
+			next = template.resumeDate(utcDate(time.Now()))
+		}
+		occurrences := []gin.H{}
+		for next != nil && len(occurrences) < count {
+			occurrences = append(occurrences, gin.H{
+				"date":           *next,
+				"debit_account":  template.DebitAccount,
+				"credit_account": template.CreditAccount,
+				"amount":         template.Amount,
+				"description":    template.Description,
+			})
+			next = template.occurrenceOnOrAfter(next.AddDate(0, 0, 1))
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Upcoming Occurrences", StatusCode: http.StatusOK, Data: occurrences})
+	}
+}
+
+// SetRecurringStatusHandler pauses or resumes a template.
+func SetRecurringStatusHandler(db *gorm.DB, status string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templateID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid recurring entry ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var template RecurringEntry
+		err = db.Transaction(func(tx *gorm.DB) error {
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("templateid = ?", templateID).First(&template).Error
+			if err != nil {
+				return err
+			}
+
+			before := template
+			switch {
+			case status == RecurringStatusPaused && template.Status == RecurringStatusActive:
+				template.Status = RecurringStatusPaused
+			case status == RecurringStatusActive && template.Status == RecurringStatusPaused:
+				if err := template.applyPostingRules(c.GetStringSlice("roles")); err != nil {
+					return err
+				}
+				template.Status = RecurringStatusActive
+				template.NextRunDate = template.resumeDate(utcDate(time.Now()))
+				if template.NextRunDate == nil {
+					template.Status = RecurringStatusCompleted
+				}
+			default:
+				return errRecurringState(fmt.Sprintf("Recurring entry is %s", template.Status))
+			}
+
+			err = tx.Model(&RecurringEntry{}).Where("templateid = ?", templateID).Updates(map[string]interface{}{
+				"status":           template.Status,
+				"nextrundate":      template.NextRunDate,
+				"postingroles":     template.PostingRoles,
+			}).Error
+			if err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "recurringentry",
+				EntityID:   templateID.String(),
+				Before:     before,
+				After:      template,
+			})
+		})
+		if err != nil {
+			respondRecurringError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Recurring entry " + template.Status, StatusCode: http.StatusOK, Data: template})
+	}
+}
+
+func respondRecurringError(c *gin.Context, err error) {
+	var state errRecurringState
+	var overLimit *PostingLimitError
+	switch {
+	case errors.As(err, &state):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+	case errors.As(err, &overLimit):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error(), StatusCode: http.StatusForbidden})
+	default:
+		respondNotFoundOr500(c, err, "Recurring entry not found")
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOccurrenceOnOrAfter(t *testing.T) {
+	end := date(2024, 6, 30)
+	for _, tc := range []struct {
+		name     string
+		template RecurringEntry
+		from     time.Time
+		want     string
+	}{
+		{
+			name:     "day of month",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 15, IntervalMonths: 1, StartDate: date(2024, 1, 1)},
+			from:     date(2024, 3, 15),
+			want:     "2024-03-15",
+		},
+		{
+			name:     "day already passed this month",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 15, IntervalMonths: 1, StartDate: date(2024, 1, 20)},
+			from:     date(2024, 1, 1),
+			want:     "2024-02-15",
+		},
+		{
+			name:     "clamped to the end of a short month",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 31, IntervalMonths: 1, StartDate: date(2024, 1, 1)},
+			from:     date(2024, 2, 1),
+			want:     "2024-02-29",
+		},
+		{
+			name:     "last business day skips a weekend",
+			template: RecurringEntry{Schedule: ScheduleLastBusinessDay, IntervalMonths: 1, StartDate: date(2024, 1, 1)},
+			from:     date(2024, 3, 1),
+			want:     "2024-03-29",
+		},
+		{
+			name:     "every third month counts from the start month",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 1, IntervalMonths: 3, StartDate: date(2024, 1, 1)},
+			from:     date(2024, 2, 2),
+			want:     "2024-04-01",
+		},
+		{
+			name:     "last occurrence on the end date",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 30, IntervalMonths: 1, StartDate: date(2024, 1, 1), EndDate: &end},
+			from:     date(2024, 6, 1),
+			want:     "2024-06-30",
+		},
+		{
+			name:     "nothing after the end date",
+			template: RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 1, IntervalMonths: 1, StartDate: date(2024, 1, 1), EndDate: &end},
+			from:     date(2024, 7, 1),
+			want:     "",
+		},
+	} {
+		got := ""
+		if next := tc.template.occurrenceOnOrAfter(tc.from); next != nil {
+			got = next.Format("2006-01-02")
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestResumeDateSkipsMissedOccurrences(t *testing.T) {
+	missed := date(2024, 2, 1)
+	template := RecurringEntry{Schedule: ScheduleDayOfMonth, DayOfMonth: 1, IntervalMonths: 1, StartDate: date(2024, 1, 1), NextRunDate: &missed}
+	next := template.resumeDate(date(2024, 4, 10))
+	if next == nil || !next.Equal(date(2024, 5, 1)) {
+		t.Errorf("got %v, want 2024-05-01", next)
+	}
+}
+
+func TestApplyPostingRulesKeepsRoles(t *testing.T) {
+	t.Setenv("TELLER_POSTING_LIMIT", "1000")
+
+	template := RecurringEntry{Amount: 1000}
+	if err := template.applyPostingRules([]string{RoleTeller, RoleViewer}); err != nil {
+		t.Fatal(err)
+	}
+	if got := template.postingRoles(); len(got) != 2 || got[0] != RoleTeller || got[1] != RoleViewer {
+		t.Errorf("got posting roles %v, want [teller viewer]", got)
+	}
+	if got := (&RecurringEntry{}).postingRoles(); got != nil {
+		t.Errorf("template without roles got %v, want none", got)
+	}
+
+	template.Amount = 1001
+	if err := template.applyPostingRules([]string{RoleTeller}); err == nil {
+		t.Error("amount over the posting limit was accepted")
+	}
+}
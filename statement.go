@@ -0,0 +1,553 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bank statements arrive as SWIFT MT940, ISO 20022 camt.053 or OFX. Each
+// parser turns a file into ParsedStatements with amounts in minor units,
+// positive for money into the bank account and negative for money out, the
+// same way round as the ledger, where a credit adds to a balance.
+
+const (
+	StatementFormatMT940   = "mt940"
+	StatementFormatCAMT053 = "camt053"
+	StatementFormatOFX     = "ofx"
+)
+
+type ParsedStatement struct {
+	Reference      string
+	BankAccount    string
+	Currency       string
+	OpeningBalance int
+	ClosingBalance int
+	FromDate       time.Time
+	ToDate         time.Time
+	Lines          []ParsedStatementLine
+}
+
+type ParsedStatementLine struct {
+	ValueDate   time.Time
+	BookingDate time.Time
+	Amount      int
+	// Reference is the payer's or our own reference, BankReference the
+	// bank's unique id for the line, used to skip lines imported before.
+	Reference     string
+	BankReference string
+	Description   string
+}
+
+// detectStatementFormat guesses the format from the first few kilobytes.
+func detectStatementFormat(content []byte) (string, error) {
+	head := string(content[:min(len(content), 4096)])
+	switch {
+	case strings.Contains(head, "OFXHEADER") || strings.Contains(strings.ToUpper(head), "<OFX>"):
+		return StatementFormatOFX, nil
+	case strings.Contains(head, "BkToCstmrStmt"):
+		return StatementFormatCAMT053, nil
+	case strings.Contains(head, ":20:") && (strings.Contains(head, ":60F:") || strings.Contains(head, ":60M:")):
+		return StatementFormatMT940, nil
+	}
+	return "", errors.New("unrecognised statement format, expected MT940, camt.053 or OFX")
+}
+
+func parseStatements(format string, content []byte) ([]ParsedStatement, error) {
+	var statements []ParsedStatement
+	var err error
+	switch format {
+	case StatementFormatMT940:
+		statements, err = parseMT940(content)
+	case StatementFormatCAMT053:
+		statements, err = parseCAMT053(content)
+	case StatementFormatOFX:
+		statements, err = parseOFX(content)
+	default:
+		return nil, fmt.Errorf("format must be %s, %s or %s", StatementFormatMT940, StatementFormatCAMT053, StatementFormatOFX)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, errors.New("file holds no statements")
+	}
+	return statements, nil
+}
+
+// parseStatementAmount reads a decimal amount with a point or comma and at
+// most two decimals into minor units.
+func parseStatementAmount(value string) (int, error) {
+	value = strings.TrimSpace(strings.Replace(value, ",", ".", 1))
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(strings.TrimPrefix(value, "-"), "+")
+	whole, fraction, _ := strings.Cut(value, ".")
+	if len(fraction) > 2 {
+		return 0, fmt.Errorf("amount %q has more than two decimals", value)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+	if whole == "" {
+		whole = "0"
+	}
+	amount, err := strconv.Atoi(whole + fraction)
+	if err != nil || amount < 0 {
+		return 0, fmt.Errorf("invalid amount %q", value)
+	}
+	if negative {
+		amount = -amount
+	}
+	return amount, nil
+}
+
+// MT940
+
+var (
+	mt940Tag  = regexp.MustCompile(`^:(\d{2}[A-Z]?):`)
+	mt940Line = regexp.MustCompile(`^(\d{6})(\d{4})?(R?[CD])[A-Z]?([\d,]+)[NSF][A-Z0-9]{3}([^/]*)(?://(.*))?$`)
+	// balance as C or D, YYMMDD, currency and amount
+	mt940Balance = regexp.MustCompile(`^([CD])(\d{6})([A-Z]{3})([\d,]+)$`)
+)
+
+type mt940Field struct {
+	tag   string
+	value string
+}
+
+func parseMT940Date(value string) (time.Time, error) {
+	return time.Parse("060102", value)
+}
+
+func parseMT940Balance(value string) (int, time.Time, string, error) {
+	match := mt940Balance.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, time.Time{}, "", fmt.Errorf("invalid MT940 balance %q", value)
+	}
+	date, err := parseMT940Date(match[2])
+	if err != nil {
+		return 0, time.Time{}, "", fmt.Errorf("invalid MT940 balance date %q", match[2])
+	}
+	amount, err := parseStatementAmount(match[4])
+	if err != nil {
+		return 0, time.Time{}, "", err
+	}
+	if match[1] == "D" {
+		amount = -amount
+	}
+	return amount, date, match[3], nil
+}
+
+// parseMT940 reads the fields of each statement, from :20: to :62F: or
+// :62M:. SWIFT envelope blocks around the text are ignored.
+func parseMT940(content []byte) ([]ParsedStatement, error) {
+	var fields []mt940Field
+	for _, raw := range strings.Split(strings.ReplaceAll(string(content), "\r\n", "\n"), "\n") {
+		line := strings.TrimRight(raw, " \r")
+		if match := mt940Tag.FindStringSubmatch(line); match != nil {
+			fields = append(fields, mt940Field{tag: match[1], value: line[len(match[0]):]})
+			continue
+		}
+		// anything outside a field is envelope or a block terminator
+		if len(fields) == 0 || line == "-" || strings.HasPrefix(line, "-}") || strings.HasPrefix(line, "{") {
+			continue
+		}
+		fields[len(fields)-1].value += "\n" + line
+	}
+
+	var statements []ParsedStatement
+	var current *ParsedStatement
+	for _, field := range fields {
+		if field.tag == "20" {
+			statements = append(statements, ParsedStatement{Reference: strings.TrimSpace(field.value)})
+			current = &statements[len(statements)-1]
+			continue
+		}
+		if current == nil {
+			return nil, fmt.Errorf("MT940 field :%s: before :20:", field.tag)
+		}
+		switch field.tag {
+		case "25":
+			current.BankAccount = strings.TrimSpace(field.value)
+		case "60F", "60M":
+			amount, date, currency, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, err
+			}
+			current.OpeningBalance, current.FromDate, current.Currency = amount, date, currency
+		case "62F", "62M":
+			amount, date, _, err := parseMT940Balance(field.value)
+			if err != nil {
+				return nil, err
+			}
+			current.ClosingBalance, current.ToDate = amount, date
+		case "61":
+			line, err := parseMT940Line(field.value)
+			if err != nil {
+				return nil, err
+			}
+			current.Lines = append(current.Lines, line)
+		case "86":
+			if len(current.Lines) > 0 {
+				current.Lines[len(current.Lines)-1].Description = strings.Join(strings.Fields(field.value), " ")
+			}
+		}
+	}
+	for i := range statements {
+		if statements[i].FromDate.IsZero() || statements[i].ToDate.IsZero() {
+			return nil, fmt.Errorf("MT940 statement %s has no opening or closing balance", statements[i].Reference)
+		}
+	}
+	return statements, nil
+}
+
+// parseMT940Line reads a :61: field: value date, optional entry date, mark,
+// amount, transaction type, customer reference, //bank reference, and a
+// supplementary line.
+func parseMT940Line(value string) (ParsedStatementLine, error) {
+	first, supplementary, _ := strings.Cut(value, "\n")
+	match := mt940Line.FindStringSubmatch(strings.TrimSpace(first))
+	if match == nil {
+		return ParsedStatementLine{}, fmt.Errorf("invalid MT940 statement line %q", first)
+	}
+	valueDate, err := parseMT940Date(match[1])
+	if err != nil {
+		return ParsedStatementLine{}, fmt.Errorf("invalid MT940 value date %q", match[1])
+	}
+	bookingDate := valueDate
+	if match[2] != "" {
+		entry, err := time.Parse("0102", match[2])
+		if err != nil {
+			return ParsedStatementLine{}, fmt.Errorf("invalid MT940 entry date %q", match[2])
+		}
+		// the entry date has no year and can fall either side of a year end
+		bookingDate = time.Date(valueDate.Year(), entry.Month(), entry.Day(), 0, 0, 0, 0, time.UTC)
+		if bookingDate.Sub(valueDate) > 180*24*time.Hour {
+			bookingDate = bookingDate.AddDate(-1, 0, 0)
+		} else if valueDate.Sub(bookingDate) > 180*24*time.Hour {
+			bookingDate = bookingDate.AddDate(1, 0, 0)
+		}
+	}
+	amount, err := parseStatementAmount(match[4])
+	if err != nil {
+		return ParsedStatementLine{}, err
+	}
+	// D and RC take money out; C and RD, a reversed debit, put it back
+	if match[3] == "D" || match[3] == "RC" {
+		amount = -amount
+	}
+	reference := strings.TrimSpace(match[5])
+	if reference == "NONREF" {
+		reference = ""
+	}
+	return ParsedStatementLine{
+		ValueDate:     valueDate,
+		BookingDate:   bookingDate,
+		Amount:        amount,
+		Reference:     reference,
+		BankReference: strings.TrimSpace(match[6]),
+		Description:   strings.TrimSpace(supplementary),
+	}, nil
+}
+
+// camt.053
+
+type camtAmount struct {
+	Value    string `xml:",chardata"`
+	Currency string `xml:"Ccy,attr"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) parse() (time.Time, error) {
+	if d.Date != "" {
+		return time.Parse("2006-01-02", d.Date)
+	}
+	if len(d.DateTime) >= 10 {
+		return time.Parse("2006-01-02", d.DateTime[:10])
+	}
+	return time.Time{}, errors.New("missing date")
+}
+
+type camtDocument struct {
+	Statements []struct {
+		ID      string `xml:"Id"`
+		Account struct {
+			IBAN     string `xml:"Id>IBAN"`
+			Other    string `xml:"Id>Othr>Id"`
+			Currency string `xml:"Ccy"`
+		} `xml:"Acct"`
+		Period struct {
+			From string `xml:"FrDtTm"`
+			To   string `xml:"ToDtTm"`
+		} `xml:"FrToDt"`
+		Balances []struct {
+			Code      string     `xml:"Tp>CdOrPrtry>Cd"`
+			Amount    camtAmount `xml:"Amt"`
+			Indicator string     `xml:"CdtDbtInd"`
+			Date      camtDate   `xml:"Dt"`
+		} `xml:"Bal"`
+		Entries []struct {
+			Amount          camtAmount `xml:"Amt"`
+			Indicator       string     `xml:"CdtDbtInd"`
+			Reversal        bool       `xml:"RvslInd"`
+			BookingDate     camtDate   `xml:"BookgDt"`
+			ValueDate       camtDate   `xml:"ValDt"`
+			ServicerRef     string     `xml:"AcctSvcrRef"`
+			AdditionalInfo  string     `xml:"AddtlNtryInf"`
+			EndToEndID      string     `xml:"NtryDtls>TxDtls>Refs>EndToEndId"`
+			RemittanceInfo  []string   `xml:"NtryDtls>TxDtls>RmtInf>Ustrd"`
+			CreditorRef     string     `xml:"NtryDtls>TxDtls>RmtInf>Strd>CdtrRefInf>Ref"`
+			TransactionInfo string     `xml:"NtryDtls>TxDtls>AddtlTxInf"`
+		} `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+func camtSigned(amount camtAmount, indicator string) (int, error) {
+	value, err := parseStatementAmount(amount.Value)
+	if err != nil {
+		return 0, err
+	}
+	if indicator == "DBIT" {
+		value = -value
+	}
+	return value, nil
+}
+
+// parseCAMT053 reads every Stmt of a BkToCstmrStmt document. Element names
+// are matched without their namespace, so any camt.053 version is read.
+func parseCAMT053(content []byte) ([]ParsedStatement, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid camt.053 document: %v", err)
+	}
+
+	var statements []ParsedStatement
+	for _, stmt := range document.Statements {
+		statement := ParsedStatement{Reference: stmt.ID, BankAccount: stmt.Account.IBAN, Currency: stmt.Account.Currency}
+		if statement.BankAccount == "" {
+			statement.BankAccount = stmt.Account.Other
+		}
+		if len(stmt.Period.From) >= 10 {
+			statement.FromDate, _ = time.Parse("2006-01-02", stmt.Period.From[:10])
+		}
+		if len(stmt.Period.To) >= 10 {
+			statement.ToDate, _ = time.Parse("2006-01-02", stmt.Period.To[:10])
+		}
+
+		opening, closing := false, false
+		for _, balance := range stmt.Balances {
+			amount, err := camtSigned(balance.Amount, balance.Indicator)
+			if err != nil {
+				return nil, err
+			}
+			date, _ := balance.Date.parse()
+			if statement.Currency == "" {
+				statement.Currency = balance.Amount.Currency
+			}
+			switch balance.Code {
+			case "OPBD", "PRCD":
+				statement.OpeningBalance, opening = amount, true
+				if statement.FromDate.IsZero() {
+					statement.FromDate = date
+				}
+			case "CLBD":
+				statement.ClosingBalance, closing = amount, true
+				if statement.ToDate.IsZero() {
+					statement.ToDate = date
+				}
+			}
+		}
+
+		for _, entry := range stmt.Entries {
+			amount, err := camtSigned(entry.Amount, entry.Indicator)
+			if err != nil {
+				return nil, err
+			}
+			if entry.Reversal {
+				amount = -amount
+			}
+			line := ParsedStatementLine{Amount: amount, BankReference: entry.ServicerRef}
+			if line.BookingDate, err = entry.BookingDate.parse(); err != nil {
+				return nil, fmt.Errorf("camt.053 entry %s has no booking date", entry.ServicerRef)
+			}
+			if line.ValueDate, err = entry.ValueDate.parse(); err != nil {
+				line.ValueDate = line.BookingDate
+			}
+			line.Reference = entry.CreditorRef
+			if line.Reference == "" && entry.EndToEndID != "NOTPROVIDED" {
+				line.Reference = entry.EndToEndID
+			}
+			line.Description = strings.Join(entry.RemittanceInfo, " ")
+			for _, info := range []string{entry.TransactionInfo, entry.AdditionalInfo} {
+				if line.Description == "" {
+					line.Description = info
+				}
+			}
+			statement.Lines = append(statement.Lines, line)
+		}
+
+		if !opening || !closing {
+			return nil, fmt.Errorf("camt.053 statement %s has no opening or closing balance", stmt.ID)
+		}
+		statement.FromDate, statement.ToDate = statementPeriod(statement)
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
+
+// statementPeriod fills a missing period from the statement's lines.
+func statementPeriod(statement ParsedStatement) (time.Time, time.Time) {
+	from, to := statement.FromDate, statement.ToDate
+	for _, line := range statement.Lines {
+		if from.IsZero() || line.ValueDate.Before(from) {
+			from = line.ValueDate
+		}
+		if to.IsZero() || line.ValueDate.After(to) {
+			to = line.ValueDate
+		}
+	}
+	return from, to
+}
+
+// OFX
+
+var ofxToken = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// ofxNode is an OFX aggregate. OFX 1.x is SGML, where leaf elements have
+// no closing tag, so the file is read as tags rather than as XML.
+type ofxNode struct {
+	name     string
+	values   map[string]string
+	children []*ofxNode
+}
+
+func (n *ofxNode) find(name string) []*ofxNode {
+	var found []*ofxNode
+	for _, child := range n.children {
+		if child.name == name {
+			found = append(found, child)
+		}
+		found = append(found, child.find(name)...)
+	}
+	return found
+}
+
+func (n *ofxNode) first(name string) *ofxNode {
+	if found := n.find(name); len(found) > 0 {
+		return found[0]
+	}
+	return &ofxNode{values: map[string]string{}}
+}
+
+func parseOFXTree(content []byte) *ofxNode {
+	root := &ofxNode{name: "ROOT", values: map[string]string{}}
+	stack := []*ofxNode{root}
+	for _, match := range ofxToken.FindAllStringSubmatch(string(content), -1) {
+		closing, name, value := match[1] == "/", strings.ToUpper(match[2]), strings.TrimSpace(match[3])
+		top := stack[len(stack)-1]
+		switch {
+		case closing:
+			// the closing tag of a leaf, as in OFX 2, closes nothing
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].name == name {
+					stack = stack[:i]
+					break
+				}
+			}
+		case value != "":
+			top.values[name] = value
+		default:
+			node := &ofxNode{name: name, values: map[string]string{}}
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+		}
+	}
+	return root
+}
+
+// parseOFXDate reads YYYYMMDD, ignoring any time and zone after it.
+func parseOFXDate(value string) (time.Time, error) {
+	if len(value) < 8 {
+		return time.Time{}, fmt.Errorf("invalid OFX date %q", value)
+	}
+	return time.Parse("20060102", value[:8])
+}
+
+// parseOFX reads each STMTRS, or CCSTMTRS for a card account. OFX gives only
+// the closing balance, so the opening balance is worked back from the lines.
+func parseOFX(content []byte) ([]ParsedStatement, error) {
+	root := parseOFXTree(content)
+	responses := append(root.find("STMTRS"), root.find("CCSTMTRS")...)
+
+	var statements []ParsedStatement
+	for _, response := range responses {
+		statement := ParsedStatement{Currency: response.values["CURDEF"]}
+		statement.BankAccount = response.first("BANKACCTFROM").values["ACCTID"]
+		if statement.BankAccount == "" {
+			statement.BankAccount = response.first("CCACCTFROM").values["ACCTID"]
+		}
+
+		list := response.first("BANKTRANLIST")
+		var err error
+		if start := list.values["DTSTART"]; start != "" {
+			if statement.FromDate, err = parseOFXDate(start); err != nil {
+				return nil, err
+			}
+		}
+		if end := list.values["DTEND"]; end != "" {
+			if statement.ToDate, err = parseOFXDate(end); err != nil {
+				return nil, err
+			}
+		}
+
+		total := 0
+		for _, transaction := range list.find("STMTTRN") {
+			line := ParsedStatementLine{BankReference: transaction.values["FITID"]}
+			if line.BookingDate, err = parseOFXDate(transaction.values["DTPOSTED"]); err != nil {
+				return nil, err
+			}
+			line.ValueDate = line.BookingDate
+			if available := transaction.values["DTAVAIL"]; available != "" {
+				if line.ValueDate, err = parseOFXDate(available); err != nil {
+					return nil, err
+				}
+			}
+			if line.Amount, err = parseStatementAmount(transaction.values["TRNAMT"]); err != nil {
+				return nil, err
+			}
+			for _, key := range []string{"REFNUM", "CHECKNUM"} {
+				if line.Reference == "" {
+					line.Reference = transaction.values[key]
+				}
+			}
+			line.Description = strings.TrimSpace(transaction.values["NAME"] + " " + transaction.values["MEMO"])
+			total += line.Amount
+			statement.Lines = append(statement.Lines, line)
+		}
+
+		balance := response.first("LEDGERBAL")
+		if balance.values["BALAMT"] == "" {
+			return nil, errors.New("OFX statement has no LEDGERBAL")
+		}
+		if statement.ClosingBalance, err = parseStatementAmount(balance.values["BALAMT"]); err != nil {
+			return nil, err
+		}
+		statement.OpeningBalance = statement.ClosingBalance - total
+		if statement.ToDate.IsZero() && balance.values["DTASOF"] != "" {
+			if statement.ToDate, err = parseOFXDate(balance.values["DTASOF"]); err != nil {
+				return nil, err
+			}
+		}
+		statement.FromDate, statement.ToDate = statementPeriod(statement)
+		statement.Reference = fmt.Sprintf("%s-%s", statement.BankAccount, statement.ToDate.Format("20060102"))
+		statements = append(statements, statement)
+	}
+	return statements, nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseStatementAmount(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    int
+		invalid bool
+	}{
+		{value: "100.00", want: 10000},
+		{value: "100,00", want: 10000},
+		{value: "100,5", want: 10050},
+		{value: "100,", want: 10000},
+		{value: ",01", want: 1},
+		{value: "-12.34", want: -1234},
+		{value: "+7", want: 700},
+		{value: " 250.00 ", want: 25000},
+		{value: "1.234", invalid: true},
+		{value: "12,345", invalid: true},
+		{value: "1,234.56", invalid: true},
+		{value: "12a", invalid: true},
+		{value: "--5", invalid: true},
+	} {
+		got, err := parseStatementAmount(tc.value)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%q: got %d, want an error", tc.value, got)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("%q: got %d, %v, want %d", tc.value, got, err, tc.want)
+		}
+	}
+}
+
+func TestParseMT940Line(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		value string
+		want  ParsedStatementLine
+	}{
+		{
+			name:  "credit",
+			value: "2401150115C100,00NTRFINV-42//BANKREF1",
+			want: ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: 10000,
+				Reference: "INV-42", BankReference: "BANKREF1"},
+		},
+		{
+			name:  "debit without entry date",
+			value: "240115D5,5NMSCNONREF",
+			want:  ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: -550},
+		},
+		{
+			name:  "reversal of a credit takes money out",
+			value: "2401150115RC100,00NTRFREF1",
+			want:  ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: -10000, Reference: "REF1"},
+		},
+		{
+			name:  "reversal of a debit puts money back",
+			value: "2401150115RD100,00NTRFREF1",
+			want:  ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: 10000, Reference: "REF1"},
+		},
+		{
+			name:  "funds code after the mark",
+			value: "2401150115CR1,00NTRFREF1",
+			want:  ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: 100, Reference: "REF1"},
+		},
+		{
+			name:  "entry date in the next year",
+			value: "2312310102D5,00NTRFNONREF",
+			want:  ParsedStatementLine{ValueDate: date(2023, 12, 31), BookingDate: date(2024, 1, 2), Amount: -500},
+		},
+		{
+			name:  "entry date in the previous year",
+			value: "2401021231C5,00NTRFNONREF",
+			want:  ParsedStatementLine{ValueDate: date(2024, 1, 2), BookingDate: date(2023, 12, 31), Amount: 500},
+		},
+		{
+			name:  "supplementary details",
+			value: "2401150115C1,00NTRFREF1//B1\nCARD PAYMENT",
+			want: ParsedStatementLine{ValueDate: date(2024, 1, 15), BookingDate: date(2024, 1, 15), Amount: 100,
+				Reference: "REF1", BankReference: "B1", Description: "CARD PAYMENT"},
+		},
+	} {
+		got, err := parseMT940Line(tc.value)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+
+	for _, value := range []string{
+		"2401150115C1,234NTRFREF1",
+		"2401150115X1,00NTRFREF1",
+		"2413150115C1,00NTRFREF1",
+		"2401151315C1,00NTRFREF1",
+		"not a line",
+	} {
+		if got, err := parseMT940Line(value); err == nil {
+			t.Errorf("%q: got %+v, want an error", value, got)
+		}
+	}
+}
+
+const testMT940 = `{1:F01BANKBEBBAXXX0000000000}{2:I940BANKBEBBXXXXN}{4:
+:20:STMT-001
+:25:BE68539007547034
+:28C:1/1
+:60F:C231229EUR1000,00
+:61:2312290102D250,50NTRFNONREF//B1
+:86:RENT
+ JANUARY
+:61:2401020102C100,NMSCINV-42//B2
+:62F:D240102EUR150,50
+-}`
+
+func TestParseMT940(t *testing.T) {
+	statements, err := parseMT940([]byte(testMT940))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParsedStatement{{
+		Reference:      "STMT-001",
+		BankAccount:    "BE68539007547034",
+		Currency:       "EUR",
+		OpeningBalance: 100000,
+		ClosingBalance: -15050,
+		FromDate:       date(2023, 12, 29),
+		ToDate:         date(2024, 1, 2),
+		Lines: []ParsedStatementLine{
+			{ValueDate: date(2023, 12, 29), BookingDate: date(2024, 1, 2), Amount: -25050, BankReference: "B1", Description: "RENT JANUARY"},
+			{ValueDate: date(2024, 1, 2), BookingDate: date(2024, 1, 2), Amount: 10000, Reference: "INV-42", BankReference: "B2"},
+		},
+	}}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %+v, want %+v", statements, want)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"missing opening balance", strings.Replace(testMT940, ":60F:C231229EUR1000,00\n", "", 1)},
+		{"missing closing balance", strings.Replace(testMT940, ":62F:D240102EUR150,50\n", "", 1)},
+		{"balance with three decimals", strings.Replace(testMT940, "1000,00", "1000,001", 1)},
+		{"field before :20:", ":25:BE68539007547034\n" + testMT940},
+	} {
+		if _, err := parseMT940([]byte(tc.content)); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+	}
+}
+
+const testCAMT053 = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt>
+<Stmt>
+  <Id>CAMT-001</Id>
+  <Acct><Id><IBAN>DE89370400440532013000</IBAN></Id><Ccy>EUR</Ccy></Acct>
+  <Bal><Tp><CdOrPrtry><Cd>OPBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">500.00</Amt><CdtDbtInd>CRDT</CdtDbtInd><Dt><Dt>2024-03-01</Dt></Dt></Bal>
+  <Bal><Tp><CdOrPrtry><Cd>CLBD</Cd></CdOrPrtry></Tp><Amt Ccy="EUR">20.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><Dt><Dt>2024-03-05</Dt></Dt></Bal>
+  <Ntry>
+    <Amt Ccy="EUR">120.00</Amt><CdtDbtInd>CRDT</CdtDbtInd>
+    <BookgDt><Dt>2024-03-02</Dt></BookgDt><ValDt><Dt>2024-03-03</Dt></ValDt>
+    <AcctSvcrRef>S1</AcctSvcrRef>
+    <NtryDtls><TxDtls><Refs><EndToEndId>E2E-1</EndToEndId></Refs><RmtInf><Ustrd>INVOICE</Ustrd><Ustrd>42</Ustrd></RmtInf></TxDtls></NtryDtls>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">600,00</Amt><CdtDbtInd>DBIT</CdtDbtInd>
+    <BookgDt><DtTm>2024-03-04T10:00:00</DtTm></BookgDt>
+    <AcctSvcrRef>S2</AcctSvcrRef>
+    <NtryDtls><TxDtls><Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs><RmtInf><Strd><CdtrRefInf><Ref>RF18</Ref></CdtrRefInf></Strd></RmtInf></TxDtls></NtryDtls>
+    <AddtlNtryInf>SUPPLIER</AddtlNtryInf>
+  </Ntry>
+  <Ntry>
+    <Amt Ccy="EUR">40.00</Amt><CdtDbtInd>DBIT</CdtDbtInd><RvslInd>true</RvslInd>
+    <BookgDt><Dt>2024-03-05</Dt></BookgDt>
+    <AcctSvcrRef>S3</AcctSvcrRef>
+    <NtryDtls><TxDtls><Refs><EndToEndId>NOTPROVIDED</EndToEndId></Refs></TxDtls></NtryDtls>
+  </Ntry>
+</Stmt>
+</BkToCstmrStmt>
+</Document>`
+
+func TestParseCAMT053(t *testing.T) {
+	statements, err := parseCAMT053([]byte(testCAMT053))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ParsedStatement{{
+		Reference:      "CAMT-001",
+		BankAccount:    "DE89370400440532013000",
+		Currency:       "EUR",
+		OpeningBalance: 50000,
+		ClosingBalance: -2000,
+		FromDate:       date(2024, 3, 1),
+		ToDate:         date(2024, 3, 5),
+		Lines: []ParsedStatementLine{
+			{ValueDate: date(2024, 3, 3), BookingDate: date(2024, 3, 2), Amount: 12000, Reference: "E2E-1", BankReference: "S1", Description: "INVOICE 42"},
+			{ValueDate: date(2024, 3, 4), BookingDate: date(2024, 3, 4), Amount: -60000, Reference: "RF18", BankReference: "S2", Description: "SUPPLIER"},
+			// a reversed debit puts the money back
+			{ValueDate: date(2024, 3, 5), BookingDate: date(2024, 3, 5), Amount: 4000, BankReference: "S3"},
+		},
+	}}
+	if !reflect.DeepEqual(statements, want) {
+		t.Errorf("got %+v, want %+v", statements, want)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"missing closing balance", strings.Replace(testCAMT053, "<Cd>CLBD</Cd>", "<Cd>ITBD</Cd>", 1)},
+		{"missing opening balance", strings.Replace(testCAMT053, "<Cd>OPBD</Cd>", "<Cd>ITBD</Cd>", 1)},
+		{"amount with three decimals", strings.Replace(testCAMT053, "120.00", "120.001", 1)},
+		{"entry without booking date", strings.Replace(testCAMT053, "<BookgDt><Dt>2024-03-05</Dt></BookgDt>", "", 1)},
+		{"not XML", "BkToCstmrStmt <Stmt>"},
+	} {
+		if _, err := parseCAMT053([]byte(tc.content)); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+	}
+}
+
+// testOFX is OFX 1.x SGML: leaf elements have no closing tags.
+const testOFX = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1>
+<STMTTRNRS>
+<STMTRS>
+<CURDEF>EUR
+<BANKACCTFROM>
+<BANKID>12345
+<ACCTID>987654
+<ACCTTYPE>CHECKING
+</BANKACCTFROM>
+<BANKTRANLIST>
+<DTSTART>20240101
+<DTEND>20240131
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240105120000[0:GMT]
+<TRNAMT>250.00
+<FITID>F1
+<NAME>ACME
+<MEMO>Invoice 42
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CHECK
+<DTPOSTED>20240110
+<DTAVAIL>20240112
+<TRNAMT>-40,5
+<FITID>F2
+<CHECKNUM>1001
+</STMTTRN>
+</BANKTRANLIST>
+<LEDGERBAL>
+<BALAMT>1209.50
+<DTASOF>20240131
+</LEDGERBAL>
+</STMTRS>
+</STMTTRNRS>
+</BANKMSGSRSV1>
+</OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	want := []ParsedStatement{{
+		Reference:      "987654-20240131",
+		BankAccount:    "987654",
+		Currency:       "EUR",
+		OpeningBalance: 100000,
+		ClosingBalance: 120950,
+		FromDate:       date(2024, 1, 1),
+		ToDate:         date(2024, 1, 31),
+		Lines: []ParsedStatementLine{
+			{ValueDate: date(2024, 1, 5), BookingDate: date(2024, 1, 5), Amount: 25000, BankReference: "F1", Description: "ACME Invoice 42"},
+			{ValueDate: date(2024, 1, 12), BookingDate: date(2024, 1, 10), Amount: -4050, Reference: "1001", BankReference: "F2"},
+		},
+	}}
+
+	var noClosingTags []string
+	for _, line := range strings.Split(testOFX, "\n") {
+		if !strings.HasPrefix(line, "</") {
+			noClosingTags = append(noClosingTags, line)
+		}
+	}
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"SGML", testOFX},
+		{"SGML without any closing tags", strings.Join(noClosingTags, "\n")},
+		{"XML", strings.NewReplacer(
+			"<CURDEF>EUR", "<CURDEF>EUR</CURDEF>",
+			"<ACCTID>987654", "<ACCTID>987654</ACCTID>",
+			"<TRNAMT>250.00", "<TRNAMT>250.00</TRNAMT>",
+			"<FITID>F1", "<FITID>F1</FITID>",
+			"<BALAMT>1209.50", "<BALAMT>1209.50</BALAMT>",
+		).Replace(testOFX)},
+	} {
+		statements, err := parseOFX([]byte(tc.content))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(statements, want) {
+			t.Errorf("%s: got %+v, want %+v", tc.name, statements, want)
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		content string
+	}{
+		{"missing ledger balance", strings.Replace(testOFX, "<BALAMT>1209.50", "", 1)},
+		{"amount with three decimals", strings.Replace(testOFX, "<TRNAMT>250.00", "<TRNAMT>250.001", 1)},
+		{"short date", strings.Replace(testOFX, "<DTPOSTED>20240110", "<DTPOSTED>202401", 1)},
+	} {
+		if _, err := parseOFX([]byte(tc.content)); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+	}
+}
+
+func TestDetectStatementFormat(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"MT940", testMT940, StatementFormatMT940},
+		{"camt.053", testCAMT053, StatementFormatCAMT053},
+		{"OFX", testOFX, StatementFormatOFX},
+		{"OFX without a header", "<ofx><STMTRS>", StatementFormatOFX},
+	} {
+		got, err := detectStatementFormat([]byte(tc.content))
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %q, %v, want %q", tc.name, got, err, tc.want)
+		}
+	}
+	if got, err := detectStatementFormat([]byte("date,amount\n2024-01-01,5")); err == nil {
+		t.Errorf("CSV detected as %q", got)
+	}
+}
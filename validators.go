@@ -1,10 +1,11 @@
 package main
 
 import (
-	// "errors"
 	"database/sql"
+	"errors"
 	"fmt"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/google/uuid"
 
@@ -42,8 +43,6 @@ func ReturnAccount(db *gorm.DB, accountID uuid.UUID) (ChartOfAccount, error) {
 		return account, err
 	}
 
-	fmt.Println("account", account)
-
 	return account, nil
 }
 
@@ -88,6 +87,12 @@ func getAccountID(db *gorm.DB, accountNumber int) (string, error) {
 }
 
 func processTransaction(db *gorm.DB, debitAccountNumber int, creditAccountNumber int, amount int) error {
+	// the balance rules below assume money moves from debit to credit; a
+	// zero or negative amount would slip past the debit-side floor
+	if amount <= 0 {
+		return errInvalidRequest("Amount must be greater than zero")
+	}
+
 	// Retrieve account IDs
 	debitAccountID, err := getAccountUUID(db, debitAccountNumber)
 	if err != nil {
@@ -98,36 +103,79 @@ func processTransaction(db *gorm.DB, debitAccountNumber int, creditAccountNumber
 		return fmt.Errorf("failed to get credit account ID: %v", err)
 	}
 
-	// Retrieve or create debit account balance
-	debitBalance := AccountBalance{AccountID: debitAccountID}
-	err = db.FirstOrCreate(&debitBalance, AccountBalance{AccountID: debitAccountID}).Error
-	if err != nil {
-		return fmt.Errorf("failed to fetch or create debit account balance: %v", err)
+	if err := checkAccountsPostable(db, debitAccountNumber, creditAccountNumber); err != nil {
+		return err
 	}
 
-	// Retrieve or create credit account balance
-	creditBalance := AccountBalance{AccountID: creditAccountID}
-	err = db.FirstOrCreate(&creditBalance, AccountBalance{AccountID: creditAccountID}).Error
+	// With a positive amount only the debit side loses money, so only it
+	// has a floor
+	debitFloor, err := balanceFloor(db, debitAccountID)
 	if err != nil {
-		return fmt.Errorf("failed to fetch or create credit account balance: %v", err)
+		return fmt.Errorf("failed to get debit account balance rule: %v", err)
+	}
+
+	// Update balances, always in the same account order so that two
+	// postings between the same accounts cannot deadlock
+	changes := []struct {
+		accountID     uuid.UUID
+		accountNumber int
+		amount        int
+		floor         *int
+		side          string
+	}{
+		{debitAccountID, debitAccountNumber, -amount, debitFloor, "debit"},
+		{creditAccountID, creditAccountNumber, amount, nil, "credit"},
+	}
+	if changes[1].accountID.String() < changes[0].accountID.String() {
+		changes[0], changes[1] = changes[1], changes[0]
+	}
+	for _, change := range changes {
+		err = updateAccountBalance(db, change.accountID, change.amount, change.floor)
+		if err != nil {
+			var insufficient *InsufficientFundsError
+			if errors.As(err, &insufficient) {
+				insufficient.AccountNumber = change.accountNumber
+				return insufficient
+			}
+			return fmt.Errorf("failed to update %s account balance: %v", change.side, err)
+		}
 	}
 
-	// Update balances
-	debitBalance.Balance -= amount
-	creditBalance.Balance += amount
+	return updateControlBalances(db, map[uuid.UUID]int{debitAccountID: -amount, creditAccountID: amount})
+}
 
-	// Save updated balances
-	err = db.Save(&debitBalance).Error
-	if err != nil {
-		return fmt.Errorf("failed to update debit account balance: %v", err)
+// postJournalEntry applies entry to the account balances and stores it as
+// posted. It must run inside a transaction so a failed balance update never
+// leaves a half-posted entry behind.
+func postJournalEntry(tx *gorm.DB, entry *JournalEntry) error {
+	if err := checkPeriodOpen(tx, entry.Date); err != nil {
+		postingFailures.WithLabelValues(postingFailureReason(err)).Inc()
+		return err
 	}
 
-	err = db.Save(&creditBalance).Error
+	err := processTransaction(tx, entry.AccountDebitNumber, entry.AccountCreditNumber, entry.Amount)
 	if err != nil {
-		return fmt.Errorf("failed to update credit account balance: %v", err)
+		postingFailures.WithLabelValues(postingFailureReason(err)).Inc()
+		return err
 	}
 
-	return nil
+	entry.Status = JournalStatusPosted
+	if entry.TransactionID == uuid.Nil {
+		err = tx.Omit(clause.Associations).Create(entry).Error
+	} else {
+		err = tx.Omit(clause.Associations).Save(entry).Error
+	}
+	if err != nil {
+		postingFailures.WithLabelValues(postingFailureReason(err)).Inc()
+		return err
+	}
+	if _, system := tx.Get(systemPostingKey); !system {
+		if err := recordAccountActivity(tx, entry.AccountDebitNumber, entry.AccountCreditNumber); err != nil {
+			return err
+		}
+	}
+	recordPosting(tx, entry)
+	return publishEvent(tx, EventJournalPosted, entry.TransactionID.String(), journalEventData(entry))
 }
 
 func getAccountUUID(db *gorm.DB, accountNumber int) (uuid.UUID, error) {
@@ -139,20 +187,59 @@ func getAccountUUID(db *gorm.DB, accountNumber int) (uuid.UUID, error) {
 	return accountExist.AccountID, nil
 }
 
-func updateAccountBalance(db *gorm.DB, accountID uuid.UUID, amount int) error {
+// updateAccountBalance adds amount to the account's balance. When floor is
+// set the new available balance, the ledger balance less active holds, must
+// stay at or above it. The balance row is locked before the holds are read so
+// a concurrent posting or hold cannot slip in between the check and the
+// write.
+func updateAccountBalance(db *gorm.DB, accountID uuid.UUID, amount int, floor *int) error {
+	if floor == nil {
+		// increment in place so concurrent postings never overwrite each other
+		result := db.Model(&AccountBalance{}).Where("accountid = ?", accountID).
+			Update("balance", gorm.Expr("balance + ?", amount))
+		if result.Error != nil {
+			return fmt.Errorf("failed to update account balance: %v", result.Error)
+		}
+		if result.RowsAffected > 0 {
+			return nil
+		}
+		return createAccountBalance(db, accountID, amount)
+	}
+
 	var accountBalance AccountBalance
-	err := db.Where("accountid = ?", accountID).FirstOrCreate(&accountBalance).Error
+	err := db.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("accountid = ?", accountID).
+		Limit(1).
+		Find(&accountBalance).Error
 	if err != nil {
-		return fmt.Errorf("failed to fetch or create account balance: %v", err)
+		return fmt.Errorf("failed to fetch account balance: %v", err)
 	}
 
-	accountBalance.Balance += amount
+	held, err := heldAmount(db, accountID)
+	if err != nil {
+		return err
+	}
+	available := accountBalance.Balance - held - *floor
+	if available+amount < 0 {
+		return &InsufficientFundsError{Available: available, Requested: -amount}
+	}
 
-	err = db.Save(&accountBalance).Error
+	if accountBalance.BalanceID == uuid.Nil {
+		return createAccountBalance(db, accountID, amount)
+	}
+	err = db.Model(&AccountBalance{}).Where("balanceid = ?", accountBalance.BalanceID).
+		Update("balance", gorm.Expr("balance + ?", amount)).Error
 	if err != nil {
 		return fmt.Errorf("failed to update account balance: %v", err)
 	}
+	return nil
+}
 
+func createAccountBalance(db *gorm.DB, accountID uuid.UUID, amount int) error {
+	accountBalance := AccountBalance{AccountID: accountID, Balance: amount}
+	if err := db.Create(&accountBalance).Error; err != nil {
+		return fmt.Errorf("failed to create account balance: %v", err)
+	}
 	return nil
 }
 
@@ -164,11 +251,6 @@ func profitAndLost(db *gorm.DB, date *time.Time) (map[string]interface{}, error)
 		return nil, err
 	}
 
-	fmt.Println("Matching Accounts:")
-	for _, account := range matchingAccounts {
-		fmt.Printf("AccountID: %s, Name: %s, AccountNumber: %d, COAID: %s\n", account.AccountID, account.Name, account.AccountNumber, account.COAID)
-	}
-
 	if len(matchingAccounts) == 0 {
 		return nil, nil
 	}
@@ -183,7 +265,7 @@ func profitAndLost(db *gorm.DB, date *time.Time) (map[string]interface{}, error)
 		var debitTransactions []JournalEntry
 		var creditTransactions []JournalEntry
 
-		debitQuery := db.Where("AccountDebitNumber = ?", account.AccountNumber)
+		debitQuery := db.Where("AccountDebitNumber = ? AND status = ?", account.AccountNumber, JournalStatusPosted)
 		if date != nil {
 			debitQuery = debitQuery.Where("Date BETWEEN ? AND ?", date.Truncate(24*time.Hour), date.AddDate(0, 0, 1).Add(-time.Second))
 		}
@@ -192,7 +274,7 @@ func profitAndLost(db *gorm.DB, date *time.Time) (map[string]interface{}, error)
 			return nil, err
 		}
 
-		creditQuery := db.Where("AccountCreditNumber = ?", account.AccountNumber)
+		creditQuery := db.Where("AccountCreditNumber = ? AND status = ?", account.AccountNumber, JournalStatusPosted)
 		if date != nil {
 			creditQuery = creditQuery.Where("Date BETWEEN ? AND ?", date.Truncate(24*time.Hour), date.AddDate(0, 0, 1).Add(-time.Second))
 		}
@@ -205,16 +287,6 @@ func profitAndLost(db *gorm.DB, date *time.Time) (map[string]interface{}, error)
 		creditBalance := sumTransactionAmounts(creditTransactions)
 		netBalance := abs(debitBalance - creditBalance)
 
-		fmt.Printf("Account: %s\n", account.Name)
-		fmt.Println("Debit Transactions:")
-		for _, transaction := range debitTransactions {
-			fmt.Printf("TransactionID: %s, AccountDebitNumber: %d, AccountCreditNumber: %d, Date: %s, Amount: %d, Description: %s\n", transaction.TransactionID, transaction.AccountDebitNumber, transaction.AccountCreditNumber, transaction.Date, transaction.Amount, transaction.Description)
-		}
-		fmt.Println("Credit Transactions:")
-		for _, transaction := range creditTransactions {
-			fmt.Printf("TransactionID: %s, AccountDebitNumber: %d, AccountCreditNumber: %d, Date: %s, Amount: %d, Description: %s\n", transaction.TransactionID, transaction.AccountDebitNumber, transaction.AccountCreditNumber, transaction.Date, transaction.Amount, transaction.Description)
-		}
-
 		if account.Name == "Expenses" {
 			expenses = append(expenses, map[string]interface{}{
 				"account_name": account.Name,
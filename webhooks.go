@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Webhooks deliver outbox events to subscribed endpoints. The dispatcher
+// first fans each new event out into one delivery per matching
+// subscription, then sends the deliveries that are due. A failed delivery
+// is retried with exponential backoff until WEBHOOK_MAX_ATTEMPTS, after
+// which it is dead-lettered and only sent again when retried by hand.
+//
+// Each request carries X-Ledger-Signature: t=<unix time>,v1=<hex>, where
+// v1 is the HMAC-SHA256 of "<unix time>.<body>" under the subscription's
+// secret.
+
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusDead      = "dead"
+
+	webhookAllEvents = "*"
+
+	defaultWebhookInterval    = 10 * time.Second
+	defaultWebhookTimeout     = 10 * time.Second
+	defaultWebhookMaxAttempts = 10
+	webhookBaseBackoff        = 30 * time.Second
+	webhookMaxBackoff         = time.Hour
+	webhookBatchSize          = 100
+)
+
+type errWebhookState string
+
+func (e errWebhookState) Error() string {
+	return string(e)
+}
+
+func webhookMaxAttempts() int {
+	if attempts, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		return attempts
+	}
+	return defaultWebhookMaxAttempts
+}
+
+// webhookBackoff is the wait after the given number of failed attempts:
+// 30s, 1m, 2m and so on, never more than an hour.
+func webhookBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return webhookBaseBackoff
+	}
+	if attempts > 16 {
+		return webhookMaxBackoff
+	}
+	return min(webhookBaseBackoff<<(attempts-1), webhookMaxBackoff)
+}
+
+func (s WebhookSubscription) eventTypes() []string {
+	return strings.Split(s.Events, ",")
+}
+
+func (s WebhookSubscription) subscribes(eventType string) bool {
+	for _, subscribed := range s.eventTypes() {
+		if subscribed == webhookAllEvents || subscribed == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookSubscriptionResponse leaves the secret out except when it has
+// just been created.
+type WebhookSubscriptionResponse struct {
+	SubscriptionID uuid.UUID `json:"subscriptionid"`
+	URL            string    `json:"url"`
+	Events         []string  `json:"events"`
+	Active         bool      `json:"active"`
+	Secret         string    `json:"secret,omitempty"`
+	CreatedBy      string    `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func webhookResponse(subscription WebhookSubscription) WebhookSubscriptionResponse {
+	return WebhookSubscriptionResponse{
+		SubscriptionID: subscription.SubscriptionID,
+		URL:            subscription.URL,
+		Events:         subscription.eventTypes(),
+		Active:         subscription.Active,
+		CreatedBy:      subscription.CreatedBy,
+		CreatedAt:      subscription.CreatedAt,
+		UpdatedAt:      subscription.UpdatedAt,
+	}
+}
+
+func checkWebhookURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+func checkWebhookEvents(events []string) error {
+	if len(events) == 0 {
+		return errors.New("events must name at least one event type")
+	}
+	for _, event := range events {
+		known := event == webhookAllEvents
+		for _, eventType := range eventTypes {
+			known = known || event == eventType
+		}
+		if !known {
+			return fmt.Errorf("unknown event type %q, expected one of %s or %s", event, strings.Join(eventTypes, ", "), webhookAllEvents)
+		}
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %v", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+// CreateWebhookHandler registers an endpoint. The secret is generated when
+// none is given and is only ever returned in this response.
+func CreateWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var data struct {
+			URL    string   `json:"url"`
+			Events []string `json:"events"`
+			Secret string   `json:"secret"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var problems []string
+		if err := checkWebhookURL(data.URL); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if err := checkWebhookEvents(data.Events); err != nil {
+			problems = append(problems, err.Error())
+		}
+		if data.Secret != "" && len(data.Secret) < 16 {
+			problems = append(problems, "secret must be at least 16 characters")
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+		if data.Secret == "" {
+			secret, err := generateWebhookSecret()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+				return
+			}
+			data.Secret = secret
+		}
+
+		now := time.Now()
+		subscription := WebhookSubscription{
+			URL:       data.URL,
+			Events:    strings.Join(data.Events, ","),
+			Secret:    data.Secret,
+			Active:    true,
+			CreatedBy: c.GetString("userID"),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&subscription).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionCreate,
+				EntityType: "webhooksubscription",
+				EntityID:   subscription.SubscriptionID.String(),
+				After:      webhookResponse(subscription),
+			})
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		response := webhookResponse(subscription)
+		response.Secret = subscription.Secret
+		c.JSON(http.StatusCreated, SuccessResponse{Message: "Webhook created successfully", StatusCode: http.StatusCreated, Data: response})
+	}
+}
+
+func ListWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var subscriptions []WebhookSubscription
+		if err := db.Order("createdat").Find(&subscriptions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		response := make([]WebhookSubscriptionResponse, 0, len(subscriptions))
+		for _, subscription := range subscriptions {
+			response = append(response, webhookResponse(subscription))
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Webhooks", StatusCode: http.StatusOK, Data: response})
+	}
+}
+
+// UpdateWebhookHandler changes the URL, events or active flag; fields left
+// out of the body keep their value. An inactive subscription receives no
+// new events and its pending deliveries wait until it is active again.
+func UpdateWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriptionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+		var data struct {
+			URL    *string  `json:"url"`
+			Events []string `json:"events"`
+			Active *bool    `json:"active"`
+		}
+		if err := c.ShouldBindJSON(&data); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request payload"})
+			return
+		}
+
+		var problems []string
+		if data.URL != nil {
+			if err := checkWebhookURL(*data.URL); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if data.Events != nil {
+			if err := checkWebhookEvents(data.Events); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+		if len(problems) > 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: strings.Join(problems, "; "), StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var subscription WebhookSubscription
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("subscriptionid = ?", subscriptionID).First(&subscription).Error; err != nil {
+				return err
+			}
+			before := webhookResponse(subscription)
+			if data.URL != nil {
+				subscription.URL = *data.URL
+			}
+			if data.Events != nil {
+				subscription.Events = strings.Join(data.Events, ",")
+			}
+			if data.Active != nil {
+				subscription.Active = *data.Active
+			}
+			subscription.UpdatedAt = time.Now()
+			if err := tx.Save(&subscription).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "webhooksubscription",
+				EntityID:   subscription.SubscriptionID.String(),
+				Before:     before,
+				After:      webhookResponse(subscription),
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Webhook not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Webhook updated successfully", StatusCode: http.StatusOK, Data: webhookResponse(subscription)})
+	}
+}
+
+// DeleteWebhookHandler removes a subscription together with its deliveries.
+func DeleteWebhookHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriptionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var subscription WebhookSubscription
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("subscriptionid = ?", subscriptionID).First(&subscription).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&subscription).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionDelete,
+				EntityType: "webhooksubscription",
+				EntityID:   subscription.SubscriptionID.String(),
+				Before:     webhookResponse(subscription),
+			})
+		})
+		if err != nil {
+			respondNotFoundOr500(c, err, "Webhook not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Webhook deleted successfully", StatusCode: http.StatusOK})
+	}
+}
+
+// WebhookDeliveryResponse is a delivery with the event and endpoint it is
+// for.
+type WebhookDeliveryResponse struct {
+	WebhookDelivery `gorm:"embedded"`
+	EventType       string `json:"event_type" gorm:"column:eventtype"`
+	URL             string `json:"url" gorm:"column:url"`
+}
+
+func listWebhookDeliveries(c *gin.Context, query *gorm.DB, message string) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultEventPageSize)))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "limit must be between 1 and 1000", StatusCode: http.StatusBadRequest})
+		return
+	}
+
+	deliveries := []WebhookDeliveryResponse{}
+	err = query.Table("webhookdelivery d").
+		Joins("JOIN outboxevent e ON e.eventid = d.eventid").
+		Joins("JOIN webhooksubscription s ON s.subscriptionid = d.subscriptionid").
+		Select("d.*, e.eventtype, s.url").
+		Order("d.createdat DESC").Limit(limit).Scan(&deliveries).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{Message: message, StatusCode: http.StatusOK, Data: deliveries})
+}
+
+// ListWebhookDeliveryHandler lists a subscription's deliveries, optionally
+// filtered by status.
+func ListWebhookDeliveryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subscriptionID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid webhook ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		query := db.Where("d.subscriptionid = ?", subscriptionID)
+		switch status := c.Query("status"); status {
+		case "":
+		case WebhookStatusPending, WebhookStatusDelivered, WebhookStatusDead:
+			query = query.Where("d.status = ?", status)
+		default:
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid status filter", StatusCode: http.StatusBadRequest})
+			return
+		}
+		listWebhookDeliveries(c, query, "Webhook Deliveries")
+	}
+}
+
+// ListDeadLetterHandler is the dead-letter view across all subscriptions.
+func ListDeadLetterHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		listWebhookDeliveries(c, db.Where("d.status = ?", WebhookStatusDead), "Dead Letters")
+	}
+}
+
+// RetryWebhookDeliveryHandler queues a dead or pending delivery to be sent
+// on the next dispatch, with a fresh set of attempts.
+func RetryWebhookDeliveryHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := uuid.Parse(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid delivery ID", StatusCode: http.StatusBadRequest})
+			return
+		}
+
+		var delivery WebhookDelivery
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("deliveryid = ?", deliveryID).First(&delivery).Error; err != nil {
+				return err
+			}
+			if delivery.Status == WebhookStatusDelivered {
+				return errWebhookState("Delivery has already been delivered")
+			}
+			before := delivery
+			delivery.Status = WebhookStatusPending
+			delivery.Attempts = 0
+			delivery.NextAttemptAt = time.Now()
+			if err := tx.Save(&delivery).Error; err != nil {
+				return err
+			}
+			return recordAudit(tx, auditActor(c), AuditEvent{
+				Action:     AuditActionUpdate,
+				EntityType: "webhookdelivery",
+				EntityID:   delivery.DeliveryID.String(),
+				Before:     before,
+				After:      delivery,
+			})
+		})
+		var conflict errWebhookState
+		if errors.As(err, &conflict) {
+			c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error(), StatusCode: http.StatusConflict})
+			return
+		}
+		if err != nil {
+			respondNotFoundOr500(c, err, "Delivery not found")
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Delivery queued for retry", StatusCode: http.StatusOK, Data: delivery})
+	}
+}
+
+// fanOutEvents creates the deliveries for events not yet fanned out. Only
+// subscriptions active at that moment receive an event.
+func fanOutEvents(db *gorm.DB) (int, error) {
+	var fannedOut int
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var events []OutboxEvent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("fannedoutat IS NULL").Order("sequence").Limit(webhookBatchSize).Find(&events).Error
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		var subscriptions []WebhookSubscription
+		if err := tx.Where("active").Find(&subscriptions).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		eventIDs := make([]uuid.UUID, 0, len(events))
+		for _, event := range events {
+			for _, subscription := range subscriptions {
+				if !subscription.subscribes(event.EventType) {
+					continue
+				}
+				delivery := WebhookDelivery{
+					SubscriptionID: subscription.SubscriptionID,
+					EventID:        event.EventID,
+					Status:         WebhookStatusPending,
+					NextAttemptAt:  now,
+					CreatedAt:      now,
+				}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&delivery).Error; err != nil {
+					return err
+				}
+			}
+			eventIDs = append(eventIDs, event.EventID)
+		}
+		fannedOut = len(eventIDs)
+		return tx.Model(&OutboxEvent{}).Where("eventid IN ?", eventIDs).Update("fannedoutat", now).Error
+	})
+	return fannedOut, err
+}
+
+// signWebhook returns the X-Ledger-Signature value for body.
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// sendWebhook posts the event and returns the response status, or an error
+// when the endpoint could not be reached or did not answer 2xx.
+func sendWebhook(client *http.Client, subscription WebhookSubscription, event OutboxEvent, delivery WebhookDelivery) (int, error) {
+	body, err := json.Marshal(eventResponse(event))
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "ledger-webhooks")
+	request.Header.Set("X-Ledger-Event", event.EventType)
+	request.Header.Set("X-Ledger-Event-ID", event.EventID.String())
+	request.Header.Set("X-Ledger-Delivery", delivery.DeliveryID.String())
+	request.Header.Set("X-Ledger-Signature", signWebhook(subscription.Secret, time.Now().Unix(), body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	excerpt, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("HTTP %d: %s", response.StatusCode, strings.TrimSpace(string(excerpt)))
+	}
+	return response.StatusCode, nil
+}
+
+type WebhookRunReport struct {
+	FannedOut int `json:"fanned_out"`
+	Delivered int `json:"delivered"`
+	Failed    int `json:"failed"`
+	Dead      int `json:"dead"`
+}
+
+// deliverNextWebhook sends one due delivery. The row stays locked while it
+// is sent so no other dispatcher sends it at the same time. It returns
+// false when nothing is due.
+func deliverNextWebhook(db *gorm.DB, client *http.Client, logger *slog.Logger, maxAttempts int, report *WebhookRunReport) (bool, error) {
+	var found bool
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var delivery WebhookDelivery
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND nextattemptat <= ?", WebhookStatusPending, time.Now()).
+			Where("subscriptionid IN (SELECT subscriptionid FROM webhooksubscription WHERE active)").
+			Order("nextattemptat").Limit(1).Find(&delivery).Error
+		if err != nil || delivery.DeliveryID == uuid.Nil {
+			return err
+		}
+		found = true
+
+		var subscription WebhookSubscription
+		if err := tx.Where("subscriptionid = ?", delivery.SubscriptionID).First(&subscription).Error; err != nil {
+			return err
+		}
+		var event OutboxEvent
+		if err := tx.Where("eventid = ?", delivery.EventID).First(&event).Error; err != nil {
+			return err
+		}
+
+		status, sendErr := sendWebhook(client, subscription, event, delivery)
+		now := time.Now()
+		delivery.Attempts++
+		delivery.LastAttemptAt = &now
+		delivery.LastStatus = nil
+		if status != 0 {
+			delivery.LastStatus = &status
+		}
+		switch {
+		case sendErr == nil:
+			delivery.Status = WebhookStatusDelivered
+			delivery.DeliveredAt = &now
+			delivery.LastError = ""
+			report.Delivered++
+		case delivery.Attempts >= maxAttempts:
+			delivery.Status = WebhookStatusDead
+			delivery.LastError = sendErr.Error()
+			report.Dead++
+			logger.Warn("webhook delivery dead-lettered", "delivery_id", delivery.DeliveryID, "url", subscription.URL, "attempts", delivery.Attempts, "error", sendErr)
+		default:
+			delivery.NextAttemptAt = now.Add(webhookBackoff(delivery.Attempts))
+			delivery.LastError = sendErr.Error()
+			report.Failed++
+		}
+		return tx.Save(&delivery).Error
+	})
+	return found, err
+}
+
+// dispatchWebhooks fans out new events and sends up to a batch of due
+// deliveries.
+func dispatchWebhooks(db *gorm.DB, client *http.Client, logger *slog.Logger) (*WebhookRunReport, error) {
+	report := &WebhookRunReport{}
+	fannedOut, err := fanOutEvents(db)
+	if err != nil {
+		return report, err
+	}
+	report.FannedOut = fannedOut
+
+	maxAttempts := webhookMaxAttempts()
+	for i := 0; i < webhookBatchSize; i++ {
+		found, err := deliverNextWebhook(db, client, logger, maxAttempts, report)
+		if err != nil {
+			return report, err
+		}
+		if !found {
+			break
+		}
+	}
+	return report, nil
+}
+
+func webhookClient() *http.Client {
+	return &http.Client{Timeout: envDuration("WEBHOOK_TIMEOUT", defaultWebhookTimeout)}
+}
+
+func runWebhookDispatcher(ctx context.Context, db *gorm.DB, logger *slog.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	client := webhookClient()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := dispatchWebhooks(db, client, logger); err != nil {
+				logger.Error("webhook dispatch failed", "error", err)
+			}
+		}
+	}
+}
+
+func WebhookDispatchHandler(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report, err := dispatchWebhooks(db, webhookClient(), loggerFrom(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error(), StatusCode: http.StatusInternalServerError})
+			return
+		}
+
+		c.JSON(http.StatusOK, SuccessResponse{Message: "Webhooks dispatched", StatusCode: http.StatusOK, Data: report})
+	}
+}
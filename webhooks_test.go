@@ -0,0 +1,111 @@
+package main
+
+import (
+	"database/sql/driver"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// printf '%s' '1700000000.{"event":"journal.posted"}' | openssl dgst -sha256 -hmac whsec_test
+	want := "t=1700000000,v1=9ab5f345871077c9b3fb53d7102c36009e21641206e99bc494c6023b37fe1517"
+	if got := signWebhook("whsec_test", 1700000000, []byte(`{"event":"journal.posted"}`)); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	for _, tc := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, webhookMaxBackoff},
+		{16, webhookMaxBackoff},
+		{17, webhookMaxBackoff},
+		{1000, webhookMaxBackoff},
+	} {
+		if got := webhookBackoff(tc.attempts); got != tc.want {
+			t.Errorf("after %d attempts: got %v, want %v", tc.attempts, got, tc.want)
+		}
+	}
+}
+
+func TestDeliverNextWebhookDeadLetters(t *testing.T) {
+	t.Setenv("WEBHOOK_MAX_ATTEMPTS", "3")
+
+	var signatures []string
+	var bodies [][]byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		signatures = append(signatures, r.Header.Get("X-Ledger-Signature"))
+		bodies = append(bodies, body)
+		http.Error(w, "unavailable", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		attempts int
+		status   string
+	}{
+		{attempts: 1, status: WebhookStatusPending},
+		{attempts: 2, status: WebhookStatusDead},
+	} {
+		db, fake := newFakeDB(t)
+		fake.returns(`FROM "webhookdelivery"`,
+			[]string{"deliveryid", "subscriptionid", "eventid", "status", "attempts", "nextattemptat"},
+			[]driver.Value{"00000000-0000-0000-0000-0000000000d1", "00000000-0000-0000-0000-0000000000a1",
+				"00000000-0000-0000-0000-0000000000e1", WebhookStatusPending, int64(tc.attempts), time.Now().Add(-time.Minute)})
+		fake.returns(`FROM "webhooksubscription"`, []string{"subscriptionid", "url", "secret", "active"},
+			[]driver.Value{"00000000-0000-0000-0000-0000000000a1", server.URL, "whsec_test", true})
+		fake.returns(`FROM "outboxevent"`, []string{"eventid", "sequence", "eventtype", "payload"},
+			[]driver.Value{"00000000-0000-0000-0000-0000000000e1", int64(7), EventJournalPosted, `{"amount":100}`})
+
+		report := &WebhookRunReport{}
+		found, err := deliverNextWebhook(db, server.Client(), slog.New(slog.NewTextHandler(io.Discard, nil)), webhookMaxAttempts(), report)
+		if err != nil || !found {
+			t.Fatalf("after %d attempts: found %v, %v", tc.attempts, found, err)
+		}
+
+		updates := fake.sent(`UPDATE "webhookdelivery"`)
+		if len(updates) != 1 {
+			t.Fatalf("after %d attempts: got %d updates, want 1", tc.attempts, len(updates))
+		}
+		if !containsArg(updates[0].Args, tc.status) || !containsArg(updates[0].Args, tc.attempts+1) {
+			t.Errorf("after %d attempts: saved %v, want status %s at attempt %d", tc.attempts, updates[0].Args, tc.status, tc.attempts+1)
+		}
+		if !containsArg(updates[0].Args, "HTTP 500: unavailable") {
+			t.Errorf("after %d attempts: saved %v without the response", tc.attempts, updates[0].Args)
+		}
+		want := WebhookRunReport{Failed: 1}
+		if tc.status == WebhookStatusDead {
+			want = WebhookRunReport{Dead: 1}
+		}
+		if *report != want {
+			t.Errorf("after %d attempts: got report %+v, want %+v", tc.attempts, *report, want)
+		}
+	}
+
+	// the receiver can check each request against the shared secret
+	for i, signature := range signatures {
+		timestamp, _, _ := strings.Cut(strings.TrimPrefix(signature, "t="), ",")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || signature != signWebhook("whsec_test", unix, bodies[i]) {
+			t.Errorf("request %d carries signature %q that does not match its body", i, signature)
+		}
+	}
+	if len(signatures) != 2 {
+		t.Errorf("server got %d requests, want 2", len(signatures))
+	}
+}